@@ -2,10 +2,14 @@ module hephaestus
 
 go 1.18
 
+require (
+	github.com/kr/pretty v0.3.0
+	github.com/tetratelabs/wazero v1.3.1
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/go-test/deep v1.0.8 // indirect
-	github.com/kr/pretty v0.3.0 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rogpeppe/go-internal v1.8.1 // indirect
@@ -0,0 +1,485 @@
+package main
+
+import "fmt"
+
+// Opcode is an operation of the virtual machine. The operations work on the stack of values of the function.
+type Opcode byte
+
+const (
+	OP_CONST                Opcode = iota // push Constants[A]
+	OP_POP                                // pop A values
+	OP_DUP                                // push the value on the top of the stack
+	OP_LOAD_LOCAL                         // push the local A, or its global or its constant if the local is not set
+	OP_LOAD_GLOBAL                        // push the global A, or its constant if the global is not set
+	OP_STORE_LOCAL                        // store the top in the local A, or in its global if only the global is set
+	OP_STORE_GLOBAL                       // store the top in the global A
+	OP_DECLARE_LOCAL                      // store the top of type B in the local A
+	OP_DECLARE_GLOBAL                     // store the top of type B in the global A
+	OP_PRINT                              // write the string Constants[A]
+	OP_PRINT_VALUE                        // write the value on the top of the stack
+	OP_PRINT_CALL                         // write the call of Constants[A] with the B values on the top of the stack
+	OP_BINARY                             // pop two values and push the result of the binary operation A
+	OP_BIT_NOT                            // replace the int on the top by its complement
+	OP_NOT                                // replace the boolean on the top by its negation
+	OP_CHECK_BOOLEAN                      // fail if the top is not a boolean
+	OP_CHECK_INT                          // fail if the top is not an int
+	OP_JUMP                               // continue at A
+	OP_JUMP_IF_FALSE                      // pop a boolean and continue at A if it is false
+	OP_JUMP_IF_FALSE_OR_POP               // continue at A if the boolean on the top is false, pop it otherwise
+	OP_JUMP_IF_TRUE_OR_POP                // continue at A if the boolean on the top is true, pop it otherwise
+	OP_CASE                               // pop a label, if it is equal to the top then pop the top and continue at A
+	OP_CALL                               // call Functions[A] with B parameters and push the returned value
+	OP_CALL_VOID                          // call Functions[A] with B parameters
+	OP_RETURN                             // return the value on the top
+	OP_RETURN_VOID                        // return no value
+	OP_FAIL                               // fail with the message Constants[A]
+)
+
+// Instr is an instruction of the virtual machine. Steps is the number of steps of the tree-walking interpreter
+// accounted when the instruction is executed, so that both count the same steps.
+type Instr struct {
+	Op    Opcode
+	A     int32
+	B     int32
+	Steps int32
+}
+
+// Module is a program compiled to bytecode.
+type Module struct {
+	Constants []Valeur
+	Globals   []Global
+	Init      []CompiledFunction // initializers of the global variables, in order
+	Functions []CompiledFunction
+	Main      int // index of main in Functions, -1 if there is no main
+}
+
+// Global is a global variable of a module.
+type Global struct {
+	Name     string
+	Constant int // constant of the enumeration with the same name, -1 if there is none
+}
+
+// Local is a local variable of a compiled function. The variables assigned in a function are locals, but
+// they fall back to the global variable or to the constant with the same name until they are set.
+type Local struct {
+	Name     string
+	Global   int // -1 if there is no global variable with the same name
+	Constant int // -1 if there is no constant of an enumeration with the same name
+	position *Position
+}
+
+// CompiledFunction is a function compiled to bytecode. The parameters are the first locals.
+type CompiledFunction struct {
+	Name       string
+	Parameters []TypeCode // runtime types of the parameters
+	Locals     []Local
+	Code       []Instr
+	Debug      []DebugInfo // debug information of each instruction of Code
+	position   *Position
+}
+
+// DebugInfo locates an instruction in the source and tells how its errors are reported.
+type DebugInfo struct {
+	Statement *Position  // position of the instruction of the source
+	Position  *Position  // position reported by the errors of the instruction
+	Wrap      int        // number of times the errors of the instruction are wrapped
+	Steps     []StepInfo // steps accounted by the instruction, in order
+}
+
+// StepInfo is a step accounted by an instruction, with the position reported if the step limit is exceeded.
+type StepInfo struct {
+	Position *Position
+	Wrap     int
+}
+
+type compiler struct {
+	module    *Module
+	functions map[string]int
+	constants map[Valeur]int
+	enums     map[string]int // constant of each value of the enumerations
+	globals   map[string]int
+	locals    map[string]int // nil when compiling the initializer of a global variable
+	function  *CompiledFunction
+	statement *Position
+	steps     []StepInfo // steps accounted by the next instruction
+	breaks    [][]int    // jumps to the end of the enclosing switches
+}
+
+// Compile compiles the program to bytecode. The module behaves as the program executed by the tree-walking
+// interpreter, including the output, the errors and the statistics.
+func Compile(program *Program) *Module {
+	c := &compiler{module: &Module{Main: -1}, functions: make(map[string]int), constants: make(map[Valeur]int),
+		enums: make(map[string]int), globals: make(map[string]int)}
+	for _, enum := range program.Enums {
+		for _, value := range enum.Values {
+			c.enums[value.Name] = c.constant(Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: value.Value})
+		}
+	}
+	for i := range program.Functions {
+		c.functions[program.Functions[i].Name] = i
+	}
+	if main, ok := c.functions["main"]; ok {
+		c.module.Main = main
+	}
+	for i := range program.Globals {
+		assignedVariables(program.Globals[i:i+1], c.addGlobal)
+	}
+
+	for i := range program.Globals {
+		instr := &program.Globals[i]
+		c.function = &CompiledFunction{Name: instr.Variable, position: instr.position}
+		c.locals = nil
+		c.compileInstructions(program.Globals[i : i+1])
+		c.emit(OP_RETURN_VOID, 0, 0, nil, 0)
+		c.module.Init = append(c.module.Init, *c.function)
+	}
+	for i := range program.Functions {
+		c.compileFunction(&program.Functions[i])
+	}
+	return c.module
+}
+
+// addGlobal adds the global variable if it doesn't exist.
+func (c *compiler) addGlobal(name string) {
+	if _, ok := c.globals[name]; ok {
+		return
+	}
+	constant, ok := c.enums[name]
+	if !ok {
+		constant = -1
+	}
+	c.globals[name] = len(c.module.Globals)
+	c.module.Globals = append(c.module.Globals, Global{Name: name, Constant: constant})
+}
+
+// addLocal adds the local variable if it doesn't exist.
+func (c *compiler) addLocal(name string) {
+	if _, ok := c.locals[name]; !ok {
+		c.newLocal(name, nil)
+	}
+}
+
+func (c *compiler) newLocal(name string, position *Position) {
+	global, ok := c.globals[name]
+	if !ok {
+		global = -1
+	}
+	constant, ok := c.enums[name]
+	if !ok {
+		constant = -1
+	}
+	c.locals[name] = len(c.function.Locals)
+	c.function.Locals = append(c.function.Locals, Local{Name: name, Global: global, Constant: constant,
+		position: position})
+}
+
+func (c *compiler) compileFunction(function *Function) {
+	c.function = &CompiledFunction{Name: function.Name, position: function.position}
+	c.locals = make(map[string]int)
+	for _, param := range function.Parameter {
+		c.function.Parameters = append(c.function.Parameters, runtimeType(param.Type.code))
+		c.newLocal(param.Name, param.position)
+	}
+	assignedVariables(function.Instruction, c.addLocal)
+	c.compileInstructions(function.Instruction)
+	c.emit(OP_RETURN_VOID, 0, 0, nil, 0)
+	c.module.Functions = append(c.module.Functions, *c.function)
+}
+
+// assignedVariables calls add with the variables declared or assigned by the instructions.
+func assignedVariables(instructions []Instruction, add func(name string)) {
+	var expression func(expr *Expression)
+	expression = func(expr *Expression) {
+		if expr == nil {
+			return
+		} else if name := assignedVariable(expr); name != "" {
+			add(name)
+		}
+		expression(expr.condition)
+		expression(expr.left)
+		expression(expr.right)
+		for i := range expr.parameter {
+			expression(&expr.parameter[i])
+		}
+	}
+	for i := range instructions {
+		instr := &instructions[i]
+		if instr.Code == INSTRUCTION_AFFECTATION || instr.Code == INSTRUCTION_DECLARATION {
+			add(instr.Variable)
+		}
+		expression(instr.Valeur)
+		for j := range instr.Parameter {
+			expression(&instr.Parameter[j])
+		}
+		for j := range instr.Case {
+			expression(instr.Case[j].Valeur)
+			assignedVariables(instr.Case[j].Instruction, add)
+		}
+	}
+}
+
+// constant returns the index of the value in the constant pool.
+func (c *compiler) constant(val Valeur) int {
+	if index, ok := c.constants[val]; ok {
+		return index
+	}
+	c.constants[val] = len(c.module.Constants)
+	c.module.Constants = append(c.module.Constants, val)
+	return c.constants[val]
+}
+
+func (c *compiler) stringConstant(s string) int {
+	return c.constant(Valeur{valeurtype: Type{code: TYPE_STRING}, valeurString: s})
+}
+
+// enter accounts for a step of the tree-walking interpreter, done by the next instruction emitted.
+func (c *compiler) enter(position *Position, wrap int) {
+	c.steps = append(c.steps, StepInfo{Position: position, Wrap: wrap})
+}
+
+// emit appends an instruction and returns its address. The errors of the instruction report the position
+// and are wrapped wrap times.
+func (c *compiler) emit(op Opcode, a int, b int, position *Position, wrap int) int {
+	c.function.Code = append(c.function.Code, Instr{Op: op, A: int32(a), B: int32(b), Steps: int32(len(c.steps))})
+	c.function.Debug = append(c.function.Debug, DebugInfo{Statement: c.statement, Position: position, Wrap: wrap,
+		Steps: c.steps})
+	c.steps = nil
+	return len(c.function.Code) - 1
+}
+
+// patch sets the destination of the jump to the next instruction.
+func (c *compiler) patch(jump int) {
+	c.function.Code[jump].A = int32(len(c.function.Code))
+}
+
+func (c *compiler) fail(message string, position *Position, wrap int) {
+	c.emit(OP_FAIL, c.stringConstant(message), 0, position, wrap)
+}
+
+// load emits the read of the variable: a local, a global, or a constant of an enumeration.
+func (c *compiler) load(name string, position *Position, wrap int) {
+	if slot, ok := c.locals[name]; ok {
+		c.emit(OP_LOAD_LOCAL, slot, 0, position, wrap)
+	} else if slot, ok := c.globals[name]; ok {
+		c.emit(OP_LOAD_GLOBAL, slot, 0, position, wrap)
+	} else if constant, ok := c.enums[name]; ok {
+		c.emit(OP_CONST, constant, 0, position, wrap)
+	} else {
+		c.fail(fmt.Sprintf("variable %s not declared", name), position, wrap)
+	}
+}
+
+// store emits the assignment of the value on the top of the stack to the variable.
+func (c *compiler) store(name string, position *Position, wrap int) {
+	if c.locals != nil {
+		c.emit(OP_STORE_LOCAL, c.locals[name], 0, position, wrap)
+	} else {
+		c.emit(OP_STORE_GLOBAL, c.globals[name], 0, position, wrap)
+	}
+}
+
+// printAssignment emits the trace of the value on the top of the stack assigned to the variable.
+func (c *compiler) printAssignment(name string) {
+	c.emit(OP_PRINT, c.stringConstant(name+"="), 0, nil, 0)
+	c.emit(OP_PRINT_VALUE, 0, 0, nil, 0)
+}
+
+func (c *compiler) compileInstructions(instructions []Instruction) {
+	for i := range instructions {
+		instr := &instructions[i]
+		c.statement = instr.position
+		c.enter(instr.position, 0)
+		switch instr.Code {
+		case INSTRUCTION_AFFECTATION:
+			c.compileExpression(instr.Valeur, 1)
+			c.printAssignment(instr.Variable)
+			c.store(instr.Variable, instr.position, 0)
+			c.emit(OP_POP, 1, 0, nil, 0)
+			c.emit(OP_PRINT, c.stringConstant("\n"), 0, nil, 0)
+		case INSTRUCTION_DECLARATION:
+			typeCode := runtimeType(instr.VariableType.code)
+			if instr.Valeur != nil {
+				c.compileExpression(instr.Valeur, 1)
+			} else {
+				c.emit(OP_CONST, c.constant(Valeur{valeurtype: Type{code: typeCode}}), 0, nil, 0)
+			}
+			if c.locals != nil {
+				c.emit(OP_DECLARE_LOCAL, c.locals[instr.Variable], int(typeCode), instr.position, 0)
+			} else {
+				c.emit(OP_DECLARE_GLOBAL, c.globals[instr.Variable], int(typeCode), instr.position, 0)
+			}
+			c.printAssignment(instr.Variable)
+			c.emit(OP_POP, 1, 0, nil, 0)
+			c.emit(OP_PRINT, c.stringConstant("\n"), 0, nil, 0)
+		case INSTRUCTION_CALL:
+			for j := range instr.Parameter {
+				c.compileExpression(&instr.Parameter[j], 1)
+			}
+			c.emit(OP_PRINT_CALL, c.stringConstant(instr.FunctionName), len(instr.Parameter), nil, 0)
+			c.emit(OP_PRINT, c.stringConstant("\n"), 0, nil, 0)
+			if index, ok := c.functions[instr.FunctionName]; ok {
+				c.emit(OP_CALL_VOID, index, len(instr.Parameter), nil, 0)
+			} else {
+				c.emit(OP_POP, len(instr.Parameter), 0, nil, 0)
+			}
+		case INSTRUCTION_EXPRESSION:
+			c.compileExpression(instr.Valeur, 1)
+			c.emit(OP_POP, 1, 0, nil, 0)
+			if name := assignedVariable(instr.Valeur); name != "" {
+				c.load(name, nil, 0)
+				c.printAssignment(name)
+				c.emit(OP_POP, 1, 0, nil, 0)
+				c.emit(OP_PRINT, c.stringConstant("\n"), 0, nil, 0)
+			}
+		case INSTRUCTION_SWITCH:
+			c.compileSwitch(instr)
+		case INSTRUCTION_BREAK:
+			c.emit(OP_PRINT, c.stringConstant("break\n"), 0, nil, 0)
+			if len(c.breaks) == 0 {
+				// as the tree-walking interpreter, a break outside of a switch ends the function
+				c.emit(OP_RETURN_VOID, 0, 0, nil, 0)
+			} else {
+				jump := c.emit(OP_JUMP, 0, 0, nil, 0)
+				c.breaks[len(c.breaks)-1] = append(c.breaks[len(c.breaks)-1], jump)
+			}
+		case INSTRUCTION_RETURN:
+			if instr.Valeur != nil {
+				c.compileExpression(instr.Valeur, 1)
+				c.emit(OP_PRINT, c.stringConstant("return "), 0, nil, 0)
+				c.emit(OP_PRINT_VALUE, 0, 0, nil, 0)
+				c.emit(OP_PRINT, c.stringConstant("\n"), 0, nil, 0)
+				c.emit(OP_RETURN, 0, 0, nil, 0)
+			} else {
+				c.emit(OP_PRINT, c.stringConstant("return\n"), 0, nil, 0)
+				c.emit(OP_RETURN_VOID, 0, 0, nil, 0)
+			}
+		default:
+			c.emit(OP_PRINT, c.stringConstant("\n"), 0, nil, 0)
+		}
+	}
+}
+
+// compileSwitch emits the evaluation of the labels of the cases in order, then the instructions of the cases
+// one after the other, so that the execution falls through the next case until a break.
+func (c *compiler) compileSwitch(instr *Instruction) {
+	c.compileExpression(instr.Valeur, 1)
+	c.emit(OP_PRINT, c.stringConstant("switch "), 0, nil, 0)
+	c.emit(OP_PRINT_VALUE, 0, 0, nil, 0)
+	c.emit(OP_PRINT, c.stringConstant("\n"), 0, nil, 0)
+	c.emit(OP_CHECK_INT, 0, 0, nil, 0)
+	jumps := make([]int, len(instr.Case))
+	defaultCase := -1
+	for i := range instr.Case {
+		jumps[i] = -1
+		if instr.Case[i].Valeur == nil {
+			defaultCase = i
+			continue
+		}
+		c.compileExpression(instr.Case[i].Valeur, 1)
+		jumps[i] = c.emit(OP_CASE, 0, 0, nil, 0)
+	}
+	c.emit(OP_POP, 1, 0, nil, 0)
+	end := []int{c.emit(OP_JUMP, 0, 0, nil, 0)}
+	if defaultCase >= 0 {
+		jumps[defaultCase] = end[0]
+		end = nil
+	}
+
+	c.breaks = append(c.breaks, end)
+	for i := range instr.Case {
+		if jumps[i] >= 0 {
+			c.patch(jumps[i])
+		}
+		c.compileInstructions(instr.Case[i].Instruction)
+		c.statement = instr.position
+	}
+	for _, jump := range c.breaks[len(c.breaks)-1] {
+		c.patch(jump)
+	}
+	c.breaks = c.breaks[:len(c.breaks)-1]
+}
+
+// compileExpression emits the evaluation of the expression, which pushes its value. The errors of the
+// expression are wrapped wrap times, as they are by the tree-walking interpreter.
+func (c *compiler) compileExpression(expr *Expression, wrap int) {
+	c.enter(expr.position, wrap)
+	switch expr.code {
+	case EXPR_CODE_INT:
+		c.emit(OP_CONST, c.constant(Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: expr.valeurInt}), 0,
+			expr.position, wrap)
+	case EXPR_CODE_STR:
+		c.emit(OP_CONST, c.stringConstant(expr.valeurString), 0, expr.position, wrap)
+	case EXPR_CODE_TRUE, EXPR_CODE_FALSE:
+		c.emit(OP_CONST, c.constant(Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: expr.code == EXPR_CODE_TRUE}),
+			0, expr.position, wrap)
+	case EXPR_CODE_VAR:
+		c.load(expr.variable, expr.position, wrap)
+	case EXPR_CODE_CALL:
+		index, ok := c.functions[expr.functionName]
+		if !ok {
+			c.fail(fmt.Sprintf("function %s not declared", expr.functionName), expr.position, wrap)
+			return
+		}
+		for i := range expr.parameter {
+			c.compileExpression(&expr.parameter[i], wrap+1)
+		}
+		c.emit(OP_CALL, index, len(expr.parameter), expr.position, wrap)
+	case EXPR_CODE_ASSIGN:
+		c.compileExpression(expr.right, wrap+1)
+		c.store(expr.variable, expr.position, wrap)
+	case EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC, EXPR_CODE_POST_DEC:
+		// the variable is read before the right operand is evaluated, as in C
+		c.load(expr.variable, expr.position, wrap+1)
+		postfix := expr.code == EXPR_CODE_POST_INC || expr.code == EXPR_CODE_POST_DEC
+		if postfix {
+			c.emit(OP_DUP, 0, 0, nil, 0)
+		}
+		operator := EXPR_CODE_ADD
+		if expr.code == EXPR_CODE_COMPOUND_ASSIGN {
+			operator = expr.operator
+			c.compileExpression(expr.right, wrap+1)
+		} else {
+			if expr.code == EXPR_CODE_PRE_DEC || expr.code == EXPR_CODE_POST_DEC {
+				operator = EXPR_CODE_SUB
+			}
+			c.emit(OP_CONST, c.constant(Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: 1}), 0, nil, 0)
+		}
+		c.emit(OP_BINARY, int(operator), 0, expr.position, wrap)
+		c.store(expr.variable, expr.position, wrap)
+		if postfix {
+			c.emit(OP_POP, 1, 0, nil, 0)
+		}
+	case EXPR_CODE_BIT_NOT:
+		c.compileExpression(expr.right, wrap+1)
+		c.emit(OP_BIT_NOT, 0, 0, expr.position, wrap)
+	case EXPR_CODE_NOT:
+		c.compileExpression(expr.right, wrap+1)
+		c.emit(OP_NOT, 0, 0, expr.right.position, wrap)
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		op := OP_JUMP_IF_FALSE_OR_POP
+		if expr.code == EXPR_CODE_OR {
+			op = OP_JUMP_IF_TRUE_OR_POP
+		}
+		c.compileExpression(expr.left, wrap+1)
+		jump := c.emit(op, 0, 0, expr.left.position, wrap)
+		c.compileExpression(expr.right, wrap+1)
+		c.emit(OP_CHECK_BOOLEAN, 0, 0, expr.right.position, wrap)
+		c.patch(jump)
+	case EXPR_CODE_CONDITIONAL:
+		c.compileExpression(expr.condition, wrap+1)
+		jump := c.emit(OP_JUMP_IF_FALSE, 0, 0, expr.condition.position, wrap)
+		c.compileExpression(expr.left, wrap)
+		end := c.emit(OP_JUMP, 0, 0, nil, 0)
+		c.patch(jump)
+		c.compileExpression(expr.right, wrap)
+		c.patch(end)
+	default:
+		if _, ok := binaryPrecedence[expr.code]; !ok {
+			c.fail("expression not valid", expr.position, wrap)
+			return
+		}
+		c.compileExpression(expr.left, wrap+1)
+		c.compileExpression(expr.right, wrap+1)
+		c.emit(OP_BINARY, int(expr.code), 0, expr.position, wrap)
+	}
+}
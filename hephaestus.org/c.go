@@ -0,0 +1,826 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cRuntime is the runtime copied at the beginning of the generated programs.
+//
+//go:embed cruntime.h
+var cRuntime string
+
+// cReserved are the names a C program cannot declare: the keywords, and the names declared by the headers
+// included by the runtime.
+var cReserved = map[string]bool{"auto": true, "break": true, "case": true, "char": true, "const": true,
+	"continue": true, "default": true, "do": true, "double": true, "else": true, "enum": true, "extern": true,
+	"float": true, "for": true, "goto": true, "if": true, "inline": true, "int": true, "long": true,
+	"register": true, "restrict": true, "return": true, "short": true, "signed": true, "sizeof": true,
+	"static": true, "struct": true, "switch": true, "typedef": true, "union": true, "unsigned": true,
+	"void": true, "volatile": true, "while": true, "alignas": true, "alignof": true, "bool": true,
+	"constexpr": true, "false": true, "nullptr": true, "static_assert": true, "thread_local": true, "true": true,
+	"typeof": true, "typeof_unqual": true, "main": true,
+	// stdio.h
+	"FILE": true, "NULL": true, "EOF": true, "BUFSIZ": true, "FILENAME_MAX": true, "FOPEN_MAX": true,
+	"L_tmpnam": true, "SEEK_CUR": true, "SEEK_END": true, "SEEK_SET": true, "TMP_MAX": true, "stdin": true,
+	"stdout": true, "stderr": true, "remove": true, "rename": true, "tmpfile": true, "tmpnam": true,
+	"fclose": true, "fflush": true, "fopen": true, "freopen": true, "setbuf": true, "setvbuf": true,
+	"fprintf": true, "fscanf": true, "printf": true, "scanf": true, "snprintf": true, "sprintf": true,
+	"sscanf": true, "vfprintf": true, "vfscanf": true, "vprintf": true, "vscanf": true, "vsnprintf": true,
+	"vsprintf": true, "vsscanf": true, "fgetc": true, "fgets": true, "fputc": true, "fputs": true, "getc": true,
+	"getchar": true, "gets": true, "putc": true, "putchar": true, "puts": true, "ungetc": true, "fread": true,
+	"fwrite": true, "fgetpos": true, "fseek": true, "fsetpos": true, "ftell": true, "rewind": true,
+	"clearerr": true, "feof": true, "ferror": true, "perror": true,
+	// stdlib.h
+	"EXIT_FAILURE": true, "EXIT_SUCCESS": true, "MB_CUR_MAX": true, "RAND_MAX": true, "atof": true, "atoi": true,
+	"atol": true, "atoll": true, "strtod": true, "strtof": true, "strtold": true, "strtol": true, "strtoll": true,
+	"strtoul": true, "strtoull": true, "rand": true, "srand": true, "calloc": true, "free": true, "malloc": true,
+	"realloc": true, "aligned_alloc": true, "abort": true, "atexit": true, "at_quick_exit": true, "exit": true,
+	"quick_exit": true, "getenv": true, "system": true, "bsearch": true, "qsort": true, "abs": true, "labs": true,
+	"llabs": true, "div": true, "ldiv": true, "lldiv": true, "mblen": true, "mbtowc": true, "wctomb": true,
+	"mbstowcs": true, "wcstombs": true,
+	// inttypes.h, stdarg.h
+	"imaxabs": true, "imaxdiv": true, "strtoimax": true, "strtoumax": true, "wcstoimax": true, "wcstoumax": true,
+	"va_list": true, "va_start": true, "va_arg": true, "va_end": true, "va_copy": true}
+
+// isCReserved returns true if the name is reserved in a C program, as the names of the types and the macros of
+// stdint.h and inttypes.h.
+func isCReserved(name string) bool {
+	return cReserved[name] || strings.HasSuffix(name, "_t") || strings.HasPrefix(name, "INT") ||
+		strings.HasPrefix(name, "UINT") || strings.HasPrefix(name, "PRI") || strings.HasPrefix(name, "SCN")
+}
+
+// The precedence of the operators of C.
+const (
+	cConditional = 3
+	cUnary       = 14
+	cAtom        = 15
+)
+
+// cPrecedence is the precedence of the binary operators of C.
+var cPrecedence = map[string]int{"||": 4, "&&": 5, "|": 6, "^": 7, "&": 8, "==": 9, "!=": 9, "<": 10, "<=": 10,
+	">": 10, ">=": 10, "*": 13, "/": 13, "%": 13}
+
+// cOperators is the operator of C of the binary operations computed without a check.
+var cOperators = map[ExprCode]string{EXPR_CODE_BIT_AND: "&", EXPR_CODE_BIT_OR: "|", EXPR_CODE_BIT_XOR: "^",
+	EXPR_CODE_EQU: "==", EXPR_CODE_NEQ: "!=", EXPR_CODE_LT: "<", EXPR_CODE_LTE: "<=", EXPR_CODE_GT: ">",
+	EXPR_CODE_GTE: ">="}
+
+// cWrapping is the function of the runtime computing the operations whose result wraps around.
+var cWrapping = map[ExprCode]string{EXPR_CODE_ADD: "rt_add", EXPR_CODE_SUB: "rt_sub", EXPR_CODE_MUL: "rt_mul"}
+
+// cExpr is an expression of the generated program.
+type cExpr struct {
+	code     string
+	typ      TypeCode
+	prec     int  // precedence of the operator of the expression
+	constant bool // a literal or a temporary variable, whose value doesn't change
+	simple   bool // a literal or a variable, evaluated without effect
+	reads    bool // reads variables of the program
+	calls    bool // calls a function of the program, which may modify the variables
+	effects  bool // calls a function, which may write or fail
+	narrow   bool // an int literal or an enumeration constant, whose type of C is int
+}
+
+// cGenerator translates a program to C. The expressions of the program whose evaluation has effects, such as
+// the assignments and the conditional operations, are translated to statements before the expression, and the
+// operands whose order of evaluation matters are stored in temporary variables, as C doesn't specify this order.
+type cGenerator struct {
+	*nativeProgram
+	source    string
+	buf       *bytes.Buffer
+	names     map[*nativeVariable]string
+	functions map[string]string
+	constants map[*EnumValue]string
+	enums     map[string]string
+	function  *Function                // nil for the initializers of the global variables
+	used      map[*nativeVariable]bool // variables read
+	stored    map[*nativeVariable]bool // variables assigned
+	temps     []TypeCode               // types of the temporary variables
+	wrapped   bool                     // the body uses _wrap
+	indent    int
+	line      int // line of the last #line directive
+	reachable bool
+	breaks    []bool // a break ends each enclosing switch
+}
+
+// TranspileC translates the checked program to a C99 program, which writes the same output and exits with the
+// same code as the interpreter. source is the name of the source file, referenced by the #line directives.
+func TranspileC(program *Program, source string) ([]byte, error) {
+	p, err := analyzeProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	g := &cGenerator{nativeProgram: p, source: source, buf: &bytes.Buffer{}, names: make(map[*nativeVariable]string),
+		functions: make(map[string]string), constants: make(map[*EnumValue]string), enums: make(map[string]string)}
+
+	taken := make(map[string]bool)
+	for _, name := range regexp.MustCompile(`\brt_\w+`).FindAllString(cRuntime, -1) {
+		taken[name] = true
+	}
+	for i := range program.Enums {
+		enum := &program.Enums[i]
+		g.enums[enum.Name] = allocateName(isCReserved, taken, enum.Name)
+		for j := range enum.Values {
+			g.constants[&enum.Values[j]] = allocateName(isCReserved, taken, enum.Values[j].Name)
+		}
+	}
+	for i := range program.Functions {
+		g.functions[program.Functions[i].Name] = allocateName(isCReserved, taken, program.Functions[i].Name)
+	}
+	for _, v := range p.globals {
+		g.names[v] = allocateName(isCReserved, taken, v.Name)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "/* Code generated by hephaestus to-c from %s. DO NOT EDIT. */\n\n%s", source, cRuntime)
+	for i := range program.Enums {
+		enum := &program.Enums[i]
+		var values []string
+		for j := range enum.Values {
+			values = append(values, fmt.Sprintf("%s = %d", g.constants[&enum.Values[j]], enum.Values[j].Value))
+		}
+		fmt.Fprintf(&out, "\ntypedef int64_t %s;\nenum { %s };\n", g.enums[enum.Name], strings.Join(values, ", "))
+	}
+	if len(p.globals) > 0 {
+		fmt.Fprintf(&out, "\n")
+	}
+	for _, v := range p.globals {
+		fmt.Fprintf(&out, "%s;\n", g.declaration(v.Type, v.Code, g.names[v]))
+		if v.Checked {
+			fmt.Fprintf(&out, "bool _set_%s;\n", g.names[v])
+		}
+	}
+	if len(program.Functions) > 0 {
+		fmt.Fprintf(&out, "\n")
+	}
+	for i := range program.Functions {
+		g.functionLocals(&program.Functions[i], taken)
+		fmt.Fprintf(&out, "%s;\n", g.prototype(&program.Functions[i]))
+	}
+	for i := range program.Functions {
+		g.functionDecl(&out, &program.Functions[i])
+	}
+	g.mainDecl(&out)
+	return out.Bytes(), nil
+}
+
+// cQuote returns the string literal of C of the text.
+func cQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '?' && i > 0 && s[i-1] == '?':
+			// avoids the trigraphs
+			b.WriteString(`\?`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\%03o`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// cType returns the type of C of a variable with the declared type (nil if it is not declared) and the type
+// of the values.
+func (g *cGenerator) cType(typeVar *Type, code TypeCode) string {
+	if typeVar != nil && typeVar.code == TYPE_ENUM {
+		return g.enums[typeVar.name]
+	}
+	switch code {
+	case TYPE_STRING:
+		return "const char *"
+	case TYPE_BOOLEAN:
+		return "bool"
+	}
+	return "int64_t"
+}
+
+// declaration returns the declaration of a variable of the type.
+func (g *cGenerator) declaration(typeVar *Type, code TypeCode, name string) string {
+	if t := g.cType(typeVar, code); strings.HasSuffix(t, "*") {
+		return t + name
+	} else {
+		return t + " " + name
+	}
+}
+
+// resultType returns the type of the result of a function which may return no value.
+func resultType(code TypeCode) string {
+	switch code {
+	case TYPE_STRING:
+		return "rt_string_result"
+	case TYPE_BOOLEAN:
+		return "rt_bool_result"
+	}
+	return "rt_int_result"
+}
+
+// functionLocals names the parameters and the local variables of the function.
+func (g *cGenerator) functionLocals(function *Function, globalNames map[string]bool) {
+	taken := make(map[string]bool)
+	for name := range globalNames {
+		taken[name] = true
+	}
+	for _, v := range g.locals[function] {
+		g.names[v] = allocateName(isCReserved, taken, v.Name)
+	}
+}
+
+func (g *cGenerator) prototype(function *Function) string {
+	params := []string{"int _wrap"}
+	for _, v := range g.locals[function][:len(function.Parameter)] {
+		params = append(params, g.declaration(v.Type, v.Code, g.names[v]))
+	}
+	result := "void"
+	if code := runtimeType(function.ReturnType.code); g.noValue[function] {
+		result = resultType(code)
+	} else if code != TYPE_VOID {
+		result = g.cType(&function.ReturnType, code)
+	}
+	if !strings.HasSuffix(result, "*") {
+		result += " "
+	}
+	return fmt.Sprintf("%s%s(%s)", result, g.functions[function.Name], strings.Join(params, ", "))
+}
+
+// start prepares the generation of the body of a function.
+func (g *cGenerator) start(function *Function) {
+	g.buf.Reset()
+	g.function, g.temps, g.wrapped, g.indent, g.line, g.reachable = function, nil, false, 1, 0, true
+	g.used, g.stored = make(map[*nativeVariable]bool), make(map[*nativeVariable]bool)
+}
+
+// declareTemps declares the temporary variables of the body.
+func (g *cGenerator) declareTemps(out *bytes.Buffer) {
+	for i, code := range g.temps {
+		fmt.Fprintf(out, "\t%s;\n", g.declaration(nil, code, fmt.Sprintf("_t%d", i+1)))
+	}
+}
+
+func (g *cGenerator) functionDecl(out *bytes.Buffer, function *Function) {
+	g.start(function)
+	g.printf("fputs(%s, stdout);", cQuote("function "+function.Name+"\n"))
+	g.instructions(function.Instruction)
+	if g.reachable && g.noValue[function] {
+		g.printf("return (%s){%s, false};", resultType(runtimeType(function.ReturnType.code)),
+			zero(runtimeType(function.ReturnType.code)))
+	}
+
+	fmt.Fprintf(out, "\n")
+	if function.position != nil {
+		fmt.Fprintf(out, "#line %d %s\n", function.position.line, cQuote(g.source))
+	}
+	fmt.Fprintf(out, "%s {\n", g.prototype(function))
+	// the variables assigned in a function may be global variables, and may be never used
+	locals := g.locals[function][len(function.Parameter):]
+	for _, v := range locals {
+		if g.used[v] || g.stored[v] {
+			fmt.Fprintf(out, "\t%s = %s;\n", g.declaration(v.Type, v.Code, g.names[v]), zero(v.Code))
+		}
+		if v.Checked {
+			fmt.Fprintf(out, "\tbool _set_%s = false;\n", g.names[v])
+		}
+	}
+	g.declareTemps(out)
+	if !g.wrapped {
+		fmt.Fprintf(out, "\t(void)_wrap;\n")
+	}
+	for _, v := range locals {
+		if g.stored[v] && !g.used[v] {
+			fmt.Fprintf(out, "\t(void)%s;\n", g.names[v])
+		}
+	}
+	out.Write(g.buf.Bytes())
+	fmt.Fprintf(out, "}\n")
+}
+
+// mainDecl declares the main function of C, which initializes the global variables and calls main.
+func (g *cGenerator) mainDecl(out *bytes.Buffer) {
+	g.start(nil)
+	g.instructions(g.program.Globals)
+	main := g.functions["main"]
+	if function, ok := g.nativeProgram.functions["main"]; !ok {
+		g.printf("rt_fail(0, %s);", cQuote("function main not found"))
+	} else if len(function.Parameter) > 0 {
+		g.printf("rt_fail(0, %s);", cQuote(fmt.Sprintf("function main expects %d parameters, found 0",
+			len(function.Parameter))))
+	} else if function.ReturnType.code == TYPE_INT && g.noValue[function] {
+		g.printf("rt_exit(%s(0).value);", main)
+	} else if function.ReturnType.code == TYPE_INT {
+		g.printf("rt_exit(%s(0));", main)
+	} else {
+		g.printf("%s(0);", main)
+		g.printf("rt_exit(0);")
+	}
+	g.printf("return 0;")
+	fmt.Fprintf(out, "\nint main(void) {\n")
+	g.declareTemps(out)
+	out.Write(g.buf.Bytes())
+	fmt.Fprintf(out, "}\n")
+}
+
+// printf writes a line of code, indented.
+func (g *cGenerator) printf(format string, args ...interface{}) {
+	g.buf.WriteString(strings.Repeat("\t", g.indent))
+	fmt.Fprintf(g.buf, format, args...)
+	g.buf.WriteByte('\n')
+}
+
+// lineDirective refers to the line of the source file of the instruction, if it is not the line of the previous
+// instruction.
+func (g *cGenerator) lineDirective(position *Position) {
+	if position != nil && position.line != g.line {
+		g.line = position.line
+		fmt.Fprintf(g.buf, "#line %d %s\n", position.line, cQuote(g.source))
+	}
+}
+
+// wrapCode returns the number of times the errors are wrapped: the errors of the callers are wrapped _wrap
+// times, and the errors of the expression wrap times more.
+func (g *cGenerator) wrapCode(wrap int) string {
+	if g.function == nil {
+		return strconv.Itoa(wrap)
+	}
+	g.wrapped = true
+	if wrap == 0 {
+		return "_wrap"
+	}
+	return fmt.Sprintf("_wrap + %d", wrap)
+}
+
+// temp declares a temporary variable holding the value of the expression.
+func (g *cGenerator) temp(expr cExpr) cExpr {
+	res := g.newTemp(expr.typ)
+	g.printf("%s = %s;", res.code, expr.code)
+	return res
+}
+
+// newTemp declares a temporary variable of the type.
+func (g *cGenerator) newTemp(code TypeCode) cExpr {
+	g.temps = append(g.temps, code)
+	return cExpr{code: fmt.Sprintf("_t%d", len(g.temps)), typ: code, prec: cAtom, constant: true, simple: true}
+}
+
+// cut removes the code generated since mark and returns it.
+func (g *cGenerator) cut(mark int) []byte {
+	code := append([]byte(nil), g.buf.Bytes()[mark:]...)
+	g.buf.Truncate(mark)
+	return code
+}
+
+// conflicts returns true if the order of the evaluation of the operands changes the result.
+func conflicts(first, second cExpr) bool {
+	return (second.calls && (first.reads || first.effects)) || (first.calls && second.reads) ||
+		(first.effects && second.effects)
+}
+
+// operands generates the operands evaluated in order. An operand is stored in a temporary variable before the
+// statements of the next operands, or before the next operands whose evaluation must follow it.
+func (g *cGenerator) operands(operands ...func() cExpr) []cExpr {
+	res := make([]cExpr, len(operands))
+	for i, operand := range operands {
+		mark := g.buf.Len()
+		res[i] = operand()
+		hoisted := g.buf.Len() > mark
+		code := g.cut(mark)
+		for j := 0; j < i; j++ {
+			if !res[j].constant && (hoisted || conflicts(res[j], res[i])) {
+				res[j] = g.temp(res[j])
+			}
+		}
+		g.buf.Write(code)
+	}
+	return res
+}
+
+// cBinary returns the binary operation of C on the operands.
+func cBinary(left cExpr, op string, right cExpr, typ TypeCode) cExpr {
+	prec := cPrecedence[op]
+	l, r := left.code, right.code
+	if left.prec < prec {
+		l = "(" + l + ")"
+	}
+	if right.prec <= prec {
+		r = "(" + r + ")"
+	}
+	return cExpr{code: l + " " + op + " " + r, typ: typ, prec: prec, reads: left.reads || right.reads,
+		calls: left.calls || right.calls, effects: left.effects || right.effects}
+}
+
+// cUnaryOp returns the unary operation of C on the operand.
+func cUnaryOp(op string, operand cExpr, typ TypeCode) cExpr {
+	code := operand.code
+	if operand.prec < cUnary {
+		code = "(" + code + ")"
+	}
+	return cExpr{code: op + code, typ: typ, prec: cUnary, reads: operand.reads, calls: operand.calls,
+		effects: operand.effects}
+}
+
+// cCall returns the call of a function of the runtime on the operands, followed by the other arguments.
+func cCall(function string, typ TypeCode, operands []cExpr, args ...string) cExpr {
+	res := cExpr{typ: typ, prec: cAtom}
+	var codes []string
+	for _, operand := range operands {
+		codes = append(codes, operand.code)
+		res.reads = res.reads || operand.reads
+		res.calls = res.calls || operand.calls
+		res.effects = res.effects || operand.effects
+	}
+	res.code = fmt.Sprintf("%s(%s)", function, strings.Join(append(codes, args...), ", "))
+	return res
+}
+
+// cLiteral returns the value of the expression if it is an int literal.
+func cLiteral(expr cExpr) (int, bool) {
+	n, err := strconv.Atoi(expr.code)
+	return n, err == nil
+}
+
+// read returns the value of the variable, as resolved by the analysis.
+func (g *cGenerator) read(access nativeAccess, name string, code TypeCode, wrap int) cExpr {
+	if v := access.variable; v != nil && access.checked {
+		g.used[v] = true
+		return cExpr{code: fmt.Sprintf("(rt_declared(_set_%s, %s, %s), %s)", g.names[v], g.wrapCode(wrap),
+			cQuote(name), g.names[v]), typ: v.Code, prec: cAtom, reads: true, effects: true}
+	} else if v != nil {
+		g.used[v] = true
+		return cExpr{code: g.names[v], typ: v.Code, prec: cAtom, simple: true, reads: true}
+	} else if access.constant != nil {
+		return cExpr{code: g.constants[access.constant], typ: TYPE_INT, prec: cAtom, constant: true, simple: true,
+			narrow: true}
+	}
+	return cExpr{code: fmt.Sprintf("(rt_fail(%s, \"variable %%s not declared\", %s), %s)", g.wrapCode(wrap),
+		cQuote(name), zero(code)), typ: code, prec: cAtom, effects: true}
+}
+
+// store assigns the value to the variable.
+func (g *cGenerator) store(v *nativeVariable, value cExpr) {
+	g.stored[v] = true
+	g.printf("%s = %s;", g.names[v], value.code)
+	if v.Checked {
+		g.printf("_set_%s = true;", g.names[v])
+	}
+}
+
+// binary returns the binary operation on the operands. The divisions and the shifts check their right operand,
+// unless it is a literal.
+func (g *cGenerator) binary(code ExprCode, left, right cExpr, wrap int, position *Position) cExpr {
+	pos := cQuote(fmt.Sprintf("%v", position))
+	switch code {
+	case EXPR_CODE_ADD, EXPR_CODE_SUB, EXPR_CODE_MUL:
+		return cCall(cWrapping[code], TYPE_INT, []cExpr{left, right})
+	case EXPR_CODE_DIV, EXPR_CODE_MOD:
+		n, ok := cLiteral(right)
+		if !ok || n == 0 {
+			if left.effects && !left.constant {
+				// the left operand fails before the check of the divisor
+				left = g.temp(left)
+			}
+			right = cCall("rt_divisor", TYPE_INT, []cExpr{right}, g.wrapCode(wrap), pos)
+		} else if n != -1 && code == EXPR_CODE_DIV {
+			return cBinary(left, "/", right, TYPE_INT)
+		} else if n != -1 {
+			return cBinary(left, "%", right, TYPE_INT)
+		}
+		if code == EXPR_CODE_DIV {
+			return cCall("rt_div", TYPE_INT, []cExpr{left, right})
+		}
+		return cCall("rt_mod", TYPE_INT, []cExpr{left, right})
+	case EXPR_CODE_SHL, EXPR_CODE_SHR:
+		if n, ok := cLiteral(right); !ok || n < 0 || n >= 64 {
+			if left.effects && !left.constant {
+				left = g.temp(left)
+			}
+			right = cCall("rt_shift", TYPE_INT, []cExpr{right}, g.wrapCode(wrap), pos)
+		}
+		function := map[ExprCode]string{EXPR_CODE_SHL: "rt_shl", EXPR_CODE_SHR: "rt_shr"}[code]
+		return cCall(function, TYPE_INT, []cExpr{left, right})
+	case EXPR_CODE_BIT_AND, EXPR_CODE_BIT_OR, EXPR_CODE_BIT_XOR:
+		return cBinary(left, cOperators[code], right, TYPE_INT)
+	}
+	return cBinary(left, cOperators[code], right, TYPE_BOOLEAN)
+}
+
+// expression generates the expression, whose errors are wrapped wrap times as they are by the interpreter.
+func (g *cGenerator) expression(expr *Expression, wrap int) cExpr {
+	switch expr.code {
+	case EXPR_CODE_INT:
+		return cExpr{code: strconv.Itoa(expr.valeurInt), typ: TYPE_INT, prec: cAtom, constant: true, simple: true,
+			narrow: true}
+	case EXPR_CODE_STR:
+		return cExpr{code: cQuote(expr.valeurString), typ: TYPE_STRING, prec: cAtom, constant: true, simple: true}
+	case EXPR_CODE_TRUE, EXPR_CODE_FALSE:
+		return cExpr{code: strconv.FormatBool(expr.code == EXPR_CODE_TRUE), typ: TYPE_BOOLEAN, prec: cAtom,
+			constant: true, simple: true}
+	case EXPR_CODE_VAR:
+		return g.read(g.reads[expr], expr.variable, g.typeOf(expr), wrap)
+	case EXPR_CODE_CALL:
+		var operands []func() cExpr
+		for i := range expr.parameter {
+			param := &expr.parameter[i]
+			operands = append(operands, func() cExpr { return g.expression(param, wrap+1) })
+		}
+		callee := g.nativeProgram.functions[expr.functionName]
+		code := runtimeType(callee.ReturnType.code)
+		args := []string{g.wrapCode(wrap)}
+		res := cExpr{typ: code, prec: cAtom, calls: true, effects: true}
+		for _, arg := range g.operands(operands...) {
+			args = append(args, arg.code)
+			res.reads = res.reads || arg.reads
+		}
+		res.code = fmt.Sprintf("%s(%s)", g.functions[expr.functionName], strings.Join(args, ", "))
+		if g.noValue[callee] {
+			function := map[TypeCode]string{TYPE_INT: "rt_int", TYPE_STRING: "rt_string",
+				TYPE_BOOLEAN: "rt_bool_value"}[code]
+			res.code = fmt.Sprintf("%s(%s, %s, %s, %s)", function, res.code, g.wrapCode(wrap), cQuote(callee.Name),
+				cQuote(fmt.Sprintf("%v", expr.position)))
+		}
+		return res
+	}
+	return g.operation(expr, wrap)
+}
+
+// operation generates the assignments and the operations.
+func (g *cGenerator) operation(expr *Expression, wrap int) cExpr {
+	switch expr.code {
+	case EXPR_CODE_ASSIGN:
+		v := g.writes[expr]
+		g.store(v, g.expression(expr.right, wrap+1))
+		return g.read(nativeAccess{variable: v}, v.Name, v.Code, wrap)
+	case EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC, EXPR_CODE_POST_DEC:
+		// the variable is read before the right operand is evaluated
+		operator := expr.operator
+		right := func() cExpr { return g.expression(expr.right, wrap+1) }
+		if expr.code != EXPR_CODE_COMPOUND_ASSIGN {
+			operator = EXPR_CODE_ADD
+			if expr.code == EXPR_CODE_PRE_DEC || expr.code == EXPR_CODE_POST_DEC {
+				operator = EXPR_CODE_SUB
+			}
+			right = func() cExpr { return cExpr{code: "1", typ: TYPE_INT, prec: cAtom, constant: true, simple: true} }
+		}
+		operands := g.operands(func() cExpr {
+			return g.read(g.reads[expr], expr.variable, TYPE_INT, wrap+1)
+		}, right)
+		postfix := expr.code == EXPR_CODE_POST_INC || expr.code == EXPR_CODE_POST_DEC
+		if postfix && !operands[0].constant {
+			operands[0] = g.temp(operands[0])
+		}
+		v := g.writes[expr]
+		g.store(v, g.binary(operator, operands[0], operands[1], wrap, expr.position))
+		if postfix {
+			return operands[0]
+		}
+		return g.read(nativeAccess{variable: v}, v.Name, v.Code, wrap)
+	case EXPR_CODE_BIT_NOT:
+		return cUnaryOp("~", g.expression(expr.right, wrap+1), TYPE_INT)
+	case EXPR_CODE_NOT:
+		return cUnaryOp("!", g.expression(expr.right, wrap+1), TYPE_BOOLEAN)
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		op := "&&"
+		if expr.code == EXPR_CODE_OR {
+			op = "||"
+		}
+		left := g.expression(expr.left, wrap+1)
+		mark := g.buf.Len()
+		g.indent++
+		right := g.expression(expr.right, wrap+1)
+		g.indent--
+		if g.buf.Len() == mark {
+			// the operators of C evaluate the right operand after the left one
+			return cBinary(left, op, right, TYPE_BOOLEAN)
+		}
+		// the statements of the right operand are executed only if the left operand doesn't decide the result
+		code := g.cut(mark)
+		res := g.temp(left)
+		if expr.code == EXPR_CODE_AND {
+			g.printf("if (%s) {", res.code)
+		} else {
+			g.printf("if (!%s) {", res.code)
+		}
+		g.buf.Write(code)
+		g.indent++
+		g.printf("%s = %s;", res.code, right.code)
+		g.indent--
+		g.printf("}")
+		return res
+	case EXPR_CODE_CONDITIONAL:
+		condition := g.expression(expr.condition, wrap+1)
+		mark := g.buf.Len()
+		g.indent++
+		left := g.expression(expr.left, wrap)
+		leftCode := g.cut(mark)
+		right := g.expression(expr.right, wrap)
+		rightCode := g.cut(mark)
+		g.indent--
+		if len(leftCode) == 0 && len(rightCode) == 0 {
+			// the operator of C evaluates only one of the operands
+			res := cExpr{code: fmt.Sprintf("%s ? %s : %s", condition.code, left.code, right.code), typ: left.typ,
+				prec: cConditional, reads: condition.reads || left.reads || right.reads,
+				calls:   condition.calls || left.calls || right.calls,
+				effects: condition.effects || left.effects || right.effects}
+			if condition.prec <= cConditional {
+				res.code = "(" + condition.code + ")" + res.code[len(condition.code):]
+			}
+			return res
+		}
+		res := g.newTemp(g.typeOf(expr))
+		g.printf("if (%s) {", condition.code)
+		g.buf.Write(leftCode)
+		g.indent++
+		g.printf("%s = %s;", res.code, left.code)
+		g.indent--
+		g.printf("} else {")
+		g.buf.Write(rightCode)
+		g.indent++
+		g.printf("%s = %s;", res.code, right.code)
+		g.indent--
+		g.printf("}")
+		return res
+	}
+	operands := g.operands(func() cExpr { return g.expression(expr.left, wrap+1) },
+		func() cExpr { return g.expression(expr.right, wrap+1) })
+	return g.binary(expr.code, operands[0], operands[1], wrap, expr.position)
+}
+
+// value returns the expression, stored in a temporary variable if it is used twice and its evaluation has
+// effects or may fail.
+func (g *cGenerator) value(expr cExpr) cExpr {
+	if expr.simple {
+		return expr
+	}
+	return g.temp(expr)
+}
+
+// trace writes the trace of the execution: the texts and the values, which must be evaluated without effect.
+func (g *cGenerator) trace(parts ...interface{}) {
+	var format strings.Builder
+	var args []string
+	text := ""
+	for _, part := range parts {
+		switch part := part.(type) {
+		case string:
+			text += strings.ReplaceAll(part, "%", "%%")
+		case cExpr:
+			switch part.typ {
+			case TYPE_STRING:
+				text += "%s"
+				args = append(args, part.code)
+			case TYPE_BOOLEAN:
+				text += "%s"
+				args = append(args, "rt_bool("+part.code+")")
+			default:
+				format.WriteString(cQuote(text+"%") + " PRId64 ")
+				text = ""
+				if part.narrow {
+					args = append(args, "(int64_t)"+part.code)
+				} else {
+					args = append(args, part.code)
+				}
+			}
+		}
+	}
+	format.WriteString(cQuote(text))
+	if len(args) == 0 {
+		g.printf("fputs(%s, stdout);", format.String())
+	} else {
+		g.printf("printf(%s, %s);", format.String(), strings.Join(args, ", "))
+	}
+}
+
+func (g *cGenerator) instructions(instructions []Instruction) {
+	for i := range instructions {
+		if !g.reached[&instructions[i]] {
+			return
+		}
+		g.lineDirective(instructions[i].position)
+		g.instruction(&instructions[i])
+	}
+}
+
+func (g *cGenerator) instruction(instr *Instruction) {
+	switch instr.Code {
+	case INSTRUCTION_AFFECTATION, INSTRUCTION_DECLARATION:
+		v := g.stores[instr]
+		value := cExpr{code: zero(v.Code), typ: v.Code, prec: cAtom, constant: true, simple: true}
+		if instr.Valeur != nil {
+			value = g.expression(instr.Valeur, 1)
+		}
+		g.store(v, value)
+		g.trace(instr.Variable+"=", g.read(nativeAccess{variable: v}, v.Name, v.Code, 0), "\n")
+	case INSTRUCTION_CALL:
+		var operands []func() cExpr
+		for i := range instr.Parameter {
+			param := &instr.Parameter[i]
+			operands = append(operands, func() cExpr { return g.expression(param, 1) })
+		}
+		var args []string
+		parts := []interface{}{instr.FunctionName + "("}
+		for i, arg := range g.operands(operands...) {
+			arg = g.value(arg)
+			if i > 0 {
+				parts = append(parts, ",")
+			}
+			args = append(args, arg.code)
+			parts = append(parts, arg)
+		}
+		g.trace(append(parts, ")\n")...)
+		if name, ok := g.functions[instr.FunctionName]; ok {
+			g.printf("%s(%s);", name, strings.Join(append([]string{g.wrapCode(0)}, args...), ", "))
+		}
+	case INSTRUCTION_EXPRESSION:
+		if value := g.expression(instr.Valeur, 1); value.effects {
+			g.printf("(void)%s;", cUnaryOp("", value, value.typ).code)
+		}
+		if name := assignedVariable(instr.Valeur); name != "" {
+			access := g.traces[instr]
+			g.trace(name+"=", g.read(access, name, g.typeOf(instr.Valeur), 0), "\n")
+		}
+	case INSTRUCTION_SWITCH:
+		g.switchCases(instr)
+	case INSTRUCTION_BREAK:
+		g.trace("break\n")
+		if len(g.breaks) > 0 {
+			g.breaks[len(g.breaks)-1] = true
+			g.printf("break;")
+		} else {
+			// as the interpreter, a break outside of a switch ends the function
+			g.returnNoValue()
+		}
+		g.reachable = false
+	case INSTRUCTION_RETURN:
+		if instr.Valeur == nil {
+			g.trace("return\n")
+			g.returnNoValue()
+		} else {
+			value := g.value(g.expression(instr.Valeur, 1))
+			g.trace("return ", value, "\n")
+			if g.function.ReturnType.code == TYPE_VOID {
+				g.printf("return;")
+			} else if g.noValue[g.function] {
+				g.printf("return (%s){%s, true};", resultType(runtimeType(g.function.ReturnType.code)), value.code)
+			} else {
+				g.printf("return %s;", value.code)
+			}
+		}
+		g.reachable = false
+	}
+}
+
+// returnNoValue returns from the function without a value.
+func (g *cGenerator) returnNoValue() {
+	if code := runtimeType(g.function.ReturnType.code); code == TYPE_VOID {
+		g.printf("return;")
+	} else {
+		g.printf("return (%s){%s, false};", resultType(code), zero(code))
+	}
+}
+
+// switchCases generates a switch of C, whose cases fall through the next case until a break.
+func (g *cGenerator) switchCases(instr *Instruction) {
+	value := g.value(g.expression(instr.Valeur, 1))
+	g.trace("switch ", value, "\n")
+	g.printf("switch (%s) {", value.code)
+	hasDefault := false
+	g.breaks = append(g.breaks, false)
+	for i := range instr.Case {
+		caseSwitch := &instr.Case[i]
+		if caseSwitch.Valeur == nil {
+			hasDefault = true
+			g.printf("default:")
+		} else if caseSwitch.Valeur.code == EXPR_CODE_INT {
+			g.printf("case %d:", caseSwitch.Valeur.valeurInt)
+		} else {
+			g.printf("case %s:", g.constants[g.nativeProgram.constants[caseSwitch.Valeur.variable]])
+		}
+		g.reachable = true
+		g.indent++
+		mark := g.buf.Len()
+		g.instructions(caseSwitch.Instruction)
+		if g.buf.Len() == mark && i == len(instr.Case)-1 {
+			// a label is followed by a statement
+			g.printf("break;")
+		} else if g.buf.Len() > mark && g.reachable && i < len(instr.Case)-1 {
+			g.printf("/* fall through */")
+		}
+		g.indent--
+	}
+	g.printf("}")
+	g.reachable = g.reachable || len(instr.Case) == 0 || !hasDefault || g.breaks[len(g.breaks)-1]
+	g.breaks = g.breaks[:len(g.breaks)-1]
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Ensure the C programs generated write the same output, report the same errors and exit with the same code
+// as the interpreter.
+func TestTranspileC(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the compilation of the generated programs in short mode")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("cc not found")
+	}
+
+	testNative(t, nativeTests, func(t *testing.T, dir string, program *Program) (string, string, int) {
+		code, err := TranspileC(program, "test.he")
+		if err != nil {
+			t.Fatalf("transpile error: %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "main.c"), code, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		build := exec.Command(cc, "-std=c99", "-pedantic", "-Wall", "-Wextra", "-Werror", "-o", "prog", "main.c")
+		build.Dir = dir
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Fatalf("build error: %s\n%s\n%s", err, out, code)
+		}
+		return runExecutable(t, filepath.Join(dir, "prog"))
+	})
+}
+
+// Ensure the instructions refer to the lines of the source file.
+func TestTranspileC_line(t *testing.T) {
+	program, err := parse(strings.NewReader("int main () {\n  x = 0;\n\n  return 3 / x;\n}\n"), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := TranspileC(program, `dir\test.he`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"#line 1 \"dir\\\\test.he\"\nint64_t main_(int _wrap) {\n",
+		"#line 2 \"dir\\\\test.he\"\n\tx = 0;\n",
+		"#line 4 \"dir\\\\test.he\"\n\t_t1 = rt_div(3, rt_divisor(x, _wrap + 1, \"&{4 1 35}\"));\n",
+	} {
+		if !strings.Contains(string(code), line) {
+			t.Errorf("%q not found in:\n%s", line, code)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/* The runtime of the C programs generated by the command to-c, copied in each program. The generated programs
+   write the same output as the interpreter, and report the same errors. The integers are computed on 64 bits
+   and wrap around, as the ones of the interpreter. */
+
+#include <inttypes.h>
+#include <stdarg.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+/* rt_exit ends the program with the exit code. */
+void rt_exit(int64_t code) {
+	exit((int)(code & 0xff));
+}
+
+/* rt_fail ends the program with the error of the interpreter, wrapped wrap times. */
+void rt_fail(int wrap, const char *format, ...) {
+	va_list args;
+	fflush(stdout);
+	fputs("error : ", stderr);
+	for (; wrap > 0; wrap--) {
+		fputs("error: ", stderr);
+	}
+	va_start(args, format);
+	vfprintf(stderr, format, args);
+	va_end(args);
+	fputs("\n", stderr);
+	exit(1);
+}
+
+/* rt_bool returns the text of a boolean. */
+const char *rt_bool(bool value) {
+	return value ? "true" : "false";
+}
+
+/* rt_declared fails if the variable is not set. */
+void rt_declared(bool set, int wrap, const char *name) {
+	if (!set) {
+		rt_fail(wrap, "variable %s not declared", name);
+	}
+}
+
+int64_t rt_add(int64_t a, int64_t b) {
+	return (int64_t)((uint64_t)a + (uint64_t)b);
+}
+
+int64_t rt_sub(int64_t a, int64_t b) {
+	return (int64_t)((uint64_t)a - (uint64_t)b);
+}
+
+int64_t rt_mul(int64_t a, int64_t b) {
+	return (int64_t)((uint64_t)a * (uint64_t)b);
+}
+
+/* rt_divisor checks the divisor of a division or a modulo. */
+int64_t rt_divisor(int64_t divisor, int wrap, const char *pos) {
+	if (divisor == 0) {
+		rt_fail(wrap, "error: division by zero (pos=%s)", pos);
+	}
+	return divisor;
+}
+
+int64_t rt_div(int64_t a, int64_t b) {
+	return b == -1 ? rt_sub(0, a) : a / b;
+}
+
+int64_t rt_mod(int64_t a, int64_t b) {
+	return b == -1 ? 0 : a % b;
+}
+
+/* rt_shift checks the count of a shift is lower than the size of an integer. */
+int rt_shift(int64_t count, int wrap, const char *pos) {
+	if (count < 0 || count >= 64) {
+		rt_fail(wrap, "error: shift count %" PRId64 " out of range (pos=%s)", count, pos);
+	}
+	return (int)count;
+}
+
+int64_t rt_shl(int64_t a, int count) {
+	return (int64_t)((uint64_t)a << count);
+}
+
+int64_t rt_shr(int64_t a, int count) {
+	return a >= 0 ? a >> count : ~(~a >> count);
+}
+
+/* The results of the functions which may return no value. */
+typedef struct {
+	int64_t value;
+	bool ok;
+} rt_int_result;
+
+typedef struct {
+	const char *value;
+	bool ok;
+} rt_string_result;
+
+typedef struct {
+	bool value;
+	bool ok;
+} rt_bool_result;
+
+/* rt_returned checks the function called returns a value. */
+void rt_returned(bool ok, int wrap, const char *function, const char *pos) {
+	if (!ok) {
+		rt_fail(wrap, "function %s returns no value (pos=%s)", function, pos);
+	}
+}
+
+int64_t rt_int(rt_int_result result, int wrap, const char *function, const char *pos) {
+	rt_returned(result.ok, wrap, function, pos);
+	return result.value;
+}
+
+const char *rt_string(rt_string_result result, int wrap, const char *function, const char *pos) {
+	rt_returned(result.ok, wrap, function, pos);
+	return result.value;
+}
+
+bool rt_bool_value(rt_bool_result result, int wrap, const char *function, const char *pos) {
+	rt_returned(result.ok, wrap, function, pos);
+	return result.value;
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The identifiers of the DAP protocol used by the server: the program has a single thread, the frames of its
+// stack are numbered from 1, the innermost first, and the variables of a frame have the reference of the frame
+// plus 1, the reference 1 being the global variables.
+const (
+	DAP_THREAD_ID         = 1
+	DAP_GLOBALS_REFERENCE = 1
+)
+
+// dapRequest is a request of the client.
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+// dapArguments are the arguments of the requests handled by the server.
+type dapArguments struct {
+	Program     string    `json:"program"`
+	StopOnEntry bool      `json:"stopOnEntry"`
+	NoDebug     bool      `json:"noDebug"`
+	Source      dapSource `json:"source"`
+	Breakpoints []struct {
+		Line      int    `json:"line"`
+		Name      string `json:"name"`
+		Condition string `json:"condition"`
+	} `json:"breakpoints"`
+	FrameID            int    `json:"frameId"`
+	VariablesReference int    `json:"variablesReference"`
+	Expression         string `json:"expression"`
+}
+
+type dapBreakpoint struct {
+	ID       int    `json:"id,omitempty"`
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+type dapStackFrame struct {
+	ID     int       `json:"id"`
+	Name   string    `json:"name"`
+	Source dapSource `json:"source"`
+	Line   int       `json:"line"`
+	Column int       `json:"column"`
+}
+
+type dapScope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// dapServer is a debug adapter for the .he programs. It reads the requests of the client from r and writes its
+// responses and its events to w, while the program runs in its own goroutine under the debugger.
+type dapServer struct {
+	r        *bufio.Reader
+	w        io.Writer
+	mu       sync.Mutex // guards the writes to w, seq, stopped and terminated
+	seq      int
+	debugger *Debugger
+
+	source      dapSource
+	program     *Program
+	lines       []string // lines of the source of the program
+	noDebug     bool
+	configured  bool
+	started     bool
+	stopped     bool          // the program waits in stop for a request resuming it
+	terminated  bool          // the program is aborted, it must not stop anymore
+	resume      chan struct{} // resumes the program stopped
+	done        chan struct{} // closed when the program ends
+	lineIDs     []int         // breakpoints set by setBreakpoints
+	functionIDs []int         // breakpoints set by setFunctionBreakpoints
+	after       func()        // action of the request executed after its response is sent
+}
+
+// ServeDAP runs a debug adapter speaking the Debug Adapter Protocol on r and w, until the client disconnects. It
+// returns the exit code of the adapter: 0 if the client disconnected before the end of the input.
+func ServeDAP(r io.Reader, w io.Writer) (int, error) {
+	s := &dapServer{r: bufio.NewReader(r), w: w, resume: make(chan struct{})}
+	s.debugger = NewDebugger(s.stop)
+	defer s.terminate()
+	for {
+		content, err := readFrame(s.r)
+		if err == io.EOF {
+			return 1, nil
+		} else if err != nil {
+			return 1, err
+		}
+		var request dapRequest
+		if err := json.Unmarshal(content, &request); err != nil {
+			return 1, fmt.Errorf("invalid message: %v", err)
+		} else if request.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(&request)
+		response := dapResponse{Type: "response", RequestSeq: request.Seq, Success: err == nil,
+			Command: request.Command, Body: body}
+		if err != nil {
+			response.Message = err.Error()
+		}
+		if err := s.write(&response); err != nil {
+			return 1, err
+		}
+		if after := s.after; after != nil {
+			s.after = nil
+			after()
+		}
+		if request.Command == "disconnect" {
+			return 0, nil
+		}
+	}
+}
+
+// write numbers the message and writes it to the client.
+func (s *dapServer) write(msg interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	switch msg := msg.(type) {
+	case *dapResponse:
+		msg.Seq = s.seq
+	case *dapEvent:
+		msg.Seq = s.seq
+	}
+	return writeFrame(s.w, msg)
+}
+
+// event sends an event to the client. The errors are ignored: the next response fails the same way.
+func (s *dapServer) event(event string, body interface{}) {
+	_ = s.write(&dapEvent{Type: "event", Event: event, Body: body})
+}
+
+// handle executes the request and returns the body of its response.
+func (s *dapServer) handle(request *dapRequest) (interface{}, error) {
+	var args dapArguments
+	if len(request.Arguments) > 0 {
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	switch request.Command {
+	case "initialize":
+		s.after = func() { s.event("initialized", nil) }
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsConditionalBreakpoints":   true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		return nil, s.launch(&args)
+	case "configurationDone":
+		s.configured = true
+		s.after = s.start
+		return nil, nil
+	case "setBreakpoints":
+		return s.setBreakpoints(&args), nil
+	case "setFunctionBreakpoints":
+		return s.setFunctionBreakpoints(&args), nil
+	case "threads":
+		return map[string]interface{}{"threads": []map[string]interface{}{{"id": DAP_THREAD_ID, "name": "main"}}},
+			nil
+	case "continue", "next", "stepIn", "stepOut":
+		if !s.isStopped() {
+			return nil, fmt.Errorf("the program is not stopped")
+		}
+		switch request.Command {
+		case "continue":
+			s.debugger.Continue()
+		case "next":
+			s.debugger.StepOver()
+		case "stepIn":
+			s.debugger.StepIn()
+		case "stepOut":
+			s.debugger.StepOut()
+		}
+		s.after = s.resumeProgram
+		if request.Command == "continue" {
+			return map[string]interface{}{"allThreadsContinued": true}, nil
+		}
+		return nil, nil
+	case "pause":
+		if !s.isRunning() {
+			return nil, fmt.Errorf("the program is not running")
+		} else if !s.isStopped() {
+			s.debugger.Pause()
+		}
+		return nil, nil
+	case "stackTrace":
+		return s.stackTrace()
+	case "scopes":
+		return s.scopes(&args)
+	case "variables":
+		return s.variables(&args)
+	case "evaluate":
+		return s.evaluate(&args)
+	case "terminate":
+		s.after = s.terminate
+		return nil, nil
+	case "disconnect":
+		s.after = s.terminate
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported request %q", request.Command)
+	}
+}
+
+// launch parses the program, which starts when the configuration is done.
+func (s *dapServer) launch(args *dapArguments) error {
+	if s.program != nil {
+		return fmt.Errorf("the program is already launched")
+	} else if args.Program == "" {
+		return fmt.Errorf("no program to launch")
+	}
+	source, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+	var warnings bytes.Buffer
+	program, err := parse(bytes.NewReader(source), &warnings)
+	if warnings.Len() > 0 {
+		s.event("output", map[string]string{"category": "stderr", "output": warnings.String()})
+	}
+	if err != nil {
+		return err
+	}
+	s.source = dapSource{Name: filepath.Base(args.Program), Path: args.Program}
+	s.program, s.lines, s.noDebug = program, strings.Split(string(source), "\n"), args.NoDebug
+	s.debugger.StopOnEntry = args.StopOnEntry
+	s.after = s.start
+	return nil
+}
+
+// start runs the program in its goroutine once it is launched and configured.
+func (s *dapServer) start() {
+	if s.program == nil || !s.configured || s.started {
+		return
+	}
+	s.started = true
+	s.done = make(chan struct{})
+	stdout := &dapOutput{s: s, category: "stdout"}
+	options := Options{Stdout: stdout}
+	if !s.noDebug {
+		options.Debugger = s.debugger
+	}
+	go func() {
+		defer close(s.done)
+		exitCode := 1
+		res, err := NewInterpreterWithOptions(s.program, options).interpreter()
+		stdout.flush()
+		if errors.Is(err, ErrDebugAbort) {
+			// the client terminated the program
+		} else if err != nil {
+			s.event("output", map[string]string{"category": "stderr", "output": "error : " + err.Error() + "\n"})
+		} else {
+			exitCode = res.ExitCode
+		}
+		s.event("exited", map[string]int{"exitCode": exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// stop is called by the debugger when the program stops: it waits for a request resuming it.
+func (s *dapServer) stop(d *Debugger, stop DebugStop) {
+	body := map[string]interface{}{"reason": stop.Reason, "threadId": DAP_THREAD_ID, "allThreadsStopped": true}
+	if stop.Breakpoint != nil {
+		body["hitBreakpointIds"] = []int{stop.Breakpoint.ID}
+	}
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	s.mu.Unlock()
+	s.event("stopped", body)
+	<-s.resume
+}
+
+func (s *dapServer) resumeProgram() {
+	s.mu.Lock()
+	s.stopped = false
+	s.mu.Unlock()
+	s.resume <- struct{}{}
+}
+
+// terminate aborts the program, if it runs, and waits for its end.
+func (s *dapServer) terminate() {
+	if !s.started {
+		return
+	}
+	s.debugger.Abort()
+	s.mu.Lock()
+	s.terminated = true
+	stopped := s.stopped
+	s.mu.Unlock()
+	if stopped {
+		s.resumeProgram()
+	}
+	<-s.done
+}
+
+func (s *dapServer) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// isRunning reports whether the program started and has not ended.
+func (s *dapServer) isRunning() bool {
+	if !s.started {
+		return false
+	}
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// setBreakpoints replaces the breakpoints on the lines of the program.
+func (s *dapServer) setBreakpoints(args *dapArguments) map[string]interface{} {
+	for _, id := range s.lineIDs {
+		s.debugger.RemoveBreakpoint(id)
+	}
+	s.lineIDs = nil
+	breakpoints := []dapBreakpoint{}
+	for _, b := range args.Breakpoints {
+		breakpoint := dapBreakpoint{Line: b.Line}
+		if s.program != nil && b.Line > len(s.lines) {
+			breakpoint.Message = fmt.Sprintf("line %d out of range, the source has %d lines", b.Line, len(s.lines))
+		} else if added, err := s.debugger.AddBreakpoint(b.Line, "", b.Condition); err != nil {
+			breakpoint.Message = err.Error()
+		} else {
+			breakpoint.ID, breakpoint.Verified = added.ID, true
+			s.lineIDs = append(s.lineIDs, added.ID)
+		}
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	return map[string]interface{}{"breakpoints": breakpoints}
+}
+
+// setFunctionBreakpoints replaces the breakpoints on the functions of the program.
+func (s *dapServer) setFunctionBreakpoints(args *dapArguments) map[string]interface{} {
+	for _, id := range s.functionIDs {
+		s.debugger.RemoveBreakpoint(id)
+	}
+	s.functionIDs = nil
+	breakpoints := []dapBreakpoint{}
+	for _, b := range args.Breakpoints {
+		var breakpoint dapBreakpoint
+		if s.program != nil && !s.declared(b.Name) {
+			breakpoint.Message = fmt.Sprintf("function %s not declared", b.Name)
+		} else if added, err := s.debugger.AddBreakpoint(0, b.Name, b.Condition); err != nil {
+			breakpoint.Message = err.Error()
+		} else {
+			breakpoint.ID, breakpoint.Verified = added.ID, true
+			s.functionIDs = append(s.functionIDs, added.ID)
+		}
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	return map[string]interface{}{"breakpoints": breakpoints}
+}
+
+// declared reports whether the program declares the function.
+func (s *dapServer) declared(function string) bool {
+	for _, f := range s.program.Functions {
+		if f.Name == function {
+			return true
+		}
+	}
+	return false
+}
+
+// inspected returns an error if the program is not stopped, the only state where it can be inspected.
+func (s *dapServer) inspected() error {
+	if !s.isStopped() {
+		return fmt.Errorf("the program is not stopped")
+	}
+	return nil
+}
+
+func (s *dapServer) stackTrace() (interface{}, error) {
+	if err := s.inspected(); err != nil {
+		return nil, err
+	}
+	frames := []dapStackFrame{}
+	for i, frame := range s.debugger.Stack() {
+		frames = append(frames, dapStackFrame{ID: i + 1, Name: frame.Function, Source: s.source, Line: frame.Line,
+			Column: 1})
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *dapServer) scopes(args *dapArguments) (interface{}, error) {
+	if err := s.inspected(); err != nil {
+		return nil, err
+	} else if args.FrameID < 1 || args.FrameID > len(s.debugger.Stack()) {
+		return nil, fmt.Errorf("no frame %d", args.FrameID)
+	}
+	return map[string]interface{}{"scopes": []dapScope{
+		{Name: "Locals", VariablesReference: args.FrameID + 1},
+		{Name: "Globals", VariablesReference: DAP_GLOBALS_REFERENCE},
+	}}, nil
+}
+
+func (s *dapServer) variables(args *dapArguments) (interface{}, error) {
+	if err := s.inspected(); err != nil {
+		return nil, err
+	}
+	frame := args.VariablesReference - 2
+	if args.VariablesReference == DAP_GLOBALS_REFERENCE {
+		frame = -1
+	}
+	variables, err := s.debugger.Variables(frame)
+	if err != nil {
+		return nil, err
+	}
+	values := []dapVariable{}
+	for _, variable := range variables {
+		values = append(values, dapVariable{Name: variable.Name, Value: variable.Value, Type: variable.Type})
+	}
+	return map[string]interface{}{"variables": values}, nil
+}
+
+// evaluate evaluates the expression of the client in the frame given, the innermost one by default.
+func (s *dapServer) evaluate(args *dapArguments) (interface{}, error) {
+	if err := s.inspected(); err != nil {
+		return nil, err
+	}
+	frame := 0
+	if args.FrameID > 0 {
+		frame = args.FrameID - 1
+	}
+	val, err := s.debugger.Evaluate(args.Expression, frame)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"result": formatValue(val), "type": typeName(&val.valeurtype),
+		"variablesReference": 0}, nil
+}
+
+// dapOutput sends the output of the program to the client as output events, one for each line written.
+type dapOutput struct {
+	s        *dapServer
+	category string
+	line     []byte // end of the output, without a newline
+}
+
+func (o *dapOutput) Write(p []byte) (int, error) {
+	o.line = append(o.line, p...)
+	if i := bytes.LastIndexByte(o.line, '\n'); i >= 0 {
+		o.s.event("output", map[string]string{"category": o.category, "output": string(o.line[:i+1])})
+		o.line = o.line[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush sends the end of the output, not ended by a newline.
+func (o *dapOutput) flush() {
+	if len(o.line) > 0 {
+		o.s.event("output", map[string]string{"category": o.category, "output": string(o.line)})
+		o.line = nil
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Ensure the debug adapter answers the requests of the transcripts of testdata/dap with the messages recorded:
+// the lines "->" are sent to the adapter and each line "<-" is a message expected from it. The messages are
+// recorded again by go test -run TestServeDAP_transcript -update.
+func TestServeDAP_transcript(t *testing.T) {
+	transcripts, err := filepath.Glob(filepath.Join("testdata", "dap", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcripts) == 0 {
+		t.Fatal("no transcript found in testdata/dap")
+	}
+	for _, transcript := range transcripts {
+		t.Run(filepath.Base(transcript), func(t *testing.T) {
+			data, err := os.ReadFile(transcript)
+			if err != nil {
+				t.Fatal(err)
+			}
+			serverR, clientW := io.Pipe()
+			clientR, serverW := io.Pipe()
+			exited := make(chan int, 1)
+			go func() {
+				exitCode, err := ServeDAP(serverR, serverW)
+				if err != nil {
+					t.Errorf("adapter error: %v", err)
+				}
+				serverW.Close()
+				exited <- exitCode
+			}()
+			messages := make(chan []byte)
+			go func() {
+				defer close(messages)
+				r := bufio.NewReader(clientR)
+				for {
+					content, err := readFrame(r)
+					if err != nil {
+						return
+					}
+					messages <- content
+				}
+			}()
+
+			var recorded []string
+			for i, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+				switch {
+				case strings.HasPrefix(line, "-> "):
+					recorded = append(recorded, line)
+					msg := strings.TrimPrefix(line, "-> ")
+					if _, err := fmt.Fprintf(clientW, "Content-Length: %d\r\n\r\n%s", len(msg), msg); err != nil {
+						t.Fatal(err)
+					}
+					if *update {
+						// the messages of the adapter are those received until it is idle
+						for idle := false; !idle; {
+							select {
+							case content, ok := <-messages:
+								if ok {
+									recorded = append(recorded, "<- "+string(content))
+								}
+								idle = !ok
+							case <-time.After(200 * time.Millisecond):
+								idle = true
+							}
+						}
+					}
+				case strings.HasPrefix(line, "<- "):
+					if *update {
+						continue
+					}
+					var content []byte
+					select {
+					case content = <-messages:
+					case <-time.After(5 * time.Second):
+					}
+					if content == nil {
+						t.Fatalf("%s:%d: no message received, expected %s", transcript, i+1, line[3:])
+					}
+					var exp, got interface{}
+					if err := json.Unmarshal([]byte(line[3:]), &exp); err != nil {
+						t.Fatalf("%s:%d: %v", transcript, i+1, err)
+					} else if err := json.Unmarshal(content, &got); err != nil {
+						t.Fatal(err)
+					} else if !reflect.DeepEqual(exp, got) {
+						t.Fatalf("%s:%d: message mismatch:\n  exp=%s\n  got=%s", transcript, i+1, line[3:], content)
+					}
+				default:
+					recorded = append(recorded, line)
+				}
+			}
+			clientW.Close()
+			for content := range messages {
+				t.Errorf("unexpected message %s", content)
+			}
+			if exitCode := <-exited; exitCode != 0 {
+				t.Errorf("exit code: exp=0 got=%d", exitCode)
+			}
+			if *update {
+				if err := os.WriteFile(transcript, []byte(strings.Join(recorded, "\n")+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
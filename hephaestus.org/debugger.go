@@ -0,0 +1,619 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The reasons of the stops of the debugger.
+const (
+	STOP_ENTRY               = "entry"
+	STOP_BREAKPOINT          = "breakpoint"
+	STOP_FUNCTION_BREAKPOINT = "function breakpoint"
+	STOP_STEP                = "step"
+	STOP_PAUSE               = "pause"
+)
+
+// ErrDebugAbort is the error of an execution stopped by Debugger.Abort.
+var ErrDebugAbort = errors.New("execution aborted by the debugger")
+
+// stepMode tells where the execution stops after it resumes.
+type stepMode int
+
+const (
+	STEP_CONTINUE stepMode = iota // at the next breakpoint
+	STEP_IN                       // at the next line, in the function or in a function called
+	STEP_OVER                     // at the next line of the function or of a caller
+	STEP_OUT                      // at the next line of a caller
+)
+
+// Breakpoint stops the execution before the first instruction of a line, or at the entry of a function, if its
+// condition is true.
+type Breakpoint struct {
+	ID        int
+	Line      int    // line of the source, 0 for a breakpoint on a function
+	Function  string // function of the breakpoint, "" for a breakpoint on a line
+	Condition string // boolean expression evaluated in the function stopped, "" if the breakpoint is unconditional
+	Hits      int    // number of stops of the breakpoint
+	condition *Expression
+}
+
+func (b *Breakpoint) String() string {
+	s := "line " + strconv.Itoa(b.Line)
+	if b.Function != "" {
+		s = "function " + b.Function
+	}
+	if b.Condition != "" {
+		s += " if " + b.Condition
+	}
+	return s
+}
+
+// DebugStop describes where the execution stopped.
+type DebugStop struct {
+	Reason     string      // STOP_ENTRY, STOP_BREAKPOINT...
+	Breakpoint *Breakpoint // breakpoint reached, nil if the stop is not caused by a breakpoint
+	Function   string
+	Line       int
+}
+
+// DebugFrame is a function active in the call stack.
+type DebugFrame struct {
+	Function string
+	Line     int // line executed, or of the declaration of the function at its entry
+}
+
+// DebugVariable is a variable of a function, or a global variable, with its value.
+type DebugVariable struct {
+	Name  string
+	Type  string
+	Value string // value as a literal of the language
+}
+
+// debugFrame is a function executed by the interpreter, with its variables.
+type debugFrame struct {
+	function    *Function
+	symbolTable map[string]Valeur
+	line        int // line executed, 0 before the first instruction
+}
+
+// Debugger controls the execution of a program by the interpreter given Options.Debugger: the execution stops at
+// its breakpoints and after the steps requested, and the function Stopped is then called. The execution resumes
+// when Stopped returns, as requested by the methods Continue, StepIn, StepOver, StepOut or Abort called by
+// Stopped; it continues until the next breakpoint by default.
+//
+// While the execution is stopped, Stack, Variables and Evaluate inspect its state. Only the interpreter walking
+// the tree of the program can be debugged, not the virtual machine.
+type Debugger struct {
+	Stopped     func(d *Debugger, stop DebugStop)
+	StopOnEntry bool // stop before the first instruction of main
+
+	mu          sync.Mutex // guards the breakpoints and the requests made while the program runs
+	breakpoints []*Breakpoint
+	nextID      int
+	watches     []string
+	mode        stepMode
+	depth       int  // depth of the frame where the step started
+	line        int  // line where the step started
+	pause       bool // stop at the next instruction
+	abort       bool
+
+	interpreter *Interpreter
+	frames      []*debugFrame
+	evaluating  bool // an expression is evaluated for the user, the breakpoints are ignored
+}
+
+// NewDebugger returns a debugger calling stopped when the execution stops.
+func NewDebugger(stopped func(d *Debugger, stop DebugStop)) *Debugger {
+	return &Debugger{Stopped: stopped}
+}
+
+// AddBreakpoint adds a breakpoint on a line or on a function, with an optional condition, and returns it with
+// its ID.
+func (d *Debugger) AddBreakpoint(line int, function string, condition string) (*Breakpoint, error) {
+	if line <= 0 && function == "" {
+		return nil, fmt.Errorf("invalid breakpoint, expected a line or a function")
+	}
+	breakpoint := &Breakpoint{Line: line, Function: function, Condition: condition}
+	if condition != "" {
+		expr, err := parseExpressionSource(condition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition %q: %w", condition, err)
+		}
+		breakpoint.condition = expr
+	}
+	if function != "" {
+		breakpoint.Line = 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nextID++
+	breakpoint.ID = d.nextID
+	d.breakpoints = append(d.breakpoints, breakpoint)
+	return breakpoint, nil
+}
+
+// RemoveBreakpoint removes the breakpoint with the ID and reports whether it existed.
+func (d *Debugger) RemoveBreakpoint(id int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, breakpoint := range d.breakpoints {
+		if breakpoint.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Breakpoints returns the breakpoints, in the order of their creation.
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Breakpoint(nil), d.breakpoints...)
+}
+
+// AddWatch adds an expression evaluated by Watches.
+func (d *Debugger) AddWatch(expr string) error {
+	if _, err := parseExpressionSource(expr); err != nil {
+		return fmt.Errorf("invalid expression %q: %w", expr, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.watches = append(d.watches, expr)
+	return nil
+}
+
+// RemoveWatch removes the watch expression of index i, starting at 1, and reports whether it existed.
+func (d *Debugger) RemoveWatch(i int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if i < 1 || i > len(d.watches) {
+		return false
+	}
+	d.watches = append(d.watches[:i-1], d.watches[i:]...)
+	return true
+}
+
+// Watches returns the watch expressions with their value in the innermost frame, or the error of their
+// evaluation.
+func (d *Debugger) Watches() []DebugVariable {
+	d.mu.Lock()
+	watches := append([]string(nil), d.watches...)
+	d.mu.Unlock()
+	var values []DebugVariable
+	for _, expr := range watches {
+		variable := DebugVariable{Name: expr}
+		if val, err := d.Evaluate(expr, 0); err != nil {
+			variable.Value = "error: " + err.Error()
+		} else {
+			variable.Type, variable.Value = typeName(&val.valeurtype), formatValue(val)
+		}
+		values = append(values, variable)
+	}
+	return values
+}
+
+// Continue resumes the execution until the next breakpoint.
+func (d *Debugger) Continue() { d.resume(STEP_CONTINUE) }
+
+// StepIn resumes the execution until the next line, entering the functions called.
+func (d *Debugger) StepIn() { d.resume(STEP_IN) }
+
+// StepOver resumes the execution until the next line of the function, or of its caller if it returns.
+func (d *Debugger) StepOver() { d.resume(STEP_OVER) }
+
+// StepOut resumes the execution until the function returns to its caller.
+func (d *Debugger) StepOut() { d.resume(STEP_OUT) }
+
+// Pause stops the execution before the next instruction. It may be called while the program runs.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pause = true
+}
+
+// Abort stops the execution, which fails with ErrDebugAbort. It may be called while the program runs.
+func (d *Debugger) Abort() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.abort = true
+}
+
+func (d *Debugger) resume(mode stepMode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mode, d.depth = mode, len(d.frames)
+	d.line = 0
+	if len(d.frames) > 0 {
+		d.line = d.frames[len(d.frames)-1].line
+	}
+}
+
+// Stack returns the functions of the call stack, the innermost first.
+func (d *Debugger) Stack() []DebugFrame {
+	var stack []DebugFrame
+	for i := len(d.frames) - 1; i >= 0; i-- {
+		frame := d.frames[i]
+		line := frame.line
+		if line == 0 {
+			line = frame.function.position.line
+		}
+		stack = append(stack, DebugFrame{Function: frame.function.Name, Line: line})
+	}
+	return stack
+}
+
+// Variables returns the variables of the frame of the stack, 0 for the innermost, sorted by name. The frame -1
+// has the global variables.
+func (d *Debugger) Variables(frame int) ([]DebugVariable, error) {
+	symbolTable, err := d.symbolTable(frame)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range symbolTable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var variables []DebugVariable
+	for _, name := range names {
+		val := symbolTable[name]
+		variables = append(variables, DebugVariable{Name: name, Type: typeName(&val.valeurtype),
+			Value: formatValue(&val)})
+	}
+	return variables, nil
+}
+
+func (d *Debugger) symbolTable(frame int) (map[string]Valeur, error) {
+	if d.interpreter == nil {
+		return nil, fmt.Errorf("the program is not running")
+	} else if frame == -1 {
+		return d.interpreter.globals, nil
+	} else if frame < 0 || frame >= len(d.frames) {
+		return nil, fmt.Errorf("no frame %d", frame)
+	}
+	return d.frames[len(d.frames)-1-frame].symbolTable, nil
+}
+
+// Evaluate evaluates the expression in the frame of the stack, 0 for the innermost. The breakpoints are ignored
+// in the functions it calls.
+func (d *Debugger) Evaluate(expr string, frame int) (*Valeur, error) {
+	symbolTable, err := d.symbolTable(frame)
+	if err != nil {
+		return nil, err
+	}
+	expression, err := parseExpressionSource(expr)
+	if err != nil {
+		return nil, err
+	}
+	return d.evaluate(expression, symbolTable)
+}
+
+// evaluate evaluates the expression of the debugger, not of the program: the trace of the functions it calls is
+// discarded, and its steps and its memory are not counted in the statistics of the program.
+func (d *Debugger) evaluate(expr *Expression, symbolTable map[string]Valeur) (*Valeur, error) {
+	interpreter := d.interpreter
+	evaluating, out, steps, memory, stats := d.evaluating, interpreter.out, interpreter.steps, interpreter.memory,
+		interpreter.stats
+	d.evaluating, interpreter.out = true, &limitedWriter{w: io.Discard}
+	defer func() {
+		d.evaluating, interpreter.out, interpreter.steps, interpreter.memory, interpreter.stats = evaluating, out, steps,
+			memory, stats
+	}()
+	return interpreter.getIntValue(expr, symbolTable)
+}
+
+// enter is called by the interpreter when a function starts, after the parameters are set.
+func (d *Debugger) enter(function *Function, symbolTable map[string]Valeur) error {
+	d.frames = append(d.frames, &debugFrame{function: function, symbolTable: symbolTable})
+	if d.evaluating {
+		return nil
+	}
+	for _, breakpoint := range d.Breakpoints() {
+		if breakpoint.Function == function.Name {
+			if stop, err := d.hit(breakpoint, symbolTable); err != nil {
+				return err
+			} else if stop {
+				return d.stop(DebugStop{Reason: STOP_FUNCTION_BREAKPOINT, Breakpoint: breakpoint,
+					Function: function.Name, Line: function.position.line})
+			}
+		}
+	}
+	return nil
+}
+
+// leave is called by the interpreter when a function returns.
+func (d *Debugger) leave() {
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+// instruction is called by the interpreter before an instruction. It stops the execution at the first instruction
+// of a line with a breakpoint, or where the step requested ends.
+func (d *Debugger) instruction(instr *Instruction) error {
+	frame := d.frames[len(d.frames)-1]
+	line := instr.position.line
+	newLine := line != frame.line
+	frame.line = line
+	if d.evaluating {
+		return nil
+	}
+
+	d.mu.Lock()
+	pause, abort, mode, depth, stepLine := d.pause, d.abort, d.mode, d.depth, d.line
+	d.pause = false
+	d.mu.Unlock()
+	if abort {
+		return ErrDebugAbort
+	} else if pause {
+		return d.stop(DebugStop{Reason: STOP_PAUSE, Function: frame.function.Name, Line: line})
+	} else if !newLine {
+		return nil
+	}
+
+	if d.StopOnEntry && len(d.frames) == 1 && frame.function.Name == "main" {
+		d.StopOnEntry = false
+		return d.stop(DebugStop{Reason: STOP_ENTRY, Function: frame.function.Name, Line: line})
+	}
+	for _, breakpoint := range d.Breakpoints() {
+		if breakpoint.Line == line {
+			if stop, err := d.hit(breakpoint, frame.symbolTable); err != nil {
+				return err
+			} else if stop {
+				return d.stop(DebugStop{Reason: STOP_BREAKPOINT, Breakpoint: breakpoint,
+					Function: frame.function.Name, Line: line})
+			}
+		}
+	}
+	current := len(d.frames)
+	switch {
+	case mode == STEP_IN && (current != depth || line != stepLine),
+		mode == STEP_OVER && (current < depth || current == depth && line != stepLine),
+		mode == STEP_OUT && current < depth:
+		return d.stop(DebugStop{Reason: STOP_STEP, Function: frame.function.Name, Line: line})
+	}
+	return nil
+}
+
+// hit reports whether the breakpoint stops the execution: its condition, if any, is true.
+func (d *Debugger) hit(breakpoint *Breakpoint, symbolTable map[string]Valeur) (bool, error) {
+	if breakpoint.condition != nil {
+		val, err := d.evaluate(breakpoint.condition, symbolTable)
+		if err != nil {
+			return false, fmt.Errorf("condition of breakpoint %d: %w", breakpoint.ID, err)
+		} else if val.valeurtype.code != TYPE_BOOLEAN {
+			return false, fmt.Errorf("condition of breakpoint %d is not a boolean: %s", breakpoint.ID,
+				strings.TrimSpace(breakpoint.Condition))
+		} else if !val.valeurBoolean {
+			return false, nil
+		}
+	}
+	breakpoint.Hits++
+	return true, nil
+}
+
+// stop calls Stopped and resumes the execution as requested.
+func (d *Debugger) stop(stop DebugStop) error {
+	d.Continue()
+	if d.Stopped != nil {
+		d.Stopped(d, stop)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.abort {
+		return ErrDebugAbort
+	}
+	return nil
+}
+
+// debugConsole is the interface of the debug command: when the execution stops, it prints the line stopped and
+// the watch expressions, then reads the commands of the user until one resumes the execution.
+type debugConsole struct {
+	program *Program
+	lines   []string // lines of the source
+	in      *bufio.Scanner
+	out     io.Writer
+	frame   int  // frame of the stack selected for the inspection, 0 for the innermost
+	eof     bool // the input is exhausted, the execution continues without stopping
+}
+
+// debugHelp describes the commands of the debug command.
+const debugHelp = `Commands:
+  c, continue              resume until the next breakpoint
+  s, step                  resume until the next line, entering the functions called
+  n, next                  resume until the next line of the function
+  o, out                   resume until the function returns
+  b, break loc [if cond]   add a breakpoint on a line or a function, stopping if the condition is true
+  d, delete id             remove a breakpoint
+  bl, breakpoints          list the breakpoints
+  p, print expr            evaluate the expression in the selected frame
+  w, watch expr            print the expression at each stop
+  unwatch n                remove the watch expression n
+  l, locals                list the variables of the selected frame
+  g, globals               list the global variables
+  bt, stack                list the functions of the call stack
+  f, frame n               select the frame n of the stack, 0 is the innermost
+  list                     print the lines around the line stopped
+  q, quit                  abort the execution
+`
+
+// parseBreakpoint parses the location of a breakpoint, a line or a function, and its optional condition:
+// `12`, `fact if n == 1`.
+func parseBreakpoint(arg string) (line int, function string, condition string, err error) {
+	location := arg
+	if i := strings.Index(arg, " if "); i >= 0 {
+		location, condition = arg[:i], strings.TrimSpace(arg[i+4:])
+	}
+	location = strings.TrimSpace(location)
+	if location == "" {
+		return 0, "", "", fmt.Errorf("expected a line or a function")
+	} else if line, err := strconv.Atoi(location); err == nil {
+		return line, "", condition, nil
+	}
+	return 0, location, condition, nil
+}
+
+// addBreakpoint adds the breakpoint described by arg to the debugger.
+func (c *debugConsole) addBreakpoint(d *Debugger, arg string) (*Breakpoint, error) {
+	line, function, condition, err := parseBreakpoint(arg)
+	if err != nil {
+		return nil, err
+	} else if function != "" {
+		found := false
+		for _, f := range c.program.Functions {
+			found = found || f.Name == function
+		}
+		if !found {
+			return nil, fmt.Errorf("function %s not declared", function)
+		}
+	} else if line > len(c.lines) {
+		return nil, fmt.Errorf("line %d out of range, the source has %d lines", line, len(c.lines))
+	}
+	return d.AddBreakpoint(line, function, condition)
+}
+
+// printLine prints the line of the source with its number.
+func (c *debugConsole) printLine(line int, current bool) {
+	if line < 1 || line > len(c.lines) {
+		return
+	}
+	marker := " "
+	if current {
+		marker = ">"
+	}
+	fmt.Fprintf(c.out, "%s%4d  %s\n", marker, line, c.lines[line-1])
+}
+
+func (c *debugConsole) stopped(d *Debugger, stop DebugStop) {
+	c.frame = 0
+	switch {
+	case stop.Breakpoint != nil:
+		fmt.Fprintf(c.out, "stopped at line %d in %s (breakpoint %d: %s)\n", stop.Line, stop.Function,
+			stop.Breakpoint.ID, stop.Breakpoint)
+	default:
+		fmt.Fprintf(c.out, "stopped at line %d in %s (%s)\n", stop.Line, stop.Function, stop.Reason)
+	}
+	c.printLine(stop.Line, true)
+	for i, watch := range d.Watches() {
+		fmt.Fprintf(c.out, "watch %d: %s = %s\n", i+1, watch.Name, formatDebugValue(watch))
+	}
+
+	for !c.eof {
+		fmt.Fprint(c.out, "(debug) ")
+		if !c.in.Scan() {
+			fmt.Fprintln(c.out)
+			c.eof = true
+			break
+		}
+		command, arg := strings.TrimSpace(c.in.Text()), ""
+		if i := strings.IndexAny(command, " \t"); i > 0 {
+			command, arg = command[:i], strings.TrimSpace(command[i:])
+		}
+		if c.command(d, command, arg) {
+			return
+		}
+	}
+	d.Continue()
+}
+
+// command executes a command of the user and reports whether it resumes the execution.
+func (c *debugConsole) command(d *Debugger, command, arg string) bool {
+	switch command {
+	case "":
+	case "c", "continue":
+		d.Continue()
+		return true
+	case "s", "step":
+		d.StepIn()
+		return true
+	case "n", "next":
+		d.StepOver()
+		return true
+	case "o", "out":
+		d.StepOut()
+		return true
+	case "q", "quit":
+		d.Abort()
+		return true
+	case "b", "break":
+		if breakpoint, err := c.addBreakpoint(d, arg); err != nil {
+			fmt.Fprintf(c.out, "error : %v\n", err)
+		} else {
+			fmt.Fprintf(c.out, "breakpoint %d: %s\n", breakpoint.ID, breakpoint)
+		}
+	case "d", "delete":
+		if id, err := strconv.Atoi(arg); err != nil || !d.RemoveBreakpoint(id) {
+			fmt.Fprintf(c.out, "error : no breakpoint %s\n", arg)
+		}
+	case "bl", "breakpoints":
+		for _, breakpoint := range d.Breakpoints() {
+			fmt.Fprintf(c.out, "breakpoint %d: %s (hits=%d)\n", breakpoint.ID, breakpoint, breakpoint.Hits)
+		}
+	case "p", "print":
+		if val, err := d.Evaluate(arg, c.frame); err != nil {
+			fmt.Fprintf(c.out, "error : %v\n", err)
+		} else {
+			fmt.Fprintln(c.out, formatValeur(val, nil))
+		}
+	case "w", "watch":
+		if err := d.AddWatch(arg); err != nil {
+			fmt.Fprintf(c.out, "error : %v\n", err)
+		}
+	case "unwatch":
+		if i, err := strconv.Atoi(arg); err != nil || !d.RemoveWatch(i) {
+			fmt.Fprintf(c.out, "error : no watch expression %s\n", arg)
+		}
+	case "l", "locals", "g", "globals":
+		frame := c.frame
+		if command == "g" || command == "globals" {
+			frame = -1
+		}
+		variables, err := d.Variables(frame)
+		if err != nil {
+			fmt.Fprintf(c.out, "error : %v\n", err)
+		}
+		for _, variable := range variables {
+			fmt.Fprintf(c.out, "%s = %s\n", variable.Name, formatDebugValue(variable))
+		}
+	case "bt", "stack":
+		for i, frame := range d.Stack() {
+			marker := " "
+			if i == c.frame {
+				marker = "*"
+			}
+			fmt.Fprintf(c.out, "%s%d  %s at line %d\n", marker, i, frame.Function, frame.Line)
+		}
+	case "f", "frame":
+		if i, err := strconv.Atoi(arg); err != nil || i < 0 || i >= len(d.Stack()) {
+			fmt.Fprintf(c.out, "error : no frame %s\n", arg)
+		} else {
+			c.frame = i
+			frame := d.Stack()[i]
+			fmt.Fprintf(c.out, "frame %d: %s at line %d\n", i, frame.Function, frame.Line)
+		}
+	case "list":
+		line := d.Stack()[c.frame].Line
+		for i := line - 3; i <= line+3; i++ {
+			c.printLine(i, i == line)
+		}
+	case "h", "help":
+		fmt.Fprint(c.out, debugHelp)
+	default:
+		fmt.Fprintf(c.out, "error : unknown command %s, help lists the commands\n", command)
+	}
+	return false
+}
+
+// formatDebugValue returns the value of a variable with its type, or the error of its evaluation.
+func formatDebugValue(variable DebugVariable) string {
+	if variable.Type == "" {
+		return variable.Value
+	}
+	return "(" + variable.Type + ") " + variable.Value
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const debugSource = `int fact(int n) {
+    switch (n) {
+        case 0:
+            return 1;
+    }
+    r = n * fact(n - 1);
+    return r;
+}
+
+int main() {
+    total = 0;
+    total = fact(3);
+    return total;
+}
+`
+
+// Ensure the debugger stops at the breakpoints and after the steps requested.
+func TestDebugger_stops(t *testing.T) {
+	type breakpoint struct {
+		line      int
+		function  string
+		condition string
+	}
+	var tests = []struct {
+		entry       bool
+		breakpoints []breakpoint
+		actions     []string // how the execution resumes at each stop
+		stops       string
+		err         string
+	}{
+		{entry: true, stops: "entry main:11 [main]\n"},
+		{breakpoints: []breakpoint{{line: 7}}, stops: "breakpoint fact:7 [fact fact fact main]\n" +
+			"breakpoint fact:7 [fact fact main]\nbreakpoint fact:7 [fact main]\n"},
+		{breakpoints: []breakpoint{{function: "fact", condition: "n == 1"}},
+			stops: "function breakpoint fact:1 [fact fact fact main]\n"},
+		{breakpoints: []breakpoint{{line: 6, condition: "n < 3"}}, actions: []string{"over", "over", "over"},
+			stops: "breakpoint fact:6 [fact fact main]\nbreakpoint fact:6 [fact fact fact main]\n" +
+				"step fact:7 [fact fact fact main]\nstep fact:7 [fact fact main]\n"},
+		{entry: true, actions: []string{"over", "in", "in", "in", "out", "out"},
+			stops: "entry main:11 [main]\nstep main:12 [main]\nstep fact:2 [fact main]\nstep fact:6 [fact main]\n" +
+				"step fact:2 [fact fact main]\nstep fact:7 [fact main]\nstep main:13 [main]\n"},
+		{entry: true, breakpoints: []breakpoint{{line: 4}}, actions: []string{"c", "out"},
+			stops: "entry main:11 [main]\nbreakpoint fact:4 [fact fact fact fact main]\n" +
+				"step fact:7 [fact fact fact main]\n"},
+		{breakpoints: []breakpoint{{line: 6}}, actions: []string{"abort"},
+			stops: "breakpoint fact:6 [fact main]\n", err: ErrDebugAbort.Error()},
+		{breakpoints: []breakpoint{{line: 6, condition: "n"}}, stops: "",
+			err: "condition of breakpoint 1 is not a boolean: n"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			program, err := parse(strings.NewReader(debugSource), io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stops strings.Builder
+			actions := tt.actions
+			debugger := NewDebugger(func(d *Debugger, stop DebugStop) {
+				var functions []string
+				for _, frame := range d.Stack() {
+					functions = append(functions, frame.Function)
+				}
+				fmt.Fprintf(&stops, "%s %s:%d [%s]\n", stop.Reason, stop.Function, stop.Line,
+					strings.Join(functions, " "))
+				action := "c"
+				if len(actions) > 0 {
+					action, actions = actions[0], actions[1:]
+				}
+				switch action {
+				case "in":
+					d.StepIn()
+				case "over":
+					d.StepOver()
+				case "out":
+					d.StepOut()
+				case "abort":
+					d.Abort()
+				}
+			})
+			debugger.StopOnEntry = tt.entry
+			for _, b := range tt.breakpoints {
+				if _, err := debugger.AddBreakpoint(b.line, b.function, b.condition); err != nil {
+					t.Fatal(err)
+				}
+			}
+			res, err := NewInterpreterWithOptions(program, Options{Stdout: io.Discard, Debugger: debugger}).interpreter()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if res.ExitCode != 6 {
+				t.Errorf("exit code: exp=6 got=%d", res.ExitCode)
+			}
+			if stops.String() != tt.stops {
+				t.Errorf("stops mismatch:\n  exp=%q\n  got=%q", tt.stops, stops.String())
+			}
+		})
+	}
+}
+
+// Ensure the variables, the watch expressions and the expressions evaluated are those of the frame inspected.
+func TestDebugger_inspect(t *testing.T) {
+	program, err := parse(strings.NewReader("int g = 4;\n"+debugSource), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	debugger := NewDebugger(func(d *Debugger, stop DebugStop) {
+		for _, frame := range []int{0, 1, -1, 9} {
+			variables, err := d.Variables(frame)
+			got = append(got, fmt.Sprintf("variables %d: %v %v", frame, variables, err))
+		}
+		for _, expr := range []string{"n * g", "fact(2)", "n +", "x"} {
+			val, err := d.Evaluate(expr, 0)
+			if err != nil {
+				got = append(got, fmt.Sprintf("%s: %v", expr, err))
+			} else {
+				got = append(got, fmt.Sprintf("%s: %s", expr, formatValue(val)))
+			}
+		}
+		got = append(got, fmt.Sprintf("watches: %v", d.Watches()))
+		d.Abort()
+	})
+	if _, err := debugger.AddBreakpoint(8, "", "n == 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := debugger.AddWatch("r == n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewInterpreterWithOptions(program, Options{Stdout: io.Discard, Debugger: debugger}).
+		interpreter(); !errors.Is(err, ErrDebugAbort) {
+		t.Fatalf("expected the execution to be aborted, got %v", err)
+	}
+	exp := []string{
+		"variables 0: [{n int 1} {r int 1}] <nil>",
+		"variables 1: [{n int 2}] <nil>",
+		"variables -1: [{g int 4}] <nil>",
+		"variables 9: [] no frame 9",
+		"n * g: 4",
+		"fact(2): 2",
+		"n +: expected instruction: invalid expression: expected expression for add: found \";\", " +
+			"expected number or ident or string (pos=&{2 1 21}) (pos=&{2 1 20})",
+		"x: variable x not declared",
+		"watches: [{r == n boolean true}]",
+	}
+	if strings.Join(got, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("inspection mismatch:\n  exp=%q\n  got=%q", exp, got)
+	}
+}
+
+// Ensure the expressions evaluated by the debugger, and the functions they call, change neither the output nor
+// the statistics of the program.
+func TestDebugger_evaluateQuietly(t *testing.T) {
+	program, err := parse(strings.NewReader(debugSource), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := NewInterpreter(program).interpreter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout strings.Builder
+	debugger := NewDebugger(func(d *Debugger, stop DebugStop) {
+		if val, err := d.Evaluate("fact(4)", 0); err != nil || val.valeurInt != 24 {
+			t.Errorf("fact(4): %v %v", val, err)
+		}
+	})
+	if _, err := debugger.AddBreakpoint(7, "", "fact(n) > 1"); err != nil {
+		t.Fatal(err)
+	} else if err := debugger.AddWatch("fact(2)"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewInterpreterWithOptions(program, Options{Stdout: &stdout, Debugger: debugger}).interpreter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Stdout != exp.Stdout || stdout.String() != exp.Stdout {
+		t.Errorf("output mismatch:\n  exp=%q\n  got=%q %q", exp.Stdout, got.Stdout, stdout.String())
+	}
+	if got.Stats != exp.Stats {
+		t.Errorf("statistics mismatch:\n  exp=%+v\n  got=%+v", exp.Stats, got.Stats)
+	}
+}
+
+// Ensure the debug command reads the commands of the user when the execution stops.
+func TestCommand_debug(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "fact.he")
+	if err := os.WriteFile(filename, []byte(debugSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		args     []string
+		in       string
+		exitCode int
+		stdout   string
+		stderr   string
+	}{
+		{args: []string{"FILE"}, in: "n\n", exitCode: 6,
+			stdout: "function main\nstopped at line 11 in main (entry)\n>  11      total = 0;\ntotal=0\n" +
+				"stopped at line 12 in main (step)\n>  12      total = fact(3);\n\nfunction fact\nswitch 3\n" +
+				"function fact\nswitch 2\nfunction fact\nswitch 1\nfunction fact\nswitch 0\nreturn 1\nr=1\n" +
+				"return 1\nr=2\nreturn 2\nr=6\nreturn 6\ntotal=6\nreturn 6\n"},
+		{args: []string{"-b", "fact if n == 1", "-w", "n", "FILE"}, in: "bt\np n * 10\nd 1\nc\n", exitCode: 6,
+			stdout: "function main\ntotal=0\nfunction fact\nswitch 3\nfunction fact\nswitch 2\nfunction fact\n" +
+				"stopped at line 1 in fact (breakpoint 1: function fact if n == 1)\n>   1  int fact(int n) {\n" +
+				"watch 1: n = (int) 1\n*0  fact at line 1\n 1  fact at line 6\n 2  fact at line 6\n 3  main at line 12\n" +
+				"(int) 10\nswitch 1\nfunction fact\nswitch 0\nreturn 1\nr=1\nreturn 1\nr=2\nreturn 2\nr=6\n" +
+				"return 6\ntotal=6\nreturn 6\n"},
+		{args: []string{"-b", "7", "FILE"}, in: "l\nf 1\nl\nq\n", exitCode: 1,
+			stdout: "function main\ntotal=0\nfunction fact\nswitch 3\nfunction fact\nswitch 2\nfunction fact\n" +
+				"switch 1\nfunction fact\nswitch 0\nreturn 1\nr=1\nstopped at line 7 in fact (breakpoint 1: line 7)\n" +
+				">   7      return r;\nn = (int) 1\nr = (int) 1\nframe 1: fact at line 6\nn = (int) 2\n",
+			stderr: "error : execution aborted by the debugger\n"},
+		{args: []string{"-b", "0", "FILE"}, exitCode: 2,
+			stderr: "error : invalid breakpoint, expected a line or a function\n"},
+		{args: []string{"FILE", "FILE"}, exitCode: 2,
+			stderr: "usage: hephaestus debug [-b location]... [-w expr]... file.he\n"},
+	}
+	for i, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		var args []string
+		for _, arg := range tt.args {
+			args = append(args, strings.ReplaceAll(arg, "FILE", filename))
+		}
+		exitCode := debugCommand(args, strings.NewReader(tt.in), &stdout, &stderr)
+		if exitCode != tt.exitCode {
+			t.Errorf("%d. %v: exit code: exp=%d got=%d (stderr=%q)", i, tt.args, tt.exitCode, exitCode, stderr.String())
+		}
+		if got := strings.ReplaceAll(stdout.String(), "(debug) ", ""); got != tt.stdout {
+			t.Errorf("%d. %v: stdout mismatch:\n  exp=%q\n  got=%q", i, tt.args, tt.stdout, got)
+		}
+		if got := strings.ReplaceAll(stderr.String(), filename, "FILE"); got != tt.stderr {
+			t.Errorf("%d. %v: stderr mismatch:\n  exp=%q\n  got=%q", i, tt.args, tt.stderr, got)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unsetState tells which variables may be read before they are assigned at a point of the execution.
+type unsetState struct {
+	reachable bool
+	unset     map[string][]string // steps of a path from the start along which the variable is not assigned
+}
+
+func (s unsetState) copy() unsetState {
+	res := unsetState{reachable: s.reachable, unset: make(map[string][]string, len(s.unset))}
+	for name, path := range s.unset {
+		res.unset[name] = path
+	}
+	return res
+}
+
+// branch returns the state after the step, which chooses a branch of the execution.
+func (s unsetState) branch(format string, a ...interface{}) unsetState {
+	step := fmt.Sprintf(format, a...)
+	res := s.copy()
+	for name, path := range res.unset {
+		res.unset[name] = append(path[:len(path):len(path)], step)
+	}
+	return res
+}
+
+// merge returns the state after either s or s2: a variable is unset if it is unset after one of them.
+func (s unsetState) merge(s2 unsetState) unsetState {
+	if !s.reachable {
+		return s2.copy()
+	} else if !s2.reachable {
+		return s.copy()
+	}
+	res := s.copy()
+	for name, path := range s2.unset {
+		if _, ok := res.unset[name]; !ok {
+			res.unset[name] = path
+		}
+	}
+	return res
+}
+
+// assignmentChecker proves the variables of a function, or the global variables in their initializers, are
+// assigned before they are read along every path of the execution.
+type assignmentChecker struct {
+	*checker
+	names  map[string]bool // variables of the scope, the other names are read from the global variables
+	init   bool            // the initializers of the global variables are checked
+	state  unsetState
+	breaks [][]unsetState // states at the breaks of the enclosing switches
+	warned map[string]bool
+}
+
+// checkAssigned warns about the reads of a variable which may not be assigned yet, as the interpreter fails
+// reading them. Each variable is reported once, with a path of the execution leading to the read.
+func (c *checker) checkAssigned(instructions []Instruction, params []Parameter) {
+	a := &assignmentChecker{checker: c, names: make(map[string]bool), init: c.function == nil,
+		state: unsetState{reachable: true}.copy(), warned: make(map[string]bool)}
+	for _, param := range params {
+		a.names[param.Name] = true
+	}
+	assignedVariables(instructions, func(name string) {
+		if !a.names[name] {
+			a.names[name] = true
+			a.state.unset[name] = nil
+		}
+	})
+	a.instructions(instructions)
+}
+
+func (a *assignmentChecker) instructions(instructions []Instruction) {
+	for i := range instructions {
+		if !a.state.reachable {
+			return
+		}
+		a.instruction(&instructions[i])
+	}
+}
+
+func (a *assignmentChecker) instruction(instr *Instruction) {
+	if instr.Valeur != nil {
+		a.expression(instr.Valeur)
+	}
+	for i := range instr.Parameter {
+		a.expression(&instr.Parameter[i])
+	}
+	switch instr.Code {
+	case INSTRUCTION_AFFECTATION, INSTRUCTION_DECLARATION:
+		delete(a.state.unset, instr.Variable)
+	case INSTRUCTION_SWITCH:
+		a.switchCases(instr)
+	case INSTRUCTION_BREAK:
+		a.breaks[len(a.breaks)-1] = append(a.breaks[len(a.breaks)-1], a.state)
+		a.state = unsetState{}
+	case INSTRUCTION_RETURN:
+		a.state = unsetState{}
+	}
+}
+
+// switchCases checks the cases of a switch. Each case is reached from the switch, or from the previous case.
+func (a *assignmentChecker) switchCases(instr *Instruction) {
+	start := a.state
+	line := instr.position.line
+	hasDefault := false
+	a.breaks = append(a.breaks, nil)
+	for i := range instr.Case {
+		caseSwitch := &instr.Case[i]
+		var taken unsetState
+		if caseSwitch.Valeur == nil {
+			hasDefault = true
+			taken = start.branch("switch at line %d takes default", line)
+		} else if caseSwitch.Valeur.code == EXPR_CODE_INT {
+			taken = start.branch("switch at line %d takes case %d", line, caseSwitch.Valeur.valeurInt)
+		} else {
+			taken = start.branch("switch at line %d takes case %s", line, caseSwitch.Valeur.variable)
+		}
+		if i == 0 {
+			a.state = taken
+		} else {
+			a.state = taken.merge(a.state)
+		}
+		a.instructions(caseSwitch.Instruction)
+	}
+	end := unsetState{}
+	if len(instr.Case) > 0 {
+		end = a.state
+	}
+	if !hasDefault {
+		end = end.merge(start.branch("switch at line %d matches no case", line))
+	}
+	for _, state := range a.breaks[len(a.breaks)-1] {
+		end = end.merge(state)
+	}
+	a.breaks = a.breaks[:len(a.breaks)-1]
+	a.state = end
+}
+
+func (a *assignmentChecker) expression(expr *Expression) {
+	switch expr.code {
+	case EXPR_CODE_VAR:
+		a.read(expr.variable, expr.position)
+	case EXPR_CODE_CALL:
+		for i := range expr.parameter {
+			a.expression(&expr.parameter[i])
+		}
+	case EXPR_CODE_ASSIGN, EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC,
+		EXPR_CODE_POST_DEC:
+		if expr.code != EXPR_CODE_ASSIGN {
+			a.read(expr.variable, expr.position)
+		}
+		if expr.right != nil {
+			a.expression(expr.right)
+		}
+		delete(a.state.unset, expr.variable)
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		a.expression(expr.left)
+		operator, skip := "&&", false
+		if expr.code == EXPR_CODE_OR {
+			operator, skip = "||", true
+		}
+		line := expr.position.line
+		skipped := a.state.branch("left operand of %s at line %d is %t", operator, line, skip)
+		a.state = a.state.branch("left operand of %s at line %d is %t", operator, line, !skip)
+		a.expression(expr.right)
+		a.state = a.state.merge(skipped)
+	case EXPR_CODE_CONDITIONAL:
+		a.expression(expr.condition)
+		line := expr.position.line
+		otherwise := a.state.branch("condition at line %d is false", line)
+		a.state = a.state.branch("condition at line %d is true", line)
+		a.expression(expr.left)
+		left := a.state
+		a.state = otherwise
+		a.expression(expr.right)
+		a.state = left.merge(a.state)
+	default:
+		for _, operand := range []*Expression{expr.left, expr.right} {
+			if operand != nil {
+				a.expression(operand)
+			}
+		}
+	}
+}
+
+// read warns if the variable may not be assigned, and if no global variable or constant of an enumeration is
+// read instead. The names declared on no path are rejected by the checker before.
+func (a *assignmentChecker) read(name string, position *Position) {
+	path, unset := a.state.unset[name]
+	if a.names[name] && !unset || a.warned[name] {
+		return
+	} else if sym, ok := a.globals[name]; ok && (!a.init || sym.enumValue != nil) {
+		return
+	}
+	a.warned[name] = true
+	if len(path) == 0 {
+		a.warn(position, "variable %s may be used uninitialised", name)
+	} else {
+		a.warn(position, "variable %s may be used uninitialised, path: %s", name, strings.Join(path, " -> "))
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+)
+
+// AddTypes returns the source with the type of the variables created by an assignment: their first assignment
+// is replaced by a declaration with the type inferred by the checker. The variables which cannot be declared,
+// because their type is not known or because they are created inside an expression, are reported as warnings.
+func AddTypes(source []byte) ([]byte, []Warning, error) {
+	program, err := NewParser(bytes.NewReader(source)).Parse2()
+	if err != nil {
+		return nil, nil, err
+	}
+	c := newChecker()
+	if err := c.checkProgram(program); err != nil {
+		return nil, nil, err
+	}
+
+	var declared []*symbol
+	var warnings []Warning
+	for _, sym := range c.created {
+		if sym.creation != nil {
+			declared = append(declared, sym)
+		} else if sym.typeVar == nil {
+			warnings = append(warnings, Warning{Message: "cannot infer the type of variable " + sym.name,
+				position: sym.position})
+		} else {
+			warnings = append(warnings, Warning{Message: "variable " + sym.name +
+				" is created inside an expression, its type is not added", position: sym.position})
+		}
+	}
+	sort.Slice(declared, func(i, j int) bool { return declared[i].position.pos < declared[j].position.pos })
+
+	// the positions count the runes of the source
+	text := []rune(string(source))
+	var buf bytes.Buffer
+	start := 0
+	for _, sym := range declared {
+		pos := sym.creation.position.pos
+		buf.WriteString(string(text[start:pos]))
+		buf.WriteString(typeName(sym.typeVar) + " ")
+		start = pos
+	}
+	buf.WriteString(string(text[start:]))
+	return buf.Bytes(), warnings, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Ensure the variables created by an assignment are declared with the type of their first value, and that the
+// programs with the types added are accepted by the checker, write the same output and fail the same way.
+func TestAddTypes(t *testing.T) {
+	for _, tt := range []struct {
+		s        string
+		exp      string
+		warnings []string
+	}{
+		{s: "void main () {\n    x=15;\n    y=x+6;\n}", exp: "void main () {\n    int x=15;\n    int y=x+6;\n}"},
+		{
+			s:   `enum Color { RED }; int g = 2; void main () { x = "é"; c = RED; g = 3; switch (g) { case 3: b = g == 3; print(b, x, c); } }`,
+			exp: `enum Color { RED }; int g = 2; void main () { string x = "é"; int c = RED; g = 3; switch (g) { case 3: boolean b = g == 3; print(b, x, c); } }`,
+		},
+		{
+			s:   `int main () { y = (z = 1) + 2; return y + z; }`,
+			exp: `int main () { int y = (z = 1) + 2; return y + z; }`,
+			warnings: []string{
+				"variable z is created inside an expression, its type is not added (pos=&{1 1 21})",
+			},
+		},
+		{
+			s:   `int f(int n) { return n; } int main () { r = f(x = 3); print(b = r > 2); return r + x + (c = 4); }`,
+			exp: `int f(int n) { return n; } int main () { int r = f(x = 3); print(b = r > 2); return r + x + (c = 4); }`,
+			warnings: []string{
+				"variable x is created inside an expression, its type is not added (pos=&{1 1 49})",
+				"variable b is created inside an expression, its type is not added (pos=&{1 1 63})",
+				"variable c is created inside an expression, its type is not added (pos=&{1 1 91})",
+			},
+		},
+		{s: `void main () { switch (1) { case 2: x = 1; } print(x); }`,
+			exp: `void main () { switch (1) { case 2: int x = 1; } print(x); }`},
+		{s: `int main () { int x = 1; return x; }`, exp: `int main () { int x = 1; return x; }`},
+	} {
+		code, warnings, err := AddTypes([]byte(tt.s))
+		if err != nil {
+			t.Errorf("%q: error: %s", tt.s, err)
+			continue
+		} else if string(code) != tt.exp {
+			t.Errorf("%q: source mismatch:\n  exp=%s\n  got=%s", tt.s, tt.exp, code)
+		}
+		var got []string
+		for _, warning := range warnings {
+			got = append(got, warning.String())
+		}
+		if !reflect.DeepEqual(got, tt.warnings) {
+			t.Errorf("%q: warnings mismatch:\n  exp=%q\n  got=%q", tt.s, tt.warnings, got)
+		}
+		if exp, got := output(t, tt.s), output(t, tt.exp); got != exp {
+			t.Errorf("%q: output mismatch:\n  exp=%q\n  got=%q", tt.exp, exp, got)
+		}
+	}
+}
+
+// output returns the output of the execution of the program, followed by its error without the position.
+func output(t *testing.T, source string) string {
+	t.Helper()
+	program, err := parse(strings.NewReader(source), io.Discard)
+	if err != nil {
+		t.Fatalf("%q: parse error: %s", source, err)
+	}
+	res, err := NewInterpreter(program).interpreter()
+	return res.Stdout + positionPattern.ReplaceAllString(errstring(err), "")
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FORMAT_INDENT is the indentation of a block in the formatted source.
+const FORMAT_INDENT = "    "
+
+// operatorSymbols are the symbols of the binary operations in the source.
+var operatorSymbols = map[ExprCode]string{EXPR_CODE_ADD: "+", EXPR_CODE_SUB: "-", EXPR_CODE_MUL: "*",
+	EXPR_CODE_DIV: "/", EXPR_CODE_MOD: "%", EXPR_CODE_LT: "<", EXPR_CODE_LTE: "<=", EXPR_CODE_GT: ">",
+	EXPR_CODE_GTE: ">=", EXPR_CODE_EQU: "==", EXPR_CODE_NEQ: "!=", EXPR_CODE_BIT_AND: "&", EXPR_CODE_BIT_OR: "|",
+	EXPR_CODE_BIT_XOR: "^", EXPR_CODE_SHL: "<<", EXPR_CODE_SHR: ">>", EXPR_CODE_AND: "&&", EXPR_CODE_OR: "||"}
+
+// The precedences of the expressions which are not binary operations, around the ones of binaryPrecedence.
+const (
+	PRECEDENCE_ASSIGN      = 0
+	PRECEDENCE_CONDITIONAL = 1
+	PRECEDENCE_BINARY      = 2 // added to the precedence of the binary operation
+	PRECEDENCE_UNARY       = 13
+	PRECEDENCE_POSTFIX     = 14
+	PRECEDENCE_PRIMARY     = 15
+)
+
+// formatter writes the canonical form of a program, line by line, with the comments of its source.
+type formatter struct {
+	lines    []string
+	comments []Comment
+	blanks   map[int]bool
+	indent   int
+	open     bool // the last line opens a block, it is not followed by a blank line
+}
+
+// Format returns the source in its canonical form: one instruction by line, the blocks indented by four spaces,
+// a space around the binary operators, and the parenthesis only where the precedence requires them. The
+// comments are kept, and a blank line of the source is kept as a single one.
+func Format(source []byte) ([]byte, error) {
+	p := NewParser(bytes.NewReader(source))
+	program, err := p.Parse2()
+	if err != nil {
+		return nil, err
+	}
+	f := &formatter{comments: p.Comments(), blanks: p.blanks}
+	f.program(program)
+	f.flush(-1)
+	if len(f.lines) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(f.lines, "\n") + "\n"), nil
+}
+
+// topLevel is a declaration of a program: an enumeration, a global variable or a function.
+type topLevel struct {
+	position *Position
+	enum     *Enum
+	global   *Instruction
+	function *Function
+}
+
+// program writes the declarations in the order of the source. The functions are separated from the other
+// declarations by a blank line.
+func (f *formatter) program(program *Program) {
+	var declarations []topLevel
+	for i := range program.Enums {
+		declarations = append(declarations, topLevel{position: program.Enums[i].position, enum: &program.Enums[i]})
+	}
+	for i := range program.Globals {
+		declarations = append(declarations, topLevel{position: program.Globals[i].position,
+			global: &program.Globals[i]})
+	}
+	for i := range program.Functions {
+		function := &program.Functions[i]
+		declarations = append(declarations, topLevel{position: function.ReturnType.position, function: function})
+	}
+	sort.Slice(declarations, func(i, j int) bool {
+		return declarations[i].position.pos < declarations[j].position.pos
+	})
+
+	for i, declaration := range declarations {
+		if i > 0 && (declaration.function != nil || declarations[i-1].function != nil) {
+			// the comments at the end of the last line stay before the blank line
+			for len(f.comments) > 0 && f.comments[0].trailing && f.comments[0].position.pos < declaration.position.pos {
+				f.flush(f.comments[0].position.pos + 1)
+			}
+			f.blank()
+		}
+		switch {
+		case declaration.enum != nil:
+			f.enum(declaration.enum)
+		case declaration.global != nil:
+			f.instruction(declaration.global)
+		default:
+			f.function(declaration.function)
+		}
+	}
+}
+
+func (f *formatter) enum(enum *Enum) {
+	var values []string
+	for _, value := range enum.Values {
+		if value.Valeur != nil {
+			values = append(values, value.Name+" = "+formatExpression(value.Valeur, PRECEDENCE_ASSIGN))
+		} else {
+			values = append(values, value.Name)
+		}
+	}
+	f.line(enum.position, "enum "+enum.Name+" { "+strings.Join(values, ", ")+" };")
+}
+
+func (f *formatter) function(function *Function) {
+	f.line(function.ReturnType.position, functionSignature(function)+" {")
+	f.block(function.Instruction, function.end)
+	f.line(function.end, "}")
+}
+
+// functionSignature returns the declaration of the function, without its body: int f(int a, boolean b).
+func functionSignature(function *Function) string {
+	var params []string
+	for _, param := range function.Parameter {
+		params = append(params, typeName(&param.Type)+" "+param.Name)
+	}
+	return typeName(&function.ReturnType) + " " + function.Name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// block writes the instructions of a block, indented, and the comments before its end.
+func (f *formatter) block(instructions []Instruction, end *Position) {
+	f.open = true
+	f.indent++
+	for i := range instructions {
+		f.instruction(&instructions[i])
+	}
+	f.flush(end.pos)
+	f.indent--
+}
+
+func (f *formatter) instruction(instr *Instruction) {
+	switch instr.Code {
+	case INSTRUCTION_AFFECTATION:
+		f.line(instr.position, instr.Variable+" = "+formatExpression(instr.Valeur, PRECEDENCE_ASSIGN)+";")
+	case INSTRUCTION_DECLARATION:
+		s := typeName(instr.VariableType) + " " + instr.Variable
+		if instr.Constant {
+			s = "const " + s
+		}
+		if instr.Valeur != nil {
+			s += " = " + formatExpression(instr.Valeur, PRECEDENCE_ASSIGN)
+		}
+		f.line(instr.position, s+";")
+	case INSTRUCTION_CALL:
+		f.line(instr.position, formatCall(instr.FunctionName, instr.Parameter)+";")
+	case INSTRUCTION_EXPRESSION:
+		f.line(instr.position, formatExpression(instr.Valeur, PRECEDENCE_ASSIGN)+";")
+	case INSTRUCTION_RETURN:
+		if instr.Valeur == nil {
+			f.line(instr.position, "return;")
+		} else {
+			f.line(instr.position, "return "+formatExpression(instr.Valeur, PRECEDENCE_ASSIGN)+";")
+		}
+	case INSTRUCTION_BREAK:
+		f.line(instr.position, "break;")
+	case INSTRUCTION_SWITCH:
+		// the cases are not indented, as their instructions are the block of the switch
+		f.line(instr.position, "switch ("+formatExpression(instr.Valeur, PRECEDENCE_ASSIGN)+") {")
+		for i := range instr.Case {
+			caseSwitch := &instr.Case[i]
+			if caseSwitch.Valeur == nil {
+				f.line(caseSwitch.position, "default:")
+			} else {
+				f.line(caseSwitch.position, "case "+formatExpression(caseSwitch.Valeur, PRECEDENCE_ASSIGN)+":")
+			}
+			end := instr.end
+			if i+1 < len(instr.Case) {
+				end = instr.Case[i+1].position
+			}
+			f.block(caseSwitch.Instruction, end)
+		}
+		f.line(instr.end, "}")
+	}
+}
+
+// line writes the line of a node of the program starting at the position, after the comments before it.
+func (f *formatter) line(position *Position, s string) {
+	f.flush(position.pos)
+	if f.blanks[position.line] {
+		f.blank()
+	}
+	f.add(s)
+	f.open = strings.HasSuffix(s, "{") || strings.HasSuffix(s, ":")
+}
+
+// flush writes the comments before the position, or all the remaining comments if pos is negative. A comment
+// following a token on the same line is written at the end of the last line.
+func (f *formatter) flush(pos int) {
+	for len(f.comments) > 0 && (pos < 0 || f.comments[0].position.pos < pos) {
+		comment := f.comments[0]
+		f.comments = f.comments[1:]
+		if comment.trailing && len(f.lines) > 0 {
+			f.lines[len(f.lines)-1] += " " + comment.Text
+			continue
+		} else if f.blanks[comment.position.line] {
+			f.blank()
+		}
+		f.add(comment.Text)
+		f.open = false
+	}
+}
+
+// blank writes a blank line, unless the line is the first one, the first one of a block, or follows a blank line.
+func (f *formatter) blank() {
+	if len(f.lines) > 0 && !f.open && f.lines[len(f.lines)-1] != "" {
+		f.lines = append(f.lines, "")
+	}
+}
+
+func (f *formatter) add(s string) {
+	f.lines = append(f.lines, strings.Repeat(FORMAT_INDENT, f.indent)+s)
+}
+
+func formatCall(name string, parameter []Expression) string {
+	var params []string
+	for i := range parameter {
+		params = append(params, formatExpression(&parameter[i], PRECEDENCE_ASSIGN))
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// expressionPrecedence returns the precedence of the expression: it is written in parenthesis where an operand
+// of a higher precedence is expected.
+func expressionPrecedence(expr *Expression) int {
+	switch expr.code {
+	case EXPR_CODE_ASSIGN, EXPR_CODE_COMPOUND_ASSIGN:
+		return PRECEDENCE_ASSIGN
+	case EXPR_CODE_CONDITIONAL:
+		return PRECEDENCE_CONDITIONAL
+	case EXPR_CODE_NOT, EXPR_CODE_BIT_NOT, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC:
+		return PRECEDENCE_UNARY
+	case EXPR_CODE_POST_INC, EXPR_CODE_POST_DEC:
+		return PRECEDENCE_POSTFIX
+	}
+	if precedence, ok := binaryPrecedence[expr.code]; ok {
+		return PRECEDENCE_BINARY + precedence
+	}
+	return PRECEDENCE_PRIMARY
+}
+
+// formatExpression returns the expression as written in the source, in parenthesis if its precedence is lower
+// than min.
+func formatExpression(expr *Expression, min int) string {
+	precedence := expressionPrecedence(expr)
+	var s string
+	switch expr.code {
+	case EXPR_CODE_INT:
+		s = strconv.Itoa(expr.valeurInt)
+	case EXPR_CODE_STR:
+		s = `"` + expr.valeurString + `"`
+	case EXPR_CODE_TRUE:
+		s = "true"
+	case EXPR_CODE_FALSE:
+		s = "false"
+	case EXPR_CODE_VAR:
+		s = expr.variable
+	case EXPR_CODE_CALL:
+		s = formatCall(expr.functionName, expr.parameter)
+	case EXPR_CODE_ASSIGN:
+		s = expr.variable + " = " + formatExpression(expr.right, PRECEDENCE_ASSIGN)
+	case EXPR_CODE_COMPOUND_ASSIGN:
+		s = expr.variable + " " + operatorSymbols[expr.operator] + "= " + formatExpression(expr.right, PRECEDENCE_ASSIGN)
+	case EXPR_CODE_PRE_INC:
+		s = "++" + expr.variable
+	case EXPR_CODE_PRE_DEC:
+		s = "--" + expr.variable
+	case EXPR_CODE_POST_INC:
+		s = expr.variable + "++"
+	case EXPR_CODE_POST_DEC:
+		s = expr.variable + "--"
+	case EXPR_CODE_NOT:
+		s = "!" + formatExpression(expr.right, PRECEDENCE_UNARY)
+	case EXPR_CODE_BIT_NOT:
+		s = "~" + formatExpression(expr.right, PRECEDENCE_UNARY)
+	case EXPR_CODE_CONDITIONAL:
+		s = formatExpression(expr.condition, PRECEDENCE_BINARY) + " ? " +
+			formatExpression(expr.left, PRECEDENCE_ASSIGN) + " : " + formatExpression(expr.right, PRECEDENCE_CONDITIONAL)
+	default:
+		// the binary operations are left associative
+		s = formatExpression(expr.left, precedence) + " " + operatorSymbols[expr.code] + " " +
+			formatExpression(expr.right, precedence+1)
+	}
+	if precedence < min {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// diffLines returns the differences between the lines of a and b in the unified format, with three lines of
+// context, or nil if they are the same.
+func diffLines(nameA, nameB string, a, b []byte) []byte {
+	linesA := strings.SplitAfter(string(a), "\n")
+	linesB := strings.SplitAfter(string(b), "\n")
+	if linesA[len(linesA)-1] == "" {
+		linesA = linesA[:len(linesA)-1]
+	}
+	if linesB[len(linesB)-1] == "" {
+		linesB = linesB[:len(linesB)-1]
+	}
+
+	// common[i][j] is the length of the longest common subsequence of linesA[i:] and linesB[j:]
+	common := make([][]int, len(linesA)+1)
+	for i := range common {
+		common[i] = make([]int, len(linesB)+1)
+	}
+	for i := len(linesA) - 1; i >= 0; i-- {
+		for j := len(linesB) - 1; j >= 0; j-- {
+			if linesA[i] == linesB[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	// the edits: ' ' for a line kept, '-' for a line of a removed, '+' for a line of b added
+	type edit struct {
+		kind byte
+		line string
+		a, b int // index of the line in a and b
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(linesA) || j < len(linesB) {
+		if i < len(linesA) && j < len(linesB) && linesA[i] == linesB[j] {
+			edits = append(edits, edit{' ', linesA[i], i, j})
+			i, j = i+1, j+1
+		} else if j == len(linesB) || i < len(linesA) && common[i+1][j] >= common[i][j+1] {
+			edits = append(edits, edit{'-', linesA[i], i, j})
+			i++
+		} else {
+			edits = append(edits, edit{'+', linesB[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	var buf bytes.Buffer
+	for start := 0; start < len(edits); {
+		if edits[start].kind == ' ' {
+			start++
+			continue
+		}
+		// a hunk groups the changes separated by less than two contexts
+		first := start - context
+		if first < 0 {
+			first = 0
+		}
+		end := start
+		for k := start; k < len(edits) && k <= end+2*context; k++ {
+			if edits[k].kind != ' ' {
+				end = k
+			}
+		}
+		last := end + context + 1
+		if last > len(edits) {
+			last = len(edits)
+		}
+		if buf.Len() == 0 {
+			buf.WriteString("--- " + nameA + "\n+++ " + nameB + "\n")
+		}
+		countA, countB := 0, 0
+		for _, e := range edits[first:last] {
+			if e.kind != '+' {
+				countA++
+			}
+			if e.kind != '-' {
+				countB++
+			}
+		}
+		buf.WriteString("@@ -" + hunkRange(edits[first].a, countA) + " +" + hunkRange(edits[first].b, countB) + " @@\n")
+		for _, e := range edits[first:last] {
+			buf.WriteByte(e.kind)
+			buf.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = last
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// hunkRange returns the range of the lines of a hunk starting at the index, as in the unified format.
+func hunkRange(index, count int) string {
+	if count == 0 {
+		return strconv.Itoa(index) + ",0"
+	}
+	return strconv.Itoa(index+1) + "," + strconv.Itoa(count)
+}
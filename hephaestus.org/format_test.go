@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Ensure the programs are written in the canonical form, with their comments and blank lines.
+func TestFormat(t *testing.T) {
+	for _, tt := range []struct {
+		s   string
+		exp string
+	}{
+		{s: `void main () {x=15;y=x+6;}`, exp: "void main() {\n    x = 15;\n    y = x + 6;\n}\n"},
+		{
+			s: `enum Color {RED,GREEN=4};int total=10; const string S="a b";int f(int n, enum Color c){return n;}`,
+			exp: `enum Color { RED, GREEN = 4 };
+int total = 10;
+const string S = "a b";
+
+int f(int n, enum Color c) {
+    return n;
+}
+`,
+		},
+		{
+			s: `int main(){x=(1+2)*3-(4-5);y=x>2?1:2; z = a = b += 3; w = (a ? b : c) ? d : e ? f : g;
+			v = a - (b - c) - d + ++e + (f++) + ~(g | h) + !(i && j) + (k << 1 >> 2) * (l >= m == true); return (y);}`,
+			exp: `int main() {
+    x = (1 + 2) * 3 - (4 - 5);
+    y = x > 2 ? 1 : 2;
+    z = a = b += 3;
+    w = (a ? b : c) ? d : e ? f : g;
+    v = a - (b - c) - d + ++e + f++ + ~(g | h) + !(i && j) + (k << 1 >> 2) * (l >= m == true);
+    return y;
+}
+`,
+		},
+		{
+			s: `// Colors
+enum Color { RED };   // trailing
+
+
+/* the entry
+   point */
+int main () { switch (x) { case 1: y += 1; // one
+break;
+case RED:
+
+   // before default
+  default: print("z", f(1, 2)); /* last */ }
+
+// end of main
+  return 0; }
+void f(int a) { } // final
+`,
+			exp: `// Colors
+enum Color { RED }; // trailing
+
+/* the entry
+   point */
+int main() {
+    switch (x) {
+    case 1:
+        y += 1; // one
+        break;
+    case RED:
+        // before default
+    default:
+        print("z", f(1, 2)); /* last */
+    }
+
+    // end of main
+    return 0;
+}
+
+void f(int a) {
+} // final
+`,
+		},
+	} {
+		code, err := Format([]byte(tt.s))
+		if err != nil {
+			t.Errorf("%q: format error: %s", tt.s, err)
+		} else if string(code) != tt.exp {
+			t.Errorf("%q: source mismatch:\n  exp=%s\n  got=%s", tt.s, tt.exp, code)
+		}
+	}
+
+	if _, err := Format([]byte("void main () { } /* end")); errstring(err) != "comment not terminated (pos=&{1 1 17})" {
+		t.Errorf("unexpected error for an unterminated comment: %v", err)
+	}
+}
+
+// Ensure the programs of testdata/format, copies of the examples, are formatted as their .golden file, which
+// go test -run TestFormat_golden -update writes again.
+func TestFormat_golden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "format", "*.he"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("no program found in testdata/format")
+	}
+	for _, source := range sources {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := Format(data)
+		if err != nil {
+			t.Fatalf("%s: format error: %s", source, err)
+		}
+		golden := strings.TrimSuffix(source, ".he") + ".golden"
+		if *update {
+			if err := os.WriteFile(golden, code, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if exp, err := os.ReadFile(golden); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(exp, code) {
+			t.Errorf("%s: source mismatch with %s:\n%s", source, golden, code)
+		}
+	}
+}
+
+var positionPattern = regexp.MustCompile(`\(pos=&\{\d+ \d+ \d+\}\)`)
+
+// Ensure the formatted programs are formatted again to the same source, and give the same results as the
+// programs.
+func TestFormat_idempotent(t *testing.T) {
+	sources := nativeTests[:len(nativeTests):len(nativeTests)]
+	files, err := filepath.Glob(filepath.Join("testdata", "*", "*.he"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, string(data))
+	}
+	for _, source := range sources {
+		code, err := Format([]byte(source))
+		if err != nil {
+			t.Fatalf("%q: format error: %s", source, err)
+		}
+		if again, err := Format(code); err != nil {
+			t.Fatalf("%s: format error: %s", code, err)
+		} else if !bytes.Equal(again, code) {
+			t.Errorf("%q: formatted again differently:\n%s\n%s", source, code, again)
+		}
+
+		var results []string
+		for _, s := range []string{source, string(code)} {
+			program, err := parse(bytes.NewReader([]byte(s)), io.Discard)
+			if err != nil {
+				t.Fatalf("%s: parse error: %s", s, err)
+			}
+			res, err := NewInterpreter(program).interpreterContext(context.Background())
+			// the positions of the errors change
+			results = append(results, fmt.Sprintf("%q %d %s", res.Stdout, res.ExitCode,
+				positionPattern.ReplaceAllString(errstring(err), "")))
+		}
+		if results[0] != results[1] {
+			t.Errorf("%q: result mismatch:\n  exp=%s\n  got=%s", source, results[0], results[1])
+		}
+	}
+}
@@ -0,0 +1,645 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// goRuntime is the runtime copied in the generated programs: the package clause and the imports, then the
+// functions whose names start with rt.
+//
+//go:embed goruntime.go
+var goRuntime string
+
+// goReserved are the names a Go program cannot declare: the keywords and the predeclared identifiers.
+var goReserved = map[string]bool{"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true, "func": true, "go": true,
+	"goto": true, "if": true, "import": true, "interface": true, "map": true, "package": true, "range": true,
+	"return": true, "select": true, "struct": true, "switch": true, "type": true, "var": true,
+	"any": true, "bool": true, "byte": true, "comparable": true, "complex64": true, "complex128": true,
+	"error": true, "float32": true, "float64": true, "int": true, "int8": true, "int16": true, "int32": true,
+	"int64": true, "rune": true, "string": true, "uint": true, "uint8": true, "uint16": true, "uint32": true,
+	"uint64": true, "uintptr": true, "true": true, "false": true, "iota": true, "nil": true, "append": true,
+	"cap": true, "clear": true, "close": true, "complex": true, "copy": true, "delete": true, "imag": true,
+	"len": true, "make": true, "max": true, "min": true, "new": true, "panic": true, "print": true,
+	"println": true, "real": true, "recover": true, "init": true, "main": true}
+
+// goPrecedence is the precedence of the binary operators of Go.
+var goPrecedence = map[string]int{"*": 5, "/": 5, "%": 5, "<<": 5, ">>": 5, "&": 5, "+": 4, "-": 4, "|": 4, "^": 4,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3, "&&": 2, "||": 1}
+
+// goOperators is the operator of Go of the binary operations computed without a check.
+var goOperators = map[ExprCode]string{EXPR_CODE_ADD: "+", EXPR_CODE_SUB: "-", EXPR_CODE_MUL: "*",
+	EXPR_CODE_BIT_AND: "&", EXPR_CODE_BIT_OR: "|", EXPR_CODE_BIT_XOR: "^", EXPR_CODE_EQU: "==", EXPR_CODE_NEQ: "!=",
+	EXPR_CODE_LT: "<", EXPR_CODE_LTE: "<=", EXPR_CODE_GT: ">", EXPR_CODE_GTE: ">="}
+
+const (
+	goUnary = 6 // precedence of the unary operations
+	goAtom  = 7 // precedence of the operands
+)
+
+// goExpr is an expression of the generated program.
+type goExpr struct {
+	code     string
+	prec     int  // precedence of the operator of the expression
+	constant bool // a literal or a temporary variable, whose value doesn't change
+	simple   bool // a literal or a variable, evaluated without effect
+	reads    bool // reads variables of the program
+	calls    bool // calls a function of the program, which may modify the variables
+	effects  bool // calls a function, which may fail
+	folded   bool // a constant expression, computed by the compiler of Go which rejects the overflows
+}
+
+// goGenerator translates a program to Go. The expressions of the program whose evaluation has effects, such
+// as the assignments and the conditional operations, are translated to statements before the expression.
+type goGenerator struct {
+	*nativeProgram
+	buf       *bytes.Buffer
+	names     map[*nativeVariable]string
+	functions map[string]string
+	constants map[*EnumValue]string
+	enums     map[string]string
+	function  *Function                // nil for the initializers of the global variables
+	used      map[*nativeVariable]bool // variables read
+	stored    map[*nativeVariable]bool // variables assigned
+	temps     int
+	reachable bool
+	breaks    []bool // a break ends each enclosing switch
+}
+
+// TranspileGo translates the checked program to a Go program, which writes the same output and exits with the
+// same code as the interpreter. source is the name of the source file, written in the header.
+func TranspileGo(program *Program, source string) ([]byte, error) {
+	p, err := analyzeProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	g := &goGenerator{nativeProgram: p, buf: &bytes.Buffer{}, names: make(map[*nativeVariable]string),
+		functions: make(map[string]string), constants: make(map[*EnumValue]string), enums: make(map[string]string)}
+
+	header, runtime, taken := splitRuntime()
+	for i := range program.Enums {
+		enum := &program.Enums[i]
+		g.enums[enum.Name] = allocateName(isGoReserved, taken, enum.Name)
+		for j := range enum.Values {
+			g.constants[&enum.Values[j]] = allocateName(isGoReserved, taken, enum.Values[j].Name)
+		}
+	}
+	for i := range program.Functions {
+		g.functions[program.Functions[i].Name] = allocateName(isGoReserved, taken, program.Functions[i].Name)
+	}
+	for _, v := range p.globals {
+		g.names[v] = allocateName(isGoReserved, taken, v.Name)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by hephaestus to-go from %s. DO NOT EDIT.\n\n%s\n", source, header)
+	for i := range program.Enums {
+		enum := &program.Enums[i]
+		fmt.Fprintf(&out, "type %s = int\n\nconst (\n", g.enums[enum.Name])
+		for j := range enum.Values {
+			fmt.Fprintf(&out, "%s %s = %d\n", g.constants[&enum.Values[j]], g.enums[enum.Name], enum.Values[j].Value)
+		}
+		fmt.Fprintf(&out, ")\n\n")
+	}
+	for _, v := range p.globals {
+		fmt.Fprintf(&out, "var %s %s\n", g.names[v], g.goType(v.Type, v.Code))
+		if v.Checked {
+			fmt.Fprintf(&out, "var _set_%s bool\n", g.names[v])
+		}
+	}
+	for i := range program.Functions {
+		g.functionDecl(&out, &program.Functions[i], taken)
+	}
+	g.mainDecl(&out)
+	fmt.Fprintf(&out, "\n%s", runtime)
+
+	res, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid Go code generated: %s", err)
+	}
+	return res, nil
+}
+
+// splitRuntime returns the package clause and the imports of the runtime, its declarations, and the names
+// declared by the runtime.
+func splitRuntime() (string, string, map[string]bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "goruntime.go", goRuntime, 0)
+	if err != nil {
+		panic(err)
+	}
+	taken := make(map[string]bool)
+	end := file.Name.End()
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				taken[decl.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.ImportSpec:
+					path, _ := strconv.Unquote(spec.Path.Value)
+					taken[path[strings.LastIndex(path, "/")+1:]] = true
+					end = decl.End()
+				case *ast.TypeSpec:
+					taken[spec.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						taken[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	start := fset.Position(file.Package).Offset
+	return goRuntime[start:fset.Position(end).Offset], goRuntime[fset.Position(end).Offset:], taken
+}
+
+// isGoReserved returns true if the name is a keyword or a predeclared identifier of Go.
+func isGoReserved(name string) bool { return goReserved[name] }
+
+// allocateName returns the name in the generated program of a name of the program: the same name, followed by
+// underscores if it is reserved or already taken.
+func allocateName(reserved func(name string) bool, taken map[string]bool, name string) string {
+	for reserved(name) || taken[name] {
+		name += "_"
+	}
+	taken[name] = true
+	return name
+}
+
+// goType returns the type of Go of a variable with the declared type (nil if it is not declared) and the type
+// of the values.
+func (g *goGenerator) goType(typeVar *Type, code TypeCode) string {
+	if typeVar != nil && typeVar.code == TYPE_ENUM {
+		return g.enums[typeVar.name]
+	}
+	switch code {
+	case TYPE_STRING:
+		return "string"
+	case TYPE_BOOLEAN:
+		return "bool"
+	}
+	return "int"
+}
+
+// zero returns the zero value of the type.
+func zero(code TypeCode) string {
+	switch code {
+	case TYPE_STRING:
+		return `""`
+	case TYPE_BOOLEAN:
+		return "false"
+	}
+	return "0"
+}
+
+func (g *goGenerator) functionDecl(out *bytes.Buffer, function *Function, packageNames map[string]bool) {
+	taken := make(map[string]bool)
+	for name := range packageNames {
+		taken[name] = true
+	}
+	locals := g.locals[function]
+	var params []string
+	for i, v := range locals {
+		g.names[v] = allocateName(isGoReserved, taken, v.Name)
+		if i < len(function.Parameter) {
+			params = append(params, g.names[v]+" "+g.goType(v.Type, v.Code))
+		}
+	}
+	result := ""
+	if code := runtimeType(function.ReturnType.code); g.noValue[function] {
+		result = fmt.Sprintf(" (%s, bool)", g.goType(&function.ReturnType, code))
+	} else if code != TYPE_VOID {
+		result = " " + g.goType(&function.ReturnType, code)
+	}
+
+	g.buf.Reset()
+	g.function, g.temps, g.reachable = function, 0, true
+	g.used, g.stored = make(map[*nativeVariable]bool), make(map[*nativeVariable]bool)
+	fmt.Fprintf(g.buf, "rtPrint(%q)\n", "function "+function.Name+"\n")
+	g.instructions(function.Instruction)
+	if g.reachable && g.noValue[function] {
+		fmt.Fprintf(g.buf, "return %s, false\n", zero(runtimeType(function.ReturnType.code)))
+	}
+
+	fmt.Fprintf(out, "\nfunc %s(%s)%s {\n", g.functions[function.Name],
+		strings.Join(append([]string{"_wrap int"}, params...), ", "), result)
+	// the variables assigned in a function may be global variables, and may be never used
+	for _, v := range locals[len(function.Parameter):] {
+		if g.used[v] || g.stored[v] {
+			fmt.Fprintf(out, "var %s %s\n", g.names[v], g.goType(v.Type, v.Code))
+		}
+		if v.Checked {
+			fmt.Fprintf(out, "var _set_%s bool\n", g.names[v])
+		}
+	}
+	for _, v := range locals[len(function.Parameter):] {
+		if g.stored[v] && !g.used[v] {
+			fmt.Fprintf(out, "_ = %s\n", g.names[v])
+		}
+	}
+	out.Write(g.buf.Bytes())
+	fmt.Fprintf(out, "}\n")
+}
+
+// mainDecl declares the main function of Go, which initializes the global variables and calls main.
+func (g *goGenerator) mainDecl(out *bytes.Buffer) {
+	g.buf.Reset()
+	g.function, g.temps, g.reachable = nil, 0, true
+	g.used, g.stored = make(map[*nativeVariable]bool), make(map[*nativeVariable]bool)
+	g.instructions(g.program.Globals)
+	main := g.functions["main"]
+	if function, ok := g.nativeProgram.functions["main"]; !ok {
+		fmt.Fprintf(g.buf, "rtFail(0, %q)\n", "function main not found")
+	} else if len(function.Parameter) > 0 {
+		fmt.Fprintf(g.buf, "rtFail(0, %q)\n", fmt.Sprintf("function main expects %d parameters, found 0",
+			len(function.Parameter)))
+	} else if function.ReturnType.code == TYPE_INT && g.noValue[function] {
+		fmt.Fprintf(g.buf, "code, _ := %s(0)\nrtExit(code)\n", main)
+	} else if function.ReturnType.code == TYPE_INT {
+		fmt.Fprintf(g.buf, "rtExit(%s(0))\n", main)
+	} else {
+		fmt.Fprintf(g.buf, "%s(0)\nrtExit(0)\n", main)
+	}
+	fmt.Fprintf(out, "\nfunc main() {\n%s}\n", g.buf.Bytes())
+}
+
+// wrapCode returns the number of times the errors are wrapped: the errors of the callers are wrapped _wrap
+// times, and the errors of the expression wrap times more.
+func (g *goGenerator) wrapCode(wrap int) string {
+	if g.function == nil {
+		return strconv.Itoa(wrap)
+	} else if wrap == 0 {
+		return "_wrap"
+	}
+	return fmt.Sprintf("_wrap+%d", wrap)
+}
+
+// temp declares a temporary variable holding the value of the expression.
+func (g *goGenerator) temp(expr goExpr) goExpr {
+	g.temps++
+	name := fmt.Sprintf("_t%d", g.temps)
+	fmt.Fprintf(g.buf, "%s := %s\n", name, expr.code)
+	return goExpr{code: name, prec: goAtom, constant: true, simple: true}
+}
+
+// cut removes the code generated since mark and returns it.
+func (g *goGenerator) cut(mark int) []byte {
+	code := append([]byte(nil), g.buf.Bytes()[mark:]...)
+	g.buf.Truncate(mark)
+	return code
+}
+
+// operands generates the operands evaluated in order. Go doesn't specify when the variables are read relative
+// to the calls of an expression, so an operand is stored in a temporary variable before the statements or the
+// calls of the next operands.
+func (g *goGenerator) operands(operands ...func() goExpr) []goExpr {
+	res := make([]goExpr, len(operands))
+	for i, operand := range operands {
+		mark := g.buf.Len()
+		res[i] = operand()
+		hoisted := g.buf.Len() > mark
+		if !hoisted && !res[i].calls {
+			continue
+		}
+		code := g.cut(mark)
+		for j := 0; j < i; j++ {
+			if !res[j].constant && (hoisted || res[j].reads) {
+				res[j] = g.temp(res[j])
+			}
+		}
+		g.buf.Write(code)
+	}
+	return res
+}
+
+// goBinary returns the binary operation of Go on the operands.
+func goBinary(left goExpr, op string, right goExpr) goExpr {
+	prec := goPrecedence[op]
+	l, r := left.code, right.code
+	if left.prec < prec {
+		l = "(" + l + ")"
+	}
+	if right.prec <= prec {
+		r = "(" + r + ")"
+	}
+	return goExpr{code: l + " " + op + " " + r, prec: prec, reads: left.reads || right.reads,
+		calls: left.calls || right.calls, effects: left.effects || right.effects, folded: left.folded && right.folded}
+}
+
+// goUnaryOp returns the unary operation of Go on the operand.
+func goUnaryOp(op string, operand goExpr) goExpr {
+	code := operand.code
+	if operand.prec < goUnary {
+		code = "(" + code + ")"
+	}
+	return goExpr{code: op + code, prec: goUnary, reads: operand.reads, calls: operand.calls,
+		effects: operand.effects, folded: operand.folded}
+}
+
+// goCall returns the call of a function of the runtime with the arguments. The variables read by the arguments
+// are read before the call, so before the next calls.
+func goCall(function string, operand goExpr, args ...string) goExpr {
+	return goExpr{code: fmt.Sprintf("%s(%s)", function, strings.Join(append([]string{operand.code}, args...), ", ")),
+		prec: goAtom, calls: operand.calls, effects: true}
+}
+
+// literal returns the value of the expression if it is an int literal.
+func literal(expr goExpr) (int, bool) {
+	n, err := strconv.Atoi(expr.code)
+	return n, err == nil
+}
+
+// read returns the value of the variable, as resolved by the analysis.
+func (g *goGenerator) read(access nativeAccess, name string, code TypeCode, wrap int) goExpr {
+	if v := access.variable; v != nil && access.checked {
+		g.used[v] = true
+		return goExpr{code: fmt.Sprintf("rtLoad(%s, _set_%s, %s, %q)", g.names[v], g.names[v], g.wrapCode(wrap), name),
+			prec: goAtom, reads: true, effects: true}
+	} else if v != nil {
+		g.used[v] = true
+		return goExpr{code: g.names[v], prec: goAtom, simple: true, reads: true}
+	} else if access.constant != nil {
+		return goExpr{code: g.constants[access.constant], prec: goAtom, constant: true, simple: true, folded: true}
+	}
+	return goExpr{code: fmt.Sprintf("rtUndeclared[%s](%s, %q)", g.goType(nil, code), g.wrapCode(wrap), name),
+		prec: goAtom, effects: true}
+}
+
+// store assigns the value to the variable.
+func (g *goGenerator) store(v *nativeVariable, value goExpr) {
+	g.stored[v] = true
+	fmt.Fprintf(g.buf, "%s = %s\n", g.names[v], value.code)
+	if v.Checked {
+		fmt.Fprintf(g.buf, "_set_%s = true\n", g.names[v])
+	}
+}
+
+// binary returns the binary operation on the operands. The divisions and the shifts check their right operand,
+// unless it is a literal.
+func (g *goGenerator) binary(code ExprCode, left, right goExpr, wrap int, position *Position) goExpr {
+	pos := fmt.Sprintf("%v", position)
+	if left.folded && right.folded && (code == EXPR_CODE_ADD || code == EXPR_CODE_SUB || code == EXPR_CODE_MUL ||
+		code == EXPR_CODE_SHL) {
+		// the result wraps around at run time
+		left = g.temp(left)
+	}
+	switch code {
+	case EXPR_CODE_DIV, EXPR_CODE_MOD:
+		if n, ok := literal(right); !ok || n == 0 {
+			right = goCall("rtDivisor", right, g.wrapCode(wrap), strconv.Quote(pos))
+		}
+		if code == EXPR_CODE_DIV {
+			return goBinary(left, "/", right)
+		}
+		return goBinary(left, "%", right)
+	case EXPR_CODE_SHL, EXPR_CODE_SHR:
+		if n, ok := literal(right); !ok || n < 0 || n >= 64 {
+			right = goCall("rtShift", right, g.wrapCode(wrap), strconv.Quote(pos))
+		}
+		if code == EXPR_CODE_SHL {
+			return goBinary(left, "<<", right)
+		}
+		return goBinary(left, ">>", right)
+	}
+	return goBinary(left, goOperators[code], right)
+}
+
+// expression generates the expression, whose errors are wrapped wrap times as they are by the interpreter.
+func (g *goGenerator) expression(expr *Expression, wrap int) goExpr {
+	switch expr.code {
+	case EXPR_CODE_INT:
+		return goExpr{code: strconv.Itoa(expr.valeurInt), prec: goAtom, constant: true, simple: true, folded: true}
+	case EXPR_CODE_STR:
+		return goExpr{code: strconv.Quote(expr.valeurString), prec: goAtom, constant: true, simple: true}
+	case EXPR_CODE_TRUE, EXPR_CODE_FALSE:
+		return goExpr{code: strconv.FormatBool(expr.code == EXPR_CODE_TRUE), prec: goAtom, constant: true,
+			simple: true}
+	case EXPR_CODE_VAR:
+		return g.read(g.reads[expr], expr.variable, g.typeOf(expr), wrap)
+	case EXPR_CODE_CALL:
+		var operands []func() goExpr
+		for i := range expr.parameter {
+			param := &expr.parameter[i]
+			operands = append(operands, func() goExpr { return g.expression(param, wrap+1) })
+		}
+		args := []string{g.wrapCode(wrap)}
+		res := goExpr{prec: goAtom, calls: true, effects: true}
+		for _, arg := range g.operands(operands...) {
+			args = append(args, arg.code)
+		}
+		callee := g.nativeProgram.functions[expr.functionName]
+		res.code = fmt.Sprintf("%s(%s)", g.functions[expr.functionName], strings.Join(args, ", "))
+		if g.noValue[callee] {
+			method := map[TypeCode]string{TYPE_INT: "Int", TYPE_STRING: "String", TYPE_BOOLEAN: "Bool"}
+			res.code = fmt.Sprintf("rtCall{%s, %q, %q}.%s(%s)", g.wrapCode(wrap), callee.Name,
+				fmt.Sprintf("%v", expr.position), method[runtimeType(callee.ReturnType.code)], res.code)
+		}
+		return res
+	case EXPR_CODE_ASSIGN:
+		v := g.writes[expr]
+		g.store(v, g.expression(expr.right, wrap+1))
+		return g.read(nativeAccess{variable: v}, v.Name, v.Code, wrap)
+	case EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC, EXPR_CODE_POST_DEC:
+		// the variable is read before the right operand is evaluated, as in C
+		operator := expr.operator
+		right := func() goExpr { return g.expression(expr.right, wrap+1) }
+		if expr.code != EXPR_CODE_COMPOUND_ASSIGN {
+			operator = EXPR_CODE_ADD
+			if expr.code == EXPR_CODE_PRE_DEC || expr.code == EXPR_CODE_POST_DEC {
+				operator = EXPR_CODE_SUB
+			}
+			right = func() goExpr { return goExpr{code: "1", prec: goAtom, constant: true, simple: true} }
+		}
+		operands := g.operands(func() goExpr {
+			return g.read(g.reads[expr], expr.variable, TYPE_INT, wrap+1)
+		}, right)
+		postfix := expr.code == EXPR_CODE_POST_INC || expr.code == EXPR_CODE_POST_DEC
+		if postfix && !operands[0].constant {
+			operands[0] = g.temp(operands[0])
+		}
+		v := g.writes[expr]
+		g.store(v, g.binary(operator, operands[0], operands[1], wrap, expr.position))
+		if postfix {
+			return operands[0]
+		}
+		return g.read(nativeAccess{variable: v}, v.Name, v.Code, wrap)
+	case EXPR_CODE_BIT_NOT:
+		return goUnaryOp("^", g.expression(expr.right, wrap+1))
+	case EXPR_CODE_NOT:
+		return goUnaryOp("!", g.expression(expr.right, wrap+1))
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		op := "&&"
+		if expr.code == EXPR_CODE_OR {
+			op = "||"
+		}
+		left := g.expression(expr.left, wrap+1)
+		mark := g.buf.Len()
+		right := g.expression(expr.right, wrap+1)
+		if g.buf.Len() == mark {
+			return goBinary(left, op, right)
+		}
+		// the statements of the right operand are executed only if the left operand doesn't decide the result
+		code := g.cut(mark)
+		res := g.temp(left)
+		if expr.code == EXPR_CODE_AND {
+			fmt.Fprintf(g.buf, "if %s {\n", res.code)
+		} else {
+			fmt.Fprintf(g.buf, "if !%s {\n", res.code)
+		}
+		fmt.Fprintf(g.buf, "%s%s = %s\n}\n", code, res.code, right.code)
+		return res
+	case EXPR_CODE_CONDITIONAL:
+		condition := g.expression(expr.condition, wrap+1)
+		g.temps++
+		res := goExpr{code: fmt.Sprintf("_t%d", g.temps), prec: goAtom, constant: true, simple: true}
+		fmt.Fprintf(g.buf, "var %s %s\nif %s {\n", res.code, g.goType(nil, g.typeOf(expr)), condition.code)
+		left := g.expression(expr.left, wrap)
+		fmt.Fprintf(g.buf, "%s = %s\n} else {\n", res.code, left.code)
+		right := g.expression(expr.right, wrap)
+		fmt.Fprintf(g.buf, "%s = %s\n}\n", res.code, right.code)
+		return res
+	}
+	operands := g.operands(func() goExpr { return g.expression(expr.left, wrap+1) },
+		func() goExpr { return g.expression(expr.right, wrap+1) })
+	return g.binary(expr.code, operands[0], operands[1], wrap, expr.position)
+}
+
+// value returns the expression, stored in a temporary variable if it is used twice and its evaluation has
+// effects or may fail.
+func (g *goGenerator) value(expr goExpr) goExpr {
+	if expr.simple {
+		return expr
+	}
+	return g.temp(expr)
+}
+
+// printValue writes the trace of the value: the prefix, the value and a new line.
+func (g *goGenerator) printValue(prefix string, value goExpr) {
+	fmt.Fprintf(g.buf, "rtPrint(%q, %s, %q)\n", prefix, value.code, "\n")
+}
+
+func (g *goGenerator) instructions(instructions []Instruction) {
+	for i := range instructions {
+		if !g.reached[&instructions[i]] {
+			return
+		}
+		g.instruction(&instructions[i])
+	}
+}
+
+func (g *goGenerator) instruction(instr *Instruction) {
+	switch instr.Code {
+	case INSTRUCTION_AFFECTATION, INSTRUCTION_DECLARATION:
+		v := g.stores[instr]
+		value := goExpr{code: zero(v.Code), prec: goAtom, constant: true, simple: true}
+		if instr.Valeur != nil {
+			value = g.expression(instr.Valeur, 1)
+		}
+		g.store(v, value)
+		g.printValue(instr.Variable+"=", g.read(nativeAccess{variable: v}, v.Name, v.Code, 0))
+	case INSTRUCTION_CALL:
+		var operands []func() goExpr
+		for i := range instr.Parameter {
+			param := &instr.Parameter[i]
+			operands = append(operands, func() goExpr { return g.expression(param, 1) })
+		}
+		args := []string{g.wrapCode(0)}
+		values := []string{strconv.Quote(instr.FunctionName + "(")}
+		for i, arg := range g.operands(operands...) {
+			arg = g.value(arg)
+			if i > 0 {
+				values = append(values, `","`)
+			}
+			args = append(args, arg.code)
+			values = append(values, arg.code)
+		}
+		fmt.Fprintf(g.buf, "rtPrint(%s, %q)\n", strings.Join(values, ", "), ")\n")
+		if name, ok := g.functions[instr.FunctionName]; ok {
+			fmt.Fprintf(g.buf, "%s(%s)\n", name, strings.Join(args, ", "))
+		}
+	case INSTRUCTION_EXPRESSION:
+		if value := g.expression(instr.Valeur, 1); value.effects {
+			fmt.Fprintf(g.buf, "_ = %s\n", value.code)
+		}
+		if name := assignedVariable(instr.Valeur); name != "" {
+			g.printValue(name+"=", g.read(g.traces[instr], name, TYPE_INT, 0))
+		}
+	case INSTRUCTION_SWITCH:
+		g.switchCases(instr)
+	case INSTRUCTION_BREAK:
+		fmt.Fprintf(g.buf, "rtPrint(%q)\n", "break\n")
+		if len(g.breaks) > 0 {
+			g.breaks[len(g.breaks)-1] = true
+			fmt.Fprintf(g.buf, "break\n")
+		} else {
+			// as the interpreter, a break outside of a switch ends the function
+			g.returnNoValue()
+		}
+		g.reachable = false
+	case INSTRUCTION_RETURN:
+		if instr.Valeur == nil {
+			fmt.Fprintf(g.buf, "rtPrint(%q)\n", "return\n")
+			g.returnNoValue()
+		} else {
+			value := g.value(g.expression(instr.Valeur, 1))
+			g.printValue("return ", value)
+			if g.function.ReturnType.code == TYPE_VOID {
+				fmt.Fprintf(g.buf, "return\n")
+			} else if g.noValue[g.function] {
+				fmt.Fprintf(g.buf, "return %s, true\n", value.code)
+			} else {
+				fmt.Fprintf(g.buf, "return %s\n", value.code)
+			}
+		}
+		g.reachable = false
+	}
+}
+
+// returnNoValue returns from the function without a value.
+func (g *goGenerator) returnNoValue() {
+	if g.function.ReturnType.code == TYPE_VOID {
+		fmt.Fprintf(g.buf, "return\n")
+	} else {
+		fmt.Fprintf(g.buf, "return %s, false\n", zero(runtimeType(g.function.ReturnType.code)))
+	}
+}
+
+// switchCases generates a switch of Go, whose cases fall through the next case until a break.
+func (g *goGenerator) switchCases(instr *Instruction) {
+	value := g.value(g.expression(instr.Valeur, 1))
+	g.printValue("switch ", value)
+	fmt.Fprintf(g.buf, "switch %s {\n", value.code)
+	hasDefault := false
+	g.breaks = append(g.breaks, false)
+	for i := range instr.Case {
+		caseSwitch := &instr.Case[i]
+		if caseSwitch.Valeur == nil {
+			hasDefault = true
+			fmt.Fprintf(g.buf, "default:\n")
+		} else if caseSwitch.Valeur.code == EXPR_CODE_INT {
+			fmt.Fprintf(g.buf, "case %d:\n", caseSwitch.Valeur.valeurInt)
+		} else {
+			fmt.Fprintf(g.buf, "case %s:\n", g.constants[g.nativeProgram.constants[caseSwitch.Valeur.variable]])
+		}
+		g.reachable = true
+		g.instructions(caseSwitch.Instruction)
+		if g.reachable && i < len(instr.Case)-1 {
+			fmt.Fprintf(g.buf, "fallthrough\n")
+		}
+	}
+	fmt.Fprintf(g.buf, "}\n")
+	g.reachable = g.reachable || len(instr.Case) == 0 || !hasDefault || g.breaks[len(g.breaks)-1]
+	g.breaks = g.breaks[:len(g.breaks)-1]
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// nativeTests are the programs translated by the native backends, which must give the same results as the
+// interpreter.
+var nativeTests = []string{
+	`int main () { x=5;return x+3;}`,
+	`enum Color { RED, GREEN, BLUE }; int total = 10; string s = "abc"; boolean b = true;
+	 void add(int n) { total += n; }
+	 int fib(int n) { switch (n < 2 ? 0 : 1) { case 0: return n; } return fib(n-1) + fib(n-2); }
+	 int main () { enum Color c = GREEN; switch (c) { case RED: add(1); case GREEN: add(2); break; default: add(4); }
+	 x = fib(5); y = x++ + (x = 3) * 2; print(s, b, total, y); z = total > 11 && (w = true);
+	 return total > 11 && b ? total >> 1 : ~total; }`,
+	`int div(int a, int b) { return a / b; } int main () { x = 0; return 1 + div(10, x); }`,
+	`int main () { x = 70; return 1 << x; }`,
+	`int main () { switch (1 > 2 ? 1 : 0) { case 1: y = 1; } return y; }`,
+	`int f(int n) { switch (n > 0 ? 1 : 0) { case 1: return n; default: return 0 - n; } } int main () { return f(1) + f(0); }`,
+	`void f() { }`,
+	`enum Color { RED, GREEN }; enum Color f() { return GREEN; } int main () { return f(); }`,
+	`enum Sign { MINUS = -1, ZERO, PLUS }; int main () { enum Sign s = MINUS; print(s); return s + PLUS + 2; }`,
+	`void main () { print("no exit code"); }`,
+	`void main () { switch (1) { case 1: switch (2) { case 2: print(2); case 3: print(3); break; } case 4: print(4); } }`,
+	`int len = 3; int func(int type) { return type * len; }
+	 int main () { var = func(2); ok = var > 5 || (var = 0) > 0; return var % 4; }`,
+	`int main () { i = 0; t = 0; switch (i++) { case 0: t += i; default: t -= i++ * 2; } return t + i; }`,
+	`int g = h(); int h() { return 7; } int main () { return g; }`,
+	`string s = "100% \\ ok??= \u00e9"; int printf = 1; int exit(int int64_t) { return int64_t - printf; }
+	 int main () { x = 5000000000 * 5000000000; y = x / 0 - 1; return exit(2); }`,
+	`int f(int n) { print(n); return n; } int main () { x = f(1) / f(0); return 0; }`,
+	`int f(int n) { print(n); return 2 * n; } int main () { x = (f(1) << f(40)) + f(3) % f(2); return x >> 60; }`,
+}
+
+// testNative checks the programs of the tests run by run write the same output, report the same errors and exit
+// with the same code as the interpreter. run returns the standard output, the standard error and the exit code.
+func testNative(t *testing.T, tests []string,
+	run func(t *testing.T, dir string, program *Program) (string, string, int)) {
+	dir := t.TempDir()
+	for i, s := range tests {
+		i, s := i, s
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			t.Parallel()
+			dir := filepath.Join(dir, fmt.Sprint(i))
+			if err := os.Mkdir(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			source := filepath.Join(dir, "test.he")
+			if err := os.WriteFile(source, []byte(s), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var stdout, stderr bytes.Buffer
+			exitCode := runCommand([]string{source}, &stdout, &stderr)
+
+			program, err := parse(strings.NewReader(s), io.Discard)
+			if err != nil {
+				t.Fatalf("%q: parse error: %s", s, err)
+			}
+			stdout2, stderr2, exitCode2 := run(t, dir, program)
+			if stdout.String() != stdout2 {
+				t.Errorf("%q: output mismatch:\n  exp=%q\n  got=%q\n\n", s, stdout.String(), stdout2)
+			}
+			// the warnings of the checker are written before the execution
+			var errors []string
+			for _, line := range strings.SplitAfter(stderr.String(), "\n") {
+				if !strings.HasPrefix(line, "warning : ") {
+					errors = append(errors, line)
+				}
+			}
+			if exp := strings.Join(errors, ""); exp != stderr2 {
+				t.Errorf("%q: error mismatch:\n  exp=%q\n  got=%q\n\n", s, exp, stderr2)
+			}
+			if exitCode&0xff != exitCode2 {
+				t.Errorf("%q: exit code mismatch: exp=%d got=%d", s, exitCode&0xff, exitCode2)
+			}
+		})
+	}
+}
+
+// runExecutable runs the program with the arguments and returns its standard output, its standard error and
+// its exit code.
+func runExecutable(t *testing.T, path string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatal(err)
+		}
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+// Ensure the Go programs generated write the same output, report the same errors and exit with the same code
+// as the interpreter.
+func TestTranspileGo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the compilation of the generated programs in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+
+	testNative(t, nativeTests, func(t *testing.T, dir string, program *Program) (string, string, int) {
+		code, err := TranspileGo(program, "test.he")
+		if err != nil {
+			t.Fatalf("transpile error: %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "main.go"), code, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		build := exec.Command(goTool, "build", "-o", "prog", "main.go")
+		build.Dir = dir
+		build.Env = append(os.Environ(), "GOFLAGS=", "GO111MODULE=off")
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Fatalf("build error: %s\n%s\n%s", err, out, code)
+		}
+		return runExecutable(t, filepath.Join(dir, "prog"))
+	})
+}
+
+// Ensure the programs whose global variables may be used before their initialization are rejected.
+func TestTranspileGo_errors(t *testing.T) {
+	var tests = []struct {
+		s   string
+		err string
+	}{
+		{s: `int g = f(); int h = 2; int f() { return h; } int main () { return g; }`,
+			err: "global variable h may be used by function f before its initialization (pos=&{1 1 0})"},
+	}
+
+	for i, tt := range tests {
+		program, err := parse(strings.NewReader(tt.s), io.Discard)
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.s, err)
+		}
+		_, err = TranspileGo(program, "test.he")
+		if errstring2(err) != tt.err {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		}
+	}
+}
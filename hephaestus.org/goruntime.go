@@ -0,0 +1,95 @@
+//go:build ignore
+
+// The runtime of the Go programs generated by the command to-go, copied in each program. The generated programs
+// write the same output as the interpreter, and report the same errors.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/bits"
+	"os"
+	"strings"
+)
+
+var rtOut = bufio.NewWriter(os.Stdout)
+
+// rtPrint writes the values as the interpreter writes the trace of the execution.
+func rtPrint(values ...interface{}) {
+	for _, value := range values {
+		fmt.Fprint(rtOut, value)
+	}
+}
+
+// rtExit ends the program with the exit code.
+func rtExit(code int) {
+	rtOut.Flush()
+	os.Exit(code)
+}
+
+// rtFail ends the program with the error of the interpreter, wrapped wrap times.
+func rtFail(wrap int, message string) {
+	rtOut.Flush()
+	fmt.Fprintf(os.Stderr, "error : %s%s\n", strings.Repeat("error: ", wrap), message)
+	os.Exit(1)
+}
+
+// rtUndeclared fails reading the variable, which is not declared.
+func rtUndeclared[T any](wrap int, name string) T {
+	rtFail(wrap, "variable "+name+" not declared")
+	var zero T
+	return zero
+}
+
+// rtLoad returns the value of the variable, which may not be set.
+func rtLoad[T any](value T, set bool, wrap int, name string) T {
+	if !set {
+		rtFail(wrap, "variable "+name+" not declared")
+	}
+	return value
+}
+
+// rtDivisor checks the divisor of a division or a modulo.
+func rtDivisor(divisor int, wrap int, pos string) int {
+	if divisor == 0 {
+		rtFail(wrap, "error: division by zero (pos="+pos+")")
+	}
+	return divisor
+}
+
+// rtShift checks the count of a shift is lower than the size of an int.
+func rtShift(count int, wrap int, pos string) uint {
+	if count < 0 || count >= bits.UintSize {
+		rtFail(wrap, fmt.Sprintf("error: shift count %d out of range (pos=%s)", count, pos))
+	}
+	return uint(count)
+}
+
+// rtCall checks the function called returns a value.
+type rtCall struct {
+	wrap     int
+	function string
+	pos      string
+}
+
+func (c rtCall) check(ok bool) {
+	if !ok {
+		rtFail(c.wrap, "function "+c.function+" returns no value (pos="+c.pos+")")
+	}
+}
+
+func (c rtCall) Int(value int, ok bool) int {
+	c.check(ok)
+	return value
+}
+
+func (c rtCall) String(value string, ok bool) string {
+	c.check(ok)
+	return value
+}
+
+func (c rtCall) Bool(value bool, ok bool) bool {
+	c.check(ok)
+	return value
+}
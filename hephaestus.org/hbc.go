@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The compiled modules are saved in .hbc files:
+//
+//	magic       "\x7fHBC"
+//	version     uvarint
+//	positions   count, then line, column, pos of each position of the source
+//	constants   count, then the type code and the value of each constant
+//	globals     count, then the name and the constant of each global variable
+//	main        varint
+//	init        count, then the initializers of the global variables
+//	functions   count, then the functions
+//	checksum    CRC-32 (IEEE) of the previous bytes, little endian
+//
+// A function is its name, its position, the types of its parameters, its locals, its instructions, and the
+// debug information of each instruction: the position of the statement, the position and the wrapping of its
+// errors, and the steps it accounts for. The positions are indexes in the table of positions, 0 for none.
+// The integers are varints unless stated otherwise.
+
+// moduleMagic starts the .hbc files.
+const moduleMagic = "\x7fHBC"
+
+// moduleVersion is the version of the format of the .hbc files, and of the instructions of the virtual machine.
+const moduleVersion = 2
+
+// IsModule returns true if data starts as a compiled module.
+func IsModule(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(moduleMagic))
+}
+
+type moduleWriter struct {
+	buf       bytes.Buffer
+	positions map[Position]int
+}
+
+func (w *moduleWriter) uvarint(n uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], n)])
+}
+
+func (w *moduleWriter) varint(n int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutVarint(b[:], n)])
+}
+
+func (w *moduleWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *moduleWriter) position(position *Position) {
+	if position == nil {
+		w.uvarint(0)
+	} else {
+		w.uvarint(uint64(w.positions[*position]))
+	}
+}
+
+// WriteModule writes the compiled module in the .hbc format.
+func WriteModule(out io.Writer, module *Module) error {
+	w := &moduleWriter{positions: make(map[Position]int)}
+	var positions []Position
+	module.eachPosition(func(position *Position) {
+		if position == nil {
+			return
+		} else if _, ok := w.positions[*position]; !ok {
+			positions = append(positions, *position)
+			w.positions[*position] = len(positions)
+		}
+	})
+
+	w.buf.WriteString(moduleMagic)
+	w.uvarint(moduleVersion)
+	w.uvarint(uint64(len(positions)))
+	for _, position := range positions {
+		w.uvarint(uint64(position.line))
+		w.uvarint(uint64(position.column))
+		w.uvarint(uint64(position.pos))
+	}
+	w.uvarint(uint64(len(module.Constants)))
+	for _, val := range module.Constants {
+		w.buf.WriteByte(byte(val.valeurtype.code))
+		switch val.valeurtype.code {
+		case TYPE_INT:
+			w.varint(int64(val.valeurInt))
+		case TYPE_STRING:
+			w.string(val.valeurString)
+		case TYPE_BOOLEAN:
+			if val.valeurBoolean {
+				w.buf.WriteByte(1)
+			} else {
+				w.buf.WriteByte(0)
+			}
+		default:
+			return fmt.Errorf("invalid constant of type %s", typeName(&val.valeurtype))
+		}
+	}
+	w.uvarint(uint64(len(module.Globals)))
+	for _, global := range module.Globals {
+		w.string(global.Name)
+		w.varint(int64(global.Constant))
+	}
+	w.varint(int64(module.Main))
+	for _, functions := range [][]CompiledFunction{module.Init, module.Functions} {
+		w.uvarint(uint64(len(functions)))
+		for i := range functions {
+			w.function(&functions[i])
+		}
+	}
+
+	var checksum [4]byte
+	binary.LittleEndian.PutUint32(checksum[:], crc32.ChecksumIEEE(w.buf.Bytes()))
+	w.buf.Write(checksum[:])
+	_, err := out.Write(w.buf.Bytes())
+	return err
+}
+
+func (w *moduleWriter) function(function *CompiledFunction) {
+	w.string(function.Name)
+	w.position(function.position)
+	w.uvarint(uint64(len(function.Parameters)))
+	for _, typeCode := range function.Parameters {
+		w.buf.WriteByte(byte(typeCode))
+	}
+	w.uvarint(uint64(len(function.Locals)))
+	for _, local := range function.Locals {
+		w.string(local.Name)
+		w.varint(int64(local.Global))
+		w.varint(int64(local.Constant))
+		w.position(local.position)
+	}
+	w.uvarint(uint64(len(function.Code)))
+	for i, instr := range function.Code {
+		w.buf.WriteByte(byte(instr.Op))
+		w.varint(int64(instr.A))
+		w.varint(int64(instr.B))
+		debug := &function.Debug[i]
+		w.position(debug.Statement)
+		w.position(debug.Position)
+		w.uvarint(uint64(debug.Wrap))
+		w.uvarint(uint64(len(debug.Steps)))
+		for _, step := range debug.Steps {
+			w.position(step.Position)
+			w.uvarint(uint64(step.Wrap))
+		}
+	}
+}
+
+// eachPosition calls f with each position of the source referenced by the module.
+func (module *Module) eachPosition(f func(position *Position)) {
+	for _, functions := range [][]CompiledFunction{module.Init, module.Functions} {
+		for i := range functions {
+			function := &functions[i]
+			f(function.position)
+			for j := range function.Locals {
+				f(function.Locals[j].position)
+			}
+			for _, debug := range function.Debug {
+				f(debug.Statement)
+				f(debug.Position)
+				for _, step := range debug.Steps {
+					f(step.Position)
+				}
+			}
+		}
+	}
+}
+
+// errInvalidModule is returned when a .hbc file is truncated or inconsistent.
+var errInvalidModule = errors.New("invalid module")
+
+type moduleReader struct {
+	r         *bytes.Reader
+	positions []*Position
+	err       error
+}
+
+func (r *moduleReader) uvarint() uint64 {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil && r.err == nil {
+		r.err = errInvalidModule
+	}
+	return n
+}
+
+func (r *moduleReader) varint() int64 {
+	n, err := binary.ReadVarint(r.r)
+	if err != nil && r.err == nil {
+		r.err = errInvalidModule
+	}
+	return n
+}
+
+func (r *moduleReader) byte() byte {
+	b, err := r.r.ReadByte()
+	if err != nil && r.err == nil {
+		r.err = errInvalidModule
+	}
+	return b
+}
+
+// count reads the length of a list, each element taking at least one byte.
+func (r *moduleReader) count() int {
+	n := r.uvarint()
+	if n > uint64(r.r.Len()) {
+		if r.err == nil {
+			r.err = errInvalidModule
+		}
+		return 0
+	}
+	return int(n)
+}
+
+func (r *moduleReader) string() string {
+	b := make([]byte, r.count())
+	if _, err := io.ReadFull(r.r, b); err != nil && r.err == nil {
+		r.err = errInvalidModule
+	}
+	return string(b)
+}
+
+func (r *moduleReader) position() *Position {
+	index := r.uvarint()
+	if index == 0 {
+		return nil
+	} else if index > uint64(len(r.positions)) {
+		if r.err == nil {
+			r.err = errInvalidModule
+		}
+		return nil
+	}
+	return r.positions[index-1]
+}
+
+// ReadModule reads a compiled module in the .hbc format.
+func ReadModule(in io.Reader) (*Module, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	if !IsModule(data) {
+		return nil, fmt.Errorf("%w: not a compiled module", errInvalidModule)
+	} else if len(data) < len(moduleMagic)+4 {
+		return nil, fmt.Errorf("%w: truncated", errInvalidModule)
+	}
+	content := data[:len(data)-4]
+	if crc32.ChecksumIEEE(content) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", errInvalidModule)
+	}
+
+	r := &moduleReader{r: bytes.NewReader(content[len(moduleMagic):])}
+	if version := r.uvarint(); r.err == nil && version != moduleVersion {
+		return nil, fmt.Errorf("unsupported module version %d, expected %d", version, moduleVersion)
+	}
+	for i, n := 0, r.count(); i < n; i++ {
+		r.positions = append(r.positions, &Position{line: int(r.uvarint()), column: int(r.uvarint()),
+			pos: int(r.uvarint())})
+	}
+	module := &Module{}
+	for i, n := 0, r.count(); i < n; i++ {
+		val := Valeur{valeurtype: Type{code: TypeCode(r.byte())}}
+		switch val.valeurtype.code {
+		case TYPE_INT:
+			val.valeurInt = int(r.varint())
+		case TYPE_STRING:
+			val.valeurString = r.string()
+		case TYPE_BOOLEAN:
+			val.valeurBoolean = r.byte() != 0
+		default:
+			return nil, fmt.Errorf("%w: invalid constant of type %d", errInvalidModule, val.valeurtype.code)
+		}
+		module.Constants = append(module.Constants, val)
+	}
+	for i, n := 0, r.count(); i < n; i++ {
+		module.Globals = append(module.Globals, Global{Name: r.string(), Constant: int(r.varint())})
+	}
+	module.Main = int(r.varint())
+	for _, functions := range []*[]CompiledFunction{&module.Init, &module.Functions} {
+		for i, n := 0, r.count(); i < n; i++ {
+			*functions = append(*functions, r.function())
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: truncated", r.err)
+	} else if r.r.Len() != 0 {
+		return nil, fmt.Errorf("%w: unexpected data after the functions", errInvalidModule)
+	} else if err := module.verify(); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidModule, err)
+	}
+	return module, nil
+}
+
+func (r *moduleReader) function() CompiledFunction {
+	function := CompiledFunction{Name: r.string(), position: r.position()}
+	for i, n := 0, r.count(); i < n; i++ {
+		function.Parameters = append(function.Parameters, TypeCode(r.byte()))
+	}
+	for i, n := 0, r.count(); i < n; i++ {
+		function.Locals = append(function.Locals, Local{Name: r.string(), Global: int(r.varint()),
+			Constant: int(r.varint()), position: r.position()})
+	}
+	for i, n := 0, r.count(); i < n; i++ {
+		instr := Instr{Op: Opcode(r.byte()), A: int32(r.varint()), B: int32(r.varint())}
+		debug := DebugInfo{Statement: r.position(), Position: r.position(), Wrap: int(r.uvarint())}
+		for j, m := 0, r.count(); j < m; j++ {
+			debug.Steps = append(debug.Steps, StepInfo{Position: r.position(), Wrap: int(r.uvarint())})
+		}
+		instr.Steps = int32(len(debug.Steps))
+		function.Code = append(function.Code, instr)
+		function.Debug = append(function.Debug, debug)
+	}
+	return function
+}
+
+// verify checks the indexes of the module are valid, so that the virtual machine can execute it.
+func (module *Module) verify() error {
+	inRange := func(index int, length int) bool { return index >= 0 && index < length }
+	if module.Main != -1 && !inRange(module.Main, len(module.Functions)) {
+		return fmt.Errorf("invalid main function %d", module.Main)
+	}
+	for _, global := range module.Globals {
+		if global.Constant != -1 && !inRange(global.Constant, len(module.Constants)) {
+			return fmt.Errorf("invalid constant %d of global %s", global.Constant, global.Name)
+		}
+	}
+	for _, functions := range [][]CompiledFunction{module.Init, module.Functions} {
+		for i := range functions {
+			if err := module.verifyFunction(&functions[i]); err != nil {
+				return fmt.Errorf("function %s: %s", functions[i].Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (module *Module) verifyFunction(function *CompiledFunction) error {
+	inRange := func(index int32, length int) bool { return index >= 0 && int(index) < length }
+	if len(function.Parameters) > len(function.Locals) {
+		return fmt.Errorf("%d parameters for %d locals", len(function.Parameters), len(function.Locals))
+	}
+	for _, local := range function.Locals {
+		if local.Global != -1 && !inRange(int32(local.Global), len(module.Globals)) {
+			return fmt.Errorf("invalid global %d of local %s", local.Global, local.Name)
+		} else if local.Constant != -1 && !inRange(int32(local.Constant), len(module.Constants)) {
+			return fmt.Errorf("invalid constant %d of local %s", local.Constant, local.Name)
+		}
+	}
+	for pc, instr := range function.Code {
+		valid := true
+		switch instr.Op {
+		case OP_CONST, OP_PRINT, OP_FAIL:
+			valid = inRange(instr.A, len(module.Constants))
+		case OP_PRINT_CALL:
+			valid = inRange(instr.A, len(module.Constants)) && instr.B >= 0
+		case OP_LOAD_LOCAL, OP_STORE_LOCAL, OP_DECLARE_LOCAL:
+			valid = inRange(instr.A, len(function.Locals))
+		case OP_LOAD_GLOBAL, OP_STORE_GLOBAL, OP_DECLARE_GLOBAL:
+			valid = inRange(instr.A, len(module.Globals))
+		case OP_CALL, OP_CALL_VOID:
+			valid = inRange(instr.A, len(module.Functions)) && instr.B >= 0
+		case OP_JUMP, OP_JUMP_IF_FALSE, OP_JUMP_IF_FALSE_OR_POP, OP_JUMP_IF_TRUE_OR_POP, OP_CASE:
+			valid = inRange(instr.A, len(function.Code)+1)
+		case OP_POP:
+			valid = instr.A >= 0
+		case OP_DUP, OP_PRINT_VALUE, OP_BINARY, OP_BIT_NOT, OP_NOT, OP_CHECK_BOOLEAN, OP_CHECK_INT, OP_RETURN,
+			OP_RETURN_VOID:
+		default:
+			valid = false
+		}
+		if !valid {
+			return fmt.Errorf("invalid instruction %d at %d", instr.Op, pc)
+		}
+	}
+	return function.verifyStack()
+}
+
+// verifyStack checks the instructions never pop more values than the stack holds, and that the stack has the same
+// size whatever the path to an instruction.
+func (function *CompiledFunction) verifyStack() error {
+	depths := make([]int, len(function.Code)+1)
+	for i := range depths {
+		depths[i] = -1
+	}
+	var pending []int
+	next := func(pc int, depth int) error {
+		if depths[pc] == -1 {
+			depths[pc] = depth
+			pending = append(pending, pc)
+		} else if depths[pc] != depth {
+			return fmt.Errorf("inconsistent stack at %d", pc)
+		}
+		return nil
+	}
+	if err := next(0, 0); err != nil {
+		return err
+	}
+	for len(pending) > 0 {
+		pc := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if pc == len(function.Code) {
+			continue
+		}
+		instr, depth := function.Code[pc], depths[pc]
+		// pop is the number of values used, push the number of values left after it
+		pop, push, jump, jumpPush, fallThrough := 0, 0, -1, 0, true
+		switch instr.Op {
+		case OP_CONST, OP_LOAD_LOCAL, OP_LOAD_GLOBAL:
+			push = 1
+		case OP_POP:
+			pop = int(instr.A)
+		case OP_DUP:
+			pop, push = 1, 2
+		case OP_STORE_LOCAL, OP_STORE_GLOBAL, OP_DECLARE_LOCAL, OP_DECLARE_GLOBAL, OP_PRINT_VALUE, OP_BIT_NOT, OP_NOT,
+			OP_CHECK_BOOLEAN, OP_CHECK_INT:
+			pop, push = 1, 1
+		case OP_PRINT_CALL:
+			pop, push = int(instr.B), int(instr.B)
+		case OP_BINARY:
+			pop, push = 2, 1
+		case OP_JUMP:
+			jump, fallThrough = int(instr.A), false
+		case OP_JUMP_IF_FALSE:
+			pop, jump = 1, int(instr.A)
+		case OP_JUMP_IF_FALSE_OR_POP, OP_JUMP_IF_TRUE_OR_POP:
+			pop, jump, jumpPush = 1, int(instr.A), 1
+		case OP_CASE:
+			pop, push, jump = 2, 1, int(instr.A)
+		case OP_CALL:
+			pop, push = int(instr.B), 1
+		case OP_CALL_VOID:
+			pop = int(instr.B)
+		case OP_RETURN:
+			pop, fallThrough = 1, false
+		case OP_RETURN_VOID, OP_FAIL:
+			fallThrough = false
+		}
+		if depth < pop {
+			return fmt.Errorf("stack underflow at %d", pc)
+		}
+		if fallThrough {
+			if err := next(pc+1, depth-pop+push); err != nil {
+				return err
+			}
+		}
+		if jump >= 0 {
+			if err := next(jump, depth-pop+jumpPush); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Ensure a module read back from its .hbc encoding is identical to the compiled module, and gives the same
+// results and errors as the tree-walking interpreter.
+func TestModule_roundTrip(t *testing.T) {
+	var tests = []string{
+		`int main () { x=5;return x+3;}`,
+		`enum Color { RED, GREEN, BLUE }; int total = 10; string s = "abc"; boolean b = true;
+		 void add(int n) { total += n; }
+		 int main () { enum Color c = GREEN; switch (c) { case RED: add(1); case GREEN: add(2); break; default: add(4); }
+		 print(s, b, total); return total > 11 && b ? total >> 1 : ~total; }`,
+		`int main () { x = 0; return 10 / x; }`,
+		`int g = f(); int f() { return 1 << 70; } void main () { }`,
+		`void f() { }`,
+	}
+
+	for i, s := range tests {
+		program, err := NewParser(strings.NewReader(s)).Parse2()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, s, err)
+		}
+		module := Compile(program)
+		var buf bytes.Buffer
+		if err := WriteModule(&buf, module); err != nil {
+			t.Fatalf("%d. %q: write error: %s", i, s, err)
+		}
+		if !IsModule(buf.Bytes()) {
+			t.Fatalf("%d. %q: not recognized as a module", i, s)
+		}
+		module2, err := ReadModule(&buf)
+		if err != nil {
+			t.Fatalf("%d. %q: read error: %s", i, s, err)
+		}
+		if !reflect.DeepEqual(module, module2) {
+			t.Errorf("%d. %q: module mismatch:\n  exp=%+v\n  got=%+v\n\n", i, s, module, module2)
+		}
+
+		res, err := NewInterpreterWithOptions(program, Options{}).interpreterContext(context.Background())
+		res2, err2 := NewInterpreterFromModule(module2, Options{}).interpreterContext(context.Background())
+		if errstring2(err) != errstring2(err2) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, s, err, err2)
+		}
+		res.Err, res2.Err = nil, nil
+		if !reflect.DeepEqual(res, res2) {
+			t.Errorf("%d. %q: result mismatch:\n  exp=%+v\n  got=%+v\n\n", i, s, res, res2)
+		}
+	}
+}
+
+// Ensure corrupted or incompatible .hbc files are rejected.
+func TestReadModule_invalid(t *testing.T) {
+	program, err := NewParser(strings.NewReader(`int main () { x=5;return x+3;}`)).Parse2()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteModule(&buf, Compile(program)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// withChecksum replaces the checksum of the data by the one of its content.
+	withChecksum := func(data []byte) []byte {
+		data = append([]byte(nil), data...)
+		n := len(data) - 4
+		binary.LittleEndian.PutUint32(data[n:], crc32.ChecksumIEEE(data[:n]))
+		return data
+	}
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	version := append([]byte(nil), data...)
+	version[len(moduleMagic)] = moduleVersion + 1
+
+	var tests = []struct {
+		data []byte
+		err  string
+	}{
+		{data: []byte("int main () { }"), err: "invalid module: not a compiled module"},
+		{data: data[:len(moduleMagic)+2], err: "invalid module: truncated"},
+		{data: corrupted, err: "invalid module: checksum mismatch"},
+		{data: withChecksum(version), err: "unsupported module version 3, expected 2"},
+		{data: withChecksum(append(append([]byte(nil), data[:len(data)-4]...), 0, 0, 0, 0, 0)),
+			err: "invalid module: unexpected data after the functions"},
+		{data: withChecksum(append(append([]byte(nil), data[:len(data)-6]...), 0, 0, 0, 0)), err: "invalid module: truncated"},
+	}
+
+	// the instructions of main are replaced, the module is valid but not its code
+	for _, tt := range []struct {
+		instr Instr
+		err   string
+	}{
+		{instr: Instr{Op: OP_CONST, A: 1000}, err: "invalid module: function main: invalid instruction 0 at 0"},
+		{instr: Instr{Op: OP_POP, A: 1}, err: "invalid module: function main: stack underflow at 0"},
+		{instr: Instr{Op: OP_JUMP, A: -1}, err: "invalid module: function main: invalid instruction 17 at 0"},
+	} {
+		module := Compile(program)
+		module.Functions[0].Code[0] = tt.instr
+		var buf bytes.Buffer
+		if err := WriteModule(&buf, module); err != nil {
+			t.Fatal(err)
+		}
+		tests = append(tests, struct {
+			data []byte
+			err  string
+		}{data: buf.Bytes(), err: tt.err})
+	}
+
+	for i, tt := range tests {
+		_, err := ReadModule(bytes.NewReader(tt.data))
+		if errstring2(err) != tt.err {
+			t.Errorf("%d. error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, err)
+		}
+	}
+}
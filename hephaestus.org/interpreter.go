@@ -1,9 +1,39 @@
 package main
 
-import "fmt"
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/bits"
+)
 
 type Interpreter struct {
-	functions []Function
+	program   *Program
+	functions map[string]*Function
+	globals   map[string]Valeur
+	constants map[string]Valeur // values of the enumerations
+	options   Options
+	ctx       context.Context
+	out       *limitedWriter
+	stdout    bytes.Buffer
+	steps     int64
+	depth     int
+	memory    int64
+	stats     Stats
+
+	module       *Module // program compiled for the virtual machine
+	globalValues []Valeur
+	globalSet    []bool
+}
+
+// Options configures the execution of a program.
+type Options struct {
+	Limits Limits
+	Stdout io.Writer // receives the output as it is written, in addition to Result.Stdout
+	VM     bool      // compile the program to bytecode and execute it with the virtual machine
+
+	Debugger *Debugger // stops the execution at its breakpoints, nil to execute the program without stopping
 }
 
 type Valeur struct {
@@ -13,11 +43,70 @@ type Valeur struct {
 	valeurBoolean bool
 }
 
-func NewInterpreter(functions []Function) *Interpreter {
-	return &Interpreter{functions: functions}
+func NewInterpreter(program *Program) *Interpreter {
+	return NewInterpreterWithOptions(program, Options{})
+}
+
+// NewInterpreterWithOptions returns a new instance of Interpreter using the given options.
+func NewInterpreterWithOptions(program *Program, options Options) *Interpreter {
+	functions := make(map[string]*Function)
+	for i := range program.Functions {
+		functions[program.Functions[i].Name] = &program.Functions[i]
+	}
+	constants := make(map[string]Valeur)
+	for _, enum := range program.Enums {
+		for _, value := range enum.Values {
+			constants[value.Name] = Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: value.Value}
+		}
+	}
+	return &Interpreter{program: program, functions: functions, constants: constants, options: options}
+}
+
+// NewInterpreterFromModule returns a new instance of Interpreter executing the compiled module with the
+// virtual machine.
+func NewInterpreterFromModule(module *Module, options Options) *Interpreter {
+	options.VM = true
+	return &Interpreter{module: module, options: options}
+}
+
+// step accounts for one step of execution and checks the step limit and the context.
+func (interpreter *Interpreter) step(position *Position) error {
+	interpreter.steps++
+	if limit := interpreter.options.Limits.MaxSteps; limit > 0 && interpreter.steps > limit {
+		return &StepLimitError{Limit: limit, position: position}
+	}
+	select {
+	case <-interpreter.ctx.Done():
+		return contextError(interpreter.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// allocate accounts for size bytes of memory (released if size is negative) and checks the memory limit.
+func (interpreter *Interpreter) allocate(size int64, position *Position) error {
+	interpreter.memory += size
+	if size > 0 {
+		interpreter.stats.Allocations++
+	}
+	if interpreter.memory > interpreter.stats.PeakMemory {
+		interpreter.stats.PeakMemory = interpreter.memory
+	}
+	if limit := interpreter.options.Limits.MaxMemory; limit > 0 && interpreter.memory > limit {
+		return &MemoryLimitError{Limit: limit, Used: interpreter.memory, position: position}
+	}
+	return nil
+}
+
+func (interpreter *Interpreter) printf(format string, a ...interface{}) error {
+	_, err := fmt.Fprintf(interpreter.out, format, a...)
+	return err
 }
 
 func (interpreter *Interpreter) getIntValue(expression *Expression, symbolTable map[string]Valeur) (*Valeur, error) {
+	if err := interpreter.step(expression.position); err != nil {
+		return nil, err
+	}
 	if expression.code == EXPR_CODE_INT {
 		return &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: expression.valeurInt}, nil
 	} else if expression.code == EXPR_CODE_STR {
@@ -27,123 +116,611 @@ func (interpreter *Interpreter) getIntValue(expression *Expression, symbolTable
 	} else if expression.code == EXPR_CODE_STR {
 		return &Valeur{valeurtype: Type{code: TYPE_STRING}, valeurString: expression.valeurString}, nil
 	} else if expression.code == EXPR_CODE_VAR {
-		if val, ok := symbolTable[expression.variable]; ok {
-			return &val, nil
-		} else {
-			return nil, fmt.Errorf("variable %s not declared", expression.variable)
+		return interpreter.getVariable(expression.variable, symbolTable)
+	} else if expression.code == EXPR_CODE_CALL {
+		function, ok := interpreter.functions[expression.functionName]
+		if !ok {
+			return nil, fmt.Errorf("function %s not declared", expression.functionName)
+		}
+		args, err := interpreter.getParameters(expression.parameter, symbolTable)
+		if err != nil {
+			return nil, err
+		}
+		_, val, err := interpreter.runFunction(function, args)
+		if err != nil {
+			return nil, err
+		} else if val == nil {
+			return nil, errorAt(expression.position, "function %s returns no value", function.Name)
+		}
+		return val, nil
+	} else if expression.code == EXPR_CODE_ASSIGN {
+		val, err := interpreter.getIntValue(expression.right, symbolTable)
+		if err != nil {
+			return nil, fmt.Errorf("error: %w", err)
+		}
+		if err := interpreter.setVariable(expression.variable, val, symbolTable, expression.position); err != nil {
+			return nil, err
+		}
+		return val, nil
+	} else if expression.code == EXPR_CODE_COMPOUND_ASSIGN || expression.code == EXPR_CODE_PRE_INC ||
+		expression.code == EXPR_CODE_PRE_DEC || expression.code == EXPR_CODE_POST_INC ||
+		expression.code == EXPR_CODE_POST_DEC {
+		// the variable is read before the right operand is evaluated, as in C
+		old, err := interpreter.getVariable(expression.variable, symbolTable)
+		if err != nil {
+			return nil, fmt.Errorf("error: %w", err)
+		}
+		operator := EXPR_CODE_ADD
+		val2 := &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: 1}
+		if expression.code == EXPR_CODE_PRE_DEC || expression.code == EXPR_CODE_POST_DEC {
+			operator = EXPR_CODE_SUB
+		} else if expression.code == EXPR_CODE_COMPOUND_ASSIGN {
+			operator = expression.operator
+			val2, err = interpreter.getIntValue(expression.right, symbolTable)
+			if err != nil {
+				return nil, fmt.Errorf("error: %w", err)
+			}
 		}
-	} else if expression.code == EXPR_CODE_ADD || expression.code == EXPR_CODE_SUB ||
-		expression.code == EXPR_CODE_EQU || expression.code == EXPR_CODE_LT || expression.code == EXPR_CODE_LTE ||
-		expression.code == EXPR_CODE_GT || expression.code == EXPR_CODE_GTE {
+		val, err := binaryValue(operator, old, val2, expression.position)
+		if err != nil {
+			return nil, err
+		}
+		if err := interpreter.setVariable(expression.variable, val, symbolTable, expression.position); err != nil {
+			return nil, err
+		}
+		if expression.code == EXPR_CODE_POST_INC || expression.code == EXPR_CODE_POST_DEC {
+			return old, nil
+		}
+		return val, nil
+	} else if expression.code == EXPR_CODE_BIT_NOT {
+		val, err := interpreter.getIntValue(expression.right, symbolTable)
+		if err != nil {
+			return nil, fmt.Errorf("error: %w", err)
+		} else if val.valeurtype.code != TYPE_INT {
+			return nil, fmt.Errorf("error: var is not int")
+		}
+		return &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: ^val.valeurInt}, nil
+	} else if expression.code == EXPR_CODE_NOT {
+		val, err := interpreter.getBooleanValue(expression.right, symbolTable)
+		if err != nil {
+			return nil, err
+		}
+		return &Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: !val}, nil
+	} else if expression.code == EXPR_CODE_AND || expression.code == EXPR_CODE_OR {
+		// the right operand is evaluated only if the left operand doesn't decide the result
+		val, err := interpreter.getBooleanValue(expression.left, symbolTable)
+		if err != nil {
+			return nil, err
+		} else if val == (expression.code == EXPR_CODE_AND) {
+			val, err = interpreter.getBooleanValue(expression.right, symbolTable)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: val}, nil
+	} else if expression.code == EXPR_CODE_CONDITIONAL {
+		val, err := interpreter.getBooleanValue(expression.condition, symbolTable)
+		if err != nil {
+			return nil, err
+		} else if val {
+			return interpreter.getIntValue(expression.left, symbolTable)
+		}
+		return interpreter.getIntValue(expression.right, symbolTable)
+	} else if _, ok := binaryPrecedence[expression.code]; ok {
 		val, err := interpreter.getIntValue(expression.left, symbolTable)
 		if err != nil {
-			return nil, fmt.Errorf("error: %s", err)
+			return nil, fmt.Errorf("error: %w", err)
 		}
 		val2, err2 := interpreter.getIntValue(expression.right, symbolTable)
 		if err2 != nil {
-			return nil, fmt.Errorf("error: %s", err2)
-		}
-		if expression.code == EXPR_CODE_ADD || expression.code == EXPR_CODE_SUB {
-			if val.valeurtype.code == TYPE_INT && val2.valeurtype.code == TYPE_INT {
-				var val3 int
-				switch expression.code {
-				case EXPR_CODE_ADD:
-					val3 = val.valeurInt + val2.valeurInt
-					break
-				case EXPR_CODE_SUB:
-					val3 = val.valeurInt - val2.valeurInt
-					break
-				default:
-					return nil, fmt.Errorf("error: invalid opertator")
+			return nil, fmt.Errorf("error: %w", err2)
+		}
+		return binaryValue(expression.code, val, val2, expression.position)
+	}
+
+	return nil, fmt.Errorf("expression not valid")
+}
+
+// getBooleanValue evaluates an operand of a logical operation or a condition, which must be a boolean.
+func (interpreter *Interpreter) getBooleanValue(expression *Expression, symbolTable map[string]Valeur) (bool, error) {
+	val, err := interpreter.getIntValue(expression, symbolTable)
+	if err != nil {
+		return false, fmt.Errorf("error: %w", err)
+	} else if val.valeurtype.code != TYPE_BOOLEAN {
+		return false, errorAt(expression.position, "error: var is not boolean")
+	}
+	return val.valeurBoolean, nil
+}
+
+// assignedVariable returns the variable modified by the expression, or "" if the expression is not an assignment.
+func assignedVariable(expression *Expression) string {
+	switch expression.code {
+	case EXPR_CODE_ASSIGN, EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC,
+		EXPR_CODE_POST_DEC:
+		return expression.variable
+	}
+	return ""
+}
+
+// getVariable returns the value of the local variable, or of the global variable, or of the enumeration constant.
+func (interpreter *Interpreter) getVariable(name string, symbolTable map[string]Valeur) (*Valeur, error) {
+	if val, ok := symbolTable[name]; ok {
+		return &val, nil
+	} else if val, ok := interpreter.globals[name]; ok {
+		return &val, nil
+	} else if val, ok := interpreter.constants[name]; ok {
+		return &val, nil
+	} else {
+		return nil, fmt.Errorf("variable %s not declared", name)
+	}
+}
+
+// isArithmetic returns true if the binary operation computes an int.
+func isArithmetic(code ExprCode) bool {
+	switch code {
+	case EXPR_CODE_ADD, EXPR_CODE_SUB, EXPR_CODE_MUL, EXPR_CODE_DIV, EXPR_CODE_MOD, EXPR_CODE_BIT_AND, EXPR_CODE_BIT_OR,
+		EXPR_CODE_BIT_XOR, EXPR_CODE_SHL, EXPR_CODE_SHR:
+		return true
+	}
+	return false
+}
+
+// binaryValue computes the binary operation on the values.
+func binaryValue(code ExprCode, val *Valeur, val2 *Valeur, position *Position) (*Valeur, error) {
+	if isArithmetic(code) {
+		if val.valeurtype.code == TYPE_INT && val2.valeurtype.code == TYPE_INT {
+			var val3 int
+			switch code {
+			case EXPR_CODE_ADD:
+				val3 = val.valeurInt + val2.valeurInt
+			case EXPR_CODE_SUB:
+				val3 = val.valeurInt - val2.valeurInt
+			case EXPR_CODE_MUL:
+				val3 = val.valeurInt * val2.valeurInt
+			case EXPR_CODE_DIV, EXPR_CODE_MOD:
+				if val2.valeurInt == 0 {
+					return nil, errorAt(position, "error: division by zero")
+				} else if code == EXPR_CODE_DIV {
+					val3 = val.valeurInt / val2.valeurInt
+				} else {
+					val3 = val.valeurInt % val2.valeurInt
 				}
-				return &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: val3}, nil
-			} else {
-				return nil, fmt.Errorf("error: var is not int")
-			}
-		} else if expression.code == EXPR_CODE_EQU || expression.code == EXPR_CODE_LT || expression.code == EXPR_CODE_LTE ||
-			expression.code == EXPR_CODE_GT || expression.code == EXPR_CODE_GTE {
-			if val.valeurtype.code == TYPE_INT && val2.valeurtype.code == TYPE_INT {
-				var val3 bool
-				switch expression.code {
-				case EXPR_CODE_EQU:
-					val3 = val.valeurInt == val2.valeurInt
-					break
-				case EXPR_CODE_LT:
-					val3 = val.valeurInt < val2.valeurInt
-					break
-				case EXPR_CODE_LTE:
-					val3 = val.valeurInt <= val2.valeurInt
-					break
-				case EXPR_CODE_GT:
-					val3 = val.valeurInt > val2.valeurInt
-					break
-				case EXPR_CODE_GTE:
-					val3 = val.valeurInt >= val2.valeurInt
-					break
-				default:
-					return nil, fmt.Errorf("error: invalid opertator")
+			case EXPR_CODE_BIT_AND:
+				val3 = val.valeurInt & val2.valeurInt
+			case EXPR_CODE_BIT_OR:
+				val3 = val.valeurInt | val2.valeurInt
+			case EXPR_CODE_BIT_XOR:
+				val3 = val.valeurInt ^ val2.valeurInt
+			case EXPR_CODE_SHL, EXPR_CODE_SHR:
+				if val2.valeurInt < 0 || val2.valeurInt >= bits.UintSize {
+					return nil, errorAt(position, "error: shift count %d out of range", val2.valeurInt)
+				} else if code == EXPR_CODE_SHL {
+					val3 = val.valeurInt << uint(val2.valeurInt)
+				} else {
+					val3 = val.valeurInt >> uint(val2.valeurInt)
 				}
-				return &Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: val3}, nil
-			} else {
-				return nil, fmt.Errorf("error: var is not int")
+			default:
+				return nil, fmt.Errorf("error: invalid opertator")
+			}
+			return &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: val3}, nil
+		} else {
+			return nil, fmt.Errorf("error: var is not int")
+		}
+	} else if code == EXPR_CODE_EQU || code == EXPR_CODE_NEQ || code == EXPR_CODE_LT || code == EXPR_CODE_LTE ||
+		code == EXPR_CODE_GT || code == EXPR_CODE_GTE {
+		if val.valeurtype.code == TYPE_INT && val2.valeurtype.code == TYPE_INT {
+			var val3 bool
+			switch code {
+			case EXPR_CODE_EQU:
+				val3 = val.valeurInt == val2.valeurInt
+			case EXPR_CODE_NEQ:
+				val3 = val.valeurInt != val2.valeurInt
+			case EXPR_CODE_LT:
+				val3 = val.valeurInt < val2.valeurInt
+			case EXPR_CODE_LTE:
+				val3 = val.valeurInt <= val2.valeurInt
+			case EXPR_CODE_GT:
+				val3 = val.valeurInt > val2.valeurInt
+			case EXPR_CODE_GTE:
+				val3 = val.valeurInt >= val2.valeurInt
+			default:
+				return nil, fmt.Errorf("error: invalid opertator")
 			}
+			return &Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: val3}, nil
+		} else if (code == EXPR_CODE_EQU || code == EXPR_CODE_NEQ) && val.valeurtype.code == TYPE_BOOLEAN &&
+			val2.valeurtype.code == TYPE_BOOLEAN {
+			val3 := (val.valeurBoolean == val2.valeurBoolean) == (code == EXPR_CODE_EQU)
+			return &Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: val3}, nil
 		} else {
-			return nil, fmt.Errorf("error: invalid opertator")
+			return nil, fmt.Errorf("error: var is not int")
 		}
 	}
-
-	return nil, fmt.Errorf("expression not valid")
+	return nil, fmt.Errorf("error: invalid opertator")
 }
 
 func (interpreter *Interpreter) printValue(value *Valeur) error {
 	if value.valeurtype.code == TYPE_INT {
-		fmt.Printf("%d", value.valeurInt)
+		return interpreter.printf("%d", value.valeurInt)
 	} else if value.valeurtype.code == TYPE_STRING {
-		fmt.Printf("%s", value.valeurString)
+		return interpreter.printf("%s", value.valeurString)
 	} else if value.valeurtype.code == TYPE_BOOLEAN {
-		fmt.Printf("%t", value.valeurBoolean)
+		return interpreter.printf("%t", value.valeurBoolean)
 	} else {
 		return fmt.Errorf("value not valid")
 	}
+}
+
+// runtimeType returns the type of the values of a variable: the enumerations are int, as in C.
+func runtimeType(code TypeCode) TypeCode {
+	if code == TYPE_ENUM {
+		return TYPE_INT
+	}
+	return code
+}
+
+// getParameters evaluates the parameters of a call.
+func (interpreter *Interpreter) getParameters(parameter []Expression, symbolTable map[string]Valeur) ([]Valeur, error) {
+	var args []Valeur
+	for i := range parameter {
+		val, err := interpreter.getIntValue(&parameter[i], symbolTable)
+		if err != nil {
+			return nil, fmt.Errorf("error: %w", err)
+		}
+		args = append(args, *val)
+	}
+	return args, nil
+}
+
+// setVariable stores the value in the local variable, or in the global variable if there is no local variable
+// with this name. If the variable doesn't exist, a local variable is created.
+func (interpreter *Interpreter) setVariable(name string, val *Valeur, symbolTable map[string]Valeur, position *Position) error {
+	table := symbolTable
+	if _, ok := symbolTable[name]; !ok {
+		if _, ok := interpreter.globals[name]; ok {
+			table = interpreter.globals
+		}
+	}
+	size := valueSize(val)
+	if old, ok := table[name]; ok {
+		size -= valueSize(&old)
+	}
+	table[name] = *val
+	return interpreter.allocate(size, position)
+}
+
+// declareVariable creates the variable in symbolTable, with the value of the initializer or the zero value of its type.
+func (interpreter *Interpreter) declareVariable(instruction *Instruction, symbolTable map[string]Valeur) (*Valeur, error) {
+	val := &Valeur{valeurtype: Type{code: runtimeType(instruction.VariableType.code)}}
+	if instruction.Valeur != nil {
+		var err error
+		val, err = interpreter.getIntValue(instruction.Valeur, symbolTable)
+		if err != nil {
+			return nil, fmt.Errorf("error: %w", err)
+		} else if val.valeurtype.code != runtimeType(instruction.VariableType.code) {
+			return nil, errorAt(instruction.position, "invalid type for variable %s", instruction.Variable)
+		}
+	}
+	size := valueSize(val)
+	if old, ok := symbolTable[instruction.Variable]; ok {
+		size -= valueSize(&old)
+	}
+	symbolTable[instruction.Variable] = *val
+	return val, interpreter.allocate(size, instruction.position)
+}
+
+func (interpreter *Interpreter) interpreter() (*Result, error) {
+	return interpreter.interpreterContext(context.Background())
+}
+
+// interpreterContext initializes the global variables and executes the main function, stopping when ctx is done
+// or when a limit is exceeded. The result is returned even if the execution fails.
+func (interpreter *Interpreter) interpreterContext(ctx context.Context) (*Result, error) {
+
+	interpreter.reset(ctx)
+	res := &Result{Globals: interpreter.globals}
+	if debugger := interpreter.options.Debugger; debugger != nil {
+		debugger.interpreter, debugger.frames = interpreter, nil
+	}
+	if interpreter.options.VM && interpreter.options.Debugger != nil {
+		res.Err = &RuntimeError{err: fmt.Errorf("the virtual machine cannot be debugged")}
+	} else if interpreter.options.VM {
+		interpreter.runModule(res)
+	} else {
+		interpreter.runProgram(res)
+	}
+	interpreter.stats.Steps = interpreter.steps
+	res.Stats = interpreter.stats
+	res.Stdout = interpreter.stdout.String()
+
+	return res, res.Err
+}
+
+// reset prepares the interpreter for an execution stopping when ctx is done: the output, the global variables
+// and the statistics are emptied.
+func (interpreter *Interpreter) reset(ctx context.Context) {
+	interpreter.stdout.Reset()
+	var stdout io.Writer = &interpreter.stdout
+	if interpreter.options.Stdout != nil {
+		stdout = io.MultiWriter(&interpreter.stdout, interpreter.options.Stdout)
+	}
+	interpreter.ctx = ctx
+	interpreter.out = &limitedWriter{w: stdout, limit: interpreter.options.Limits.MaxOutput}
+	interpreter.globals = make(map[string]Valeur)
+	interpreter.steps = 0
+	interpreter.depth = 0
+	interpreter.memory = 0
+	interpreter.stats = Stats{}
+}
+
+// runProgram initializes the global variables and executes the main function by walking the tree of the program.
+func (interpreter *Interpreter) runProgram(res *Result) {
+	for i := range interpreter.program.Globals {
+		if res.Err = interpreter.initGlobal(&interpreter.program.Globals[i]); res.Err != nil {
+			break
+		}
+	}
+	main, ok := interpreter.functions["main"]
+	if res.Err != nil {
+		// the initialization of the global variables failed
+	} else if !ok {
+		res.Err = &RuntimeError{err: fmt.Errorf("function main not found")}
+	} else if symbolTable, val, err := interpreter.runFunction(main, nil); err != nil {
+		res.Err = &RuntimeError{Function: main.Name, position: main.position, err: err}
+	} else {
+		res.Variables = symbolTable
+		res.Value = val
+		if val != nil && val.valeurtype.code == TYPE_INT {
+			res.ExitCode = val.valeurInt
+		}
+	}
+}
+
+// initGlobal evaluates the initializer of a global variable.
+func (interpreter *Interpreter) initGlobal(instruction *Instruction) error {
+	if err := interpreter.step(instruction.position); err != nil {
+		return &RuntimeError{position: instruction.position, err: err}
+	}
+	val, err := interpreter.declareVariable(instruction, interpreter.globals)
+	if err != nil {
+		return &RuntimeError{position: instruction.position, err: err}
+	}
+	if err := interpreter.printf("%s=", instruction.Variable); err != nil {
+		return &RuntimeError{position: instruction.position, err: err}
+	}
+	if err := interpreter.printValue(val); err != nil {
+		return &RuntimeError{position: instruction.position, err: err}
+	}
+	if err := interpreter.printf("\n"); err != nil {
+		return &RuntimeError{position: instruction.position, err: err}
+	}
 	return nil
 }
 
-func (interpreter *Interpreter) interpreter() ([]map[string]Valeur, error) {
+// runFunction executes the function with the values of the parameters, and returns its variables
+// and the returned value.
+func (interpreter *Interpreter) runFunction(function *Function, args []Valeur) (map[string]Valeur, *Valeur, error) {
+
+	if limit := interpreter.options.Limits.MaxCallDepth; limit > 0 && interpreter.depth >= limit {
+		return nil, nil, &CallDepthError{Limit: limit, Function: function.Name}
+	}
+	if len(args) != len(function.Parameter) {
+		return nil, nil, fmt.Errorf("function %s expects %d parameters, found %d", function.Name,
+			len(function.Parameter), len(args))
+	}
+	interpreter.depth++
+	defer func() { interpreter.depth-- }()
+	if interpreter.depth > interpreter.stats.MaxStackDepth {
+		interpreter.stats.MaxStackDepth = interpreter.depth
+	}
+
+	if err := interpreter.printf("function %s\n", function.Name); err != nil {
+		return nil, nil, err
+	}
+
+	symbolTable := make(map[string]Valeur)
+	defer func() {
+		for _, val := range symbolTable {
+			interpreter.memory -= valueSize(&val)
+		}
+	}()
+	for i, param := range function.Parameter {
+		if args[i].valeurtype.code != runtimeType(param.Type.code) {
+			return nil, nil, fmt.Errorf("invalid type for parameter %s of function %s", param.Name, function.Name)
+		}
+		symbolTable[param.Name] = args[i]
+		if err := interpreter.allocate(valueSize(&args[i]), param.position); err != nil {
+			return nil, nil, err
+		}
+	}
+	if debugger := interpreter.options.Debugger; debugger != nil {
+		defer debugger.leave()
+		if err := debugger.enter(function, symbolTable); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	_, val, err := interpreter.execute(function.Instruction, symbolTable)
+	if err != nil {
+		return nil, nil, err
+	}
+	return symbolTable, val, nil
+}
+
+// flow tells how the execution continues after an instruction.
+type flow int
 
-	var res []map[string]Valeur = nil
-	for _, function := range interpreter.functions {
-		fmt.Printf("function %s\n", function.Name)
+const (
+	FLOW_NEXT flow = iota
+	FLOW_BREAK
+	FLOW_RETURN
+)
 
-		symbolTable := make(map[string]Valeur)
+// execute executes the instructions until the end, a break or a return. The returned value is set for a return.
+func (interpreter *Interpreter) execute(instructions []Instruction, symbolTable map[string]Valeur) (flow, *Valeur, error) {
 
-		for _, instruction := range function.Instruction {
-			if instruction.Code == INSTRUCTION_AFFECTATION {
-				fmt.Printf("%s=", instruction.Variable)
-				val, err := interpreter.getIntValue(instruction.Valeur, symbolTable)
+	for _, instruction := range instructions {
+		if err := interpreter.step(instruction.position); err != nil {
+			return FLOW_NEXT, nil, err
+		} else if debugger := interpreter.options.Debugger; debugger != nil {
+			if err := debugger.instruction(&instruction); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+		}
+		if instruction.Code == INSTRUCTION_AFFECTATION {
+			val, err := interpreter.getIntValue(instruction.Valeur, symbolTable)
+			if err != nil {
+				return FLOW_NEXT, nil, fmt.Errorf("error: %w", err)
+			}
+			if err := interpreter.printf("%s=", instruction.Variable); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if err := interpreter.printValue(val); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if err := interpreter.setVariable(instruction.Variable, val, symbolTable, instruction.position); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+		} else if instruction.Code == INSTRUCTION_DECLARATION {
+			val, err := interpreter.declareVariable(&instruction, symbolTable)
+			if err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if err := interpreter.printf("%s=", instruction.Variable); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if err := interpreter.printValue(val); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+		} else if instruction.Code == INSTRUCTION_CALL {
+			args, err := interpreter.getParameters(instruction.Parameter, symbolTable)
+			if err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if err := interpreter.printf("%s(", instruction.FunctionName); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			for i := range args {
+				if i > 0 {
+					if err := interpreter.printf(","); err != nil {
+						return FLOW_NEXT, nil, err
+					}
+				}
+				if err := interpreter.printValue(&args[i]); err != nil {
+					return FLOW_NEXT, nil, err
+				}
+			}
+			if err := interpreter.printf(")"); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if function, ok := interpreter.functions[instruction.FunctionName]; ok {
+				if err := interpreter.printf("\n"); err != nil {
+					return FLOW_NEXT, nil, err
+				}
+				if _, _, err := interpreter.runFunction(function, args); err != nil {
+					return FLOW_NEXT, nil, err
+				}
+				continue
+			}
+		} else if instruction.Code == INSTRUCTION_EXPRESSION {
+			if _, err := interpreter.getIntValue(instruction.Valeur, symbolTable); err != nil {
+				return FLOW_NEXT, nil, fmt.Errorf("error: %w", err)
+			}
+			name := assignedVariable(instruction.Valeur)
+			if name == "" {
+				continue
+			}
+			val, err := interpreter.getVariable(name, symbolTable)
+			if err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if err := interpreter.printf("%s=", name); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if err := interpreter.printValue(val); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+		} else if instruction.Code == INSTRUCTION_SWITCH {
+			val, err := interpreter.getIntValue(instruction.Valeur, symbolTable)
+			if err != nil {
+				return FLOW_NEXT, nil, fmt.Errorf("error: %w", err)
+			}
+			if err := interpreter.printf("switch "); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if err := interpreter.printValue(val); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if err := interpreter.printf("\n"); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			start, err := interpreter.selectCase(instruction.Case, val, symbolTable)
+			if err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			for i := start; i >= 0 && i < len(instruction.Case); i++ {
+				next, ret, err := interpreter.execute(instruction.Case[i].Instruction, symbolTable)
+				if err != nil || next == FLOW_RETURN {
+					return next, ret, err
+				} else if next == FLOW_BREAK {
+					break
+				}
+			}
+			continue
+		} else if instruction.Code == INSTRUCTION_BREAK {
+			if err := interpreter.printf("break\n"); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			return FLOW_BREAK, nil, nil
+		} else if instruction.Code == INSTRUCTION_RETURN {
+			var val *Valeur
+			if instruction.Valeur != nil {
+				var err error
+				val, err = interpreter.getIntValue(instruction.Valeur, symbolTable)
 				if err != nil {
-					return nil, fmt.Errorf("error: %s", err)
+					return FLOW_NEXT, nil, fmt.Errorf("error: %w", err)
 				}
-				interpreter.printValue(val)
-				symbolTable[instruction.Variable] = *val
-			} else if instruction.Code == INSTRUCTION_CALL {
-				fmt.Printf("%s(", instruction.FunctionName)
-				for i, expr := range instruction.Parameter {
-					val, err := interpreter.getIntValue(&expr, symbolTable)
-					if err != nil {
-						return nil, fmt.Errorf("error: %s", err)
-					}
-					if i > 0 {
-						fmt.Printf(",")
-					}
-					interpreter.printValue(val)
+			}
+			if err := interpreter.printf("return"); err != nil {
+				return FLOW_NEXT, nil, err
+			}
+			if val != nil {
+				if err := interpreter.printf(" "); err != nil {
+					return FLOW_NEXT, nil, err
 				}
-				fmt.Printf(")")
+				if err := interpreter.printValue(val); err != nil {
+					return FLOW_NEXT, nil, err
+				}
+			}
+			if err := interpreter.printf("\n"); err != nil {
+				return FLOW_NEXT, nil, err
 			}
-			fmt.Printf("\n")
+			return FLOW_RETURN, val, nil
+		}
+		if err := interpreter.printf("\n"); err != nil {
+			return FLOW_NEXT, nil, err
 		}
-
-		res = append(res, symbolTable)
 	}
 
+	return FLOW_NEXT, nil, nil
+}
+
+// selectCase returns the index of the case matching the value, or of the default case, or -1.
+func (interpreter *Interpreter) selectCase(cases []Case, val *Valeur, symbolTable map[string]Valeur) (int, error) {
+	if val.valeurtype.code != TYPE_INT {
+		return -1, fmt.Errorf("error: var is not int")
+	}
+	res := -1
+	for i := range cases {
+		if cases[i].Valeur == nil {
+			res = i
+			continue
+		}
+		caseVal, err := interpreter.getIntValue(cases[i].Valeur, symbolTable)
+		if err != nil {
+			return -1, fmt.Errorf("error: %w", err)
+		} else if caseVal.valeurInt == val.valeurInt {
+			return i, nil
+		}
+	}
 	return res, nil
 }
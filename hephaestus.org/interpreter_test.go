@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Ensure the parser can parse strings into Statement ASTs.
@@ -58,23 +62,318 @@ func TestParser_interpreter(t *testing.T) {
 		if funct == nil {
 			t.Errorf("%d. %q: error no program to execute (err:%s)\n", i, tt.s, err)
 		} else {
-			interpreter := NewInterpreter(funct)
-			var symbolTableList []map[string]Valeur
-			symbolTableList, err = interpreter.interpreter()
+			var res *Result
+			res, err = interpret(t, funct, Options{}, context.Background())
 
 			if !reflect.DeepEqual(tt.err, errstring2(err)) {
 				t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
 			} else if err != nil && tt.err == "" {
 				t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
-			} else if symbolTableList == nil && tt.symbolTable != nil {
+			} else if res.Variables == nil && tt.symbolTable != nil {
 				t.Errorf("%d. %q: error no symbol table\n", i, tt.s)
-			} else if tt.err == "" && !reflect.DeepEqual(tt.symbolTable, symbolTableList[0]) {
-				t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.symbolTable, symbolTableList[0])
+			} else if tt.err == "" && !reflect.DeepEqual(tt.symbolTable, res.Variables) {
+				t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.symbolTable, res.Variables)
 			}
 		}
 	}
 }
 
+// Ensure the interpreter returns the value of main, the output and the statistics.
+func TestInterpreter_result(t *testing.T) {
+	var tests = []struct {
+		s        string
+		value    *Valeur
+		exitCode int
+		stdout   string
+		stats    Stats
+		err      string
+	}{
+		{
+			s:      `void main () { x=5;print(x);}`,
+			stdout: "function main\nx=5\nprint(5)\n",
+			stats:  Stats{Steps: 4, MaxStackDepth: 1, Allocations: 1, PeakMemory: 8},
+		},
+		{
+			s:        `int main () { x=5;return x+2;y=3;}`,
+			value:    &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: 7},
+			exitCode: 7,
+			stdout:   "function main\nx=5\nreturn 7\n",
+			stats:    Stats{Steps: 6, MaxStackDepth: 1, Allocations: 1, PeakMemory: 8},
+		},
+		{
+			s:      `void main () { x="abc";return;}`,
+			stdout: "function main\nx=abc\nreturn\n",
+			stats:  Stats{Steps: 3, MaxStackDepth: 1, Allocations: 1, PeakMemory: 19},
+		},
+		// Errors
+		{
+			s:      `int main () { x=5;return y;}`,
+			stdout: "function main\nx=5\n",
+			stats:  Stats{Steps: 4, MaxStackDepth: 1, Allocations: 1, PeakMemory: 8},
+			err:    "error: variable y not declared",
+		},
+		{
+			s:   `void test () { x=5;}`,
+			err: "function main not found",
+		},
+	}
+
+	for i, tt := range tests {
+		funct, err := NewParser(strings.NewReader(tt.s)).Parse2()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.s, err)
+		}
+		res, err := interpret(t, funct, Options{}, context.Background())
+		var runtimeError *RuntimeError
+		if tt.err != errstring2(err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if err != nil && (!errors.As(err, &runtimeError) || res.Err != err) {
+			t.Errorf("%d. %q: error is not a runtime error: %#v", i, tt.s, err)
+		} else if !reflect.DeepEqual(tt.value, res.Value) {
+			t.Errorf("%d. %q: value mismatch:\n  exp=%#v\n  got=%#v\n\n", i, tt.s, tt.value, res.Value)
+		} else if tt.exitCode != res.ExitCode {
+			t.Errorf("%d. %q: exit code mismatch: exp=%d got=%d", i, tt.s, tt.exitCode, res.ExitCode)
+		} else if tt.stdout != res.Stdout {
+			t.Errorf("%d. %q: stdout mismatch:\n  exp=%q\n  got=%q\n\n", i, tt.s, tt.stdout, res.Stdout)
+		} else if tt.stats != res.Stats {
+			t.Errorf("%d. %q: stats mismatch:\n  exp=%+v\n  got=%+v\n\n", i, tt.s, tt.stats, res.Stats)
+		}
+	}
+}
+
+// Ensure the global variables are initialized before main and shared by the functions.
+func TestInterpreter_globals(t *testing.T) {
+	var tests = []struct {
+		s       string
+		globals map[string]Valeur
+		value   *Valeur
+		stdout  string
+		err     string
+	}{
+		{
+			s: `const int N=3; int total=N+2; string name; void main () { total=total+N; }`,
+			globals: map[string]Valeur{
+				"N":     {valeurtype: Type{code: TYPE_INT}, valeurInt: 3},
+				"total": {valeurtype: Type{code: TYPE_INT}, valeurInt: 8},
+				"name":  {valeurtype: Type{code: TYPE_STRING}},
+			},
+			stdout: "N=3\ntotal=5\nname=\nfunction main\ntotal=8\n",
+		},
+		{
+			s: `int count=0; void add(int n) { count=count+n; } int twice(int a) { int b=a+a; return b; } ` +
+				`int main () { add(5); add(twice(3)); return count; }`,
+			globals: map[string]Valeur{
+				"count": {valeurtype: Type{code: TYPE_INT}, valeurInt: 11},
+			},
+			value:  &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: 11},
+			stdout: "count=0\nfunction main\nadd(5)\nfunction add\ncount=5\nfunction twice\nb=6\nreturn 6\nadd(6)\nfunction add\ncount=11\nreturn 11\n",
+		},
+		{
+			s: `int x=1; void main () { int x=2; x=x+1; }`,
+			globals: map[string]Valeur{
+				"x": {valeurtype: Type{code: TYPE_INT}, valeurInt: 1},
+			},
+			stdout: "x=1\nfunction main\nx=2\nx=3\n",
+		},
+		// Errors
+		{
+			s:      `int x=y; void main () { }`,
+			stdout: "",
+			err:    "error: variable y not declared",
+		},
+	}
+
+	for i, tt := range tests {
+		program, err := NewParser(strings.NewReader(tt.s)).Parse2()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.s, err)
+		}
+		res, err := interpret(t, program, Options{}, context.Background())
+		if tt.err != errstring2(err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if err == nil && !reflect.DeepEqual(tt.globals, res.Globals) {
+			t.Errorf("%d. %q: globals mismatch:\n  exp=%#v\n  got=%#v\n\n", i, tt.s, tt.globals, res.Globals)
+		} else if !reflect.DeepEqual(tt.value, res.Value) {
+			t.Errorf("%d. %q: value mismatch:\n  exp=%#v\n  got=%#v\n\n", i, tt.s, tt.value, res.Value)
+		} else if tt.stdout != res.Stdout {
+			t.Errorf("%d. %q: stdout mismatch:\n  exp=%q\n  got=%q\n\n", i, tt.s, tt.stdout, res.Stdout)
+		}
+	}
+}
+
+// Ensure the compound assignments and the increments modify the variables with the C semantics.
+func TestInterpreter_assignment(t *testing.T) {
+	var tests = []struct {
+		s           string
+		symbolTable map[string]Valeur
+		err         string
+	}{
+		{
+			s: `void main () { x=10; x+=5; x-=3; x*=4; x/=5; x%=4; }`,
+			symbolTable: map[string]Valeur{
+				"x": {valeurtype: Type{code: TYPE_INT}, valeurInt: 1},
+			},
+		},
+		{
+			s: `void main () { x=5; y=x++; z=++x; t=x--; u=--x; }`,
+			symbolTable: map[string]Valeur{
+				"x": {valeurtype: Type{code: TYPE_INT}, valeurInt: 5},
+				"y": {valeurtype: Type{code: TYPE_INT}, valeurInt: 5},
+				"z": {valeurtype: Type{code: TYPE_INT}, valeurInt: 7},
+				"t": {valeurtype: Type{code: TYPE_INT}, valeurInt: 7},
+				"u": {valeurtype: Type{code: TYPE_INT}, valeurInt: 5},
+			},
+		},
+		{
+			s: `void main () { a = b = c = 7; a += b *= 2; x = 2 + 3 * 4 - 10 / 3 % 2; y = (2 + 3) * 4; z = 0 - 7 / 2; }`,
+			symbolTable: map[string]Valeur{
+				"a": {valeurtype: Type{code: TYPE_INT}, valeurInt: 21},
+				"b": {valeurtype: Type{code: TYPE_INT}, valeurInt: 14},
+				"c": {valeurtype: Type{code: TYPE_INT}, valeurInt: 7},
+				"x": {valeurtype: Type{code: TYPE_INT}, valeurInt: 13},
+				"y": {valeurtype: Type{code: TYPE_INT}, valeurInt: 20},
+				"z": {valeurtype: Type{code: TYPE_INT}, valeurInt: -3},
+			},
+		},
+		{
+			s: `int count; int next() { return ++count; } void main () { x = next() * 10 + next(); count++; }`,
+			symbolTable: map[string]Valeur{
+				"x": {valeurtype: Type{code: TYPE_INT}, valeurInt: 12},
+			},
+		},
+		{
+			s: `void main () { x = 12 & 10; y = 12 | 10 ^ 3; z = ~0; t = 1 << 62 + 1; u = 0 - 16 >> 2; v = 0 - 16 >> 60; }`,
+			symbolTable: map[string]Valeur{
+				"x": {valeurtype: Type{code: TYPE_INT}, valeurInt: 8},
+				"y": {valeurtype: Type{code: TYPE_INT}, valeurInt: 13},
+				"z": {valeurtype: Type{code: TYPE_INT}, valeurInt: -1},
+				"t": {valeurtype: Type{code: TYPE_INT}, valeurInt: -1 << 63},
+				"u": {valeurtype: Type{code: TYPE_INT}, valeurInt: -4},
+				"v": {valeurtype: Type{code: TYPE_INT}, valeurInt: -1},
+			},
+		},
+		{
+			s: `void main () { flags = 0; flags |= 1 << 3; flags |= 5; flags &= ~1; flags ^= 2; flags <<= 4; m = flags; m >>= 6; }`,
+			symbolTable: map[string]Valeur{
+				"flags": {valeurtype: Type{code: TYPE_INT}, valeurInt: 224},
+				"m":     {valeurtype: Type{code: TYPE_INT}, valeurInt: 3},
+			},
+		},
+		{
+			s: `int calls; boolean check(boolean b) { calls++; return b; }
+				void main () { x = 0; a = false && x++ == 0; b = true || 1 / x == 0; c = check(true) && !check(false);
+				d = check(false) || x != 0; e = x > 0 ? 1 / x : 2; f = !(a || b) ? x-- : ++x; n = calls; }`,
+			symbolTable: map[string]Valeur{
+				"x": {valeurtype: Type{code: TYPE_INT}, valeurInt: 1},
+				"a": {valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: false},
+				"b": {valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: true},
+				"c": {valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: true},
+				"d": {valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: false},
+				"e": {valeurtype: Type{code: TYPE_INT}, valeurInt: 2},
+				"f": {valeurtype: Type{code: TYPE_INT}, valeurInt: 1},
+				"n": {valeurtype: Type{code: TYPE_INT}, valeurInt: 3},
+			},
+		},
+		// Errors
+		{s: `void main () { x = 0; b = true && 1 / x == 0; }`, err: "error: error: error: error: division by zero (pos=&{1 1 36})"},
+		{s: `void main () { x = 1 ? 2 : 3; }`, err: "error: error: var is not boolean (pos=&{1 1 19})"},
+		{s: `void main () { n = 64; x = 1 << n; }`, err: "error: error: shift count 64 out of range (pos=&{1 1 29})"},
+		{s: `void main () { n = 0 - 1; x = 8; x >>= n; }`, err: "error: error: shift count -1 out of range (pos=&{1 1 35})"},
+		{s: `void main () { x=1; y=x/0; }`, err: "error: error: division by zero (pos=&{1 1 23})"},
+		{s: `void main () { x=1; x%=0; }`, err: "error: error: division by zero (pos=&{1 1 21})"},
+		{s: `void main () { y++; }`, err: "error: error: variable y not declared"},
+	}
+
+	for i, tt := range tests {
+		program, err := NewParser(strings.NewReader(tt.s)).Parse2()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.s, err)
+		}
+		res, err := interpret(t, program, Options{}, context.Background())
+		if tt.err != errstring2(err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if err == nil && !reflect.DeepEqual(tt.symbolTable, res.Variables) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.symbolTable, res.Variables)
+		}
+	}
+}
+
+// Ensure the switch jumps to the matching case and falls through until a break, as in C.
+func TestInterpreter_switch(t *testing.T) {
+	var tests = []struct {
+		s     string
+		value int
+	}{
+		{s: `int main () { x=0; switch (2) { case 1: x=x+1; case 2: x=x+10; case 3: x=x+100; break; case 4: x=x+1000; } return x; }`, value: 110},
+		{s: `int main () { x=0; switch (4) { case 1: x=x+1; break; default: x=x+10; case 2: x=x+100; } return x; }`, value: 110},
+		{s: `int main () { x=0; switch (4) { case 1: x=x+1; } return x; }`, value: 0},
+		{s: `enum Color { RED, GREEN = 5, BLUE }; int f(enum Color c) { switch (c) { case RED: return 1; case BLUE: return 2; } return 3; } ` +
+			`int main () { return f(RED)+f(GREEN)+BLUE; }`, value: 10},
+		{s: `enum State { START, RUN, STOP }; enum State state = START; void next() { switch (state) { case START: state = RUN; break; ` +
+			`case RUN: state = STOP; break; default: } } int main () { next(); next(); next(); return state; }`, value: 2},
+	}
+
+	for i, tt := range tests {
+		p := NewParser(strings.NewReader(tt.s))
+		program, err := p.Parse2()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.s, err)
+		} else if err = p.Checker(program); err != nil {
+			t.Fatalf("%d. %q: check error: %s", i, tt.s, err)
+		}
+		res, err := interpret(t, program, Options{}, context.Background())
+		if err != nil {
+			t.Errorf("%d. %q: unexpected error: %s", i, tt.s, err)
+		} else if tt.value != res.ExitCode {
+			t.Errorf("%d. %q: value mismatch: exp=%d got=%d\n%s", i, tt.s, tt.value, res.ExitCode, res.Stdout)
+		}
+	}
+}
+
+// Ensure the interpreter stops when a limit is exceeded or the context is done.
+func TestInterpreter_limits(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel2 := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel2()
+
+	var tests = []struct {
+		s      string
+		ctx    context.Context
+		limits Limits
+		err    interface{}
+	}{
+		{s: `void main () { x=5;y=18;z=x+y;}`, limits: Limits{MaxSteps: 100, MaxCallDepth: 1, MaxMemory: 100, MaxOutput: 100}},
+		{s: `void main () { x=5;y=18;z=x+y;}`, limits: Limits{MaxSteps: 6}, err: new(*StepLimitError)},
+		{s: `int f(int n) { return f(n+1); } int main () { return f(0);}`, limits: Limits{MaxCallDepth: 10}, err: new(*CallDepthError)},
+		{s: `void main () { x="abcdef";y="ghijkl";}`, limits: Limits{MaxMemory: 40}, err: new(*MemoryLimitError)},
+		{s: `void main () { x="abcdef";x="ghijkl";x="mnopqr";}`, limits: Limits{MaxMemory: 40}},
+		{s: `void main () { x=5;print(x,x,x,x);}`, limits: Limits{MaxOutput: 20}, err: new(*OutputLimitError)},
+		{s: `void main () { x=5;}`, ctx: canceled, err: new(*CanceledError)},
+		{s: `void main () { x=5;}`, ctx: expired, err: new(*TimeoutError)},
+	}
+
+	for i, tt := range tests {
+		funct, err := NewParser(strings.NewReader(tt.s)).Parse2()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.s, err)
+		}
+		ctx := tt.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var out bytes.Buffer
+		_, err = interpret(t, funct, Options{Limits: tt.limits, Stdout: &out}, ctx)
+		if tt.err == nil && err != nil {
+			t.Errorf("%d. %q: unexpected error: %s", i, tt.s, err)
+		} else if tt.err != nil && !errors.As(err, tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%T\n  got=%#v\n\n", i, tt.s, tt.err, err)
+		} else if limit := tt.limits.MaxOutput; limit > 0 && int64(out.Len()) > limit {
+			t.Errorf("%d. %q: output of %d bytes exceeds limit %d", i, tt.s, out.Len(), limit)
+		}
+	}
+}
+
 // errstring returns the string representation of an error.
 func errstring2(err error) string {
 	if err != nil {
@@ -0,0 +1,946 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IROp is an operation of the intermediate representation. The instructions are in three-address form: they
+// compute at most one value, from operands which are constants or variables.
+type IROp int
+
+const (
+	IR_COPY    IROp = iota // Dest = Args[0]
+	IR_BINARY              // Dest = Args[0] Operator Args[1], the divisions and the shifts may fail
+	IR_BIT_NOT             // Dest = the complement of Args[0]
+	IR_NOT                 // Dest = the negation of Args[0]
+	IR_LOAD                // Dest = the global variable Args[0]
+	IR_STORE               // store Args[1] in the global variable Args[0]
+	IR_CALL                // Dest = the value returned by Function called with Args, fail if it returns none
+	IR_CHECK               // fail if the variable Args[0] is not set
+	IR_FAIL                // fail with the message Args[0]
+	IR_TRACE               // write the values of Args, the trace of the execution
+	IR_PHI                 // Dest = Args[i] if the block is entered from Preds[i]
+	IR_JUMP                // continue at Succs[0]
+	IR_BRANCH              // continue at Succs[0] if Args[0] is true, at Succs[1] otherwise
+	IR_SWITCH              // continue at Succs[i] if Args[0] is Cases[i], at the last successor otherwise
+	IR_RETURN              // return Args[0], or no value if there is no argument
+)
+
+// irOps are the names of the operations in the textual form.
+var irOps = map[IROp]string{IR_COPY: "copy", IR_BIT_NOT: "bitnot", IR_NOT: "not", IR_LOAD: "load",
+	IR_STORE: "store", IR_CALL: "call", IR_CHECK: "check", IR_FAIL: "fail", IR_TRACE: "trace", IR_PHI: "phi",
+	IR_JUMP: "jump", IR_BRANCH: "branch", IR_SWITCH: "switch", IR_RETURN: "return"}
+
+// irOperators are the names of the binary operations.
+var irOperators = map[ExprCode]string{EXPR_CODE_ADD: "add", EXPR_CODE_SUB: "sub", EXPR_CODE_MUL: "mul",
+	EXPR_CODE_DIV: "div", EXPR_CODE_MOD: "mod", EXPR_CODE_BIT_AND: "and", EXPR_CODE_BIT_OR: "or",
+	EXPR_CODE_BIT_XOR: "xor", EXPR_CODE_SHL: "shl", EXPR_CODE_SHR: "shr",
+	EXPR_CODE_EQU: "eq", EXPR_CODE_NEQ: "ne", EXPR_CODE_LT: "lt", EXPR_CODE_LTE: "le", EXPR_CODE_GT: "gt",
+	EXPR_CODE_GTE: "ge"}
+
+// IRValue is an operand of an instruction: an *IRConst, an *IRVar, an *IRGlobal or IRUndef.
+type IRValue interface {
+	String() string
+}
+
+// IRConst is a constant.
+type IRConst struct {
+	Value Valeur
+}
+
+func (c *IRConst) String() string {
+	switch c.Value.valeurtype.code {
+	case TYPE_STRING:
+		return strconv.Quote(c.Value.valeurString)
+	case TYPE_BOOLEAN:
+		return strconv.FormatBool(c.Value.valeurBoolean)
+	}
+	return strconv.Itoa(c.Value.valeurInt)
+}
+
+func irInt(n int) *IRConst {
+	return &IRConst{Value: Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: n}}
+}
+
+func irString(s string) *IRConst {
+	return &IRConst{Value: Valeur{valeurtype: Type{code: TYPE_STRING}, valeurString: s}}
+}
+
+func irBool(b bool) *IRConst {
+	return &IRConst{Value: Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: b}}
+}
+
+// IRVar is a local variable of a function, or a temporary value computed by the lowering. In SSA form, each
+// assignment of a local variable defines a new version of the variable.
+type IRVar struct {
+	Name    string   // empty for a temporary value
+	Temp    int      // number of the temporary value
+	Version int      // version of the variable, 0 before the construction of the SSA form
+	Code    TypeCode // type of the values
+}
+
+func (v *IRVar) String() string {
+	if v.Name == "" {
+		return fmt.Sprintf("%%%d", v.Temp)
+	} else if v.Version == 0 {
+		return v.Name
+	}
+	return fmt.Sprintf("%s.%d", v.Name, v.Version)
+}
+
+// IRGlobal is a global variable, which is never in SSA form.
+type IRGlobal struct {
+	Name string
+	Code TypeCode
+}
+
+func (g *IRGlobal) String() string {
+	return "@" + g.Name
+}
+
+type irUndef struct{}
+
+func (irUndef) String() string {
+	return "undef"
+}
+
+// IRUndef is the value of a local variable which is not set.
+var IRUndef IRValue = irUndef{}
+
+// IRInstr is an instruction of a basic block.
+type IRInstr struct {
+	Op       IROp
+	Dest     *IRVar // nil if the instruction computes no value, or if its value is not used
+	Args     []IRValue
+	Operator ExprCode // operation of IR_BINARY
+	Function string   // function called by IR_CALL
+	Cases    []int    // values of IR_SWITCH
+	Position *Position
+}
+
+// IRBlock is a basic block: a sequence of instructions ended by a jump, a branch, a switch or a return. The
+// phi instructions are at the beginning of the block.
+type IRBlock struct {
+	Index     int // index in the blocks of the function
+	Instrs    []*IRInstr
+	Preds     []*IRBlock
+	Succs     []*IRBlock
+	Idom      *IRBlock   // immediate dominator, nil for the entry block
+	Dominated []*IRBlock // blocks whose immediate dominator is the block
+}
+
+// IRFunction is a function of the intermediate representation. Its blocks are the nodes of its control-flow
+// graph, the entry block first, in reverse postorder.
+type IRFunction struct {
+	Name    string
+	Params  []*IRVar
+	Result  TypeCode // TYPE_VOID if the function returns no value
+	NoValue bool     // the function declares a type but may return no value
+	Blocks  []*IRBlock
+	temps   int
+}
+
+// IRProgram is a program in the intermediate representation. Init initializes the global variables, before the
+// call of main.
+type IRProgram struct {
+	Globals   []*IRGlobal
+	Init      *IRFunction
+	Functions []*IRFunction
+}
+
+// irInitName is the name of the function initializing the global variables, which is not an identifier.
+const irInitName = "<init>"
+
+// irBuilder lowers the functions of a program to the intermediate representation.
+type irBuilder struct {
+	*nativeProgram
+	function *IRFunction
+	block    *IRBlock // nil after a terminator
+	locals   map[*nativeVariable]*IRVar
+	globals  map[*nativeVariable]*IRGlobal
+	position *Position  // position of the instruction of the source lowered
+	ends     []*IRBlock // blocks ending the enclosing switches
+}
+
+// LowerIR lowers the checked program to the intermediate representation, and computes the control-flow graph
+// and the dominator tree of its functions. The local variables are not in SSA form yet, see BuildSSA. The
+// programs rejected by the native backends, whose variables have no static type, are rejected.
+func LowerIR(program *Program) (*IRProgram, error) {
+	p, err := analyzeProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	b := &irBuilder{nativeProgram: p, globals: make(map[*nativeVariable]*IRGlobal)}
+	res := &IRProgram{}
+	for _, v := range p.globals {
+		b.globals[v] = &IRGlobal{Name: v.Name, Code: v.Code}
+		res.Globals = append(res.Globals, b.globals[v])
+	}
+
+	b.start(&IRFunction{Name: irInitName, Result: TYPE_VOID}, nil)
+	b.instructions(program.Globals)
+	res.Init = b.finish()
+	for i := range program.Functions {
+		function := &program.Functions[i]
+		b.start(&IRFunction{Name: function.Name, Result: runtimeType(function.ReturnType.code),
+			NoValue: p.noValue[function]}, function)
+		b.emit(&IRInstr{Op: IR_TRACE, Args: []IRValue{irString("function " + function.Name + "\n")}})
+		b.instructions(function.Instruction)
+		res.Functions = append(res.Functions, b.finish())
+	}
+	return res, nil
+}
+
+// BuildIR lowers the checked program to the intermediate representation in SSA form.
+func BuildIR(program *Program) (*IRProgram, error) {
+	res, err := LowerIR(program)
+	if err != nil {
+		return nil, err
+	}
+	res.BuildSSA()
+	return res, nil
+}
+
+// start prepares the lowering of a function, nil for the initialization of the global variables.
+func (b *irBuilder) start(f *IRFunction, function *Function) {
+	b.function, b.block, b.position = f, nil, nil
+	b.locals = make(map[*nativeVariable]*IRVar)
+	if function == nil {
+		return
+	}
+	b.position = function.position
+	for i, v := range b.nativeProgram.locals[function] {
+		b.locals[v] = &IRVar{Name: v.Name, Code: v.Code}
+		if i < len(function.Parameter) {
+			f.Params = append(f.Params, b.locals[v])
+		}
+	}
+}
+
+// finish ends the lowering of the function: the end of the function returns no value, and the control-flow
+// graph is computed.
+func (b *irBuilder) finish() *IRFunction {
+	if b.block != nil || len(b.function.Blocks) == 0 {
+		b.terminate(&IRInstr{Op: IR_RETURN})
+	}
+	b.function.computeCFG()
+	return b.function
+}
+
+// newBlock adds a block to the function.
+func (b *irBuilder) newBlock() *IRBlock {
+	block := &IRBlock{Index: len(b.function.Blocks)}
+	b.function.Blocks = append(b.function.Blocks, block)
+	return block
+}
+
+// emit adds the instruction to the current block, located at the instruction of the source if its position
+// is not set. The instructions following a terminator are in a block without predecessors.
+func (b *irBuilder) emit(instr *IRInstr) *IRInstr {
+	if b.block == nil {
+		b.block = b.newBlock()
+	}
+	if instr.Position == nil {
+		instr.Position = b.position
+	}
+	b.block.Instrs = append(b.block.Instrs, instr)
+	return instr
+}
+
+// terminate ends the current block with the instruction continuing at the successors.
+func (b *irBuilder) terminate(instr *IRInstr, succs ...*IRBlock) {
+	b.emit(instr)
+	for _, succ := range succs {
+		b.block.Succs = append(b.block.Succs, succ)
+		succ.Preds = append(succ.Preds, b.block)
+	}
+	b.block = nil
+}
+
+// continueAt starts the block, the current block jumps to it if it is not terminated.
+func (b *irBuilder) continueAt(block *IRBlock) {
+	if b.block != nil {
+		b.terminate(&IRInstr{Op: IR_JUMP}, block)
+	}
+	b.block = block
+}
+
+// temp returns a new temporary value of the type.
+func (b *irBuilder) temp(code TypeCode) *IRVar {
+	b.function.temps++
+	return &IRVar{Temp: b.function.temps, Code: code}
+}
+
+// compute emits the instruction computing a new temporary value of the type.
+func (b *irBuilder) compute(code TypeCode, instr *IRInstr) *IRVar {
+	instr.Dest = b.temp(code)
+	b.emit(instr)
+	return instr.Dest
+}
+
+// read returns the value of the variable, as resolved by the analysis.
+func (b *irBuilder) read(access nativeAccess, name string, position *Position) IRValue {
+	var variable IRValue
+	if v := access.variable; v != nil && v.Global {
+		variable = b.globals[v]
+	} else if v != nil {
+		variable = b.locals[v]
+	} else if access.constant != nil {
+		return irInt(access.constant.Value)
+	} else {
+		b.emit(&IRInstr{Op: IR_FAIL, Args: []IRValue{irString("variable " + name + " not declared")},
+			Position: position})
+		return IRUndef
+	}
+	if access.checked {
+		b.emit(&IRInstr{Op: IR_CHECK, Args: []IRValue{variable}, Position: position})
+	}
+	// the value is copied, as the variable may be assigned before the value is used
+	if global, ok := variable.(*IRGlobal); ok {
+		return b.compute(global.Code, &IRInstr{Op: IR_LOAD, Args: []IRValue{global}})
+	}
+	return b.compute(access.variable.Code, &IRInstr{Op: IR_COPY, Args: []IRValue{variable}})
+}
+
+// assign assigns the value to the variable.
+func (b *irBuilder) assign(v *nativeVariable, value IRValue) {
+	if v.Global {
+		b.emit(&IRInstr{Op: IR_STORE, Args: []IRValue{b.globals[v], value}})
+	} else {
+		b.emit(&IRInstr{Op: IR_COPY, Dest: b.locals[v], Args: []IRValue{value}})
+	}
+}
+
+// binary computes the binary operation on the operands.
+func (b *irBuilder) binary(code ExprCode, left, right IRValue, position *Position) IRValue {
+	typ := TYPE_INT
+	if _, ok := llvmComparisons[code]; ok {
+		typ = TYPE_BOOLEAN
+	}
+	return b.compute(typ, &IRInstr{Op: IR_BINARY, Operator: code, Args: []IRValue{left, right},
+		Position: position})
+}
+
+// expression lowers the expression and returns its value.
+func (b *irBuilder) expression(expr *Expression) IRValue {
+	switch expr.code {
+	case EXPR_CODE_INT:
+		return irInt(expr.valeurInt)
+	case EXPR_CODE_STR:
+		return irString(expr.valeurString)
+	case EXPR_CODE_TRUE, EXPR_CODE_FALSE:
+		return irBool(expr.code == EXPR_CODE_TRUE)
+	case EXPR_CODE_VAR:
+		return b.read(b.reads[expr], expr.variable, expr.position)
+	case EXPR_CODE_CALL:
+		var args []IRValue
+		for i := range expr.parameter {
+			args = append(args, b.expression(&expr.parameter[i]))
+		}
+		callee := b.nativeProgram.functions[expr.functionName]
+		return b.compute(runtimeType(callee.ReturnType.code), &IRInstr{Op: IR_CALL, Function: callee.Name,
+			Args: args, Position: expr.position})
+	case EXPR_CODE_ASSIGN:
+		value := b.expression(expr.right)
+		b.assign(b.writes[expr], value)
+		return value
+	case EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC, EXPR_CODE_POST_DEC:
+		// the variable is read before the right operand is evaluated
+		old := b.read(b.reads[expr], expr.variable, expr.position)
+		operator, right := expr.operator, IRValue(irInt(1))
+		if expr.code == EXPR_CODE_COMPOUND_ASSIGN {
+			right = b.expression(expr.right)
+		} else if expr.code == EXPR_CODE_PRE_INC || expr.code == EXPR_CODE_POST_INC {
+			operator = EXPR_CODE_ADD
+		} else {
+			operator = EXPR_CODE_SUB
+		}
+		value := b.binary(operator, old, right, expr.position)
+		b.assign(b.writes[expr], value)
+		if expr.code == EXPR_CODE_POST_INC || expr.code == EXPR_CODE_POST_DEC {
+			return old
+		}
+		return value
+	case EXPR_CODE_BIT_NOT:
+		return b.compute(TYPE_INT, &IRInstr{Op: IR_BIT_NOT, Args: []IRValue{b.expression(expr.right)}})
+	case EXPR_CODE_NOT:
+		return b.compute(TYPE_BOOLEAN, &IRInstr{Op: IR_NOT, Args: []IRValue{b.expression(expr.right)}})
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		// the right operand is evaluated only if the left operand doesn't decide the result
+		left := b.expression(expr.left)
+		from, right, end := b.block, b.newBlock(), b.newBlock()
+		if expr.code == EXPR_CODE_AND {
+			b.terminate(&IRInstr{Op: IR_BRANCH, Args: []IRValue{left}}, right, end)
+		} else {
+			b.terminate(&IRInstr{Op: IR_BRANCH, Args: []IRValue{left}}, end, right)
+		}
+		b.block = right
+		rightValue := b.expression(expr.right)
+		rightBlock := b.block
+		b.continueAt(end)
+		phi := &IRInstr{Op: IR_PHI, Args: make([]IRValue, 2)}
+		for i, pred := range end.Preds {
+			if pred == from {
+				phi.Args[i] = irBool(expr.code == EXPR_CODE_OR)
+			} else if pred == rightBlock {
+				phi.Args[i] = rightValue
+			}
+		}
+		return b.compute(TYPE_BOOLEAN, phi)
+	case EXPR_CODE_CONDITIONAL:
+		condition := b.expression(expr.condition)
+		then, otherwise, end := b.newBlock(), b.newBlock(), b.newBlock()
+		b.terminate(&IRInstr{Op: IR_BRANCH, Args: []IRValue{condition}}, then, otherwise)
+		b.block = then
+		left := b.expression(expr.left)
+		leftBlock := b.block
+		b.terminate(&IRInstr{Op: IR_JUMP}, end)
+		b.block = otherwise
+		right := b.expression(expr.right)
+		rightBlock := b.block
+		b.continueAt(end)
+		phi := &IRInstr{Op: IR_PHI, Args: make([]IRValue, 2)}
+		for i, pred := range end.Preds {
+			if pred == leftBlock {
+				phi.Args[i] = left
+			} else if pred == rightBlock {
+				phi.Args[i] = right
+			}
+		}
+		return b.compute(b.typeOf(expr), phi)
+	}
+	left := b.expression(expr.left)
+	right := b.expression(expr.right)
+	return b.binary(expr.code, left, right, expr.position)
+}
+
+func (b *irBuilder) instructions(instructions []Instruction) {
+	for i := range instructions {
+		if !b.reached[&instructions[i]] {
+			return
+		}
+		b.position = instructions[i].position
+		b.instruction(&instructions[i])
+	}
+}
+
+// trace writes the values.
+func (b *irBuilder) trace(args ...IRValue) {
+	b.emit(&IRInstr{Op: IR_TRACE, Args: args})
+}
+
+func (b *irBuilder) instruction(instr *Instruction) {
+	switch instr.Code {
+	case INSTRUCTION_AFFECTATION, INSTRUCTION_DECLARATION:
+		v := b.stores[instr]
+		var value IRValue
+		if instr.Valeur != nil {
+			value = b.expression(instr.Valeur)
+		} else {
+			value = irZero(v.Code)
+		}
+		b.assign(v, value)
+		b.trace(irString(instr.Variable+"="), value, irString("\n"))
+	case INSTRUCTION_CALL:
+		var args []IRValue
+		trace := []IRValue{irString(instr.FunctionName + "(")}
+		for i := range instr.Parameter {
+			arg := b.expression(&instr.Parameter[i])
+			if i > 0 {
+				trace = append(trace, irString(","))
+			}
+			args = append(args, arg)
+			trace = append(trace, arg)
+		}
+		b.trace(append(trace, irString(")\n"))...)
+		if _, ok := b.nativeProgram.functions[instr.FunctionName]; ok {
+			b.emit(&IRInstr{Op: IR_CALL, Function: instr.FunctionName, Args: args})
+		}
+	case INSTRUCTION_EXPRESSION:
+		b.expression(instr.Valeur)
+		if name := assignedVariable(instr.Valeur); name != "" {
+			b.trace(irString(name+"="), b.read(b.traces[instr], name, instr.position), irString("\n"))
+		}
+	case INSTRUCTION_SWITCH:
+		b.switchCases(instr)
+	case INSTRUCTION_BREAK:
+		b.trace(irString("break\n"))
+		if len(b.ends) > 0 {
+			b.terminate(&IRInstr{Op: IR_JUMP}, b.ends[len(b.ends)-1])
+		} else {
+			// as the interpreter, a break outside of a switch ends the function
+			b.terminate(&IRInstr{Op: IR_RETURN})
+		}
+	case INSTRUCTION_RETURN:
+		if instr.Valeur == nil {
+			b.trace(irString("return\n"))
+			b.terminate(&IRInstr{Op: IR_RETURN})
+		} else {
+			value := b.expression(instr.Valeur)
+			b.trace(irString("return "), value, irString("\n"))
+			if b.function.Result == TYPE_VOID {
+				b.terminate(&IRInstr{Op: IR_RETURN})
+			} else {
+				b.terminate(&IRInstr{Op: IR_RETURN, Args: []IRValue{value}})
+			}
+		}
+	}
+}
+
+// irZero returns the zero value of the type.
+func irZero(code TypeCode) *IRConst {
+	switch code {
+	case TYPE_STRING:
+		return irString("")
+	case TYPE_BOOLEAN:
+		return irBool(false)
+	}
+	return irInt(0)
+}
+
+// switchCases lowers the switch to a block by case, each continuing with the next one until a break.
+func (b *irBuilder) switchCases(instr *Instruction) {
+	value := b.expression(instr.Valeur)
+	b.trace(irString("switch "), value, irString("\n"))
+
+	blocks := make([]*IRBlock, len(instr.Case))
+	for i := range blocks {
+		blocks[i] = b.newBlock()
+	}
+	end := b.newBlock()
+	var cases []int
+	var succs []*IRBlock
+	otherwise := end
+	seen := make(map[int]bool)
+	for i := range instr.Case {
+		caseSwitch := &instr.Case[i]
+		if caseSwitch.Valeur == nil {
+			otherwise = blocks[i]
+			continue
+		}
+		n := caseSwitch.Valeur.valeurInt
+		if caseSwitch.Valeur.code != EXPR_CODE_INT {
+			n = b.nativeProgram.constants[caseSwitch.Valeur.variable].Value
+		}
+		// the cases of a value already seen are reached only from the previous case
+		if !seen[n] {
+			seen[n] = true
+			cases = append(cases, n)
+			succs = append(succs, blocks[i])
+		}
+	}
+	b.terminate(&IRInstr{Op: IR_SWITCH, Args: []IRValue{value}, Cases: cases}, append(succs, otherwise)...)
+
+	b.ends = append(b.ends, end)
+	for i := range instr.Case {
+		b.continueAt(blocks[i])
+		b.instructions(instr.Case[i].Instruction)
+	}
+	b.continueAt(end)
+	b.ends = b.ends[:len(b.ends)-1]
+	if len(end.Preds) == 0 {
+		// every case returns
+		b.block = nil
+	}
+}
+
+// computeCFG removes the blocks which are not reached from the entry block, orders the blocks in reverse
+// postorder, and computes the dominator tree.
+func (f *IRFunction) computeCFG() {
+	var postorder []*IRBlock
+	visited := make(map[*IRBlock]bool)
+	var visit func(block *IRBlock)
+	visit = func(block *IRBlock) {
+		visited[block] = true
+		for _, succ := range block.Succs {
+			if !visited[succ] {
+				visit(succ)
+			}
+		}
+		postorder = append(postorder, block)
+	}
+	visit(f.Blocks[0])
+
+	f.Blocks = f.Blocks[:0]
+	for i := len(postorder) - 1; i >= 0; i-- {
+		block := postorder[i]
+		block.Index = len(f.Blocks)
+		f.Blocks = append(f.Blocks, block)
+		for j := len(block.Preds) - 1; j >= 0; j-- {
+			if !visited[block.Preds[j]] {
+				block.removePred(j)
+			}
+		}
+	}
+	f.computeDominators()
+}
+
+// removePred removes the predecessor i of the block, and its value in the phi instructions.
+func (block *IRBlock) removePred(i int) {
+	block.Preds = append(block.Preds[:i:i], block.Preds[i+1:]...)
+	for _, instr := range block.Instrs {
+		if instr.Op == IR_PHI {
+			instr.Args = append(instr.Args[:i:i], instr.Args[i+1:]...)
+		}
+	}
+}
+
+// computeDominators computes the immediate dominator of the blocks, with the algorithm of Cooper, Harvey and
+// Kennedy, on the blocks ordered in reverse postorder.
+func (f *IRFunction) computeDominators() {
+	idom := make([]*IRBlock, len(f.Blocks))
+	entry := f.Blocks[0]
+	idom[0] = entry
+	intersect := func(b1, b2 *IRBlock) *IRBlock {
+		for b1 != b2 {
+			for b1.Index > b2.Index {
+				b1 = idom[b1.Index]
+			}
+			for b2.Index > b1.Index {
+				b2 = idom[b2.Index]
+			}
+		}
+		return b1
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, block := range f.Blocks[1:] {
+			var dom *IRBlock
+			for _, pred := range block.Preds {
+				if idom[pred.Index] == nil {
+					continue
+				} else if dom == nil {
+					dom = pred
+				} else {
+					dom = intersect(pred, dom)
+				}
+			}
+			if idom[block.Index] != dom {
+				idom[block.Index], changed = dom, true
+			}
+		}
+	}
+	for _, block := range f.Blocks {
+		block.Idom, block.Dominated = nil, nil
+	}
+	for _, block := range f.Blocks[1:] {
+		block.Idom = idom[block.Index]
+		block.Idom.Dominated = append(block.Idom.Dominated, block)
+	}
+}
+
+// Dominates returns true if every path from the entry block to the block b goes through the block a.
+func (a *IRBlock) Dominates(b *IRBlock) bool {
+	for ; b != nil; b = b.Idom {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+// DominanceFrontiers returns the dominance frontier of each block: the blocks which have a predecessor dominated
+// by the block, without being strictly dominated by it.
+func (f *IRFunction) DominanceFrontiers() map[*IRBlock][]*IRBlock {
+	frontiers := make(map[*IRBlock][]*IRBlock)
+	for _, block := range f.Blocks {
+		if len(block.Preds) < 2 {
+			continue
+		}
+		for _, pred := range block.Preds {
+			for runner := pred; runner != block.Idom; runner = runner.Idom {
+				if n := len(frontiers[runner]); n == 0 || frontiers[runner][n-1] != block {
+					frontiers[runner] = append(frontiers[runner], block)
+				}
+			}
+		}
+	}
+	return frontiers
+}
+
+// BuildSSA converts the functions of the program to SSA form.
+func (p *IRProgram) BuildSSA() {
+	p.Init.BuildSSA()
+	for _, f := range p.Functions {
+		f.BuildSSA()
+	}
+}
+
+// BuildSSA converts the function to SSA form: the phi instructions of the local variables are inserted at
+// the dominance frontiers of their assignments, and the variables are renamed along the dominator tree.
+// The copies of the variables to temporary values are then propagated, and the phi instructions whose value
+// is not used are removed.
+func (f *IRFunction) BuildSSA() {
+	// the blocks assigning each variable
+	assigned := make(map[string][]*IRBlock)
+	variables := make(map[string]*IRVar)
+	for _, param := range f.Params {
+		assigned[param.Name] = append(assigned[param.Name], f.Blocks[0])
+		variables[param.Name] = param
+	}
+	for _, block := range f.Blocks {
+		for _, instr := range block.Instrs {
+			if v := instr.Dest; v != nil && v.Name != "" {
+				if blocks := assigned[v.Name]; len(blocks) == 0 || blocks[len(blocks)-1] != block {
+					assigned[v.Name] = append(blocks, block)
+				}
+				variables[v.Name] = v
+			}
+		}
+	}
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	frontiers := f.DominanceFrontiers()
+	for _, name := range names {
+		work := append([]*IRBlock(nil), assigned[name]...)
+		inserted := make(map[*IRBlock]bool)
+		queued := make(map[*IRBlock]bool)
+		for _, block := range work {
+			queued[block] = true
+		}
+		for len(work) > 0 {
+			block := work[len(work)-1]
+			work = work[:len(work)-1]
+			for _, frontier := range frontiers[block] {
+				if inserted[frontier] {
+					continue
+				}
+				inserted[frontier] = true
+				frontier.insertPhi(&IRInstr{Op: IR_PHI, Dest: variables[name], Args: make([]IRValue, len(frontier.Preds))})
+				if !queued[frontier] {
+					queued[frontier] = true
+					work = append(work, frontier)
+				}
+			}
+		}
+	}
+
+	f.rename()
+	f.propagateCopies()
+	f.removeDeadPhis()
+}
+
+// insertPhi inserts the phi instruction after the phi instructions of the block.
+func (block *IRBlock) insertPhi(phi *IRInstr) {
+	i := 0
+	for i < len(block.Instrs) && block.Instrs[i].Op == IR_PHI {
+		i++
+	}
+	block.Instrs = append(block.Instrs[:i], append([]*IRInstr{phi}, block.Instrs[i:]...)...)
+}
+
+// rename defines a version of the variable at each assignment, and replaces each use of a variable by the
+// version reaching it.
+func (f *IRFunction) rename() {
+	stacks := make(map[string][]*IRVar)
+	versions := make(map[string]int)
+	define := func(v *IRVar) *IRVar {
+		versions[v.Name]++
+		res := &IRVar{Name: v.Name, Version: versions[v.Name], Code: v.Code}
+		stacks[v.Name] = append(stacks[v.Name], res)
+		return res
+	}
+	current := func(name string) IRValue {
+		if stack := stacks[name]; len(stack) > 0 {
+			return stack[len(stack)-1]
+		}
+		return IRUndef
+	}
+	for i, param := range f.Params {
+		f.Params[i] = define(param)
+	}
+
+	var visit func(block *IRBlock)
+	visit = func(block *IRBlock) {
+		var defined []string
+		for _, instr := range block.Instrs {
+			if instr.Op != IR_PHI {
+				for i, arg := range instr.Args {
+					if v, ok := arg.(*IRVar); ok && v.Name != "" && v.Version == 0 {
+						instr.Args[i] = current(v.Name)
+					}
+				}
+			}
+			if v := instr.Dest; v != nil && v.Name != "" && v.Version == 0 {
+				instr.Dest = define(v)
+				defined = append(defined, v.Name)
+			}
+		}
+		for _, succ := range block.Succs {
+			i := 0
+			for succ.Preds[i] != block {
+				i++
+			}
+			for _, instr := range succ.Instrs {
+				if instr.Op != IR_PHI {
+					break
+				} else if instr.Dest.Name != "" {
+					instr.Args[i] = current(instr.Dest.Name)
+				}
+			}
+		}
+		for _, dominated := range block.Dominated {
+			visit(dominated)
+		}
+		for _, name := range defined {
+			stacks[name] = stacks[name][:len(stacks[name])-1]
+		}
+	}
+	visit(f.Blocks[0])
+}
+
+// propagateCopies replaces the temporary values which are copies by the values copied.
+func (f *IRFunction) propagateCopies() {
+	copies := make(map[*IRVar]IRValue)
+	for _, block := range f.Blocks {
+		instrs := block.Instrs[:0]
+		for _, instr := range block.Instrs {
+			if instr.Op == IR_COPY && instr.Dest.Name == "" {
+				copies[instr.Dest] = instr.Args[0]
+			} else {
+				instrs = append(instrs, instr)
+			}
+		}
+		block.Instrs = instrs
+	}
+	f.replaceArgs(func(value IRValue) IRValue {
+		for {
+			v, ok := value.(*IRVar)
+			if !ok || copies[v] == nil {
+				return value
+			}
+			value = copies[v]
+		}
+	})
+}
+
+// replaceArgs replaces the operands of the instructions.
+func (f *IRFunction) replaceArgs(replace func(value IRValue) IRValue) {
+	for _, block := range f.Blocks {
+		for _, instr := range block.Instrs {
+			for i, arg := range instr.Args {
+				instr.Args[i] = replace(arg)
+			}
+		}
+	}
+}
+
+// removeDeadPhis removes the phi instructions whose value is not used.
+func (f *IRFunction) removeDeadPhis() {
+	uses := make(map[*IRVar]int)
+	for _, block := range f.Blocks {
+		for _, instr := range block.Instrs {
+			for _, arg := range instr.Args {
+				if v, ok := arg.(*IRVar); ok {
+					uses[v]++
+				}
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, block := range f.Blocks {
+			instrs := block.Instrs[:0]
+			for _, instr := range block.Instrs {
+				if instr.Op != IR_PHI || uses[instr.Dest] > 0 {
+					instrs = append(instrs, instr)
+					continue
+				}
+				changed = true
+				for _, arg := range instr.Args {
+					if v, ok := arg.(*IRVar); ok {
+						uses[v]--
+					}
+				}
+			}
+			block.Instrs = instrs
+		}
+	}
+}
+
+// WriteIR writes the textual form of the program.
+func WriteIR(w io.Writer, program *IRProgram) error {
+	var buf bytes.Buffer
+	for _, global := range program.Globals {
+		fmt.Fprintf(&buf, "global %s %s\n", global, typeName(&Type{code: global.Code}))
+	}
+	for _, f := range append([]*IRFunction{program.Init}, program.Functions...) {
+		if buf.Len() > 0 {
+			fmt.Fprintf(&buf, "\n")
+		}
+		writeIRFunction(&buf, f)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeIRFunction(buf *bytes.Buffer, f *IRFunction) {
+	var params []string
+	for _, param := range f.Params {
+		params = append(params, fmt.Sprintf("%s %s", param, typeName(&Type{code: param.Code})))
+	}
+	fmt.Fprintf(buf, "function %s(%s)", f.Name, strings.Join(params, ", "))
+	if f.Result != TYPE_VOID {
+		fmt.Fprintf(buf, " %s", typeName(&Type{code: f.Result}))
+	}
+	fmt.Fprintf(buf, "\n")
+	for _, block := range f.Blocks {
+		fmt.Fprintf(buf, "b%d:", block.Index)
+		if len(block.Preds) > 0 {
+			var preds []string
+			for _, pred := range block.Preds {
+				preds = append(preds, fmt.Sprintf("b%d", pred.Index))
+			}
+			fmt.Fprintf(buf, " ; preds %s, idom b%d", strings.Join(preds, " "), block.Idom.Index)
+		}
+		fmt.Fprintf(buf, "\n")
+		for _, instr := range block.Instrs {
+			fmt.Fprintf(buf, "  %s\n", block.format(instr))
+		}
+	}
+}
+
+// format returns the textual form of the instruction of the block.
+func (block *IRBlock) format(instr *IRInstr) string {
+	var args []string
+	for i, arg := range instr.Args {
+		if instr.Op == IR_PHI {
+			args = append(args, fmt.Sprintf("[%s, b%d]", arg, block.Preds[i].Index))
+		} else {
+			args = append(args, arg.String())
+		}
+	}
+	var s string
+	switch instr.Op {
+	case IR_BINARY:
+		s = irOperators[instr.Operator] + " " + strings.Join(args, ", ")
+	case IR_CALL:
+		s = fmt.Sprintf("call %s(%s)", instr.Function, strings.Join(args, ", "))
+	case IR_JUMP:
+		s = fmt.Sprintf("jump b%d", block.Succs[0].Index)
+	case IR_BRANCH:
+		s = fmt.Sprintf("branch %s, b%d, b%d", args[0], block.Succs[0].Index, block.Succs[1].Index)
+	case IR_SWITCH:
+		var cases []string
+		for i, n := range instr.Cases {
+			cases = append(cases, fmt.Sprintf("%d: b%d", n, block.Succs[i].Index))
+		}
+		s = fmt.Sprintf("switch %s [%s], default b%d", args[0], strings.Join(cases, ", "),
+			block.Succs[len(block.Succs)-1].Index)
+	default:
+		s = strings.TrimSpace(irOps[instr.Op] + " " + strings.Join(args, ", "))
+	}
+	if instr.Dest != nil {
+		return instr.Dest.String() + " = " + s
+	}
+	return s
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// buildIR parses the program and lowers it to the intermediate representation, in SSA form if ssa is true.
+func buildIR(t *testing.T, source string, ssa bool) *IRProgram {
+	t.Helper()
+	program, err := parse(strings.NewReader(source), io.Discard)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	res, err := LowerIR(program)
+	if err != nil {
+		t.Fatalf("lowering error: %s", err)
+	}
+	if ssa {
+		res.BuildSSA()
+	}
+	return res
+}
+
+// irFunction returns the function of the program.
+func irFunction(t *testing.T, program *IRProgram, name string) *IRFunction {
+	t.Helper()
+	for _, f := range program.Functions {
+		if f.Name == name {
+			return f
+		}
+	}
+	t.Fatalf("function %s not found", name)
+	return nil
+}
+
+const irSign = `int sign(int n) {
+  int s = 0;
+  switch (n > 0 ? 1 : 0) {
+    case 1: s = 1; break;
+    default: s = 0 - 1;
+  }
+  return s;
+}
+int main() { return sign(3); }`
+
+// Ensure the textual form of the intermediate representation is the expected one, with and without SSA form.
+func TestWriteIR(t *testing.T) {
+	for _, tt := range []struct {
+		source string
+		ssa    bool
+		exp    string
+	}{
+		{source: `int total = 1; void add(int n) { total += n; } int main() { add(2); return total; }`, exp: `global @total int
+
+function <init>()
+b0:
+  store @total, 1
+  trace "total=", 1, "\n"
+  return
+
+function add(n int)
+b0:
+  trace "function add\n"
+  %1 = load @total
+  %2 = copy n
+  %3 = add %1, %2
+  store @total, %3
+  %4 = load @total
+  trace "total=", %4, "\n"
+  return
+
+function main() int
+b0:
+  trace "function main\n"
+  trace "add(", 2, ")\n"
+  call add(2)
+  %1 = load @total
+  trace "return ", %1, "\n"
+  return %1
+`},
+		{source: irSign, ssa: true, exp: `function <init>()
+b0:
+  return
+
+function sign(n.1 int) int
+b0:
+  trace "function sign\n"
+  s.1 = copy 0
+  trace "s=", 0, "\n"
+  %2 = gt n.1, 0
+  branch %2, b2, b1
+b1: ; preds b0, idom b0
+  jump b3
+b2: ; preds b0, idom b0
+  jump b3
+b3: ; preds b2 b1, idom b0
+  %3 = phi [1, b2], [0, b1]
+  trace "switch ", %3, "\n"
+  switch %3 [1: b5], default b4
+b4: ; preds b3, idom b3
+  %4 = sub 0, 1
+  s.2 = copy %4
+  trace "s=", %4, "\n"
+  jump b6
+b5: ; preds b3, idom b3
+  s.3 = copy 1
+  trace "s=", 1, "\n"
+  trace "break\n"
+  jump b6
+b6: ; preds b5 b4, idom b3
+  s.4 = phi [s.3, b5], [s.2, b4]
+  trace "return ", s.4, "\n"
+  return s.4
+
+function main() int
+b0:
+  trace "function main\n"
+  %1 = call sign(3)
+  trace "return ", %1, "\n"
+  return %1
+`},
+	} {
+		var buf bytes.Buffer
+		if err := WriteIR(&buf, buildIR(t, tt.source, tt.ssa)); err != nil {
+			t.Fatal(err)
+		} else if buf.String() != tt.exp {
+			t.Errorf("%s: unexpected IR:\n%s", tt.source, buf.String())
+		}
+	}
+}
+
+// Ensure the blocks which are not reached are removed, and the dominator tree and the dominance frontiers are
+// computed.
+func TestIRFunction_dominators(t *testing.T) {
+	f := irFunction(t, buildIR(t, irSign, false), "sign")
+	b := f.Blocks
+	if len(b) != 7 {
+		t.Fatalf("unexpected number of blocks: %d", len(b))
+	}
+	for i, exp := range []int{-1, 0, 0, 0, 3, 3, 3} {
+		if i == 0 {
+			if b[i].Idom != nil {
+				t.Errorf("unexpected immediate dominator of the entry block: b%d", b[i].Idom.Index)
+			}
+		} else if b[i].Idom != b[exp] {
+			t.Errorf("unexpected immediate dominator of b%d: b%d", i, b[i].Idom.Index)
+		}
+	}
+	if !b[3].Dominates(b[6]) || !b[0].Dominates(b[5]) || b[4].Dominates(b[6]) || b[1].Dominates(b[3]) {
+		t.Error("unexpected dominance")
+	}
+
+	frontiers := f.DominanceFrontiers()
+	for i, exp := range []string{"", "b3", "b3", "", "b6", "b6", ""} {
+		var s []string
+		for _, block := range frontiers[b[i]] {
+			s = append(s, fmt.Sprintf("b%d", block.Index))
+		}
+		if strings.Join(s, " ") != exp {
+			t.Errorf("unexpected dominance frontier of b%d: %v", i, s)
+		}
+	}
+
+	// the code following the return of every case is removed
+	f = irFunction(t, buildIR(t, `int f(int n) { switch (n) { case 0: return 1; default: return 2; } }
+		int main() { return f(0); }`, false), "f")
+	for _, block := range f.Blocks[1:] {
+		if len(block.Preds) == 0 {
+			t.Errorf("b%d is not reached", block.Index)
+		}
+	}
+}
+
+// Ensure the programs lowered to SSA form assign each variable once, before its uses, and that each phi
+// instruction has a value by predecessor.
+func TestBuildIR_ssa(t *testing.T) {
+	for _, source := range append(nativeTests[:len(nativeTests):len(nativeTests)], irSign) {
+		program := buildIR(t, source, true)
+		for _, f := range append([]*IRFunction{program.Init}, program.Functions...) {
+			defs := make(map[*IRVar]*IRBlock)
+			params := make(map[*IRVar]bool)
+			for _, param := range f.Params {
+				defs[param], params[param] = f.Blocks[0], true
+			}
+			for _, block := range f.Blocks {
+				for _, instr := range block.Instrs {
+					if instr.Dest == nil {
+						continue
+					} else if defs[instr.Dest] != nil {
+						t.Errorf("%s: %s: %s assigned twice", source, f.Name, instr.Dest)
+					} else if instr.Dest.Name != "" && instr.Dest.Version == 0 {
+						t.Errorf("%s: %s: %s not renamed", source, f.Name, instr.Dest)
+					}
+					defs[instr.Dest] = block
+				}
+			}
+			for _, block := range f.Blocks {
+				for i, instr := range block.Instrs {
+					if instr.Op == IR_PHI && len(instr.Args) != len(block.Preds) {
+						t.Errorf("%s: %s: %s has %d values for %d predecessors", source, f.Name,
+							block.format(instr), len(instr.Args), len(block.Preds))
+						continue
+					}
+					for j, arg := range instr.Args {
+						v, ok := arg.(*IRVar)
+						if !ok {
+							continue
+						}
+						def := defs[v]
+						use := block
+						if instr.Op == IR_PHI {
+							use = block.Preds[j]
+						}
+						if def == nil || !def.Dominates(use) || def == block && instr.Op != IR_PHI &&
+							!params[v] && !definedBefore(block, v, i) {
+							t.Errorf("%s: %s: %s used by %s before it is assigned", source, f.Name, v,
+								block.format(instr))
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// definedBefore returns true if the value is assigned by an instruction of the block before the instruction i.
+func definedBefore(block *IRBlock, v *IRVar, i int) bool {
+	for _, instr := range block.Instrs[:i] {
+		if instr.Dest == v {
+			return true
+		}
+	}
+	return false
+}
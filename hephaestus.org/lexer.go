@@ -3,8 +3,10 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 )
 
 type Position struct {
@@ -13,6 +15,40 @@ type Position struct {
 	pos    int
 }
 
+// PositionError is an error at a position of the source, reported by the parser, the checker or the interpreter.
+type PositionError struct {
+	Pos *Position
+	Msg string
+	Err error // error wrapped in the message, with a more precise position
+}
+
+func (e *PositionError) Error() string {
+	return fmt.Sprintf("%s (pos=%v)", e.Msg, e.Pos)
+}
+
+func (e *PositionError) Unwrap() error { return e.Err }
+
+// errorAt returns a PositionError at the position with the message formatted as fmt.Errorf, wrapping the error
+// of its verb %w.
+func errorAt(pos *Position, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	return &PositionError{Pos: pos, Msg: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// errorMessage returns the message of the error without the positions of the PositionErrors it wraps, and the
+// position of the innermost one, nil if there is none.
+func errorMessage(err error) (string, *Position) {
+	message := err.Error()
+	var position *Position
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if positionErr, ok := e.(*PositionError); ok {
+			message = strings.Replace(message, fmt.Sprintf(" (pos=%v)", positionErr.Pos), "", 1)
+			position = positionErr.Pos
+		}
+	}
+	return message, position
+}
+
 type ScannerRes struct {
 	tok      Token
 	lit      string
@@ -83,7 +119,31 @@ func (s *Scanner) Scan() (ScannerRes, error) {
 	case eof:
 		return s.newScannerRes(EOF, "", pos), nil
 	case '*':
-		return s.newScannerRes(ASTERISK, string(ch), pos), nil
+		ch := s.read()
+		if ch == '=' {
+			return s.newScannerRes(MUL_EQUALS, "*=", pos), nil
+		} else {
+			err := s.unread()
+			return s.newScannerRes(ASTERISK, "*", pos), err
+		}
+	case '/':
+		ch := s.read()
+		if ch == '=' {
+			return s.newScannerRes(DIV_EQUALS, "/=", pos), nil
+		} else if ch == '/' || ch == '*' {
+			return s.scanComment(ch, pos)
+		} else {
+			err := s.unread()
+			return s.newScannerRes(SLASH, "/", pos), err
+		}
+	case '%':
+		ch := s.read()
+		if ch == '=' {
+			return s.newScannerRes(MOD_EQUALS, "%=", pos), nil
+		} else {
+			err := s.unread()
+			return s.newScannerRes(PERCENT, "%", pos), err
+		}
 	case ',':
 		return s.newScannerRes(COMMA, string(ch), pos), nil
 	case '(':
@@ -104,14 +164,38 @@ func (s *Scanner) Scan() (ScannerRes, error) {
 		}
 	case ';':
 		return s.newScannerRes(SEMICOLON, string(ch), pos), nil
+	case ':':
+		return s.newScannerRes(COLON, string(ch), pos), nil
 	case '+':
-		return s.newScannerRes(ADD, string(ch), pos), nil
+		ch := s.read()
+		if ch == '+' {
+			return s.newScannerRes(INCREMENT, "++", pos), nil
+		} else if ch == '=' {
+			return s.newScannerRes(ADD_EQUALS, "+=", pos), nil
+		} else {
+			err := s.unread()
+			return s.newScannerRes(ADD, "+", pos), err
+		}
 	case '-':
-		return s.newScannerRes(SUB, string(ch), pos), nil
+		ch := s.read()
+		if ch == '-' {
+			return s.newScannerRes(DECREMENT, "--", pos), nil
+		} else if ch == '=' {
+			return s.newScannerRes(SUB_EQUALS, "-=", pos), nil
+		} else {
+			err := s.unread()
+			return s.newScannerRes(SUB, "-", pos), err
+		}
 	case '<':
 		ch := s.read()
 		if ch == '=' {
 			return s.newScannerRes(LESSER_OR_EQUALS, "<=", pos), nil
+		} else if ch == '<' {
+			if ch := s.read(); ch == '=' {
+				return s.newScannerRes(SHL_EQUALS, "<<=", pos), nil
+			}
+			err := s.unread()
+			return s.newScannerRes(SHIFT_LEFT, "<<", pos), err
 		} else {
 			err := s.unread()
 			return s.newScannerRes(LESSER, "<", pos), err
@@ -120,10 +204,56 @@ func (s *Scanner) Scan() (ScannerRes, error) {
 		ch := s.read()
 		if ch == '=' {
 			return s.newScannerRes(GREATER_OR_EQUALS, ">=", pos), nil
+		} else if ch == '>' {
+			if ch := s.read(); ch == '=' {
+				return s.newScannerRes(SHR_EQUALS, ">>=", pos), nil
+			}
+			err := s.unread()
+			return s.newScannerRes(SHIFT_RIGHT, ">>", pos), err
 		} else {
 			err := s.unread()
 			return s.newScannerRes(GREATER, ">", pos), err
 		}
+	case '&':
+		ch := s.read()
+		if ch == '=' {
+			return s.newScannerRes(AND_EQUALS, "&=", pos), nil
+		} else if ch == '&' {
+			return s.newScannerRes(LOGICAL_AND, "&&", pos), nil
+		} else {
+			err := s.unread()
+			return s.newScannerRes(AMPERSAND, "&", pos), err
+		}
+	case '|':
+		ch := s.read()
+		if ch == '=' {
+			return s.newScannerRes(OR_EQUALS, "|=", pos), nil
+		} else if ch == '|' {
+			return s.newScannerRes(LOGICAL_OR, "||", pos), nil
+		} else {
+			err := s.unread()
+			return s.newScannerRes(PIPE, "|", pos), err
+		}
+	case '^':
+		ch := s.read()
+		if ch == '=' {
+			return s.newScannerRes(XOR_EQUALS, "^=", pos), nil
+		} else {
+			err := s.unread()
+			return s.newScannerRes(CARET, "^", pos), err
+		}
+	case '~':
+		return s.newScannerRes(TILDE, string(ch), pos), nil
+	case '!':
+		ch := s.read()
+		if ch == '=' {
+			return s.newScannerRes(NOT_EQUALS, "!=", pos), nil
+		} else {
+			err := s.unread()
+			return s.newScannerRes(NOT, "!", pos), err
+		}
+	case '?':
+		return s.newScannerRes(QUESTION_MARK, string(ch), pos), nil
 	}
 
 	return s.newScannerRes(ILLEGAL, string(ch), pos), nil
@@ -155,6 +285,33 @@ func (s *Scanner) scanWhitespace() (ScannerRes, error) {
 	return s.newScannerRes(WS, buf.String(), pos), nil
 }
 
+// scanComment consumes a comment after its first two runes: until the end of the line, which is not consumed, for
+// a comment starting with //, or until */ for a comment starting with /*.
+func (s *Scanner) scanComment(kind rune, pos Position) (ScannerRes, error) {
+	var buf bytes.Buffer
+	buf.WriteRune('/')
+	buf.WriteRune(kind)
+	for {
+		ch := s.read()
+		if ch == eof {
+			if kind == '*' {
+				return ScannerRes{}, errorAt(&pos, "comment not terminated")
+			}
+			break
+		} else if ch == '\n' && kind == '/' {
+			if err := s.unread(); err != nil {
+				return ScannerRes{}, err
+			}
+			break
+		}
+		buf.WriteRune(ch)
+		if kind == '*' && ch == '/' && buf.Len() > 3 && bytes.HasSuffix(buf.Bytes(), []byte("*/")) {
+			break
+		}
+	}
+	return s.newScannerRes(COMMENT, buf.String(), pos), nil
+}
+
 // scanIdent consumes the current rune and all contiguous ident runes.
 func (s *Scanner) scanIdent() (ScannerRes, error) {
 	// Create a buffer and read the current character into it.
@@ -191,6 +348,20 @@ func (s *Scanner) scanIdent() (ScannerRes, error) {
 		return s.newScannerRes(TRUE, buf.String(), pos), nil
 	case "false":
 		return s.newScannerRes(FALSE, buf.String(), pos), nil
+	case "return":
+		return s.newScannerRes(RETURN, buf.String(), pos), nil
+	case "const":
+		return s.newScannerRes(CONST, buf.String(), pos), nil
+	case "enum":
+		return s.newScannerRes(ENUM, buf.String(), pos), nil
+	case "switch":
+		return s.newScannerRes(SWITCH, buf.String(), pos), nil
+	case "case":
+		return s.newScannerRes(CASE, buf.String(), pos), nil
+	case "default":
+		return s.newScannerRes(DEFAULT, buf.String(), pos), nil
+	case "break":
+		return s.newScannerRes(BREAK, buf.String(), pos), nil
 	}
 
 	// Otherwise return as a regular identifier.
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"io"
 	"strings"
 	"testing"
 )
@@ -18,17 +20,61 @@ func TestScanner_Scan(t *testing.T) {
 		{s: ` `, tok: WS, lit: " "},
 		{s: "\t", tok: WS, lit: "\t"},
 		{s: "\n", tok: WS, lit: "\n"},
+		{s: "// a */ b\nc", tok: COMMENT, lit: "// a */ b"},
+		{s: "/* a\n * b */c", tok: COMMENT, lit: "/* a\n * b */"},
+		{s: "/**/", tok: COMMENT, lit: "/**/"},
 
 		// Misc characters
 		{s: `*`, tok: ASTERISK, lit: "*"},
+		{s: `/`, tok: SLASH, lit: "/"},
+		{s: `%`, tok: PERCENT, lit: "%"},
+		{s: `:`, tok: COLON, lit: ":"},
+
+		// Operators
+		{s: `+`, tok: ADD, lit: "+"},
+		{s: `++`, tok: INCREMENT, lit: "++"},
+		{s: `+=`, tok: ADD_EQUALS, lit: "+="},
+		{s: `-1`, tok: SUB, lit: "-"},
+		{s: `--`, tok: DECREMENT, lit: "--"},
+		{s: `-=`, tok: SUB_EQUALS, lit: "-="},
+		{s: `*=`, tok: MUL_EQUALS, lit: "*="},
+		{s: `/=`, tok: DIV_EQUALS, lit: "/="},
+		{s: `%=`, tok: MOD_EQUALS, lit: "%="},
+		{s: `+++`, tok: INCREMENT, lit: "++"},
+		{s: `&`, tok: AMPERSAND, lit: "&"},
+		{s: `&=`, tok: AND_EQUALS, lit: "&="},
+		{s: `|`, tok: PIPE, lit: "|"},
+		{s: `|=`, tok: OR_EQUALS, lit: "|="},
+		{s: `^`, tok: CARET, lit: "^"},
+		{s: `^=`, tok: XOR_EQUALS, lit: "^="},
+		{s: `~`, tok: TILDE, lit: "~"},
+		{s: `<<`, tok: SHIFT_LEFT, lit: "<<"},
+		{s: `<<=`, tok: SHL_EQUALS, lit: "<<="},
+		{s: `<<<`, tok: SHIFT_LEFT, lit: "<<"},
+		{s: `>>`, tok: SHIFT_RIGHT, lit: ">>"},
+		{s: `>>=`, tok: SHR_EQUALS, lit: ">>="},
+		{s: `>>>`, tok: SHIFT_RIGHT, lit: ">>"},
+		{s: `>>1`, tok: SHIFT_RIGHT, lit: ">>"},
+		{s: `&&`, tok: LOGICAL_AND, lit: "&&"},
+		{s: `&&&`, tok: LOGICAL_AND, lit: "&&"},
+		{s: `||`, tok: LOGICAL_OR, lit: "||"},
+		{s: `!`, tok: NOT, lit: "!"},
+		{s: `!!`, tok: NOT, lit: "!"},
+		{s: `!=`, tok: NOT_EQUALS, lit: "!="},
+		{s: `?`, tok: QUESTION_MARK, lit: "?"},
 
 		// Identifiers
 		{s: `foo`, tok: IDENT, lit: `foo`},
 		{s: `Zx12_3U_-`, tok: IDENT, lit: `Zx12_3U_`},
 
 		// Keywords
-		//{s: `FROM`, tok: FROM, lit: "FROM"},
-		//{s: `SELECT`, tok: SELECT, lit: "SELECT"},
+		{s: `return`, tok: RETURN, lit: "return"},
+		{s: `const`, tok: CONST, lit: "const"},
+		{s: `enum`, tok: ENUM, lit: "enum"},
+		{s: `switch`, tok: SWITCH, lit: "switch"},
+		{s: `case`, tok: CASE, lit: "case"},
+		{s: `default`, tok: DEFAULT, lit: "default"},
+		{s: `break`, tok: BREAK, lit: "break"},
 	}
 
 	for i, tt := range tests {
@@ -44,3 +90,33 @@ func TestScanner_Scan(t *testing.T) {
 		}
 	}
 }
+
+// Ensure the errors of the parser and of the checker give their message without the positions, and the position
+// of the innermost error.
+func TestErrorMessage(t *testing.T) {
+	var tests = []struct {
+		s        string
+		message  string
+		position *Position
+	}{
+		{s: `int main() { x = 1 +; }`, message: "expected instruction: invalid expression: expected expression " +
+			"for add: found \";\", expected number or ident or string", position: &Position{line: 1, column: 1, pos: 20}},
+		{s: "int main() {\n  return f();\n}", message: "function f not declared",
+			position: &Position{line: 2, column: 1, pos: 22}},
+		{s: `int main() { /* x`, message: "expected instruction: comment not terminated",
+			position: &Position{line: 1, column: 1, pos: 13}},
+	}
+	for i, tt := range tests {
+		_, err := parse(strings.NewReader(tt.s), io.Discard)
+		var positionErr *PositionError
+		if !errors.As(err, &positionErr) {
+			t.Fatalf("%d. %q: expected a PositionError, got %v", i, tt.s, err)
+		}
+		message, position := errorMessage(err)
+		if message != tt.message {
+			t.Errorf("%d. %q message mismatch:\n  exp=%q\n  got=%q", i, tt.s, tt.message, message)
+		} else if *position != *tt.position {
+			t.Errorf("%d. %q position mismatch: exp=%v got=%v", i, tt.s, tt.position, position)
+		}
+	}
+}
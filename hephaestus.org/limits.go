@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Limits bounds the resources a script can use. A zero value means no limit.
+type Limits struct {
+	MaxSteps     int64 // instructions and expressions evaluated
+	MaxCallDepth int   // function frames active at the same time
+	MaxMemory    int64 // bytes held by the values stored in variables
+	MaxOutput    int64 // bytes written to the output
+}
+
+// StepLimitError is returned when the script executes more than Limits.MaxSteps steps.
+type StepLimitError struct {
+	Limit    int64
+	position *Position
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("step limit exceeded (limit=%d, pos=%v)", e.Limit, e.position)
+}
+
+// CallDepthError is returned when the script nests more than Limits.MaxCallDepth calls.
+type CallDepthError struct {
+	Limit    int
+	Function string
+}
+
+func (e *CallDepthError) Error() string {
+	return fmt.Sprintf("call depth limit exceeded calling %s (limit=%d)", e.Function, e.Limit)
+}
+
+// MemoryLimitError is returned when the values held by the script exceed Limits.MaxMemory bytes.
+type MemoryLimitError struct {
+	Limit    int64
+	Used     int64
+	position *Position
+}
+
+func (e *MemoryLimitError) Error() string {
+	return fmt.Sprintf("memory limit exceeded (limit=%d, used=%d, pos=%v)", e.Limit, e.Used, e.position)
+}
+
+// OutputLimitError is returned when the script writes more than Limits.MaxOutput bytes.
+type OutputLimitError struct {
+	Limit int64
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("output limit exceeded (limit=%d)", e.Limit)
+}
+
+// CanceledError is returned when the context of the execution is canceled.
+type CanceledError struct {
+	cause error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("execution canceled: %s", e.cause)
+}
+
+func (e *CanceledError) Unwrap() error { return e.cause }
+
+// TimeoutError is returned when the deadline of the context of the execution is exceeded.
+type TimeoutError struct {
+	cause error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("execution timeout: %s", e.cause)
+}
+
+func (e *TimeoutError) Unwrap() error { return e.cause }
+
+// contextError converts the error of a done context to a CanceledError or a TimeoutError.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &TimeoutError{cause: err}
+	}
+	return &CanceledError{cause: err}
+}
+
+// limitedWriter counts the bytes written and fails once the limit is reached.
+type limitedWriter struct {
+	w       io.Writer
+	limit   int64
+	written int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.limit > 0 && l.written+int64(len(p)) > l.limit {
+		n, _ := l.w.Write(p[:l.limit-l.written])
+		l.written += int64(n)
+		return n, &OutputLimitError{Limit: l.limit}
+	}
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	return n, err
+}
+
+// valueSize returns the number of bytes accounted for a value.
+func valueSize(value *Valeur) int64 {
+	switch value.valeurtype.code {
+	case TYPE_INT:
+		return 8
+	case TYPE_BOOLEAN:
+		return 1
+	case TYPE_STRING:
+		return 16 + int64(len(value.valeurString))
+	}
+	return 0
+}
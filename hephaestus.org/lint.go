@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The IDs of the rules of the linter.
+const (
+	LINT_NAMING              = "naming"
+	LINT_MAGIC_NUMBER        = "magic-number"
+	LINT_NESTING             = "nesting"
+	LINT_FUNCTION_LENGTH     = "function-length"
+	LINT_BOOL_COMPARE        = "bool-compare"
+	LINT_ASSIGN_IN_CONDITION = "assign-in-condition"
+)
+
+// LINT_CONFIG_FILE is the configuration read by the lint command when -config is not given.
+const LINT_CONFIG_FILE = ".helint"
+
+// LintRule is a rule of the linter. The rules with a limit report the constructions exceeding it.
+type LintRule struct {
+	ID          string
+	Description string
+	Limit       int // default limit, 0 if the rule has no limit
+}
+
+// lintRules are the rules of the linter, all enabled by default.
+var lintRules = []LintRule{
+	{ID: LINT_NAMING, Description: "functions, variables and parameters in lowerCamelCase, enumerations in " +
+		"UpperCamelCase and their values in UPPER_SNAKE_CASE"},
+	{ID: LINT_MAGIC_NUMBER, Description: "integers other than 0, 1 and 2 outside of the constants"},
+	{ID: LINT_NESTING, Description: "switches nested deeper than the limit", Limit: 3},
+	{ID: LINT_FUNCTION_LENGTH, Description: "functions longer than the limit, in lines", Limit: 50},
+	{ID: LINT_BOOL_COMPARE, Description: "comparisons of a boolean with true or false"},
+	{ID: LINT_ASSIGN_IN_CONDITION, Description: "assignments in a condition, a switch value or an operand of " +
+		"&&, || and !"},
+}
+
+// lintRule returns the rule with the ID, nil if there is none.
+func lintRule(id string) *LintRule {
+	for i := range lintRules {
+		if lintRules[i].ID == id {
+			return &lintRules[i]
+		}
+	}
+	return nil
+}
+
+// LintConfig selects the rules checked by Lint and their limits. The zero value enables all the rules with their
+// default limit.
+type LintConfig struct {
+	disabled map[string]bool
+	limits   map[string]int
+}
+
+// enabled reports whether the rule is checked.
+func (c LintConfig) enabled(rule string) bool {
+	return !c.disabled[rule]
+}
+
+// limit returns the limit of the rule.
+func (c LintConfig) limit(rule string) int {
+	if limit, ok := c.limits[rule]; ok {
+		return limit
+	}
+	return lintRule(rule).Limit
+}
+
+// ReadLintConfig reads a configuration of the linter. Each line gives the state of a rule, `rule = on` or
+// `rule = off`, or its limit, `nesting = 4`, which enables it. The lines starting with # are comments.
+func ReadLintConfig(r io.Reader) (LintConfig, error) {
+	config := LintConfig{disabled: make(map[string]bool), limits: make(map[string]int)}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		i := strings.IndexByte(text, '=')
+		if i < 0 {
+			return LintConfig{}, fmt.Errorf("expected rule = value, found %q (line %d)", text, line)
+		}
+		id, value := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+		rule := lintRule(id)
+		if rule == nil {
+			return LintConfig{}, fmt.Errorf("unknown lint rule %q (line %d)", id, line)
+		}
+		switch value {
+		case "on":
+			config.disabled[id] = false
+		case "off":
+			config.disabled[id] = true
+		default:
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				return LintConfig{}, fmt.Errorf("invalid value %q of rule %s, expected on, off or a limit (line %d)",
+					value, id, line)
+			} else if rule.Limit == 0 {
+				return LintConfig{}, fmt.Errorf("rule %s has no limit (line %d)", id, line)
+			}
+			config.disabled[id] = false
+			config.limits[id] = limit
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return LintConfig{}, err
+	}
+	return config, nil
+}
+
+// LintProblem is a construction of a program reported by a rule of the linter.
+type LintProblem struct {
+	Rule     string
+	Message  string
+	position *Position
+}
+
+func (p LintProblem) String() string {
+	return fmt.Sprintf("%s [%s] (pos=%v)", p.Message, p.Rule, p.position)
+}
+
+// The naming conventions checked by LINT_NAMING.
+var (
+	lowerCamelCase = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+	upperCamelCase = regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`)
+	upperSnakeCase = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+)
+
+// lintSuppression is the comment which disables the rules of the linter.
+var lintSuppression = regexp.MustCompile(`^(?://|/\*)\s*lint:(ignore|file-ignore)\b(.*)`)
+
+// Lint checks the program of the source with the rules enabled by the configuration and returns the problems
+// found, in the order of the source. The program must be valid: the errors of the parser and of the checker are
+// returned as errors.
+//
+// A comment `// lint:ignore rule1,rule2 reason` disables the rules for its line when it follows code, or for the
+// next line otherwise, and `// lint:file-ignore rule` disables them for the whole file.
+func Lint(source []byte, config LintConfig) ([]LintProblem, error) {
+	p := NewParser(bytes.NewReader(source))
+	program, err := p.Parse2()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Checker(program); err != nil {
+		return nil, err
+	}
+
+	fileIgnored := make(map[string]bool)
+	lineIgnored := make(map[int]map[string]bool)
+	for _, comment := range p.Comments() {
+		match := lintSuppression.FindStringSubmatch(strings.TrimSuffix(comment.Text, "*/"))
+		if match == nil {
+			continue
+		}
+		ignored := fileIgnored
+		if match[1] == "ignore" {
+			line := comment.position.line
+			if !comment.trailing {
+				line += strings.Count(comment.Text, "\n") + 1
+			}
+			if lineIgnored[line] == nil {
+				lineIgnored[line] = make(map[string]bool)
+			}
+			ignored = lineIgnored[line]
+		}
+		// the rules may be followed by an explanation
+		fields := strings.Fields(match[2])
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("expected the rules disabled by lint:%s (pos=%v)", match[1], comment.position)
+		}
+		for _, id := range strings.Split(fields[0], ",") {
+			if lintRule(id) == nil {
+				return nil, fmt.Errorf("unknown lint rule %q (pos=%v)", id, comment.position)
+			}
+			ignored[id] = true
+		}
+	}
+
+	l := &linter{config: config}
+	l.program(program)
+	var problems []LintProblem
+	for _, problem := range l.problems {
+		if !fileIgnored[problem.Rule] && !lineIgnored[problem.position.line][problem.Rule] {
+			problems = append(problems, problem)
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].position.pos < problems[j].position.pos })
+	return problems, nil
+}
+
+// linter walks a program and reports the problems found by the rules enabled.
+type linter struct {
+	config   LintConfig
+	problems []LintProblem
+	names    map[string]bool // variables whose name is checked in the function linted
+	switches int             // number of switches around the instruction linted
+	constant bool            // the expression linted is the value of a constant
+}
+
+func (l *linter) report(rule string, position *Position, format string, a ...interface{}) {
+	if l.config.enabled(rule) {
+		l.problems = append(l.problems, LintProblem{Rule: rule, Message: fmt.Sprintf(format, a...),
+			position: position})
+	}
+}
+
+func (l *linter) program(program *Program) {
+	for i := range program.Enums {
+		enum := &program.Enums[i]
+		l.name("enumeration", enum.Name, upperCamelCase, "UpperCamelCase", enum.position)
+		for j := range enum.Values {
+			value := &enum.Values[j]
+			l.name("enumeration value", value.Name, upperSnakeCase, "UPPER_SNAKE_CASE", value.position)
+		}
+	}
+	globals := make(map[string]bool)
+	l.names = globals
+	for i := range program.Globals {
+		l.instruction(&program.Globals[i])
+	}
+	for i := range program.Functions {
+		l.function(&program.Functions[i], globals)
+	}
+}
+
+func (l *linter) function(function *Function, globals map[string]bool) {
+	l.name("function", function.Name, lowerCamelCase, "lowerCamelCase", function.position)
+	start, end := function.ReturnType.position.line, function.end.line
+	if length, limit := end-start+1, l.config.limit(LINT_FUNCTION_LENGTH); length > limit {
+		l.report(LINT_FUNCTION_LENGTH, function.position, "function %s has %d lines, the maximum is %d",
+			function.Name, length, limit)
+	}
+
+	l.names = make(map[string]bool)
+	for name := range globals {
+		l.names[name] = true
+	}
+	for _, param := range function.Parameter {
+		l.names[param.Name] = true
+		l.name("parameter", param.Name, lowerCamelCase, "lowerCamelCase", param.position)
+	}
+	l.instructions(function.Instruction)
+}
+
+// name reports the name of a kind of declaration which doesn't follow its naming convention.
+func (l *linter) name(kind, name string, convention *regexp.Regexp, style string, position *Position) {
+	if !convention.MatchString(name) {
+		l.report(LINT_NAMING, position, "%s %s should be named in %s", kind, name, style)
+	}
+}
+
+// variable checks the name of a variable the first time it is declared or assigned in the function.
+func (l *linter) variable(name string, constant bool, position *Position) {
+	if l.names[name] {
+		return
+	}
+	l.names[name] = true
+	if constant && upperSnakeCase.MatchString(name) {
+		return
+	}
+	style := "lowerCamelCase"
+	if constant {
+		style += " or UPPER_SNAKE_CASE"
+	}
+	l.name("variable", name, lowerCamelCase, style, position)
+}
+
+func (l *linter) instructions(instructions []Instruction) {
+	for i := range instructions {
+		l.instruction(&instructions[i])
+	}
+}
+
+func (l *linter) instruction(instr *Instruction) {
+	switch instr.Code {
+	case INSTRUCTION_AFFECTATION:
+		l.variable(instr.Variable, false, instr.position)
+		l.expression(instr.Valeur, false)
+	case INSTRUCTION_DECLARATION:
+		l.variable(instr.Variable, instr.Constant, instr.position)
+		if instr.Valeur != nil {
+			l.constant = instr.Constant
+			l.expression(instr.Valeur, false)
+			l.constant = false
+		}
+	case INSTRUCTION_CALL:
+		for i := range instr.Parameter {
+			l.expression(&instr.Parameter[i], false)
+		}
+	case INSTRUCTION_RETURN, INSTRUCTION_EXPRESSION:
+		if instr.Valeur != nil {
+			l.expression(instr.Valeur, false)
+		}
+	case INSTRUCTION_SWITCH:
+		l.switches++
+		// only the outermost switch too deep is reported
+		if limit := l.config.limit(LINT_NESTING); l.switches == limit+1 {
+			l.report(LINT_NESTING, instr.position, "switch nested %d levels deep, the maximum is %d", l.switches,
+				limit)
+		}
+		l.expression(instr.Valeur, true)
+		// the values of the cases are labels, they are not magic numbers
+		for i := range instr.Case {
+			l.instructions(instr.Case[i].Instruction)
+		}
+		l.switches--
+	}
+}
+
+// expression lints the expression, which is evaluated as a condition if condition is set.
+func (l *linter) expression(expr *Expression, condition bool) {
+	switch expr.code {
+	case EXPR_CODE_INT:
+		if expr.valeurInt > 2 && !l.constant {
+			l.report(LINT_MAGIC_NUMBER, expr.position, "magic number %d, use a named constant", expr.valeurInt)
+		}
+	case EXPR_CODE_CALL:
+		for i := range expr.parameter {
+			l.expression(&expr.parameter[i], false)
+		}
+	case EXPR_CODE_ASSIGN, EXPR_CODE_COMPOUND_ASSIGN:
+		if condition {
+			l.report(LINT_ASSIGN_IN_CONDITION, expr.position, "assignment to %s in a condition", expr.variable)
+		}
+		if expr.code == EXPR_CODE_ASSIGN {
+			l.variable(expr.variable, false, expr.position)
+		}
+		l.expression(expr.right, condition)
+	case EXPR_CODE_CONDITIONAL:
+		l.expression(expr.condition, true)
+		l.expression(expr.left, condition)
+		l.expression(expr.right, condition)
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		l.expression(expr.left, true)
+		l.expression(expr.right, true)
+	case EXPR_CODE_NOT:
+		l.expression(expr.right, true)
+	case EXPR_CODE_EQU, EXPR_CODE_NEQ:
+		l.boolCompare(expr)
+		l.expression(expr.left, condition)
+		l.expression(expr.right, condition)
+	default:
+		if expr.left != nil {
+			l.expression(expr.left, condition)
+		}
+		if expr.right != nil {
+			l.expression(expr.right, condition)
+		}
+	}
+}
+
+// boolCompare reports the comparison of a boolean with true or false.
+func (l *linter) boolCompare(expr *Expression) {
+	for _, operand := range []*Expression{expr.left, expr.right} {
+		if operand.code != EXPR_CODE_TRUE && operand.code != EXPR_CODE_FALSE {
+			continue
+		}
+		literal := operand.code == EXPR_CODE_TRUE
+		if literal == (expr.code == EXPR_CODE_EQU) {
+			l.report(LINT_BOOL_COMPARE, expr.position, "comparison with %t, use the boolean itself", literal)
+		} else {
+			l.report(LINT_BOOL_COMPARE, expr.position, "comparison with %t, use the negation of the boolean",
+				literal)
+		}
+		return
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Ensure the linter reports the constructions breaking its rules, except the rules disabled by the configuration
+// or by a comment.
+func TestLint(t *testing.T) {
+	for i, tt := range []struct {
+		s        string
+		config   string
+		problems []string
+		err      string
+	}{
+		{s: `enum color { Red, GREEN }; const int MAX_SIZE = 10; const int minSize = 1; int Total = 0;
+			void Add(int N) { my_var = N; }`,
+			problems: []string{
+				"enumeration color should be named in UpperCamelCase [naming] (pos=&{1 1 5})",
+				"enumeration value Red should be named in UPPER_SNAKE_CASE [naming] (pos=&{1 1 13})",
+				"variable Total should be named in lowerCamelCase [naming] (pos=&{1 1 75})",
+				"function Add should be named in lowerCamelCase [naming] (pos=&{2 1 98})",
+				"parameter N should be named in lowerCamelCase [naming] (pos=&{2 1 102})",
+				"variable my_var should be named in lowerCamelCase [naming] (pos=&{2 1 111})",
+			}},
+		{s: `const int SIZE = 10; int main () { x = 2 * SIZE + 3; switch (x) { case 42: x = 1; } return x % 100; }`,
+			problems: []string{
+				"magic number 3, use a named constant [magic-number] (pos=&{1 1 50})",
+				"magic number 100, use a named constant [magic-number] (pos=&{1 1 95})",
+			}},
+		{s: `void main () { switch (1) { case 1: switch (2) { case 2: switch (1) { case 1: switch (2) {
+			case 2: switch (1) { default: } } } } } }`,
+			problems: []string{"switch nested 4 levels deep, the maximum is 3 [nesting] (pos=&{1 1 78})"}},
+		{s: "int f(int n) {\n  n += 1;\n  n += 1;\n  return n;\n}\nvoid main () { }", config: "function-length = 4",
+			problems: []string{"function f has 5 lines, the maximum is 4 [function-length] (pos=&{1 1 4})"}},
+		{s: `boolean main2 (boolean b) { x = b == true; y = false != b; return b != true && (b == false); }`,
+			problems: []string{
+				"comparison with true, use the boolean itself [bool-compare] (pos=&{1 1 34})",
+				"comparison with false, use the boolean itself [bool-compare] (pos=&{1 1 53})",
+				"comparison with true, use the negation of the boolean [bool-compare] (pos=&{1 1 68})",
+				"comparison with false, use the negation of the boolean [bool-compare] (pos=&{1 1 82})",
+			}},
+		{s: `int main () { x = 0; switch (x = 1) { } y = (x += 1) > 0 ? 1 : 0; z = !(w = true) || (x = 0) > 0;
+			v = f(x = 1) ? x : (x = 2); return x; } boolean f(int n) { return n > 0; }`,
+			problems: []string{
+				"assignment to x in a condition [assign-in-condition] (pos=&{1 1 31})",
+				"assignment to x in a condition [assign-in-condition] (pos=&{1 1 47})",
+				"assignment to w in a condition [assign-in-condition] (pos=&{1 1 74})",
+				"assignment to x in a condition [assign-in-condition] (pos=&{1 1 88})",
+			}},
+		{s: `int main () { x = 2 * 3; return x == 4 ? 5 : 6; }`, config: "# no magic numbers\nmagic-number = off"},
+		{s: `int main () { x = 1; y = x == 1 || (x = 2) > 1; return x; }`,
+			config: "assign-in-condition = off\nnaming = on"},
+		{s: "// lint:file-ignore magic-number the values of the tests\nint main () {\n" +
+			"  Y = 4; // lint:ignore naming\n  // lint:ignore naming,bool-compare reason\n  Z = Y == 4 == true;\n" +
+			"  /* lint:ignore naming */ W = 5;\n  return Y + W;\n}",
+			problems: []string{"variable W should be named in lowerCamelCase [naming] (pos=&{6 1 195})"}},
+		{s: `int main () { return 0; } // lint:ignore naming-convention`,
+			err: `unknown lint rule "naming-convention" (pos=&{1 1 26})`},
+		{s: `int main () { return 0; } // lint:ignore`,
+			err: "expected the rules disabled by lint:ignore (pos=&{1 1 26})"},
+		{s: `int main () { return "a"; }`, err: "cannot return string from function main of type int (pos=&{1 1 21})"},
+	} {
+		config, err := ReadLintConfig(strings.NewReader(tt.config))
+		if err != nil {
+			t.Fatalf("%d. %q: config error: %s", i, tt.config, err)
+		}
+		problems, err := Lint([]byte(tt.s), config)
+		var got []string
+		for _, problem := range problems {
+			got = append(got, problem.String())
+		}
+		if errstring(err) != tt.err {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if !reflect.DeepEqual(tt.problems, got) {
+			t.Errorf("%d. %q: problems mismatch:\n  exp=%q\n  got=%q\n\n", i, tt.s, tt.problems, got)
+		}
+	}
+}
+
+// Ensure the invalid configurations of the linter are rejected.
+func TestReadLintConfig_errors(t *testing.T) {
+	for i, tt := range []struct {
+		s   string
+		err string
+	}{
+		{s: "nesting = 2\nmagic-number", err: `expected rule = value, found "magic-number" (line 2)`},
+		{s: "magic = off", err: `unknown lint rule "magic" (line 1)`},
+		{s: "nesting = deep", err: `invalid value "deep" of rule nesting, expected on, off or a limit (line 1)`},
+		{s: "function-length = 0", err: `invalid value "0" of rule function-length, expected on, off or a limit (line 1)`},
+		{s: "naming = 3", err: "rule naming has no limit (line 1)"},
+	} {
+		if _, err := ReadLintConfig(strings.NewReader(tt.s)); errstring(err) != tt.err {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		}
+	}
+}
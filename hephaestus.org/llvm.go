@@ -0,0 +1,723 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// llvmRuntime is the runtime copied in the generated modules: the texts and the functions whose names start
+// with rt_, and the declarations of the functions of the C library they call.
+//
+//go:embed llvmruntime.ll
+var llvmRuntime string
+
+// llvmReserved are the names of the functions of the C library declared by the runtime, and of the function
+// main, which runs the program.
+var llvmReserved = map[string]bool{"main": true, "printf": true, "dprintf": true, "fflush": true, "exit": true}
+
+// The metadata of the debug information declared by every module: the compile unit, the source file, the
+// flags of the module, and the type of the functions. The subprograms and the locations follow.
+const (
+	llvmUnit = iota
+	llvmFile
+	llvmDebugVersion
+	llvmDwarfVersion
+	llvmFunctionType
+	llvmFirstNode
+)
+
+// llvmOperators are the instructions of the binary operations on integers computed without a check.
+var llvmOperators = map[ExprCode]string{EXPR_CODE_ADD: "add", EXPR_CODE_SUB: "sub", EXPR_CODE_MUL: "mul",
+	EXPR_CODE_BIT_AND: "and", EXPR_CODE_BIT_OR: "or", EXPR_CODE_BIT_XOR: "xor", EXPR_CODE_SHL: "shl",
+	EXPR_CODE_SHR: "ashr"}
+
+// llvmComparisons are the conditions of icmp of the comparisons.
+var llvmComparisons = map[ExprCode]string{EXPR_CODE_EQU: "eq", EXPR_CODE_NEQ: "ne", EXPR_CODE_LT: "slt",
+	EXPR_CODE_LTE: "sle", EXPR_CODE_GT: "sgt", EXPR_CODE_GTE: "sge"}
+
+// llvmValue is a value of the generated module, a register or a constant, and its type.
+type llvmValue struct {
+	code string
+	typ  TypeCode
+}
+
+// llvmGenerator translates a program to a module of LLVM IR. The values of the expressions are registers in
+// SSA form, the variables are allocated on the stack of the functions, or are global variables, as the ones
+// of the modules of the C compilers before their optimization. The switches and the logical operators branch
+// to basic blocks, the values of the logical operators are chosen by phi instructions.
+type llvmGenerator struct {
+	*nativeProgram
+	source     string
+	buf        *bytes.Buffer
+	data       bytes.Buffer      // constants of the texts
+	texts      map[string]string // constants of the texts
+	names      map[*nativeVariable]string
+	functions  map[string]string
+	metadata   []string       // metadata from llvmFirstNode
+	locations  map[string]int // metadata of the locations
+	function   *Function      // nil for the initializers of the global variables
+	scope      int            // subprogram of the function
+	location   int            // location of the next instructions
+	temps      int            // number of registers of the function
+	blocks     int            // number of blocks of the function
+	block      string         // current block
+	terminated bool           // the current block is terminated, the next instructions are not reached
+	reachable  bool
+	ends       []string // blocks ending the enclosing switches
+	breaks     []bool   // a break ends each enclosing switch
+}
+
+// TranspileLLVM translates the checked program to a module of LLVM IR in text format, which writes the same
+// output and exits with the same code as the interpreter once compiled. source is the name of the source file,
+// referenced by the debug information.
+func TranspileLLVM(program *Program, source string) ([]byte, error) {
+	p, err := analyzeProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	g := &llvmGenerator{nativeProgram: p, source: source, buf: &bytes.Buffer{}, texts: make(map[string]string),
+		names: make(map[*nativeVariable]string), functions: make(map[string]string),
+		locations: make(map[string]int)}
+
+	// the functions and the global variables are in the same name space
+	taken := make(map[string]bool)
+	for _, name := range regexp.MustCompile(`@([\w.]+)`).FindAllStringSubmatch(llvmRuntime, -1) {
+		taken[name[1]] = true
+	}
+	isReserved := func(name string) bool { return llvmReserved[name] }
+	for i := range program.Functions {
+		g.functions[program.Functions[i].Name] = allocateName(isReserved, taken, program.Functions[i].Name)
+	}
+	for _, v := range p.globals {
+		g.names[v] = allocateName(isReserved, taken, v.Name)
+	}
+
+	var funcs bytes.Buffer
+	for i := range program.Functions {
+		g.functionDecl(&funcs, &program.Functions[i])
+	}
+	g.mainDecl(&funcs)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "; Code generated by hephaestus to-llvm from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&out, "source_filename = %s\n\n%s", llvmString(source), llvmRuntime)
+	if g.data.Len() > 0 {
+		fmt.Fprintf(&out, "\n")
+		out.Write(g.data.Bytes())
+	}
+	if len(p.globals) > 0 {
+		fmt.Fprintf(&out, "\n")
+	}
+	for _, v := range p.globals {
+		fmt.Fprintf(&out, "@%s = internal global %s %s\n", g.names[v], llvmType(v.Code), llvmZero(v.Code))
+		if v.Checked {
+			fmt.Fprintf(&out, "@%s.set = internal global i1 false\n", g.names[v])
+		}
+	}
+	out.Write(funcs.Bytes())
+
+	fmt.Fprintf(&out, "\n!llvm.dbg.cu = !{!%d}\n!llvm.module.flags = !{!%d, !%d}\n\n", llvmUnit, llvmDebugVersion,
+		llvmDwarfVersion)
+	fmt.Fprintf(&out, "!%d = distinct !DICompileUnit(language: DW_LANG_C99, file: !%d, producer: \"hephaestus\", "+
+		"isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)\n", llvmUnit, llvmFile)
+	fmt.Fprintf(&out, "!%d = !DIFile(filename: %s, directory: \"\")\n", llvmFile, llvmString(source))
+	fmt.Fprintf(&out, "!%d = !{i32 2, !\"Debug Info Version\", i32 3}\n", llvmDebugVersion)
+	fmt.Fprintf(&out, "!%d = !{i32 2, !\"Dwarf Version\", i32 4}\n", llvmDwarfVersion)
+	fmt.Fprintf(&out, "!%d = !DISubroutineType(types: !{})\n", llvmFunctionType)
+	for i, node := range g.metadata {
+		fmt.Fprintf(&out, "!%d = %s\n", llvmFirstNode+i, node)
+	}
+	return out.Bytes(), nil
+}
+
+// llvmType returns the type of LLVM of the values of the type: the texts are pointers to their bytes, ended
+// by a null byte.
+func llvmType(code TypeCode) string {
+	switch code {
+	case TYPE_STRING:
+		return "ptr"
+	case TYPE_BOOLEAN:
+		return "i1"
+	}
+	return "i64"
+}
+
+// llvmResultType returns the type of the result of a function which may return no value: the value, and
+// whether it is returned.
+func llvmResultType(code TypeCode) string {
+	return fmt.Sprintf("{ %s, i1 }", llvmType(code))
+}
+
+// llvmZero returns the constant of the zero value of the type.
+func llvmZero(code TypeCode) string {
+	switch code {
+	case TYPE_STRING:
+		return "null"
+	case TYPE_BOOLEAN:
+		return "false"
+	}
+	return "0"
+}
+
+// llvmEscape returns the text with the characters which are not printable escaped, as in the strings of LLVM.
+func llvmEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			fmt.Fprintf(&b, `\%02X`, c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// llvmString returns the string of LLVM of the text, as in the metadata.
+func llvmString(s string) string {
+	return `"` + llvmEscape(s) + `"`
+}
+
+// text returns the constant of the text, added to the module if needed.
+func (g *llvmGenerator) text(s string) string {
+	if name, ok := g.texts[s]; ok {
+		return name
+	}
+	name := fmt.Sprintf("@.str.%d", len(g.texts)+1)
+	g.texts[s] = name
+	fmt.Fprintf(&g.data, "%s = private unnamed_addr constant [%d x i8] c\"%s\\00\"\n", name, len(s)+1, llvmEscape(s))
+	return name
+}
+
+// node adds the metadata to the module, and returns its number.
+func (g *llvmGenerator) node(metadata string) int {
+	g.metadata = append(g.metadata, metadata)
+	return llvmFirstNode + len(g.metadata) - 1
+}
+
+// locate sets the location of the next instructions to the position, if known.
+func (g *llvmGenerator) locate(position *Position) {
+	if position == nil {
+		return
+	}
+	location := fmt.Sprintf("!DILocation(line: %d, column: %d, scope: !%d)", position.line, position.column,
+		g.scope)
+	if _, ok := g.locations[location]; !ok {
+		g.locations[location] = g.node(location)
+	}
+	g.location = g.locations[location]
+}
+
+// start prepares the generation of the body of a function, described by the subprogram.
+func (g *llvmGenerator) start(function *Function, name string, position *Position) {
+	line := 1
+	if position != nil {
+		line = position.line
+	}
+	g.buf.Reset()
+	g.function, g.temps, g.blocks, g.block, g.terminated, g.reachable = function, 0, 0, "entry", false, true
+	g.scope = g.node(fmt.Sprintf("distinct !DISubprogram(name: %s, linkageName: %s, scope: !%d, file: !%d, "+
+		"line: %d, type: !%d, scopeLine: %d, spFlags: DISPFlagDefinition, unit: !%d)", llvmString(name),
+		llvmString(g.functionName(function)), llvmFile, llvmFile, line, llvmFunctionType, line, llvmUnit))
+	g.locate(&Position{line: line, column: 1})
+	fmt.Fprintf(g.buf, "entry:\n")
+}
+
+// functionName returns the name of the function of the module, main for the initializers of the global
+// variables.
+func (g *llvmGenerator) functionName(function *Function) string {
+	if function == nil {
+		return "main"
+	}
+	return g.functions[function.Name]
+}
+
+// emit writes an instruction of the current block, at the current location.
+func (g *llvmGenerator) emit(format string, args ...interface{}) {
+	if g.terminated {
+		// the instructions following a terminator are in a block without predecessors
+		g.blocks++
+		g.label(fmt.Sprintf("dead%d", g.blocks))
+	}
+	fmt.Fprintf(g.buf, "  "+format+", !dbg !%d\n", append(args, g.location)...)
+}
+
+// terminate writes the instruction ending the current block.
+func (g *llvmGenerator) terminate(format string, args ...interface{}) {
+	g.emit(format, args...)
+	g.terminated = true
+}
+
+// branch ends the current block with a branch to the block.
+func (g *llvmGenerator) branch(label string) {
+	g.terminate("br label %%%s", label)
+}
+
+// label starts a block, the current block continues with it if it is not terminated.
+func (g *llvmGenerator) label(label string) {
+	if !g.terminated {
+		g.branch(label)
+	}
+	fmt.Fprintf(g.buf, "%s:\n", label)
+	g.block, g.terminated = label, false
+}
+
+// temp returns a new register.
+func (g *llvmGenerator) temp() string {
+	g.temps++
+	return fmt.Sprintf("%%t%d", g.temps)
+}
+
+// pointer returns the address of the variable.
+func (g *llvmGenerator) pointer(v *nativeVariable) string {
+	if v.Global {
+		return "@" + g.names[v]
+	}
+	return "%" + v.Name + ".addr"
+}
+
+// setFlag returns the address of the flag telling if the variable is set.
+func (g *llvmGenerator) setFlag(v *nativeVariable) string {
+	if v.Global {
+		return "@" + g.names[v] + ".set"
+	}
+	return "%" + v.Name + ".set"
+}
+
+func (g *llvmGenerator) functionDecl(out *bytes.Buffer, function *Function) {
+	g.start(function, function.Name, function.position)
+	locals := g.locals[function]
+	params := []string{"i32 %wrap"}
+	for i, v := range locals {
+		g.emit("%s = alloca %s", g.pointer(v), llvmType(v.Code))
+		if i < len(function.Parameter) {
+			params = append(params, fmt.Sprintf("%s %%%s.arg", llvmType(v.Code), v.Name))
+			g.emit("store %s %%%s.arg, ptr %s", llvmType(v.Code), v.Name, g.pointer(v))
+		}
+		if v.Checked {
+			g.emit("%s = alloca i1", g.setFlag(v))
+			g.emit("store i1 false, ptr %s", g.setFlag(v))
+		}
+	}
+	g.trace("function " + function.Name + "\n")
+	g.instructions(function.Instruction)
+	code := runtimeType(function.ReturnType.code)
+	if !g.terminated {
+		switch {
+		case code == TYPE_VOID:
+			g.terminate("ret void")
+		case g.reachable && g.noValue[function]:
+			g.returnNoValue()
+		default:
+			g.terminate("unreachable")
+		}
+	}
+
+	result := "void"
+	if g.noValue[function] {
+		result = llvmResultType(code)
+	} else if code != TYPE_VOID {
+		result = llvmType(code)
+	}
+	fmt.Fprintf(out, "\ndefine internal %s @%s(%s) !dbg !%d {\n", result, g.functions[function.Name],
+		strings.Join(params, ", "), g.scope)
+	out.Write(g.buf.Bytes())
+	fmt.Fprintf(out, "}\n")
+}
+
+// mainDecl declares the function main, which initializes the global variables and calls the function main of
+// the program.
+func (g *llvmGenerator) mainDecl(out *bytes.Buffer) {
+	g.start(nil, "main", nil)
+	g.instructions(g.program.Globals)
+	main := g.functions["main"]
+	function, ok := g.nativeProgram.functions["main"]
+	if ok {
+		g.locate(function.position)
+	}
+	if !ok {
+		g.emit("call void @rt_fail(i32 0, ptr %s)", g.text("function main not found"))
+	} else if len(function.Parameter) > 0 {
+		g.emit("call void @rt_fail(i32 0, ptr %s)", g.text(fmt.Sprintf("function main expects %d parameters, "+
+			"found 0", len(function.Parameter))))
+	} else if code := runtimeType(function.ReturnType.code); code == TYPE_INT && g.noValue[function] {
+		result, value := g.temp(), g.temp()
+		g.emit("%s = call %s @%s(i32 0)", result, llvmResultType(code), main)
+		g.emit("%s = extractvalue %s %s, 0", value, llvmResultType(code), result)
+		g.emit("call void @rt_exit(i64 %s)", value)
+	} else if code == TYPE_INT {
+		value := g.temp()
+		g.emit("%s = call i64 @%s(i32 0)", value, main)
+		g.emit("call void @rt_exit(i64 %s)", value)
+	} else {
+		if g.noValue[function] {
+			g.emit("call %s @%s(i32 0)", llvmResultType(code), main)
+		} else if code != TYPE_VOID {
+			g.emit("call %s @%s(i32 0)", llvmType(code), main)
+		} else {
+			g.emit("call void @%s(i32 0)", main)
+		}
+		g.emit("call void @rt_exit(i64 0)")
+	}
+	g.terminate("unreachable")
+	fmt.Fprintf(out, "\ndefine i32 @main() !dbg !%d {\n", g.scope)
+	out.Write(g.buf.Bytes())
+	fmt.Fprintf(out, "}\n")
+}
+
+// wrapValue returns the number of times the errors are wrapped: the errors of the callers are wrapped %wrap
+// times, and the errors of the expression wrap times more.
+func (g *llvmGenerator) wrapValue(wrap int) string {
+	if g.function == nil {
+		return strconv.Itoa(wrap)
+	} else if wrap == 0 {
+		return "%wrap"
+	}
+	value := g.temp()
+	g.emit("%s = add i32 %%wrap, %d", value, wrap)
+	return value
+}
+
+// read returns the value of the variable, as resolved by the analysis.
+func (g *llvmGenerator) read(access nativeAccess, name string, code TypeCode, wrap int) string {
+	if v := access.variable; v != nil {
+		if access.checked {
+			set, wrapValue := g.temp(), g.wrapValue(wrap)
+			g.emit("%s = load i1, ptr %s", set, g.setFlag(v))
+			g.emit("call void @rt_declared(i1 %s, i32 %s, ptr %s)", set, wrapValue,
+				g.text("variable "+name+" not declared"))
+		}
+		value := g.temp()
+		g.emit("%s = load %s, ptr %s", value, llvmType(v.Code), g.pointer(v))
+		return value
+	} else if access.constant != nil {
+		return strconv.Itoa(access.constant.Value)
+	}
+	g.emit("call void @rt_fail(i32 %s, ptr %s)", g.wrapValue(wrap), g.text("variable "+name+" not declared"))
+	return llvmZero(code)
+}
+
+// store assigns the value to the variable.
+func (g *llvmGenerator) store(v *nativeVariable, value string) {
+	g.emit("store %s %s, ptr %s", llvmType(v.Code), value, g.pointer(v))
+	if v.Checked {
+		g.emit("store i1 true, ptr %s", g.setFlag(v))
+	}
+}
+
+// binary returns the binary operation on the operands. right is the right operand, whose checks are omitted
+// if it is a literal, nil if it is not an expression of the program.
+func (g *llvmGenerator) binary(code ExprCode, left, right string, rightExpr *Expression, typ TypeCode, wrap int,
+	position *Position) string {
+	literal := rightExpr != nil && rightExpr.code == EXPR_CODE_INT
+	switch code {
+	case EXPR_CODE_DIV, EXPR_CODE_MOD:
+		if !literal || rightExpr.valeurInt == 0 {
+			checked, wrapValue := g.temp(), g.wrapValue(wrap)
+			g.emit("%s = call i64 @rt_divisor(i64 %s, i32 %s, ptr %s)", checked, right, wrapValue,
+				g.text(fmt.Sprintf("error: division by zero (pos=%v)", position)))
+			right = checked
+		}
+		instruction, function := "sdiv", "rt_div"
+		if code == EXPR_CODE_MOD {
+			instruction, function = "srem", "rt_mod"
+		}
+		value := g.temp()
+		if literal && rightExpr.valeurInt != 0 && rightExpr.valeurInt != -1 {
+			g.emit("%s = %s i64 %s, %s", value, instruction, left, right)
+		} else {
+			g.emit("%s = call i64 @%s(i64 %s, i64 %s)", value, function, left, right)
+		}
+		return value
+	case EXPR_CODE_SHL, EXPR_CODE_SHR:
+		if !literal || rightExpr.valeurInt < 0 || rightExpr.valeurInt >= 64 {
+			checked, wrapValue := g.temp(), g.wrapValue(wrap)
+			g.emit("%s = call i64 @rt_shift(i64 %s, i32 %s, ptr %s)", checked, right, wrapValue,
+				g.text(fmt.Sprintf("%v", position)))
+			right = checked
+		}
+	case EXPR_CODE_EQU, EXPR_CODE_NEQ, EXPR_CODE_LT, EXPR_CODE_LTE, EXPR_CODE_GT, EXPR_CODE_GTE:
+		value := g.temp()
+		g.emit("%s = icmp %s %s %s, %s", value, llvmComparisons[code], llvmType(typ), left, right)
+		return value
+	}
+	value := g.temp()
+	g.emit("%s = %s i64 %s, %s", value, llvmOperators[code], left, right)
+	return value
+}
+
+// expression returns the value of the expression, whose errors are wrapped wrap times as they are by the
+// interpreter.
+func (g *llvmGenerator) expression(expr *Expression, wrap int) string {
+	switch expr.code {
+	case EXPR_CODE_INT:
+		return strconv.Itoa(expr.valeurInt)
+	case EXPR_CODE_STR:
+		return g.text(expr.valeurString)
+	case EXPR_CODE_TRUE:
+		return "true"
+	case EXPR_CODE_FALSE:
+		return "false"
+	case EXPR_CODE_VAR:
+		return g.read(g.reads[expr], expr.variable, g.typeOf(expr), wrap)
+	case EXPR_CODE_CALL:
+		callee := g.nativeProgram.functions[expr.functionName]
+		wrapValue := g.wrapValue(wrap)
+		args := []string{"i32 " + wrapValue}
+		for i := range expr.parameter {
+			param := &expr.parameter[i]
+			args = append(args, llvmType(g.locals[callee][i].Code)+" "+g.expression(param, wrap+1))
+		}
+		code := runtimeType(callee.ReturnType.code)
+		result := g.temp()
+		if !g.noValue[callee] {
+			g.emit("%s = call %s @%s(%s)", result, llvmType(code), g.functions[callee.Name], strings.Join(args, ", "))
+			return result
+		}
+		ok, value := g.temp(), g.temp()
+		g.emit("%s = call %s @%s(%s)", result, llvmResultType(code), g.functions[callee.Name],
+			strings.Join(args, ", "))
+		g.emit("%s = extractvalue %s %s, 1", ok, llvmResultType(code), result)
+		g.emit("call void @rt_returned(i1 %s, i32 %s, ptr %s)", ok, wrapValue,
+			g.text(fmt.Sprintf("function %s returns no value (pos=%v)", callee.Name, expr.position)))
+		g.emit("%s = extractvalue %s %s, 0", value, llvmResultType(code), result)
+		return value
+	case EXPR_CODE_ASSIGN:
+		value := g.expression(expr.right, wrap+1)
+		g.store(g.writes[expr], value)
+		return value
+	case EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC, EXPR_CODE_POST_DEC:
+		// the variable is read before the right operand is evaluated
+		old := g.read(g.reads[expr], expr.variable, TYPE_INT, wrap+1)
+		operator, right, rightExpr := expr.operator, "1", (*Expression)(nil)
+		if expr.code == EXPR_CODE_COMPOUND_ASSIGN {
+			right, rightExpr = g.expression(expr.right, wrap+1), expr.right
+		} else if expr.code == EXPR_CODE_PRE_INC || expr.code == EXPR_CODE_POST_INC {
+			operator = EXPR_CODE_ADD
+		} else {
+			operator = EXPR_CODE_SUB
+		}
+		value := g.binary(operator, old, right, rightExpr, TYPE_INT, wrap, expr.position)
+		g.store(g.writes[expr], value)
+		if expr.code == EXPR_CODE_POST_INC || expr.code == EXPR_CODE_POST_DEC {
+			return old
+		}
+		return value
+	case EXPR_CODE_BIT_NOT:
+		operand, value := g.expression(expr.right, wrap+1), g.temp()
+		g.emit("%s = xor i64 %s, -1", value, operand)
+		return value
+	case EXPR_CODE_NOT:
+		operand, value := g.expression(expr.right, wrap+1), g.temp()
+		g.emit("%s = xor i1 %s, true", value, operand)
+		return value
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		// the right operand is evaluated only if the left operand doesn't decide the result
+		left := g.expression(expr.left, wrap+1)
+		g.blocks++
+		right, end := fmt.Sprintf("logic%d.right", g.blocks), fmt.Sprintf("logic%d.end", g.blocks)
+		decided := "false"
+		if expr.code == EXPR_CODE_AND {
+			g.terminate("br i1 %s, label %%%s, label %%%s", left, right, end)
+		} else {
+			decided = "true"
+			g.terminate("br i1 %s, label %%%s, label %%%s", left, end, right)
+		}
+		from := g.block
+		g.label(right)
+		rightValue := g.expression(expr.right, wrap+1)
+		rightBlock := g.block
+		g.label(end)
+		value := g.temp()
+		g.emit("%s = phi i1 [ %s, %%%s ], [ %s, %%%s ]", value, decided, from, rightValue, rightBlock)
+		return value
+	case EXPR_CODE_CONDITIONAL:
+		condition := g.expression(expr.condition, wrap+1)
+		g.blocks++
+		prefix := fmt.Sprintf("cond%d", g.blocks)
+		g.terminate("br i1 %s, label %%%s.then, label %%%s.else", condition, prefix, prefix)
+		g.label(prefix + ".then")
+		left := g.expression(expr.left, wrap)
+		leftBlock := g.block
+		g.branch(prefix + ".end")
+		g.label(prefix + ".else")
+		right := g.expression(expr.right, wrap)
+		rightBlock := g.block
+		g.label(prefix + ".end")
+		value := g.temp()
+		g.emit("%s = phi %s [ %s, %%%s ], [ %s, %%%s ]", value, llvmType(g.typeOf(expr)), left, leftBlock, right,
+			rightBlock)
+		return value
+	}
+	left := g.expression(expr.left, wrap+1)
+	right := g.expression(expr.right, wrap+1)
+	return g.binary(expr.code, left, right, expr.right, g.typeOf(expr.left), wrap, expr.position)
+}
+
+// trace writes the trace of the execution: the texts and the values.
+func (g *llvmGenerator) trace(parts ...interface{}) {
+	var format strings.Builder
+	args := []string{""}
+	for _, part := range parts {
+		switch part := part.(type) {
+		case string:
+			format.WriteString(strings.ReplaceAll(part, "%", "%%"))
+		case llvmValue:
+			switch part.typ {
+			case TYPE_STRING:
+				format.WriteString("%s")
+				args = append(args, "ptr "+part.code)
+			case TYPE_BOOLEAN:
+				text := g.temp()
+				g.emit("%s = call ptr @rt_bool(i1 %s)", text, part.code)
+				format.WriteString("%s")
+				args = append(args, "ptr "+text)
+			default:
+				format.WriteString("%lld")
+				args = append(args, "i64 "+part.code)
+			}
+		}
+	}
+	args[0] = "ptr " + g.text(format.String())
+	g.emit("call i32 (ptr, ...) @printf(%s)", strings.Join(args, ", "))
+}
+
+func (g *llvmGenerator) instructions(instructions []Instruction) {
+	for i := range instructions {
+		if !g.reached[&instructions[i]] {
+			return
+		}
+		g.locate(instructions[i].position)
+		g.instruction(&instructions[i])
+	}
+}
+
+func (g *llvmGenerator) instruction(instr *Instruction) {
+	switch instr.Code {
+	case INSTRUCTION_AFFECTATION, INSTRUCTION_DECLARATION:
+		v := g.stores[instr]
+		value := llvmZero(v.Code)
+		if instr.Valeur != nil {
+			value = g.expression(instr.Valeur, 1)
+		}
+		g.store(v, value)
+		g.trace(instr.Variable+"=", llvmValue{value, v.Code}, "\n")
+	case INSTRUCTION_CALL:
+		var args []string
+		parts := []interface{}{instr.FunctionName + "("}
+		for i := range instr.Parameter {
+			code := g.typeOf(&instr.Parameter[i])
+			value := g.expression(&instr.Parameter[i], 1)
+			if i > 0 {
+				parts = append(parts, ",")
+			}
+			args = append(args, llvmType(code)+" "+value)
+			parts = append(parts, llvmValue{value, code})
+		}
+		g.trace(append(parts, ")\n")...)
+		if callee, ok := g.nativeProgram.functions[instr.FunctionName]; ok {
+			result := "void"
+			if code := runtimeType(callee.ReturnType.code); g.noValue[callee] {
+				result = llvmResultType(code)
+			} else if code != TYPE_VOID {
+				result = llvmType(code)
+			}
+			args = append([]string{"i32 " + g.wrapValue(0)}, args...)
+			g.emit("call %s @%s(%s)", result, g.functions[callee.Name], strings.Join(args, ", "))
+		}
+	case INSTRUCTION_EXPRESSION:
+		g.expression(instr.Valeur, 1)
+		if name := assignedVariable(instr.Valeur); name != "" {
+			code := g.typeOf(instr.Valeur)
+			g.trace(name+"=", llvmValue{g.read(g.traces[instr], name, code, 0), code}, "\n")
+		}
+	case INSTRUCTION_SWITCH:
+		g.switchCases(instr)
+	case INSTRUCTION_BREAK:
+		g.trace("break\n")
+		if len(g.breaks) > 0 {
+			g.breaks[len(g.breaks)-1] = true
+			g.branch(g.ends[len(g.ends)-1])
+		} else {
+			// as the interpreter, a break outside of a switch ends the function
+			g.returnNoValue()
+		}
+		g.reachable = false
+	case INSTRUCTION_RETURN:
+		if instr.Valeur == nil {
+			g.trace("return\n")
+			g.returnNoValue()
+		} else {
+			code := g.typeOf(instr.Valeur)
+			value := g.expression(instr.Valeur, 1)
+			g.trace("return ", llvmValue{value, code}, "\n")
+			if g.function.ReturnType.code == TYPE_VOID {
+				g.terminate("ret void")
+			} else if g.noValue[g.function] {
+				first, second := g.temp(), g.temp()
+				g.emit("%s = insertvalue %s poison, %s %s, 0", first, llvmResultType(code), llvmType(code), value)
+				g.emit("%s = insertvalue %s %s, i1 true, 1", second, llvmResultType(code), first)
+				g.terminate("ret %s %s", llvmResultType(code), second)
+			} else {
+				g.terminate("ret %s %s", llvmType(code), value)
+			}
+		}
+		g.reachable = false
+	}
+}
+
+// returnNoValue returns from the function without a value.
+func (g *llvmGenerator) returnNoValue() {
+	if code := runtimeType(g.function.ReturnType.code); code == TYPE_VOID {
+		g.terminate("ret void")
+	} else {
+		g.terminate("ret %s { %s %s, i1 false }", llvmResultType(code), llvmType(code), llvmZero(code))
+	}
+}
+
+// switchCases generates a switch branching to a block by case, each continuing with the next one until a
+// break.
+func (g *llvmGenerator) switchCases(instr *Instruction) {
+	value := g.expression(instr.Valeur, 1)
+	g.trace("switch ", llvmValue{value, TYPE_INT}, "\n")
+
+	g.blocks++
+	prefix := fmt.Sprintf("switch%d", g.blocks)
+	end := prefix + ".end"
+	target := end
+	var cases []string
+	seen := make(map[int]bool)
+	for i := range instr.Case {
+		label := fmt.Sprintf("%s.case%d", prefix, i)
+		caseSwitch := &instr.Case[i]
+		if caseSwitch.Valeur == nil {
+			target = label
+			continue
+		}
+		n := caseSwitch.Valeur.valeurInt
+		if caseSwitch.Valeur.code != EXPR_CODE_INT {
+			n = g.nativeProgram.constants[caseSwitch.Valeur.variable].Value
+		}
+		// the values are distinct, the cases of a value already seen are reached only from the previous case
+		if !seen[n] {
+			seen[n] = true
+			cases = append(cases, fmt.Sprintf("i64 %d, label %%%s", n, label))
+		}
+	}
+	g.terminate("switch i64 %s, label %%%s [%s]", value, target, strings.Join(cases, " "))
+
+	hasDefault := false
+	g.ends, g.breaks = append(g.ends, end), append(g.breaks, false)
+	for i := range instr.Case {
+		hasDefault = hasDefault || instr.Case[i].Valeur == nil
+		g.label(fmt.Sprintf("%s.case%d", prefix, i))
+		g.reachable = true
+		g.instructions(instr.Case[i].Instruction)
+	}
+	g.label(end)
+	g.reachable = g.reachable || len(instr.Case) == 0 || !hasDefault || g.breaks[len(g.breaks)-1]
+	g.ends, g.breaks = g.ends[:len(g.ends)-1], g.breaks[:len(g.breaks)-1]
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+// Ensure the modules generated for the programs of testdata/llvm are the ones of the golden files. The golden
+// files are written by go test -run TestTranspileLLVM_golden -update.
+func TestTranspileLLVM_golden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "llvm", "*.he"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("no program found in testdata/llvm")
+	}
+	for _, source := range sources {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program, err := parse(bytes.NewReader(data), io.Discard)
+		if err != nil {
+			t.Fatalf("%s: parse error: %s", source, err)
+		}
+		code, err := TranspileLLVM(program, filepath.Base(source))
+		if err != nil {
+			t.Fatalf("%s: transpile error: %s", source, err)
+		}
+		golden := strings.TrimSuffix(source, ".he") + ".ll"
+		if *update {
+			if err := os.WriteFile(golden, code, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if exp, err := os.ReadFile(golden); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(exp, code) {
+			t.Errorf("%s: module mismatch with %s:\n%s", source, golden, code)
+		}
+	}
+}
+
+// Ensure the modules generated write the same output, report the same errors and exit with the same code as
+// the interpreter when run by lli.
+func TestTranspileLLVM(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the execution of the generated modules in short mode")
+	}
+	lli, err := exec.LookPath("lli")
+	if err != nil {
+		t.Skip("lli not found")
+	}
+	version, err := exec.Command(lli, "--version").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args []string
+	if m := regexp.MustCompile(`LLVM version (\d+)`).FindSubmatch(version); m == nil {
+		t.Skipf("unknown version of lli: %s", version)
+	} else if major, _ := strconv.Atoi(string(m[1])); major < 14 {
+		t.Skipf("lli %s doesn't read the opaque pointers", m[1])
+	} else if major == 14 {
+		args = append(args, "-opaque-pointers")
+	}
+
+	testNative(t, nativeTests, func(t *testing.T, dir string, program *Program) (string, string, int) {
+		code, err := TranspileLLVM(program, "test.he")
+		if err != nil {
+			t.Fatalf("transpile error: %s", err)
+		}
+		module := filepath.Join(dir, "main.ll")
+		if err := os.WriteFile(module, code, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return runExecutable(t, lli, append(args, module)...)
+	})
+}
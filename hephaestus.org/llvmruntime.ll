@@ -0,0 +1,130 @@
+; The runtime of the LLVM modules generated by the command to-llvm, copied in each module. The modules write
+; the same output as the interpreter, and report the same errors. The integers are computed on 64 bits and
+; wrap around, as the ones of the interpreter.
+
+@rt.true = private unnamed_addr constant [5 x i8] c"true\00"
+@rt.false = private unnamed_addr constant [6 x i8] c"false\00"
+@rt.error = private unnamed_addr constant [9 x i8] c"error : \00"
+@rt.wrap = private unnamed_addr constant [8 x i8] c"error: \00"
+@rt.line = private unnamed_addr constant [4 x i8] c"%s\0A\00"
+@rt.shift = private unnamed_addr constant [47 x i8] c"error: shift count %lld out of range (pos=%s)\0A\00"
+
+declare i32 @printf(ptr, ...)
+declare i32 @dprintf(i32, ptr, ...)
+declare i32 @fflush(ptr)
+declare void @exit(i32) noreturn
+
+; @rt_exit ends the program with the exit code.
+define void @rt_exit(i64 %code) noreturn {
+entry:
+  %low = trunc i64 %code to i32
+  %status = and i32 %low, 255
+  call void @exit(i32 %status)
+  unreachable
+}
+
+; @rt_bool returns the text of a boolean.
+define ptr @rt_bool(i1 %value) {
+entry:
+  %text = select i1 %value, ptr @rt.true, ptr @rt.false
+  ret ptr %text
+}
+
+; @rt_error writes the beginning of an error, wrapped %wrap times.
+define void @rt_error(i32 %wrap) {
+entry:
+  %flushed = call i32 @fflush(ptr null)
+  %written = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.error)
+  br label %loop
+loop:
+  %n = phi i32 [ %wrap, %entry ], [ %next, %body ]
+  %done = icmp sle i32 %n, 0
+  br i1 %done, label %end, label %body
+body:
+  %wrapped = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.wrap)
+  %next = sub i32 %n, 1
+  br label %loop
+end:
+  ret void
+}
+
+; @rt_fail ends the program with the error of the interpreter, wrapped %wrap times.
+define void @rt_fail(i32 %wrap, ptr %message) noreturn {
+entry:
+  call void @rt_error(i32 %wrap)
+  %written = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.line, ptr %message)
+  call void @exit(i32 1)
+  unreachable
+}
+
+; @rt_declared fails if the variable is not set.
+define void @rt_declared(i1 %set, i32 %wrap, ptr %message) {
+entry:
+  br i1 %set, label %ok, label %fail
+fail:
+  call void @rt_fail(i32 %wrap, ptr %message)
+  unreachable
+ok:
+  ret void
+}
+
+; @rt_divisor checks the divisor of a division or a modulo.
+define i64 @rt_divisor(i64 %divisor, i32 %wrap, ptr %message) {
+entry:
+  %zero = icmp eq i64 %divisor, 0
+  br i1 %zero, label %fail, label %ok
+fail:
+  call void @rt_fail(i32 %wrap, ptr %message)
+  unreachable
+ok:
+  ret i64 %divisor
+}
+
+; @rt_div divides, the division of the smallest integer by -1 wraps around.
+define i64 @rt_div(i64 %a, i64 %b) {
+entry:
+  %negate = icmp eq i64 %b, -1
+  br i1 %negate, label %opposite, label %divide
+opposite:
+  %opposite.value = sub i64 0, %a
+  ret i64 %opposite.value
+divide:
+  %quotient = sdiv i64 %a, %b
+  ret i64 %quotient
+}
+
+define i64 @rt_mod(i64 %a, i64 %b) {
+entry:
+  %negate = icmp eq i64 %b, -1
+  br i1 %negate, label %zero, label %divide
+zero:
+  ret i64 0
+divide:
+  %remainder = srem i64 %a, %b
+  ret i64 %remainder
+}
+
+; @rt_shift checks the count of a shift is lower than the size of an integer.
+define i64 @rt_shift(i64 %count, i32 %wrap, ptr %pos) {
+entry:
+  %out = icmp uge i64 %count, 64
+  br i1 %out, label %fail, label %ok
+fail:
+  call void @rt_error(i32 %wrap)
+  %written = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.shift, i64 %count, ptr %pos)
+  call void @exit(i32 1)
+  unreachable
+ok:
+  ret i64 %count
+}
+
+; @rt_returned checks the function called returns a value.
+define void @rt_returned(i1 %ok, i32 %wrap, ptr %message) {
+entry:
+  br i1 %ok, label %done, label %fail
+fail:
+  call void @rt_fail(i32 %wrap, ptr %message)
+  unreachable
+done:
+  ret void
+}
@@ -0,0 +1,673 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// The kinds of the LSP protocol used by the server.
+const (
+	LSP_SEVERITY_ERROR   = 1
+	LSP_SEVERITY_WARNING = 2
+
+	LSP_SYMBOL_FUNCTION    = 12
+	LSP_SYMBOL_VARIABLE    = 13
+	LSP_SYMBOL_CONSTANT    = 14
+	LSP_SYMBOL_ENUM        = 10
+	LSP_SYMBOL_ENUM_MEMBER = 22
+
+	LSP_COMPLETION_FUNCTION    = 3
+	LSP_COMPLETION_VARIABLE    = 6
+	LSP_COMPLETION_ENUM        = 13
+	LSP_COMPLETION_KEYWORD     = 14
+	LSP_COMPLETION_ENUM_MEMBER = 20
+	LSP_COMPLETION_CONSTANT    = 21
+
+	LSP_METHOD_NOT_FOUND   = -32601
+	LSP_INVALID_PARAMS     = -32602
+	LSP_REQUEST_FAILED     = -32803
+	LSP_SERVER_NOT_STARTED = -32002
+)
+
+// lspKeywords are the keywords proposed by the completion.
+var lspKeywords = []string{"boolean", "break", "case", "const", "default", "enum", "false", "int", "return",
+	"string", "switch", "true", "void"}
+
+// lspMessage is a request, a response or a notification of JSON-RPC.
+type lspMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *lspError       `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *lspError) Error() string {
+	return e.Message
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text,omitempty"`
+}
+
+// lspParams are the parameters of the requests and of the notifications handled by the server.
+type lspParams struct {
+	TextDocument   lspTextDocument `json:"textDocument"`
+	Position       lspPosition     `json:"position"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspHover struct {
+	Contents struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	} `json:"contents"`
+	Range lspRange `json:"range"`
+}
+
+type lspDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Detail         string              `json:"detail,omitempty"`
+	Kind           int                 `json:"kind"`
+	Range          lspRange            `json:"range"`
+	SelectionRange lspRange            `json:"selectionRange"`
+	Children       []lspDocumentSymbol `json:"children,omitempty"`
+}
+
+type lspCompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+// lspDocument is a source opened by the client, with the analysis of its last valid version.
+type lspDocument struct {
+	uri   string
+	text  []rune
+	lines []int // offset of the first rune of each line
+
+	// analysis of the last version of the source accepted by the checker
+	program *Program
+	checker *checker
+	tokens  []ScannerRes // tokens of the source, without the whitespaces and the comments
+	stale   bool         // the source changed since the analysis, its positions may be wrong
+}
+
+// lspServer is a language server for the .he files. It reads the messages of the client from r and writes its
+// responses and its notifications to w.
+type lspServer struct {
+	r           *bufio.Reader
+	w           io.Writer
+	documents   map[string]*lspDocument
+	initialized bool
+	shutdown    bool
+}
+
+// ServeLSP runs a language server speaking the Language Server Protocol on r and w, until the client exits. It
+// returns the exit code of the server: 0 if the client asked to shut it down before exiting.
+func ServeLSP(r io.Reader, w io.Writer) (int, error) {
+	s := &lspServer{r: bufio.NewReader(r), w: w, documents: make(map[string]*lspDocument)}
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return 1, nil
+		} else if err != nil {
+			return 1, err
+		}
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return 0, nil
+			}
+			return 1, nil
+		}
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			// the notifications have no response, their errors are ignored
+			continue
+		}
+		response := lspMessage{JSONRPC: "2.0", ID: msg.ID}
+		if lspErr, ok := err.(*lspError); ok {
+			response.Error = lspErr
+		} else if err != nil {
+			response.Error = &lspError{Code: LSP_REQUEST_FAILED, Message: err.Error()}
+		} else if response.Result, err = json.Marshal(result); err != nil {
+			return 1, err
+		}
+		if err := s.write(response); err != nil {
+			return 1, err
+		}
+	}
+}
+
+// read reads the next message of the client.
+func (s *lspServer) read() (*lspMessage, error) {
+	content, err := readFrame(s.r)
+	if err != nil {
+		return nil, err
+	}
+	var msg lspMessage
+	if err := json.Unmarshal(content, &msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %v", err)
+	}
+	return &msg, nil
+}
+
+func (s *lspServer) write(msg lspMessage) error {
+	return writeFrame(s.w, msg)
+}
+
+// readFrame reads the content of a message framed as in LSP and DAP: headers, including its Content-Length, then
+// the content. It returns io.EOF if the input ends before the headers.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// writeFrame writes the message encoded in JSON, framed by its Content-Length.
+func writeFrame(w io.Writer, msg interface{}) error {
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// notify sends a notification to the client.
+func (s *lspServer) notify(method string, params interface{}) error {
+	content, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.write(lspMessage{JSONRPC: "2.0", Method: method, Params: content})
+}
+
+// handle executes the request or the notification and returns its result.
+func (s *lspServer) handle(msg *lspMessage) (interface{}, error) {
+	var params lspParams
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{Code: LSP_INVALID_PARAMS, Message: err.Error()}
+		}
+	}
+	if msg.Method == "initialize" {
+		s.initialized = true
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1, // the whole source is sent at each change
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"documentSymbolProvider":     true,
+				"completionProvider":         map[string]interface{}{},
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "hephaestus"},
+		}, nil
+	} else if !s.initialized {
+		return nil, &lspError{Code: LSP_SERVER_NOT_STARTED, Message: "server not initialized"}
+	}
+
+	doc := s.documents[params.TextDocument.URI]
+	switch msg.Method {
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		doc = &lspDocument{uri: params.TextDocument.URI}
+		s.documents[doc.uri] = doc
+		return nil, s.update(doc, params.TextDocument.Text)
+	case "textDocument/didChange":
+		if doc == nil || len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.update(doc, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics",
+			map[string]interface{}{"uri": params.TextDocument.URI, "diagnostics": []lspDiagnostic{}})
+	}
+
+	if doc == nil && strings.HasPrefix(msg.Method, "textDocument/") {
+		return nil, &lspError{Code: LSP_INVALID_PARAMS, Message: "document not opened: " + params.TextDocument.URI}
+	}
+	switch msg.Method {
+	case "textDocument/hover":
+		return doc.hover(doc.offset(params.Position)), nil
+	case "textDocument/definition":
+		return doc.definition(doc.offset(params.Position)), nil
+	case "textDocument/documentSymbol":
+		return doc.symbols(), nil
+	case "textDocument/completion":
+		return doc.completion(doc.offset(params.Position)), nil
+	case "textDocument/formatting":
+		return doc.format()
+	}
+	if msg.ID == nil {
+		return nil, nil
+	}
+	return nil, &lspError{Code: LSP_METHOD_NOT_FOUND, Message: "method not found: " + msg.Method}
+}
+
+// update replaces the source of the document, analyzes it and publishes its diagnostics: the error of the parser
+// or of the checker, or the warnings of the checker.
+func (s *lspServer) update(doc *lspDocument, text string) error {
+	doc.text = []rune(text)
+	doc.lines = []int{0}
+	for i, r := range doc.text {
+		if r == '\n' {
+			doc.lines = append(doc.lines, i+1)
+		}
+	}
+
+	diagnostics := []lspDiagnostic{}
+	program, err := NewParser(strings.NewReader(text)).Parse2()
+	c := newChecker()
+	if err == nil {
+		err = c.checkProgram(program)
+	}
+	if err != nil {
+		// the innermost error has the most precise position
+		message, position := errorMessage(err)
+		diagnostics = append(diagnostics, lspDiagnostic{Range: doc.tokenRange(position), Severity: LSP_SEVERITY_ERROR,
+			Source: "hephaestus", Message: message})
+		doc.stale = true
+	} else {
+		doc.program, doc.checker, doc.stale = program, c, false
+		doc.tokens = nil
+		scanner := NewScanner(strings.NewReader(text))
+		for {
+			res, err := scanner.Scan()
+			if err != nil || res.tok == EOF {
+				break
+			} else if res.tok != WS && res.tok != COMMENT {
+				doc.tokens = append(doc.tokens, res)
+			}
+		}
+		for _, warning := range c.warnings {
+			diagnostics = append(diagnostics, lspDiagnostic{Range: doc.tokenRange(warning.position),
+				Severity: LSP_SEVERITY_WARNING, Source: "hephaestus", Message: warning.Message})
+		}
+	}
+	return s.notify("textDocument/publishDiagnostics",
+		map[string]interface{}{"uri": doc.uri, "diagnostics": diagnostics})
+}
+
+// position returns the position in the protocol of the rune at the offset: its line and its column in UTF-16
+// code units.
+func (d *lspDocument) position(offset int) lspPosition {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	} else if offset < 0 {
+		offset = 0
+	}
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > offset }) - 1
+	return lspPosition{Line: line, Character: len(utf16.Encode(d.text[d.lines[line]:offset]))}
+}
+
+// offset returns the offset of the rune at the position of the protocol.
+func (d *lspDocument) offset(position lspPosition) int {
+	if position.Line >= len(d.lines) {
+		return len(d.text)
+	} else if position.Line < 0 {
+		return 0
+	}
+	offset, units := d.lines[position.Line], 0
+	for offset < len(d.text) && d.text[offset] != '\n' && units < position.Character {
+		units += len(utf16.Encode([]rune{d.text[offset]}))
+		offset++
+	}
+	return offset
+}
+
+func (d *lspDocument) rangeOf(start, end int) lspRange {
+	return lspRange{Start: d.position(start), End: d.position(end)}
+}
+
+// tokenRange returns the range of the token starting at the position, empty if there is none.
+func (d *lspDocument) tokenRange(position *Position) lspRange {
+	if position == nil {
+		return d.rangeOf(0, 0)
+	}
+	scanner := NewScanner(strings.NewReader(string(d.text[minInt(position.pos, len(d.text)):])))
+	if res, err := scanner.Scan(); err == nil && res.tok != EOF && res.tok != WS {
+		return d.rangeOf(position.pos, position.pos+len([]rune(res.lit)))
+	}
+	return d.rangeOf(position.pos, position.pos)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// identifier returns the index of the identifier around the offset in the tokens, -1 if there is none.
+func (d *lspDocument) identifier(offset int) int {
+	if d.stale {
+		return -1
+	}
+	for i, token := range d.tokens {
+		if token.tok == IDENT && token.position.pos <= offset && offset <= token.position.pos+len([]rune(token.lit)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// declaration returns the range of the name declared at the position: the first identifier with this name from
+// the position, which is the name itself or the type of a declaration.
+func (d *lspDocument) declaration(name string, position *Position) lspRange {
+	for _, token := range d.tokens {
+		if token.tok == IDENT && token.lit == name && token.position.pos >= position.pos {
+			return d.rangeOf(token.position.pos, token.position.pos+len([]rune(name)))
+		}
+	}
+	return d.rangeOf(position.pos, position.pos)
+}
+
+// function returns the function whose declaration contains the offset, nil if there is none.
+func (d *lspDocument) function(offset int) *Function {
+	for i := range d.program.Functions {
+		function := &d.program.Functions[i]
+		if function.ReturnType.position.pos <= offset && offset <= function.end.pos {
+			return function
+		}
+	}
+	return nil
+}
+
+// lspReference is the declaration named by an identifier of the source.
+type lspReference struct {
+	sym      *symbol
+	function *Function
+	enum     *Enum
+}
+
+// resolve returns the declaration named by the identifier of index i in the tokens, as the checker resolves it:
+// an enumeration after enum, a function before an open parenthesis, otherwise a local variable of the function
+// around the identifier or a global variable.
+func (d *lspDocument) resolve(i int) (lspReference, bool) {
+	token := d.tokens[i]
+	c := d.checker
+	if i > 0 && d.tokens[i-1].tok == ENUM {
+		enum, ok := c.enums[token.lit]
+		return lspReference{enum: enum}, ok
+	} else if i+1 < len(d.tokens) && d.tokens[i+1].tok == OPEN_PARENTHESIS {
+		function, ok := c.functions[token.lit]
+		return lspReference{function: function}, ok
+	}
+	if function := d.function(token.position.pos); function != nil {
+		if sym, ok := c.scopes[function.Name][token.lit]; ok {
+			return lspReference{sym: sym}, true
+		}
+	}
+	sym, ok := c.globals[token.lit]
+	return lspReference{sym: sym}, ok
+}
+
+func (d *lspDocument) hover(offset int) *lspHover {
+	i := d.identifier(offset)
+	if i < 0 {
+		return nil
+	}
+	ref, ok := d.resolve(i)
+	if !ok {
+		return nil
+	}
+	var text string
+	switch {
+	case ref.enum != nil:
+		var values []string
+		for _, value := range ref.enum.Values {
+			values = append(values, value.Name)
+		}
+		text = "enum " + ref.enum.Name + " { " + strings.Join(values, ", ") + " }"
+	case ref.function != nil:
+		text = functionSignature(ref.function)
+	default:
+		text = symbolDeclaration(ref.sym)
+	}
+	token := d.tokens[i]
+	hover := &lspHover{Range: d.rangeOf(token.position.pos, token.position.pos+len([]rune(token.lit)))}
+	hover.Contents.Kind = "markdown"
+	hover.Contents.Value = "```hephaestus\n" + text + "\n```"
+	if ref.sym != nil && ref.sym.inferred != nil {
+		hover.Contents.Value += fmt.Sprintf("\n\nType inferred from the assignment at line %d.", ref.sym.inferred.line)
+	}
+	return hover
+}
+
+// symbolDeclaration returns the declaration of a variable with its type, as written in the source.
+func symbolDeclaration(sym *symbol) string {
+	switch {
+	case sym.enumValue != nil:
+		return fmt.Sprintf("%s %s = %d", typeName(sym.typeVar), sym.name, sym.enumValue.Value)
+	case sym.typeVar == nil:
+		return sym.name + " // type unknown"
+	case sym.constant:
+		return "const " + typeName(sym.typeVar) + " " + sym.name
+	case sym.param:
+		return typeName(sym.typeVar) + " " + sym.name + " // parameter"
+	}
+	return typeName(sym.typeVar) + " " + sym.name
+}
+
+func (d *lspDocument) definition(offset int) *lspLocation {
+	i := d.identifier(offset)
+	if i < 0 {
+		return nil
+	}
+	ref, ok := d.resolve(i)
+	if !ok {
+		return nil
+	}
+	switch {
+	case ref.enum != nil:
+		return &lspLocation{URI: d.uri, Range: d.declaration(ref.enum.Name, ref.enum.position)}
+	case ref.function != nil:
+		return &lspLocation{URI: d.uri, Range: d.declaration(ref.function.Name, ref.function.position)}
+	}
+	return &lspLocation{URI: d.uri, Range: d.declaration(ref.sym.name, ref.sym.position)}
+}
+
+// symbols returns the enumerations with their values, the global variables and the functions with their
+// parameters and their local variables, in the order of the source.
+func (d *lspDocument) symbols() []lspDocumentSymbol {
+	symbols := []lspDocumentSymbol{}
+	if d.stale {
+		return symbols
+	}
+	for i := range d.program.Enums {
+		enum := &d.program.Enums[i]
+		name := d.declaration(enum.Name, enum.position)
+		symbol := lspDocumentSymbol{Name: enum.Name, Kind: LSP_SYMBOL_ENUM, Range: name, SelectionRange: name}
+		for _, value := range enum.Values {
+			name := d.declaration(value.Name, value.position)
+			symbol.Children = append(symbol.Children, lspDocumentSymbol{Name: value.Name,
+				Detail: strconv.Itoa(value.Value), Kind: LSP_SYMBOL_ENUM_MEMBER, Range: name, SelectionRange: name})
+		}
+		symbols = append(symbols, symbol)
+	}
+	symbols = append(symbols, d.variables(d.checker.globals)...)
+	for i := range d.program.Functions {
+		function := &d.program.Functions[i]
+		symbols = append(symbols, lspDocumentSymbol{Name: function.Name, Detail: functionSignature(function),
+			Kind: LSP_SYMBOL_FUNCTION, Range: d.rangeOf(function.ReturnType.position.pos, function.end.pos+1),
+			SelectionRange: d.declaration(function.Name, function.position),
+			Children:       d.variables(d.checker.scopes[function.Name])})
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		a, b := symbols[i].SelectionRange.Start, symbols[j].SelectionRange.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+	})
+	return symbols
+}
+
+// variables returns the symbols of the variables of the scope, without the values of the enumerations, in the
+// order of the source.
+func (d *lspDocument) variables(scope map[string]*symbol) []lspDocumentSymbol {
+	var syms []*symbol
+	for _, sym := range scope {
+		if sym.enumValue == nil {
+			syms = append(syms, sym)
+		}
+	}
+	sort.Slice(syms, func(i, j int) bool { return syms[i].position.pos < syms[j].position.pos })
+	var symbols []lspDocumentSymbol
+	for _, sym := range syms {
+		name := d.declaration(sym.name, sym.position)
+		kind := LSP_SYMBOL_VARIABLE
+		if sym.constant {
+			kind = LSP_SYMBOL_CONSTANT
+		}
+		detail := ""
+		if sym.typeVar != nil {
+			detail = typeName(sym.typeVar)
+		}
+		symbols = append(symbols, lspDocumentSymbol{Name: sym.name, Detail: detail, Kind: kind, Range: name,
+			SelectionRange: name})
+	}
+	return symbols
+}
+
+// completion returns the names visible at the offset: the local variables of the function around it, the global
+// variables, the functions, the enumerations and their values, then the keywords. The last valid analysis of
+// the source is used while the source is being edited.
+func (d *lspDocument) completion(offset int) []lspCompletionItem {
+	items := []lspCompletionItem{}
+	if d.checker != nil {
+		c := d.checker
+		seen := make(map[string]bool)
+		variables := func(scope map[string]*symbol) {
+			var names []string
+			for name := range scope {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				sym := scope[name]
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				item := lspCompletionItem{Label: name, Kind: LSP_COMPLETION_VARIABLE}
+				if sym.enumValue != nil {
+					item.Kind = LSP_COMPLETION_ENUM_MEMBER
+				} else if sym.constant {
+					item.Kind = LSP_COMPLETION_CONSTANT
+				}
+				if sym.typeVar != nil {
+					item.Detail = typeName(sym.typeVar)
+				}
+				items = append(items, item)
+			}
+		}
+		if function := d.function(offset); function != nil {
+			variables(c.scopes[function.Name])
+		}
+		variables(c.globals)
+
+		var names []string
+		for name := range c.functions {
+			names = append(names, name)
+		}
+		for name := range builtinFunctions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			item := lspCompletionItem{Label: name, Kind: LSP_COMPLETION_FUNCTION}
+			if function, ok := c.functions[name]; ok {
+				item.Detail = functionSignature(function)
+			}
+			items = append(items, item)
+		}
+		names = nil
+		for name := range c.enums {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			items = append(items, lspCompletionItem{Label: name, Kind: LSP_COMPLETION_ENUM, Detail: "enum " + name})
+		}
+	}
+	for _, keyword := range lspKeywords {
+		items = append(items, lspCompletionItem{Label: keyword, Kind: LSP_COMPLETION_KEYWORD})
+	}
+	return items
+}
+
+// format returns the edit replacing the source by its canonical form, none if it is already formatted.
+func (d *lspDocument) format() ([]lspTextEdit, error) {
+	code, err := Format([]byte(string(d.text)))
+	if err != nil {
+		return nil, err
+	} else if bytes.Equal(code, []byte(string(d.text))) {
+		return []lspTextEdit{}, nil
+	}
+	return []lspTextEdit{{Range: d.rangeOf(0, len(d.text)), NewText: string(code)}}, nil
+}
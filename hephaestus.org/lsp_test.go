@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// lspClient is a client of the language server for the tests, which sends the messages of a script.
+type lspClient struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	id     int
+	exited chan int
+}
+
+func newLSPClient(t *testing.T) *lspClient {
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+	c := &lspClient{t: t, w: clientW, r: bufio.NewReader(clientR), exited: make(chan int, 1)}
+	go func() {
+		exitCode, err := ServeLSP(serverR, serverW)
+		if err != nil {
+			t.Errorf("server error: %v", err)
+		}
+		serverW.Close()
+		c.exited <- exitCode
+	}()
+	return c
+}
+
+func (c *lspClient) send(msg map[string]interface{}) {
+	msg["jsonrpc"] = "2.0"
+	content, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// receive reads the next message of the server.
+func (c *lspClient) receive() lspMessage {
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.r, content); err != nil {
+		c.t.Fatal(err)
+	}
+	var msg lspMessage
+	if err := json.Unmarshal(content, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// request sends a request and decodes the result of its response in result.
+func (c *lspClient) request(method string, params interface{}, result interface{}) *lspError {
+	c.id++
+	c.send(map[string]interface{}{"id": c.id, "method": method, "params": params})
+	msg := c.receive()
+	if string(msg.ID) != strconv.Itoa(c.id) {
+		c.t.Fatalf("%s: unexpected response %+v", method, msg)
+	} else if msg.Error != nil {
+		return msg.Error
+	} else if err := json.Unmarshal(msg.Result, result); err != nil {
+		c.t.Fatalf("%s: invalid result %s: %v", method, msg.Result, err)
+	}
+	return nil
+}
+
+// diagnostics reads the diagnostics published by the server.
+func (c *lspClient) diagnostics() []lspDiagnostic {
+	msg := c.receive()
+	var params struct {
+		URI         string          `json:"uri"`
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	}
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %+v", msg)
+	} else if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	return params.Diagnostics
+}
+
+func lspRangeOf(line, start, end int) lspRange {
+	return lspRange{Start: lspPosition{Line: line, Character: start}, End: lspPosition{Line: line, Character: end}}
+}
+
+// Ensure the language server analyzes the documents opened by a client and answers its requests.
+func TestServeLSP(t *testing.T) {
+	const uri = "file:///test.he"
+	source := "enum Color { RED, GREEN };\n" +
+		"const int LIMIT = 10;\n" +
+		"int add(int a, int b) {\n" +
+		"    return a + b;\n" +
+		"}\n" +
+		"int main() {\n" +
+		"    total = add(1, LIMIT);\n" +
+		"    enum Color c = GREEN;\n" +
+		"    return total + c;\n" +
+		"}\n"
+	document := map[string]interface{}{"uri": uri}
+	at := func(line, character int) map[string]interface{} {
+		return map[string]interface{}{"textDocument": document,
+			"position": map[string]int{"line": line, "character": character}}
+	}
+
+	c := newLSPClient(t)
+	var hover *lspHover
+	if err := c.request("textDocument/hover", at(0, 0), &hover); err == nil || err.Code != LSP_SERVER_NOT_STARTED {
+		t.Errorf("unexpected error before initialize: %v", err)
+	}
+	var initialize struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	if err := c.request("initialize", map[string]interface{}{}, &initialize); err != nil {
+		t.Fatal(err)
+	} else if initialize.Capabilities["hoverProvider"] != true {
+		t.Errorf("unexpected capabilities %v", initialize.Capabilities)
+	}
+	c.send(map[string]interface{}{"method": "initialized", "params": map[string]interface{}{}})
+
+	c.send(map[string]interface{}{"method": "textDocument/didOpen", "params": map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "hephaestus", "version": 1,
+			"text": source}}})
+	if diagnostics := c.diagnostics(); len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics %+v", diagnostics)
+	}
+
+	for _, tt := range []struct {
+		line, character int
+		exp             string
+	}{
+		{line: 8, character: 12, exp: "```hephaestus\nint total\n```\n\nType inferred from the assignment at line 7."},
+		{line: 8, character: 19, exp: "```hephaestus\nenum Color c\n```"},
+		{line: 7, character: 11, exp: "```hephaestus\nenum Color { RED, GREEN }\n```"},
+		{line: 7, character: 20, exp: "```hephaestus\nenum Color GREEN = 1\n```"},
+		{line: 6, character: 14, exp: "```hephaestus\nint add(int a, int b)\n```"},
+		{line: 6, character: 21, exp: "```hephaestus\nconst int LIMIT\n```"},
+		{line: 3, character: 11, exp: "```hephaestus\nint a // parameter\n```"},
+	} {
+		var hover *lspHover
+		if err := c.request("textDocument/hover", at(tt.line, tt.character), &hover); err != nil {
+			t.Fatal(err)
+		} else if hover == nil || hover.Contents.Value != tt.exp {
+			t.Errorf("%d:%d: hover mismatch:\n  exp=%q\n  got=%+v", tt.line, tt.character, tt.exp, hover)
+		}
+	}
+	if err := c.request("textDocument/hover", at(3, 4), &hover); err != nil || hover != nil {
+		t.Errorf("unexpected hover of a keyword: %+v, %v", hover, err)
+	}
+
+	for _, tt := range []struct {
+		line, character int
+		exp             lspRange
+	}{
+		{line: 8, character: 14, exp: lspRangeOf(6, 4, 9)},
+		{line: 6, character: 12, exp: lspRangeOf(2, 4, 7)},
+		{line: 3, character: 15, exp: lspRangeOf(2, 19, 20)},
+		{line: 7, character: 22, exp: lspRangeOf(0, 18, 23)},
+		{line: 7, character: 9, exp: lspRangeOf(0, 5, 10)},
+	} {
+		var location *lspLocation
+		if err := c.request("textDocument/definition", at(tt.line, tt.character), &location); err != nil {
+			t.Fatal(err)
+		} else if location == nil || location.URI != uri || location.Range != tt.exp {
+			t.Errorf("%d:%d: definition mismatch: exp=%+v got=%+v", tt.line, tt.character, tt.exp, location)
+		}
+	}
+
+	var symbols []lspDocumentSymbol
+	if err := c.request("textDocument/documentSymbol", map[string]interface{}{"textDocument": document},
+		&symbols); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	var walk func(symbols []lspDocumentSymbol, prefix string)
+	walk = func(symbols []lspDocumentSymbol, prefix string) {
+		for _, symbol := range symbols {
+			got = append(got, fmt.Sprintf("%s%s %d %s %d:%d", prefix, symbol.Name, symbol.Kind, symbol.Detail,
+				symbol.SelectionRange.Start.Line, symbol.SelectionRange.Start.Character))
+			walk(symbol.Children, prefix+"  ")
+		}
+	}
+	walk(symbols, "")
+	if exp := []string{"Color 10  0:5", "  RED 22 0 0:13", "  GREEN 22 1 0:18", "LIMIT 14 int 1:10",
+		"add 12 int add(int a, int b) 2:4", "  a 13 int 2:12", "  b 13 int 2:19",
+		"main 12 int main() 5:4", "  total 13 int 6:4", "  c 13 enum Color 7:15"}; !reflect.DeepEqual(exp, got) {
+		t.Errorf("symbols mismatch:\n  exp=%q\n  got=%q", exp, got)
+	}
+
+	// the completion uses the last valid analysis while the source is invalid
+	c.send(map[string]interface{}{"method": "textDocument/didChange", "params": map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]string{{"text": strings.Replace(source, "return total + c;", "return t", 1)}}}})
+	if diagnostics := c.diagnostics(); len(diagnostics) != 1 || diagnostics[0].Severity != LSP_SEVERITY_ERROR ||
+		diagnostics[0].Message != `expected instruction: found "}", expected ';'` ||
+		diagnostics[0].Range != lspRangeOf(9, 0, 1) {
+		t.Errorf("unexpected diagnostics %+v", diagnostics)
+	}
+	var items []lspCompletionItem
+	if err := c.request("textDocument/completion", at(8, 12), &items); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, item := range items {
+		got = append(got, item.Label)
+	}
+	if exp := append([]string{"c", "total", "GREEN", "LIMIT", "RED", "add", "main", "print", "Color"},
+		lspKeywords...); !reflect.DeepEqual(exp, got) {
+		t.Errorf("completion mismatch:\n  exp=%q\n  got=%q", exp, got)
+	}
+	if err := c.request("textDocument/hover", at(8, 11), &hover); err != nil || hover != nil {
+		t.Errorf("unexpected hover of an invalid source: %+v, %v", hover, err)
+	}
+	var edits []lspTextEdit
+	if err := c.request("textDocument/formatting", map[string]interface{}{"textDocument": document},
+		&edits); err == nil || err.Code != LSP_REQUEST_FAILED {
+		t.Errorf("unexpected formatting of an invalid source: %+v, %v", edits, err)
+	}
+
+	c.send(map[string]interface{}{"method": "textDocument/didChange", "params": map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 3},
+		"contentChanges": []map[string]string{{"text": "int main(){ x = 1; return 0; }"}}}})
+	if diagnostics := c.diagnostics(); len(diagnostics) != 1 || diagnostics[0].Severity != LSP_SEVERITY_WARNING ||
+		diagnostics[0].Message != "variable x is assigned but never read" || diagnostics[0].Range != lspRangeOf(0, 12, 13) {
+		t.Errorf("unexpected diagnostics %+v", diagnostics)
+	}
+	if err := c.request("textDocument/formatting", map[string]interface{}{"textDocument": document},
+		&edits); err != nil {
+		t.Fatal(err)
+	} else if exp := []lspTextEdit{{Range: lspRangeOf(0, 0, 30),
+		NewText: "int main() {\n    x = 1;\n    return 0;\n}\n"}}; !reflect.DeepEqual(exp, edits) {
+		t.Errorf("formatting mismatch:\n  exp=%+v\n  got=%+v", exp, edits)
+	}
+
+	var result interface{}
+	if err := c.request("textDocument/rename", at(0, 0), &result); err == nil || err.Code != LSP_METHOD_NOT_FOUND {
+		t.Errorf("unexpected result of an unknown method: %v, %v", result, err)
+	}
+	if err := c.request("shutdown", nil, &result); err != nil {
+		t.Fatal(err)
+	}
+	c.send(map[string]interface{}{"method": "exit"})
+	if exitCode := <-c.exited; exitCode != 0 {
+		t.Errorf("unexpected exit code %d", exitCode)
+	}
+}
+
+// Ensure the positions of the protocol count the characters of the lines in UTF-16 code units.
+func TestLSPDocument_position(t *testing.T) {
+	doc := &lspDocument{}
+	(&lspServer{w: io.Discard}).update(doc, "void main() {\n    print(\"\U0001F525é\"); print(\"a\");\n}")
+	for _, tt := range []struct {
+		offset   int
+		position lspPosition
+	}{
+		{offset: 0, position: lspPosition{Line: 0, Character: 0}},
+		{offset: 14, position: lspPosition{Line: 1, Character: 0}},
+		{offset: 25, position: lspPosition{Line: 1, Character: 11}},
+		{offset: 26, position: lspPosition{Line: 1, Character: 13}},
+		{offset: 27, position: lspPosition{Line: 1, Character: 14}},
+		{offset: 44, position: lspPosition{Line: 2, Character: 1}},
+	} {
+		if position := doc.position(tt.offset); position != tt.position {
+			t.Errorf("%d: position mismatch: exp=%+v got=%+v", tt.offset, tt.position, position)
+		} else if offset := doc.offset(position); offset != tt.offset {
+			t.Errorf("%+v: offset mismatch: exp=%d got=%d", position, tt.offset, offset)
+		}
+	}
+}
@@ -1,6 +1,634 @@
 package main
 
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
 func main() {
+	os.Exit(command(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// command executes the command line args and returns the exit code of the process.
+func command(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	switch args[0] {
+	case "run":
+		return runCommand(args[1:], stdout, stderr)
+	case "compile":
+		return compileCommand(args[1:], stdout, stderr)
+	case "to-go":
+		return transpileCommand("to-go", ".go", func(program *Program, source string) ([]byte, error) {
+			return TranspileGo(program, filepath.Base(source))
+		}, args[1:], stdout, stderr)
+	case "to-c":
+		return transpileCommand("to-c", ".c", TranspileC, args[1:], stdout, stderr)
+	case "to-wat":
+		return transpileCommand("to-wat", ".wat", func(program *Program, source string) ([]byte, error) {
+			return TranspileWat(program, filepath.Base(source))
+		}, args[1:], stdout, stderr)
+	case "to-llvm":
+		return transpileCommand("to-llvm", ".ll", TranspileLLVM, args[1:], stdout, stderr)
+	case "ir":
+		return irCommand(args[1:], stdout, stderr)
+	case "fix":
+		return fixCommand(args[1:], stdout, stderr)
+	case "fmt":
+		return fmtCommand(args[1:], os.Stdin, stdout, stderr)
+	case "lint":
+		return lintCommand(args[1:], stdout, stderr)
+	case "lsp":
+		return lspCommand(args[1:], os.Stdin, stdout, stderr)
+	case "dap":
+		return dapCommand(args[1:], os.Stdin, stdout, stderr)
+	case "repl":
+		return replCommand(args[1:], os.Stdin, stdout, stderr)
+	case "debug":
+		return debugCommand(args[1:], os.Stdin, stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: hephaestus <command> [arguments]\n\n")
+	fmt.Fprintf(w, "commands:\n")
+	fmt.Fprintf(w, "  run [flags] file      execute file.he or file.hbc, the exit code is the value returned by main\n")
+	fmt.Fprintf(w, "  compile [-O] [-Werror] [-o file.hbc] file.he\n")
+	fmt.Fprintf(w, "                        compile file.he to bytecode\n")
+	fmt.Fprintf(w, "  to-go [-O] [-Werror] [-o file.go] file.he\n")
+	fmt.Fprintf(w, "                        translate file.he to a Go program\n")
+	fmt.Fprintf(w, "  to-c [-O] [-Werror] [-o file.c] file.he\n")
+	fmt.Fprintf(w, "                        translate file.he to a C program\n")
+	fmt.Fprintf(w, "  to-wat [-O] [-Werror] [-o file.wat] file.he\n")
+	fmt.Fprintf(w, "                        translate file.he to a WebAssembly module in text format\n")
+	fmt.Fprintf(w, "  to-llvm [-O] [-Werror] [-o file.ll] file.he\n")
+	fmt.Fprintf(w, "                        translate file.he to a module of LLVM IR\n")
+	fmt.Fprintf(w, "  ir [-O] [-Werror] [-no-ssa] file.he\n")
+	fmt.Fprintf(w, "                        write the intermediate representation of file.he\n")
+	fmt.Fprintf(w, "  fix -add-types [-o file.he] file.he\n")
+	fmt.Fprintf(w, "                        declare the variables created by an assignment with their inferred type\n")
+	fmt.Fprintf(w, "  fmt [-w] [-l] [-d] [path ...]\n")
+	fmt.Fprintf(w, "                        format the files, or the standard input, in the canonical form\n")
+	fmt.Fprintf(w, "  lint [-config file] [-rules] path ...\n")
+	fmt.Fprintf(w, "                        report the constructions of the files against the rules of the linter\n")
+	fmt.Fprintf(w, "  debug [-b location]... [-w expr]... file.he\n")
+	fmt.Fprintf(w, "                        execute file.he, stopping at its breakpoints to inspect its variables\n")
+	fmt.Fprintf(w, "  repl [-max-steps n] [-max-depth n] [file.he]\n")
+	fmt.Fprintf(w, "                        evaluate the declarations, the statements and the expressions typed\n")
+	fmt.Fprintf(w, "  lsp                   run a language server speaking LSP on the standard input and output\n")
+	fmt.Fprintf(w, "  dap                   run a debug adapter speaking DAP on the standard input and output\n")
+}
+
+// buildOptions are the options of the commands reading the source of a program.
+type buildOptions struct {
+	optimize bool // simplify the program with Optimize
+	werror   bool // reject the program if the checker reports warnings
+}
+
+// register adds the flags of the options to the flags of a command.
+func (b *buildOptions) register(flags *flag.FlagSet) {
+	flags.BoolVar(&b.optimize, "O", false, "simplify the constant expressions of the program")
+	flags.BoolVar(&b.werror, "Werror", false, "report the warnings as errors")
+}
+
+// parseFile parses and checks the program in the file, as parse with the options. The warnings are written to
+// stderr.
+func parseFile(filename string, build buildOptions, stderr io.Writer) (*Program, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return build.parse(f, stderr)
+}
+
+// parse parses and checks the program. The warnings are written to stderr.
+func parse(r io.Reader, stderr io.Writer) (*Program, error) {
+	return buildOptions{}.parse(r, stderr)
+}
+
+// parse parses and checks the program, and optimizes it if requested. The warnings are written to stderr, as
+// errors rejecting the program if werror is set.
+func (b buildOptions) parse(r io.Reader, stderr io.Writer) (*Program, error) {
+	p := NewParser(r)
+	funct, err := p.Parse2()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Checker(funct); err != nil {
+		return nil, err
+	}
+	warnings := p.Warnings()
+	for _, warning := range warnings {
+		if b.werror {
+			fmt.Fprintf(stderr, "error : %s\n", warning)
+		} else {
+			fmt.Fprintf(stderr, "warning : %s\n", warning)
+		}
+	}
+	if b.werror && len(warnings) > 0 {
+		return nil, fmt.Errorf("%d warnings treated as errors", len(warnings))
+	}
+	if b.optimize {
+		if err := Optimize(funct); err != nil {
+			return nil, err
+		}
+	}
+	return funct, nil
+}
+
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	timeout := flags.Duration("timeout", 0, "maximum duration of the execution")
+	vm := flags.Bool("vm", false, "compile the program to bytecode and execute it with the virtual machine")
+	var build buildOptions
+	build.register(flags)
+	var limits Limits
+	flags.Int64Var(&limits.MaxSteps, "max-steps", 0, "maximum number of steps executed")
+	flags.IntVar(&limits.MaxCallDepth, "max-depth", 0, "maximum call depth")
+	flags.Int64Var(&limits.MaxMemory, "max-memory", 0, "maximum bytes held by variables")
+	flags.Int64Var(&limits.MaxOutput, "max-output", 0, "maximum bytes written")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(stderr, "usage: hephaestus run [flags] file\n")
+		return 2
+	}
+
+	interpreter, err := newInterpreter(flags.Arg(0), Options{Limits: limits, Stdout: stdout, VM: *vm}, build, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	res, err := interpreter.interpreterContext(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	return res.ExitCode
+}
+
+// newInterpreter returns the interpreter of the file: a module compiled by the compile command, executed with
+// the virtual machine, or a source file, which is parsed and checked with the options of build.
+func newInterpreter(filename string, options Options, build buildOptions, stderr io.Writer) (*Interpreter, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if IsModule(data) {
+		module, err := ReadModule(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return NewInterpreterFromModule(module, options), nil
+	}
+	program, err := build.parse(bytes.NewReader(data), stderr)
+	if err != nil {
+		return nil, err
+	}
+	return NewInterpreterWithOptions(program, options), nil
+}
+
+func compileCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("compile", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "output file, by default the source file with the extension .hbc")
+	var build buildOptions
+	build.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(stderr, "usage: hephaestus compile [-O] [-Werror] [-o file.hbc] file.he\n")
+		return 2
+	}
+
+	program, err := parseFile(flags.Arg(0), build, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	filename := *output
+	if filename == "" {
+		filename = strings.TrimSuffix(flags.Arg(0), filepath.Ext(flags.Arg(0))) + ".hbc"
+	}
+	var buf bytes.Buffer
+	if err := WriteModule(&buf, Compile(program)); err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(filename, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// transpileCommand translates the program of the file with transpile, to the standard output or to the file
+// given by -o, whose extension is ext.
+func transpileCommand(name, ext string, transpile func(program *Program, source string) ([]byte, error),
+	args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "output file, the standard output by default")
+	var build buildOptions
+	build.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(stderr, "usage: hephaestus %s [-O] [-Werror] [-o file%s] file.he\n", name, ext)
+		return 2
+	}
+
+	program, err := parseFile(flags.Arg(0), build, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	code, err := transpile(program, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	if *output == "" {
+		_, err = stdout.Write(code)
+	} else {
+		err = os.WriteFile(*output, code, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// irCommand writes the intermediate representation of the program of the file, in SSA form unless -no-ssa
+// is given.
+func irCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ir", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	noSSA := flags.Bool("no-ssa", false, "write the local variables before the construction of the SSA form")
+	var build buildOptions
+	build.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(stderr, "usage: hephaestus ir [-O] [-Werror] [-no-ssa] file.he\n")
+		return 2
+	}
+
+	program, err := parseFile(flags.Arg(0), build, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	ir, err := LowerIR(program)
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	if !*noSSA {
+		ir.BuildSSA()
+	}
+	if err := WriteIR(stdout, ir); err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// fixCommand rewrites the program of the file, in place unless -o is given. With -add-types, the variables created
+// by an assignment are declared with the type inferred from their first assignment.
+func fixCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fix", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	addTypes := flags.Bool("add-types", false, "declare the variables created by an assignment with their type")
+	output := flags.String("o", "", "output file, by default the source file is rewritten")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || !*addTypes {
+		fmt.Fprintf(stderr, "usage: hephaestus fix -add-types [-o file.he] file.he\n")
+		return 2
+	}
+
+	source, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	code, warnings, err := AddTypes(source)
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(stderr, "warning : %s\n", warning)
+	}
+	filename := *output
+	if filename == "" {
+		filename = flags.Arg(0)
+	}
+	if err := os.WriteFile(filename, code, 0o644); err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// fmtCommand formats the files, and the files .he of the directories, given as arguments, or the standard input.
+// The formatted source is written to the standard output, unless -l lists the files whose formatting differs,
+// -d writes the differences, or -w rewrites the files.
+func fmtCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result to the source file instead of the standard output")
+	list := flags.Bool("l", false, "list the files whose formatting differs")
+	diff := flags.Bool("d", false, "write the differences instead of the formatted source")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	exitCode := 0
+	format := func(filename string, source []byte) {
+		code, err := Format(source)
+		if err != nil {
+			fmt.Fprintf(stderr, "error : %s: %v\n", filename, err)
+			exitCode = 1
+			return
+		}
+		changed := !bytes.Equal(source, code)
+		if *list && changed {
+			fmt.Fprintln(stdout, filename)
+		}
+		if *write && changed {
+			if err := os.WriteFile(filename, code, 0o644); err != nil {
+				fmt.Fprintf(stderr, "error : %v\n", err)
+				exitCode = 1
+			}
+		}
+		if *diff && changed {
+			stdout.Write(diffLines(filename+".orig", filename, source, code))
+		}
+		if !*list && !*write && !*diff {
+			stdout.Write(code)
+		}
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(stderr, "error : cannot use -w with the standard input\n")
+			return 2
+		}
+		source, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "error : %v\n", err)
+			return 1
+		}
+		format("<standard input>", source)
+		return exitCode
+	}
+	for _, path := range flags.Args() {
+		if err := walkSources(path, format); err != nil {
+			fmt.Fprintf(stderr, "error : %v\n", err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// walkSources calls f with the source of the file path, or of the files .he of the directory path and its
+// subdirectories.
+func walkSources(path string, f func(filename string, source []byte)) error {
+	return filepath.WalkDir(path, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if entry.IsDir() || filename != path && filepath.Ext(filename) != ".he" {
+			return nil
+		}
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		f(filename, source)
+		return nil
+	})
+}
+
+// lintCommand reports the problems found by the linter in the files, and the files .he of the directories, given
+// as arguments. The rules are configured by the file given by -config, or by the file .helint of the current
+// directory if it exists. The exit code is 1 if a problem is found.
+func lintCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configFile := flags.String("config", "", "configuration of the rules, "+LINT_CONFIG_FILE+" by default")
+	rules := flags.Bool("rules", false, "list the rules of the linter")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *rules {
+		for _, rule := range lintRules {
+			if rule.Limit > 0 {
+				fmt.Fprintf(stdout, "%-20s %s (default %d)\n", rule.ID, rule.Description, rule.Limit)
+			} else {
+				fmt.Fprintf(stdout, "%-20s %s\n", rule.ID, rule.Description)
+			}
+		}
+		return 0
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintf(stderr, "usage: hephaestus lint [-config file] [-rules] path ...\n")
+		return 2
+	}
+
+	var config LintConfig
+	filename := *configFile
+	if filename == "" {
+		filename = LINT_CONFIG_FILE
+	}
+	if data, err := os.ReadFile(filename); err == nil {
+		if config, err = ReadLintConfig(bytes.NewReader(data)); err != nil {
+			fmt.Fprintf(stderr, "error : %s: %v\n", filename, err)
+			return 2
+		}
+	} else if *configFile != "" || !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 2
+	}
+
+	exitCode := 0
+	lint := func(filename string, source []byte) {
+		problems, err := Lint(source, config)
+		if err != nil {
+			fmt.Fprintf(stderr, "error : %s: %v\n", filename, err)
+			exitCode = 1
+			return
+		}
+		for _, problem := range problems {
+			fmt.Fprintf(stdout, "%s: %s\n", filename, problem)
+		}
+		if len(problems) > 0 {
+			exitCode = 1
+		}
+	}
+	for _, path := range flags.Args() {
+		if err := walkSources(path, lint); err != nil {
+			fmt.Fprintf(stderr, "error : %v\n", err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// lspCommand runs a language server on the standard input and output until the client exits.
+func lspCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	} else if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "usage: hephaestus lsp\n")
+		return 2
+	}
+	exitCode, err := ServeLSP(stdin, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+	}
+	return exitCode
+}
+
+// dapCommand runs a debug adapter on the standard input and output until the client disconnects.
+func dapCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("dap", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	} else if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "usage: hephaestus dap\n")
+		return 2
+	}
+	exitCode, err := ServeDAP(stdin, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+	}
+	return exitCode
+}
+
+// replCommand runs an interactive session on the standard input, after loading the declarations of the file given
+// as argument, if any.
+func replCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var limits Limits
+	flags.Int64Var(&limits.MaxSteps, "max-steps", 0, "maximum number of steps executed by an input")
+	// an infinite recursion must not end the session
+	flags.IntVar(&limits.MaxCallDepth, "max-depth", 10000, "maximum call depth")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	} else if flags.NArg() > 1 {
+		fmt.Fprintf(stderr, "usage: hephaestus repl [-max-steps n] [-max-depth n] [file.he]\n")
+		return 2
+	}
+
+	repl := NewRepl(stdout, limits)
+	if flags.NArg() == 1 {
+		if err := repl.Eval(":load " + flags.Arg(0)); err != nil {
+			fmt.Fprintf(stderr, "error : %v\n", err)
+			return 1
+		}
+	}
+	if err := repl.Run(stdin); err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// stringsFlag is a flag which can be repeated, its values are kept in their order.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ", ") }
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// debugCommand executes a program with the debugger, whose commands are read from the standard input when the
+// execution stops. The execution stops before the first instruction of main if no breakpoint is given.
+func debugCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var breakpoints, watches stringsFlag
+	flags.Var(&breakpoints, "b", "breakpoint on a line or a function, with an optional condition: 12, f if n == 0")
+	flags.Var(&watches, "w", "expression printed at each stop")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	} else if flags.NArg() != 1 {
+		fmt.Fprintf(stderr, "usage: hephaestus debug [-b location]... [-w expr]... file.he\n")
+		return 2
+	}
+
+	source, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	program, err := parse(bytes.NewReader(source), stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	console := &debugConsole{program: program, lines: strings.Split(string(source), "\n"),
+		in: bufio.NewScanner(stdin), out: stdout}
+	debugger := NewDebugger(console.stopped)
+	debugger.StopOnEntry = len(breakpoints) == 0
+	for _, arg := range breakpoints {
+		if _, err := console.addBreakpoint(debugger, arg); err != nil {
+			fmt.Fprintf(stderr, "error : %v\n", err)
+			return 2
+		}
+	}
+	for _, expr := range watches {
+		if err := debugger.AddWatch(expr); err != nil {
+			fmt.Fprintf(stderr, "error : %v\n", err)
+			return 2
+		}
+	}
 
-	parser()
+	res, err := NewInterpreterWithOptions(program, Options{Stdout: stdout, Debugger: debugger}).interpreter()
+	if errors.Is(err, ErrDebugAbort) {
+		fmt.Fprintf(stderr, "error : %v\n", ErrDebugAbort)
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(stderr, "error : %v\n", err)
+		return 1
+	}
+	return res.ExitCode
 }
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Ensure the run command executes a file and exits with the value returned by main.
+func TestCommand_run(t *testing.T) {
+	var tests = []struct {
+		args     []string
+		s        string
+		exitCode int
+		stdout   string
+		stderr   string
+	}{
+		{args: []string{"run"}, s: `int main () { x=5;return x+3;}`, exitCode: 8, stdout: "function main\nx=5\nreturn 8\n"},
+		{args: []string{"run"}, s: `void main () { print("abc");}`, exitCode: 0, stdout: "function main\nprint(abc)\n"},
+		{args: []string{"run", "-vm"}, s: `int main () { x=5;return x+3;}`, exitCode: 8, stdout: "function main\nx=5\nreturn 8\n"},
+		{args: []string{"run", "-vm", "-max-steps", "1"}, s: `int main () { x=5;return x+3;}`, exitCode: 1,
+			stdout: "function main\n", stderr: "error : error: step limit exceeded (limit=1, pos=&{1 1 16})\n"},
+		{args: []string{"run", "-max-steps", "1"}, s: `int main () { x=5;return x+3;}`, exitCode: 1,
+			stdout: "function main\n", stderr: "error : error: step limit exceeded (limit=1, pos=&{1 1 16})\n"},
+		{args: []string{"run"}, s: `int main () { x=y;return 0;}`, exitCode: 1,
+			stderr: "error : variable y not declared (pos=&{1 1 16})\n"},
+		{args: []string{"run"}, s: `int main () { x=;}`, exitCode: 1,
+			stderr: "error : expected instruction: invalid expression: found \";\", expected number or ident or string (pos=&{1 1 16})\n"},
+		{args: []string{"run", "-O", "-max-steps", "4"}, s: `int main () { x=5;return x+3;}`, exitCode: 8,
+			stdout: "function main\nx=5\nreturn 8\n"},
+		{args: []string{"run", "-O"}, s: `int main () { x=0;return 3/x;}`, exitCode: 1,
+			stderr: "error : division by zero in constant expression (pos=&{1 1 26})\n"},
+		{args: []string{"run", "-Werror"}, s: `int main () { x=5;return 3;}`, exitCode: 1,
+			stderr: "error : variable x is assigned but never read (pos=&{1 1 14})\nerror : 1 warnings treated as errors\n"},
+		{args: []string{}, exitCode: 2},
+	}
+
+	for i, tt := range tests {
+		args := tt.args
+		if tt.s != "" {
+			filename := filepath.Join(t.TempDir(), "test.he")
+			if err := os.WriteFile(filename, []byte(tt.s), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			args = append(args, filename)
+		}
+		var stdout, stderr bytes.Buffer
+		exitCode := command(args, &stdout, &stderr)
+		if tt.exitCode != exitCode {
+			t.Errorf("%d. %q: exit code mismatch: exp=%d got=%d (stderr=%q)", i, tt.s, tt.exitCode, exitCode, stderr.String())
+		} else if tt.stdout != stdout.String() {
+			t.Errorf("%d. %q: stdout mismatch:\n  exp=%q\n  got=%q\n\n", i, tt.s, tt.stdout, stdout.String())
+		} else if tt.stderr != "" && tt.stderr != stderr.String() {
+			t.Errorf("%d. %q: stderr mismatch:\n  exp=%q\n  got=%q\n\n", i, tt.s, tt.stderr, stderr.String())
+		}
+	}
+}
+
+// Ensure the compile command writes a module the run command executes.
+func TestCommand_compile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "test.he")
+	if err := os.WriteFile(source, []byte(`int main () { x=5;return x/0;}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := command([]string{"compile", source}, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("compile: exit code %d (stderr=%q)", exitCode, stderr.String())
+	}
+	output := filepath.Join(dir, "out.hbc")
+	if exitCode := command([]string{"compile", "-o", output, source}, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("compile -o: exit code %d (stderr=%q)", exitCode, stderr.String())
+	}
+	for _, filename := range []string{filepath.Join(dir, "test.hbc"), output} {
+		stdout.Reset()
+		stderr.Reset()
+		exitCode := command([]string{"run", filename}, &stdout, &stderr)
+		if exitCode != 1 || stdout.String() != "function main\nx=5\n" ||
+			stderr.String() != "error : error: error: division by zero (pos=&{1 1 26})\n" {
+			t.Errorf("%s: unexpected result: exit code %d, stdout=%q, stderr=%q", filename, exitCode, stdout.String(),
+				stderr.String())
+		}
+	}
+
+	if err := os.WriteFile(output, []byte(moduleMagic+"\x01"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if exitCode := command([]string{"run", output}, &stdout, &stderr); exitCode != 1 ||
+		stderr.String() != "error : invalid module: truncated\n" {
+		t.Errorf("unexpected result for an invalid module: exit code %d, stderr=%q", exitCode, stderr.String())
+	}
+}
+
+// Ensure the commands translating a program write it to the standard output or to a file, and report the
+// programs they cannot translate.
+func TestCommand_transpile(t *testing.T) {
+	for _, tt := range []struct {
+		command string
+		header  string
+	}{
+		{command: "to-go", header: "// Code generated by hephaestus to-go from test.he. DO NOT EDIT.\n"},
+		{command: "to-c", header: "/* Code generated by hephaestus to-c from %s. DO NOT EDIT. */\n"},
+		{command: "to-wat", header: ";; Code generated by hephaestus to-wat from test.he. DO NOT EDIT.\n"},
+		{command: "to-llvm", header: "; Code generated by hephaestus to-llvm from %s. DO NOT EDIT.\n"},
+	} {
+		dir := t.TempDir()
+		source := filepath.Join(dir, "test.he")
+		if err := os.WriteFile(source, []byte(`int main () { x=5;return x+3;}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		if exitCode := command([]string{tt.command, source}, &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("%s: exit code %d (stderr=%q)", tt.command, exitCode, stderr.String())
+		}
+		if header := strings.Replace(tt.header, "%s", source, 1); !strings.HasPrefix(stdout.String(), header) {
+			t.Errorf("%s: unexpected output: %q", tt.command, stdout.String())
+		}
+		output := filepath.Join(dir, "out")
+		if exitCode := command([]string{tt.command, "-o", output, source}, &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("%s -o: exit code %d (stderr=%q)", tt.command, exitCode, stderr.String())
+		}
+		if data, err := os.ReadFile(output); err != nil {
+			t.Fatal(err)
+		} else if string(data) != stdout.String() {
+			t.Errorf("%s: %s: content mismatch:\n  exp=%q\n  got=%q", tt.command, output, stdout.String(), data)
+		}
+
+		if err := os.WriteFile(source, []byte(`int main () { x = 1; x = "a"; return 0; }`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		stderr.Reset()
+		if exitCode := command([]string{tt.command, source}, &stdout, &stderr); exitCode != 1 ||
+			stderr.String() != "error : cannot assign string to variable x of type int inferred at line 1 (pos=&{1 1 25})\n" {
+			t.Errorf("%s: unexpected result for a dynamically typed program: exit code %d, stderr=%q", tt.command,
+				exitCode, stderr.String())
+		}
+	}
+}
+
+// Ensure the command ir writes the intermediate representation, in SSA form unless -no-ssa is given.
+func TestCommand_ir(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "test.he")
+	if err := os.WriteFile(source, []byte(`int main () { x=5;return x+3;}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		args []string
+		exp  string
+	}{
+		{args: []string{source}, exp: "  x.1 = copy 5\n  trace \"x=\", 5, \"\\n\"\n  %2 = add x.1, 3\n"},
+		{args: []string{"-no-ssa", source}, exp: "  x = copy 5\n  trace \"x=\", 5, \"\\n\"\n  %1 = copy x\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := command(append([]string{"ir"}, tt.args...), &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("%v: exit code %d (stderr=%q)", tt.args, exitCode, stderr.String())
+		} else if !strings.Contains(stdout.String(), tt.exp) {
+			t.Errorf("%v: unexpected output:\n%s", tt.args, stdout.String())
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := command([]string{"ir"}, &stdout, &stderr); exitCode != 2 ||
+		stderr.String() != "usage: hephaestus ir [-O] [-Werror] [-no-ssa] file.he\n" {
+		t.Errorf("unexpected result without file: exit code %d, stderr=%q", exitCode, stderr.String())
+	}
+}
+
+// Ensure the command fix rewrites the file with the types of the variables, or writes the file given by -o.
+func TestCommand_fix(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "test.he")
+	if err := os.WriteFile(source, []byte(`int main () { x=5;return x+3;}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.he")
+	for _, tt := range []struct {
+		args     []string
+		filename string
+	}{
+		{args: []string{"-add-types", "-o", output, source}, filename: output},
+		{args: []string{"--add-types", source}, filename: source},
+	} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := command(append([]string{"fix"}, tt.args...), &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("%v: exit code %d (stderr=%q)", tt.args, exitCode, stderr.String())
+		}
+		if data, err := os.ReadFile(tt.filename); err != nil {
+			t.Fatal(err)
+		} else if string(data) != `int main () { int x=5;return x+3;}` {
+			t.Errorf("%v: unexpected content: %q", tt.args, data)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := command([]string{"fix", source}, &stdout, &stderr); exitCode != 2 ||
+		stderr.String() != "usage: hephaestus fix -add-types [-o file.he] file.he\n" {
+		t.Errorf("unexpected result without -add-types: exit code %d, stderr=%q", exitCode, stderr.String())
+	}
+}
+
+// Ensure the command fmt writes the formatted files, lists them with -l, writes the differences with -d and
+// rewrites them with -w.
+func TestCommand_fmt(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "test.he")
+	if err := os.WriteFile(source, []byte("int main () { x=5;\n  return x+3;}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	formatted := "int main() {\n    x = 5;\n    return x + 3;\n}\n"
+	for _, tt := range []struct {
+		args []string
+		exp  string
+	}{
+		{args: []string{source}, exp: formatted},
+		{args: []string{"-l", dir}, exp: source + "\n"},
+		{args: []string{"-d", source}, exp: "--- " + source + ".orig\n+++ " + source + "\n@@ -1,2 +1,4 @@\n" +
+			"-int main () { x=5;\n-  return x+3;}\n\\ No newline at end of file\n" +
+			"+int main() {\n+    x = 5;\n+    return x + 3;\n+}\n"},
+		{args: []string{"-w", source}},
+		{args: []string{"-l", "-d", source}},
+	} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := command(append([]string{"fmt"}, tt.args...), &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("%v: exit code %d (stderr=%q)", tt.args, exitCode, stderr.String())
+		} else if stdout.String() != tt.exp {
+			t.Errorf("%v: unexpected output:\n  exp=%q\n  got=%q", tt.args, tt.exp, stdout.String())
+		}
+	}
+	if data, err := os.ReadFile(source); err != nil {
+		t.Fatal(err)
+	} else if string(data) != formatted {
+		t.Errorf("unexpected content: %q", data)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := fmtCommand(nil, strings.NewReader("void main () {"), &stdout, &stderr); exitCode != 1 ||
+		stderr.String() != "error : <standard input>: expected instruction: found \"\", expected identifier (pos=&{1 1 13})\n" {
+		t.Errorf("unexpected result for an invalid program: exit code %d, stderr=%q", exitCode, stderr.String())
+	}
+}
+
+// Ensure the lint command reports the problems of the files with the rules of the configuration.
+func TestCommand_lint(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "test.he")
+	if err := os.WriteFile(source, []byte("int main () {\n  Total = 42;\n  return Total;\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "lint.conf")
+	if err := os.WriteFile(config, []byte("magic-number = off\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		args     []string
+		exitCode int
+		exp      string
+	}{
+		{args: []string{dir}, exitCode: 1,
+			exp: source + ": variable Total should be named in lowerCamelCase [naming] (pos=&{2 1 16})\n" +
+				source + ": magic number 42, use a named constant [magic-number] (pos=&{2 1 24})\n"},
+		{args: []string{"-config", config, source}, exitCode: 1,
+			exp: source + ": variable Total should be named in lowerCamelCase [naming] (pos=&{2 1 16})\n"},
+		{args: []string{"-config", config, "../examples"}},
+	} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := command(append([]string{"lint"}, tt.args...), &stdout, &stderr); exitCode != tt.exitCode {
+			t.Errorf("%v: exit code mismatch: exp=%d got=%d (stderr=%q)", tt.args, tt.exitCode, exitCode,
+				stderr.String())
+		} else if stdout.String() != tt.exp {
+			t.Errorf("%v: unexpected output:\n  exp=%q\n  got=%q", tt.args, tt.exp, stdout.String())
+		}
+	}
+
+	if err := os.WriteFile(config, []byte("nesting = never\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if exitCode := command([]string{"lint", "-config", config, source}, &stdout, &stderr); exitCode != 2 ||
+		stderr.String() != "error : "+config+": invalid value \"never\" of rule nesting, expected on, off or a limit "+
+			"(line 1)\n" {
+		t.Errorf("unexpected result for an invalid configuration: exit code %d, stderr=%q", exitCode, stderr.String())
+	}
+}
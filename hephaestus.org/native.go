@@ -0,0 +1,638 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// typeUnknown is the type of an expression whose type is not inferred yet.
+const typeUnknown TypeCode = -1
+
+// nativeProgram is a program with the static information needed to translate it to native code: the variable
+// each name refers to, the variables checked at runtime, and the type of the variables and of the expressions.
+//
+// The interpreter resolves the names and types the values at runtime. The translation follows the same rules
+// statically, and the programs whose behavior depends on the dynamic rules are rejected: a variable with values
+// of several types, a local variable which may or may not hide a global variable, or a global variable used by
+// a function before its initialization.
+type nativeProgram struct {
+	program   *Program
+	functions map[string]*Function
+	constants map[string]*EnumValue
+	globals   []*nativeVariable
+	locals    map[*Function][]*nativeVariable // parameters first
+	reads     map[*Expression]nativeAccess    // variable read by EXPR_CODE_VAR and by the updates of a variable
+	writes    map[*Expression]*nativeVariable // variable assigned by an expression
+	stores    map[*Instruction]*nativeVariable
+	traces    map[*Instruction]nativeAccess // variable read to trace an expression instruction
+	reached   map[*Instruction]bool         // the instruction may be executed
+	noValue   map[*Function]bool            // the function declares a type but may return no value
+	expected  map[*Expression]TypeCode      // type expected from a read of a variable not declared
+}
+
+// nativeVariable is a variable of a program translated to native code.
+type nativeVariable struct {
+	Name     string
+	Global   bool
+	Type     *Type    // declared type, nil if the variable is created by an assignment
+	Code     TypeCode // type of the values
+	Checked  bool     // the variable may be read before it is set, the reads are checked at runtime
+	position *Position
+}
+
+// nativeAccess is the value read for a name: a variable, a constant of an enumeration, or none if the variable
+// is not declared.
+type nativeAccess struct {
+	variable *nativeVariable
+	checked  bool // the variable may not be set
+	constant *EnumValue
+}
+
+// assignState tells which variables are set at a point of the execution.
+type assignState struct {
+	reachable bool
+	set       map[*nativeVariable]bool // set on every path
+	maybe     map[*nativeVariable]bool // set on some paths
+}
+
+func (s assignState) copy() assignState {
+	res := assignState{reachable: s.reachable, set: make(map[*nativeVariable]bool),
+		maybe: make(map[*nativeVariable]bool)}
+	for v := range s.set {
+		res.set[v] = true
+	}
+	for v := range s.maybe {
+		res.maybe[v] = true
+	}
+	return res
+}
+
+// merge returns the state after either s or s2.
+func (s assignState) merge(s2 assignState) assignState {
+	if !s.reachable {
+		return s2.copy()
+	} else if !s2.reachable {
+		return s.copy()
+	}
+	res := s.copy()
+	for v := range s.set {
+		if !s2.set[v] {
+			delete(res.set, v)
+		}
+	}
+	for v := range s2.maybe {
+		res.maybe[v] = true
+	}
+	return res
+}
+
+// nativeAnalyzer resolves the names of a function, or of the initializers of the global variables.
+type nativeAnalyzer struct {
+	*nativeProgram
+	function *Function // nil for the initializers of the global variables
+	scope    map[string]*nativeVariable
+	global   map[string]*nativeVariable
+	state    assignState
+	breaks   [][]assignState // states at the breaks of the enclosing switches
+	calls    []string        // functions called
+	used     []*nativeVariable
+}
+
+// analyzeProgram resolves the names and infers the types of the checked program.
+func analyzeProgram(program *Program) (*nativeProgram, error) {
+	p := &nativeProgram{program: program, functions: make(map[string]*Function),
+		constants: make(map[string]*EnumValue), locals: make(map[*Function][]*nativeVariable),
+		reads: make(map[*Expression]nativeAccess), writes: make(map[*Expression]*nativeVariable),
+		stores: make(map[*Instruction]*nativeVariable), traces: make(map[*Instruction]nativeAccess),
+		reached: make(map[*Instruction]bool), noValue: make(map[*Function]bool),
+		expected: make(map[*Expression]TypeCode)}
+	for i := range program.Enums {
+		for j := range program.Enums[i].Values {
+			p.constants[program.Enums[i].Values[j].Name] = &program.Enums[i].Values[j]
+		}
+	}
+	for i := range program.Functions {
+		p.functions[program.Functions[i].Name] = &program.Functions[i]
+	}
+
+	globals := make(map[string]*nativeVariable)
+	for i := range program.Globals {
+		assignedVariables(program.Globals[i:i+1], func(name string) {
+			if _, ok := globals[name]; !ok {
+				globals[name] = &nativeVariable{Name: name, Global: true, Code: typeUnknown}
+				p.globals = append(p.globals, globals[name])
+			}
+		})
+	}
+
+	// the functions called by the initializer of a global variable may only use the global variables
+	// initialized before
+	a := &nativeAnalyzer{nativeProgram: p, scope: globals, global: globals,
+		state: assignState{reachable: true}.copy()}
+	var initialized []map[*nativeVariable]bool
+	var calls [][]string
+	for i := range program.Globals {
+		initialized = append(initialized, a.state.copy().set)
+		a.calls = nil
+		if err := a.instructions(program.Globals[i : i+1]); err != nil {
+			return nil, err
+		}
+		calls = append(calls, a.calls)
+	}
+	usedGlobals := make(map[string][]*nativeVariable)
+	callees := make(map[string][]string)
+	for i := range program.Functions {
+		function := &program.Functions[i]
+		a := &nativeAnalyzer{nativeProgram: p, function: function, scope: make(map[string]*nativeVariable),
+			global: globals, state: assignState{reachable: true}.copy()}
+		for j := range function.Parameter {
+			param := &function.Parameter[j]
+			v := &nativeVariable{Name: param.Name, Type: &param.Type, Code: runtimeType(param.Type.code),
+				position: param.position}
+			a.scope[param.Name] = v
+			p.locals[function] = append(p.locals[function], v)
+			a.state.set[v], a.state.maybe[v] = true, true
+		}
+		assignedVariables(function.Instruction, func(name string) {
+			if _, ok := a.scope[name]; !ok {
+				a.scope[name] = &nativeVariable{Name: name, Code: typeUnknown}
+				p.locals[function] = append(p.locals[function], a.scope[name])
+			}
+		})
+		if err := a.instructions(function.Instruction); err != nil {
+			return nil, err
+		}
+		if a.state.reachable && function.ReturnType.code != TYPE_VOID {
+			p.noValue[function] = true
+		}
+		usedGlobals[function.Name] = a.used
+		callees[function.Name] = a.calls
+	}
+	for i, instr := range program.Globals {
+		reached := make(map[string]bool)
+		var visit func(name string) error
+		visit = func(name string) error {
+			if reached[name] {
+				return nil
+			}
+			reached[name] = true
+			for _, v := range usedGlobals[name] {
+				if !initialized[i][v] {
+					return fmt.Errorf("global variable %s may be used by function %s before its initialization (pos=%v)",
+						v.Name, name, instr.position)
+				}
+			}
+			for _, callee := range callees[name] {
+				if err := visit(callee); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, name := range calls[i] {
+			if err := visit(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := p.inferTypes(); err != nil {
+		return nil, err
+	}
+	return p, p.checkTypes()
+}
+
+func (a *nativeAnalyzer) instructions(instructions []Instruction) error {
+	for i := range instructions {
+		if !a.state.reachable {
+			return nil
+		}
+		if err := a.instruction(&instructions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *nativeAnalyzer) instruction(instr *Instruction) error {
+	a.reached[instr] = true
+	if instr.Valeur != nil {
+		if err := a.expression(instr.Valeur); err != nil {
+			return err
+		}
+	}
+	for i := range instr.Parameter {
+		if err := a.expression(&instr.Parameter[i]); err != nil {
+			return err
+		}
+	}
+	switch instr.Code {
+	case INSTRUCTION_AFFECTATION:
+		v, err := a.write(instr.Variable, instr.position)
+		if err != nil {
+			return err
+		}
+		a.stores[instr] = v
+	case INSTRUCTION_DECLARATION:
+		v := a.scope[instr.Variable]
+		v.Type, v.Code, v.position = instr.VariableType, runtimeType(instr.VariableType.code), instr.position
+		a.state.set[v], a.state.maybe[v] = true, true
+		a.stores[instr] = v
+	case INSTRUCTION_CALL:
+		if _, ok := a.functions[instr.FunctionName]; ok {
+			a.calls = append(a.calls, instr.FunctionName)
+		}
+	case INSTRUCTION_EXPRESSION:
+		if name := assignedVariable(instr.Valeur); name != "" {
+			access, err := a.read(name, instr.position)
+			if err != nil {
+				return err
+			}
+			a.traces[instr] = access
+		}
+	case INSTRUCTION_SWITCH:
+		return a.switchCases(instr)
+	case INSTRUCTION_BREAK:
+		if len(a.breaks) > 0 {
+			a.breaks[len(a.breaks)-1] = append(a.breaks[len(a.breaks)-1], a.state)
+		} else if a.function != nil && a.function.ReturnType.code != TYPE_VOID {
+			// as the interpreter, a break outside of a switch ends the function
+			a.noValue[a.function] = true
+		}
+		a.state = assignState{}
+	case INSTRUCTION_RETURN:
+		if instr.Valeur == nil && a.function != nil && a.function.ReturnType.code != TYPE_VOID {
+			a.noValue[a.function] = true
+		}
+		a.state = assignState{}
+	}
+	return nil
+}
+
+// switchCases analyzes the cases of a switch. Each case is reached from the switch, or from the previous case.
+func (a *nativeAnalyzer) switchCases(instr *Instruction) error {
+	start := a.state.copy()
+	end := assignState{}
+	hasDefault := false
+	a.breaks = append(a.breaks, nil)
+	for i := range instr.Case {
+		hasDefault = hasDefault || instr.Case[i].Valeur == nil
+		if i == 0 {
+			a.state = start.copy()
+		} else {
+			a.state = start.merge(a.state)
+		}
+		if err := a.instructions(instr.Case[i].Instruction); err != nil {
+			return err
+		}
+	}
+	if len(instr.Case) > 0 {
+		end = a.state
+	}
+	if !hasDefault {
+		end = end.merge(start)
+	}
+	for _, state := range a.breaks[len(a.breaks)-1] {
+		end = end.merge(state)
+	}
+	a.breaks = a.breaks[:len(a.breaks)-1]
+	a.state = end
+	return nil
+}
+
+func (a *nativeAnalyzer) expression(expr *Expression) error {
+	switch expr.code {
+	case EXPR_CODE_VAR:
+		access, err := a.read(expr.variable, expr.position)
+		if err != nil {
+			return err
+		}
+		a.reads[expr] = access
+	case EXPR_CODE_CALL:
+		for i := range expr.parameter {
+			if err := a.expression(&expr.parameter[i]); err != nil {
+				return err
+			}
+		}
+		a.calls = append(a.calls, expr.functionName)
+	case EXPR_CODE_ASSIGN, EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC,
+		EXPR_CODE_POST_DEC:
+		if expr.code != EXPR_CODE_ASSIGN {
+			access, err := a.read(expr.variable, expr.position)
+			if err != nil {
+				return err
+			}
+			a.reads[expr] = access
+		}
+		if expr.right != nil {
+			if err := a.expression(expr.right); err != nil {
+				return err
+			}
+		}
+		v, err := a.write(expr.variable, expr.position)
+		if err != nil {
+			return err
+		}
+		a.writes[expr] = v
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		if err := a.expression(expr.left); err != nil {
+			return err
+		}
+		before := a.state.copy()
+		if err := a.expression(expr.right); err != nil {
+			return err
+		}
+		a.state = before.merge(a.state)
+	case EXPR_CODE_CONDITIONAL:
+		if err := a.expression(expr.condition); err != nil {
+			return err
+		}
+		before := a.state.copy()
+		if err := a.expression(expr.left); err != nil {
+			return err
+		}
+		left := a.state
+		a.state = before
+		if err := a.expression(expr.right); err != nil {
+			return err
+		}
+		a.state = left.merge(a.state)
+	default:
+		for _, operand := range []*Expression{expr.left, expr.right} {
+			if operand == nil {
+				continue
+			} else if err := a.expression(operand); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// read resolves the variable read as the interpreter does: the local variable if it is set, otherwise the global
+// variable, otherwise the constant of an enumeration.
+func (a *nativeAnalyzer) read(name string, position *Position) (nativeAccess, error) {
+	if v, ok := a.scope[name]; ok && a.state.set[v] {
+		return nativeAccess{variable: v}, nil
+	} else if ok && a.state.maybe[v] {
+		if a.fallback(name) != (nativeAccess{}) {
+			return nativeAccess{}, fmt.Errorf("variable %s may hide the variable or the constant with the same name (pos=%v)",
+				name, position)
+		}
+		v.Checked = true
+		return nativeAccess{variable: v, checked: true}, nil
+	}
+	return a.fallback(name), nil
+}
+
+// fallback resolves the name when it is not a variable of the scope set.
+func (a *nativeAnalyzer) fallback(name string) nativeAccess {
+	if v, ok := a.global[name]; ok && a.function != nil {
+		a.used = append(a.used, v)
+		return nativeAccess{variable: v}
+	} else if constant, ok := a.constants[name]; ok {
+		return nativeAccess{constant: constant}
+	}
+	return nativeAccess{}
+}
+
+// write resolves the variable assigned as the interpreter does: the local variable if it is set or if there is no
+// global variable with the same name, otherwise the global variable.
+func (a *nativeAnalyzer) write(name string, position *Position) (*nativeVariable, error) {
+	v := a.scope[name]
+	if global, ok := a.global[name]; ok && a.function != nil && !a.state.set[v] {
+		if a.state.maybe[v] {
+			return nil, fmt.Errorf("variable %s may hide the global variable with the same name (pos=%v)", name,
+				position)
+		}
+		a.used = append(a.used, global)
+		return global, nil
+	}
+	a.state.set[v], a.state.maybe[v] = true, true
+	return v, nil
+}
+
+// typeOf returns the type of the values of the expression.
+func (p *nativeProgram) typeOf(expr *Expression) TypeCode {
+	switch expr.code {
+	case EXPR_CODE_INT:
+		return TYPE_INT
+	case EXPR_CODE_STR:
+		return TYPE_STRING
+	case EXPR_CODE_TRUE, EXPR_CODE_FALSE:
+		return TYPE_BOOLEAN
+	case EXPR_CODE_VAR:
+		if access := p.reads[expr]; access.variable != nil {
+			return access.variable.Code
+		} else if access.constant != nil {
+			return TYPE_INT
+		} else if code, ok := p.expected[expr]; ok {
+			return code
+		}
+		return typeUnknown
+	case EXPR_CODE_CALL:
+		return runtimeType(p.functions[expr.functionName].ReturnType.code)
+	case EXPR_CODE_ASSIGN:
+		return p.typeOf(expr.right)
+	case EXPR_CODE_CONDITIONAL:
+		if left := p.typeOf(expr.left); left != typeUnknown {
+			return left
+		}
+		return p.typeOf(expr.right)
+	case EXPR_CODE_NOT, EXPR_CODE_AND, EXPR_CODE_OR:
+		return TYPE_BOOLEAN
+	}
+	if expr.code == EXPR_CODE_BIT_NOT || assignedVariable(expr) != "" || isArithmetic(expr.code) {
+		return TYPE_INT
+	}
+	return TYPE_BOOLEAN
+}
+
+// inferTypes sets the type of the variables created by an assignment to the type of the values assigned.
+// The variables never assigned a known type are int.
+func (p *nativeProgram) inferTypes() error {
+	infer := func(v *nativeVariable, code TypeCode, position *Position) (bool, error) {
+		if v.Type != nil || code == typeUnknown || v.Code == code {
+			return false, nil
+		} else if v.Code != typeUnknown {
+			return false, fmt.Errorf("variable %s is assigned values of types %s and %s (pos=%v)", v.Name,
+				typeName(&Type{code: v.Code}), typeName(&Type{code: code}), position)
+		}
+		v.Code = code
+		return true, nil
+	}
+	// the assignments are inferred in the order of the source, the conflicts are reported at the last one
+	type assignment struct {
+		v        *nativeVariable
+		value    *Expression
+		position *Position
+	}
+	var assignments []assignment
+	for expr, v := range p.writes {
+		assignments = append(assignments, assignment{v, expr, expr.position})
+	}
+	for instr, v := range p.stores {
+		if instr.Valeur != nil {
+			assignments = append(assignments, assignment{v, instr.Valeur, instr.position})
+		}
+	}
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].position.pos < assignments[j].position.pos })
+	for changed := true; changed; {
+		changed = false
+		for _, a := range assignments {
+			done, err := infer(a.v, p.typeOf(a.value), a.position)
+			if err != nil {
+				return err
+			}
+			changed = changed || done
+		}
+	}
+	for _, variables := range append([][]*nativeVariable{p.globals}, p.variables()...) {
+		for _, v := range variables {
+			if v.Code == typeUnknown {
+				v.Code = TYPE_INT
+			}
+		}
+	}
+	return nil
+}
+
+// variables returns the local variables of the functions, in the order of the functions.
+func (p *nativeProgram) variables() [][]*nativeVariable {
+	var res [][]*nativeVariable
+	for i := range p.program.Functions {
+		res = append(res, p.locals[&p.program.Functions[i]])
+	}
+	return res
+}
+
+// checkTypes checks the types of the operands, which the interpreter checks at runtime.
+func (p *nativeProgram) checkTypes() error {
+	for i := range p.program.Globals {
+		if err := p.checkInstructions(nil, p.program.Globals[i:i+1]); err != nil {
+			return err
+		}
+	}
+	for i := range p.program.Functions {
+		function := &p.program.Functions[i]
+		if err := p.checkInstructions(function, function.Instruction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expect checks the type of the expression.
+func (p *nativeProgram) expect(expr *Expression, code TypeCode, position *Position) error {
+	if err := p.checkExpression(expr); err != nil {
+		return err
+	} else if typeExpr := p.typeOf(expr); typeExpr == typeUnknown && expr.code == EXPR_CODE_VAR {
+		p.expected[expr] = code
+	} else if typeExpr != code && typeExpr != typeUnknown {
+		return fmt.Errorf("invalid operand of type %s, expected %s (pos=%v)", typeName(&Type{code: typeExpr}),
+			typeName(&Type{code: code}), position)
+	}
+	return nil
+}
+
+func (p *nativeProgram) checkInstructions(function *Function, instructions []Instruction) error {
+	for i := range instructions {
+		instr := &instructions[i]
+		if !p.reached[instr] {
+			break
+		}
+		var err error
+		switch instr.Code {
+		case INSTRUCTION_AFFECTATION, INSTRUCTION_DECLARATION:
+			if v := p.stores[instr]; instr.Valeur != nil && v != nil {
+				err = p.expect(instr.Valeur, v.Code, instr.position)
+			}
+		case INSTRUCTION_CALL:
+			callee := p.functions[instr.FunctionName]
+			for j := range instr.Parameter {
+				if callee == nil {
+					err = p.checkExpression(&instr.Parameter[j])
+				} else {
+					err = p.expect(&instr.Parameter[j], runtimeType(callee.Parameter[j].Type.code),
+						instr.Parameter[j].position)
+				}
+				if err != nil {
+					break
+				}
+			}
+		case INSTRUCTION_EXPRESSION:
+			err = p.checkExpression(instr.Valeur)
+		case INSTRUCTION_SWITCH:
+			if err = p.expect(instr.Valeur, TYPE_INT, instr.Valeur.position); err == nil {
+				for j := range instr.Case {
+					if err = p.checkInstructions(function, instr.Case[j].Instruction); err != nil {
+						break
+					}
+				}
+			}
+		case INSTRUCTION_RETURN:
+			if instr.Valeur == nil {
+				// no value
+			} else if function == nil || function.ReturnType.code == TYPE_VOID {
+				err = p.checkExpression(instr.Valeur)
+			} else {
+				err = p.expect(instr.Valeur, runtimeType(function.ReturnType.code), instr.Valeur.position)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *nativeProgram) checkExpression(expr *Expression) error {
+	switch expr.code {
+	case EXPR_CODE_INT, EXPR_CODE_STR, EXPR_CODE_TRUE, EXPR_CODE_FALSE, EXPR_CODE_VAR:
+		return nil
+	case EXPR_CODE_CALL:
+		callee := p.functions[expr.functionName]
+		for i := range expr.parameter {
+			if err := p.expect(&expr.parameter[i], runtimeType(callee.Parameter[i].Type.code),
+				expr.parameter[i].position); err != nil {
+				return err
+			}
+		}
+		return nil
+	case EXPR_CODE_ASSIGN:
+		return p.expect(expr.right, p.writes[expr].Code, expr.position)
+	case EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC, EXPR_CODE_POST_DEC:
+		if v := p.writes[expr]; v.Code != TYPE_INT {
+			return fmt.Errorf("invalid operand of type %s, expected int (pos=%v)", typeName(&Type{code: v.Code}),
+				expr.position)
+		} else if expr.right != nil {
+			return p.expect(expr.right, TYPE_INT, expr.position)
+		}
+		return nil
+	case EXPR_CODE_BIT_NOT:
+		return p.expect(expr.right, TYPE_INT, expr.position)
+	case EXPR_CODE_NOT:
+		return p.expect(expr.right, TYPE_BOOLEAN, expr.right.position)
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		if err := p.expect(expr.left, TYPE_BOOLEAN, expr.left.position); err != nil {
+			return err
+		}
+		return p.expect(expr.right, TYPE_BOOLEAN, expr.right.position)
+	case EXPR_CODE_CONDITIONAL:
+		if err := p.expect(expr.condition, TYPE_BOOLEAN, expr.condition.position); err != nil {
+			return err
+		} else if err := p.checkExpression(expr.left); err != nil {
+			return err
+		}
+		return p.expect(expr.right, p.typeOf(expr), expr.position)
+	}
+	code := TYPE_INT
+	if (expr.code == EXPR_CODE_EQU || expr.code == EXPR_CODE_NEQ) &&
+		(p.typeOf(expr.left) == TYPE_BOOLEAN || p.typeOf(expr.right) == TYPE_BOOLEAN) {
+		code = TYPE_BOOLEAN
+	}
+	if err := p.expect(expr.left, code, expr.position); err != nil {
+		return err
+	}
+	return p.expect(expr.right, code, expr.position)
+}
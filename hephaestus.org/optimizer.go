@@ -0,0 +1,438 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+)
+
+// optimizer simplifies the expressions of a checked program. The types of the variables are the ones known by
+// the checker: the identities are simplified only if the type of the operand kept is known.
+type optimizer struct {
+	functions map[string]*Function
+	enums     map[string]int   // values of the enumeration constants
+	globals   map[string]*Type // nil if the variable is not declared with a type
+	locals    map[string]*Type
+	constants map[string]*Expression // literal values of the variables assigned once, read after the assignment
+	declared  map[string]int         // number of declarations of each name in the program, parameters included
+	written   map[string]int         // number of assignments of each name in the program
+}
+
+// Optimize simplifies the expressions of the checked program, in place, without changing its output:
+//   - the operations whose operands are constants are computed,
+//   - the identities x+0, x-0, x*1, x/1, x|0, x^0, x&-1 and the shifts by 0 are replaced by x,
+//   - the logical operations and the conditional expressions whose result is decided by a constant are reduced,
+//   - the variables assigned once with a constant, and never modified, are replaced by the constant after
+//     their assignment. The global variables declared after an initializer calling a function are not replaced
+//     in the functions, which may read them before their initialization.
+//
+// The constant divisions by zero, the shifts out of range and the integer overflows are reported as errors,
+// although they would only fail or wrap around at runtime if they are executed.
+func Optimize(program *Program) error {
+	o := &optimizer{functions: make(map[string]*Function), enums: make(map[string]int),
+		globals: make(map[string]*Type), constants: make(map[string]*Expression), declared: make(map[string]int),
+		written: make(map[string]int)}
+	for _, enum := range program.Enums {
+		for _, value := range enum.Values {
+			o.enums[value.Name] = value.Value
+		}
+	}
+	o.count(program.Globals, o.declared, o.written)
+	for i := range program.Functions {
+		function := &program.Functions[i]
+		o.functions[function.Name] = function
+		for _, param := range function.Parameter {
+			o.declared[param.Name]++
+		}
+		o.count(function.Instruction, o.declared, o.written)
+	}
+
+	globalConstants := make(map[string]*Expression)
+	called := false // an initializer calls a function
+	for i := range program.Globals {
+		instr := &program.Globals[i]
+		if err := o.instruction(instr); err != nil {
+			return err
+		}
+		o.globals[instr.Variable] = instr.VariableType
+		if instr.Code == INSTRUCTION_DECLARATION && isLiteral(instr.Valeur) && o.declared[instr.Variable] == 1 &&
+			o.written[instr.Variable] == 0 {
+			o.constants[instr.Variable] = instr.Valeur
+			if !called {
+				globalConstants[instr.Variable] = instr.Valeur
+			}
+		}
+		called = called || hasCall(instr.Valeur)
+	}
+	for i := range program.Functions {
+		if err := o.function(&program.Functions[i], globalConstants); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasCall reports whether the expression calls a function.
+func hasCall(expr *Expression) bool {
+	if expr == nil {
+		return false
+	} else if expr.code == EXPR_CODE_CALL {
+		return true
+	}
+	return hasCall(expr.condition) || hasCall(expr.left) || hasCall(expr.right)
+}
+
+// count counts the declarations and the assignments of each name in the instructions.
+func (o *optimizer) count(instructions []Instruction, declared, written map[string]int) {
+	var expression func(expr *Expression)
+	expression = func(expr *Expression) {
+		if expr == nil {
+			return
+		} else if assignedVariable(expr) != "" {
+			written[expr.variable]++
+		}
+		for i := range expr.parameter {
+			expression(&expr.parameter[i])
+		}
+		expression(expr.condition)
+		expression(expr.left)
+		expression(expr.right)
+	}
+	for i := range instructions {
+		instr := &instructions[i]
+		if instr.Code == INSTRUCTION_DECLARATION {
+			declared[instr.Variable]++
+		} else if instr.Code == INSTRUCTION_AFFECTATION {
+			written[instr.Variable]++
+		}
+		expression(instr.Valeur)
+		for j := range instr.Parameter {
+			expression(&instr.Parameter[j])
+		}
+		for j := range instr.Case {
+			o.count(instr.Case[j].Instruction, declared, written)
+		}
+	}
+}
+
+// function optimizes the instructions of the function. The local variables assigned once with a constant, by
+// an instruction of the body which is not in a switch, are replaced by the constant after the instruction.
+func (o *optimizer) function(function *Function, globalConstants map[string]*Expression) error {
+	o.locals = make(map[string]*Type)
+	o.constants = make(map[string]*Expression)
+	for name, value := range globalConstants {
+		o.constants[name] = value
+	}
+	declared, written := make(map[string]int), make(map[string]int)
+	for i := range function.Parameter {
+		param := &function.Parameter[i]
+		o.locals[param.Name] = &param.Type
+		declared[param.Name]++
+	}
+	o.count(function.Instruction, declared, written)
+
+	for i := range function.Instruction {
+		instr := &function.Instruction[i]
+		if err := o.instruction(instr); err != nil {
+			return err
+		}
+		_, global := o.globals[instr.Variable]
+		if _, ok := o.enums[instr.Variable]; ok || global || !isLiteral(instr.Valeur) {
+			continue
+		}
+		if (instr.Code == INSTRUCTION_DECLARATION && declared[instr.Variable] == 1 && written[instr.Variable] == 0) ||
+			(instr.Code == INSTRUCTION_AFFECTATION && declared[instr.Variable] == 0 && written[instr.Variable] == 1) {
+			o.constants[instr.Variable] = instr.Valeur
+		}
+	}
+	o.locals = nil
+	return nil
+}
+
+func (o *optimizer) instruction(instr *Instruction) error {
+	if instr.Valeur != nil {
+		if err := o.expression(instr.Valeur); err != nil {
+			return err
+		}
+	}
+	for i := range instr.Parameter {
+		if err := o.expression(&instr.Parameter[i]); err != nil {
+			return err
+		}
+	}
+	switch instr.Code {
+	case INSTRUCTION_DECLARATION:
+		o.declare(instr.Variable, instr.VariableType)
+	case INSTRUCTION_AFFECTATION:
+		o.declare(instr.Variable, nil)
+	case INSTRUCTION_SWITCH:
+		// the labels of the cases are constants already
+		for i := range instr.Case {
+			for j := range instr.Case[i].Instruction {
+				if err := o.instruction(&instr.Case[i].Instruction[j]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// declare adds the variable to the scope, as the checker: a declaration in a function adds a local variable, an
+// assignment adds an untyped local variable if the variable doesn't exist.
+func (o *optimizer) declare(name string, typeVar *Type) {
+	scope := o.locals
+	if scope == nil {
+		scope = o.globals
+	}
+	if typeVar != nil {
+		scope[name] = typeVar
+	} else if _, ok := o.lookup(name); !ok {
+		scope[name] = nil
+	}
+}
+
+// lookup returns the type of the variable visible with this name.
+func (o *optimizer) lookup(name string) (*Type, bool) {
+	if typeVar, ok := o.locals[name]; ok {
+		return typeVar, true
+	} else if typeVar, ok := o.globals[name]; ok {
+		return typeVar, true
+	} else if _, ok := o.enums[name]; ok {
+		return &Type{code: TYPE_ENUM}, true
+	}
+	return nil, false
+}
+
+// isLiteral returns true if the expression is a constant written in the source.
+func isLiteral(expr *Expression) bool {
+	if expr == nil {
+		return false
+	}
+	switch expr.code {
+	case EXPR_CODE_INT, EXPR_CODE_STR, EXPR_CODE_TRUE, EXPR_CODE_FALSE:
+		return true
+	}
+	return false
+}
+
+// constant returns the value of the expression if it is a constant: a literal or an enumeration constant.
+func (o *optimizer) constant(expr *Expression) (*Valeur, bool) {
+	switch expr.code {
+	case EXPR_CODE_INT:
+		return &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: expr.valeurInt}, true
+	case EXPR_CODE_TRUE, EXPR_CODE_FALSE:
+		return &Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: expr.code == EXPR_CODE_TRUE}, true
+	case EXPR_CODE_VAR:
+		_, local := o.locals[expr.variable]
+		if value, ok := o.enums[expr.variable]; ok && !local {
+			return &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: value}, true
+		}
+	}
+	return nil, false
+}
+
+// setConstant replaces the expression by the literal of the value.
+func setConstant(expr *Expression, value *Valeur) {
+	*expr = Expression{code: EXPR_CODE_INT, valeurInt: value.valeurInt, position: expr.position}
+	if value.valeurtype.code == TYPE_BOOLEAN {
+		expr.code, expr.valeurInt = EXPR_CODE_FALSE, 0
+		if value.valeurBoolean {
+			expr.code = EXPR_CODE_TRUE
+		}
+	}
+}
+
+// typeOf returns the type of the value of the expression, or nil if it is only known at runtime.
+func (o *optimizer) typeOf(expr *Expression) *Type {
+	switch expr.code {
+	case EXPR_CODE_INT, EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC,
+		EXPR_CODE_POST_DEC, EXPR_CODE_BIT_NOT:
+		return &Type{code: TYPE_INT}
+	case EXPR_CODE_STR:
+		return &Type{code: TYPE_STRING}
+	case EXPR_CODE_TRUE, EXPR_CODE_FALSE, EXPR_CODE_NOT, EXPR_CODE_AND, EXPR_CODE_OR:
+		return &Type{code: TYPE_BOOLEAN}
+	case EXPR_CODE_VAR:
+		typeVar, _ := o.lookup(expr.variable)
+		return typeVar
+	case EXPR_CODE_CALL:
+		if function, ok := o.functions[expr.functionName]; ok {
+			return &function.ReturnType
+		}
+		return nil
+	case EXPR_CODE_ASSIGN:
+		if typeVar, _ := o.lookup(expr.variable); typeVar != nil {
+			return typeVar
+		}
+		return o.typeOf(expr.right)
+	case EXPR_CODE_CONDITIONAL:
+		left, right := o.typeOf(expr.left), o.typeOf(expr.right)
+		if left != nil && right != nil && runtimeType(left.code) == runtimeType(right.code) {
+			return left
+		}
+		return nil
+	}
+	if isArithmetic(expr.code) {
+		return &Type{code: TYPE_INT}
+	}
+	return &Type{code: TYPE_BOOLEAN}
+}
+
+// isType returns true if the type of the values of the expression is known to be code.
+func (o *optimizer) isType(expr *Expression, code TypeCode) bool {
+	typeVar := o.typeOf(expr)
+	return typeVar != nil && runtimeType(typeVar.code) == code
+}
+
+// expression simplifies the expression in place.
+func (o *optimizer) expression(expr *Expression) error {
+	for i := range expr.parameter {
+		if err := o.expression(&expr.parameter[i]); err != nil {
+			return err
+		}
+	}
+	for _, operand := range []*Expression{expr.condition, expr.left, expr.right} {
+		if operand != nil {
+			if err := o.expression(operand); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch expr.code {
+	case EXPR_CODE_VAR:
+		if value, ok := o.constants[expr.variable]; ok {
+			position := expr.position
+			*expr = *value
+			expr.position = position
+		}
+	case EXPR_CODE_ASSIGN:
+		o.declare(expr.variable, nil)
+	case EXPR_CODE_BIT_NOT:
+		if value, ok := o.constant(expr.right); ok && value.valeurtype.code == TYPE_INT {
+			setConstant(expr, &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: ^value.valeurInt})
+		}
+	case EXPR_CODE_NOT:
+		if value, ok := o.constant(expr.right); ok && value.valeurtype.code == TYPE_BOOLEAN {
+			setConstant(expr, &Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: !value.valeurBoolean})
+		}
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		o.logical(expr)
+	case EXPR_CODE_CONDITIONAL:
+		if value, ok := o.constant(expr.condition); ok && value.valeurtype.code == TYPE_BOOLEAN {
+			position := expr.position
+			if value.valeurBoolean {
+				*expr = *expr.left
+			} else {
+				*expr = *expr.right
+			}
+			expr.position = position
+		}
+	default:
+		if _, ok := binaryPrecedence[expr.code]; ok {
+			return o.binary(expr)
+		}
+	}
+	return nil
+}
+
+// logical reduces the logical operation whose result is decided by a constant. The left operand is kept if it
+// is not a constant, as it may have side effects.
+func (o *optimizer) logical(expr *Expression) {
+	decisive := expr.code == EXPR_CODE_OR // the value of an operand deciding the result
+	if left, ok := o.constant(expr.left); ok && left.valeurtype.code == TYPE_BOOLEAN {
+		if left.valeurBoolean == decisive {
+			// the right operand is not evaluated
+			setConstant(expr, left)
+		} else if right, ok := o.constant(expr.right); ok && right.valeurtype.code == TYPE_BOOLEAN {
+			setConstant(expr, right)
+		} else if o.isType(expr.right, TYPE_BOOLEAN) {
+			replace(expr, expr.right)
+		}
+	} else if right, ok := o.constant(expr.right); ok && right.valeurtype.code == TYPE_BOOLEAN &&
+		right.valeurBoolean != decisive && o.isType(expr.left, TYPE_BOOLEAN) {
+		replace(expr, expr.left)
+	}
+}
+
+// replace replaces the expression by its operand, at the position of the expression.
+func replace(expr *Expression, operand *Expression) {
+	position := expr.position
+	*expr = *operand
+	expr.position = position
+}
+
+// binary computes the binary operation of constants, or simplifies it if it is an identity.
+func (o *optimizer) binary(expr *Expression) error {
+	left, leftOk := o.constant(expr.left)
+	right, rightOk := o.constant(expr.right)
+	if leftOk && rightOk {
+		if left.valeurtype.code == TYPE_INT && right.valeurtype.code == TYPE_INT {
+			if err := checkConstant(expr.code, left.valeurInt, right.valeurInt, expr.position); err != nil {
+				return err
+			}
+		}
+		if value, err := binaryValue(expr.code, left, right, expr.position); err == nil {
+			setConstant(expr, value)
+		}
+		return nil
+	}
+
+	if rightOk && right.valeurtype.code == TYPE_INT {
+		// the divisor and the count of the shift are checked even if the other operand is not a constant
+		if (expr.code == EXPR_CODE_DIV || expr.code == EXPR_CODE_MOD) && right.valeurInt == 0 {
+			return errorAt(expr.position, "division by zero in constant expression")
+		} else if isShift(expr.code) && (right.valeurInt < 0 || right.valeurInt >= bits.UintSize) {
+			return errorAt(expr.position, "shift count %d out of range", right.valeurInt)
+		}
+	}
+
+	// the operand kept must be an int, as the operation fails for the other values
+	if rightOk && right.valeurtype.code == TYPE_INT && o.isType(expr.left, TYPE_INT) {
+		switch {
+		case right.valeurInt == 0 && (expr.code == EXPR_CODE_ADD || expr.code == EXPR_CODE_SUB ||
+			expr.code == EXPR_CODE_BIT_OR || expr.code == EXPR_CODE_BIT_XOR || isShift(expr.code)),
+			right.valeurInt == 1 && (expr.code == EXPR_CODE_MUL || expr.code == EXPR_CODE_DIV),
+			right.valeurInt == -1 && expr.code == EXPR_CODE_BIT_AND:
+			replace(expr, expr.left)
+		}
+	} else if leftOk && left.valeurtype.code == TYPE_INT && o.isType(expr.right, TYPE_INT) {
+		switch {
+		case left.valeurInt == 0 && (expr.code == EXPR_CODE_ADD || expr.code == EXPR_CODE_BIT_OR ||
+			expr.code == EXPR_CODE_BIT_XOR),
+			left.valeurInt == 1 && expr.code == EXPR_CODE_MUL,
+			left.valeurInt == -1 && expr.code == EXPR_CODE_BIT_AND:
+			replace(expr, expr.right)
+		}
+	}
+	return nil
+}
+
+// checkConstant reports the operations of constants which fail, or whose result overflows an int.
+func checkConstant(code ExprCode, a, b int, position *Position) error {
+	overflow := false
+	switch code {
+	case EXPR_CODE_ADD:
+		sum := a + b
+		overflow = (a >= 0) == (b >= 0) && (sum >= 0) != (a >= 0)
+	case EXPR_CODE_SUB:
+		diff := a - b
+		overflow = (a >= 0) != (b >= 0) && (diff >= 0) != (a >= 0)
+	case EXPR_CODE_MUL:
+		product := a * b
+		overflow = a != 0 && (product/a != b || (a == -1 && b == math.MinInt))
+	case EXPR_CODE_DIV, EXPR_CODE_MOD:
+		if b == 0 {
+			return errorAt(position, "division by zero in constant expression")
+		}
+		overflow = code == EXPR_CODE_DIV && a == math.MinInt && b == -1
+	case EXPR_CODE_SHL, EXPR_CODE_SHR:
+		if b < 0 || b >= bits.UintSize {
+			return errorAt(position, "shift count %d out of range", b)
+		}
+	}
+	if overflow {
+		return errorAt(position, "integer overflow in constant expression")
+	}
+	return nil
+}
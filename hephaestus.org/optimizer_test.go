@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Ensure the constant expressions are computed, the identities simplified, and the variables assigned once with a
+// constant replaced by the constant.
+func TestOptimize(t *testing.T) {
+	var tests = []struct {
+		s    string
+		exps []string // values of the instructions of main
+	}{
+		{s: `int main () { x = 10+8; return x; }`, exps: []string{"18", "18"}},
+		{s: `int main () { x = 2 * (3 + 4) - 1 << 2; y = ~0 ^ 5 % 3; return x >> 1; }`,
+			exps: []string{"52", "-3", "26"}},
+		{s: `int main () { b = 1 < 2 && !(3 >= 4) || f(); return b ? 1 : 0; } boolean f() { return true; }`,
+			exps: []string{"true", "1"}},
+		{s: `int main () { int x = read(); int y = x + 0; y = 1 * x * 1 - 0; return (x | 0) / 1 + ((0 - 1) & y << 0); }
+		     int read() { return 3; }`,
+			exps: []string{"read()", "x", "x", "(x + y)"}},
+		{s: `int main () { x = read(); return x + 0; } int read() { return 3; }`,
+			exps: []string{"read()", "(x + 0)"}},
+		{s: `int main () { boolean b = f(); c = true && b; d = b || false; e = false && f(); return b == true ? 1 : 0; }
+		     boolean f() { return true; }`,
+			exps: []string{"f()", "b", "b", "false", "((b == true) ? 1 : 0)"}},
+		{s: `int main () { boolean b = 3 > 2; return b ? 1 : f(); } int f() { return 2; }`,
+			exps: []string{"true", "1"}},
+		{s: `enum Color { RED, GREEN, BLUE }; int main () { return GREEN * 2 + BLUE; }`, exps: []string{"4"}},
+		{s: `int g = 4; int h = 5; void set() { h = 1; } int main () { set(); return g + h; }`,
+			exps: []string{"(4 + h)"}},
+		{s: `int main () { x = 1; x = x + 1; int y = 2; switch (y) { case 2: int z = 3; return z + y; } return x; }`,
+			exps: []string{"1", "(x + 1)", "2", "2", "3", "(z + 2)", "x"}},
+		{s: `int main () { int x; y = x; x = 5; return x; }`, exps: []string{"x", "5", "x"}},
+		{s: `int main () { string s = "a"; print(s); t = s; return 0; }`, exps: []string{`"a"`, `"a"`, `"a"`, "0"}},
+	}
+
+	for i, tt := range tests {
+		program, err := parse(strings.NewReader(tt.s), io.Discard)
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.s, err)
+		}
+		if err := Optimize(program); err != nil {
+			t.Errorf("%d. %q: optimization error: %s", i, tt.s, err)
+			continue
+		}
+		var main *Function
+		for j := range program.Functions {
+			if program.Functions[j].Name == "main" {
+				main = &program.Functions[j]
+			}
+		}
+		var got []string
+		var values func(instructions []Instruction)
+		values = func(instructions []Instruction) {
+			for _, instr := range instructions {
+				if instr.Valeur != nil {
+					got = append(got, exprString(instr.Valeur))
+				}
+				for j := range instr.Parameter {
+					got = append(got, exprString(&instr.Parameter[j]))
+				}
+				for _, c := range instr.Case {
+					values(c.Instruction)
+				}
+			}
+		}
+		values(main.Instruction)
+		if strings.Join(got, "; ") != strings.Join(tt.exps, "; ") {
+			t.Errorf("%d. %q: values mismatch:\n  exp=%q\n  got=%q\n\n", i, tt.s, tt.exps, got)
+		}
+	}
+}
+
+// Ensure the constant operations which fail or overflow are reported.
+func TestOptimize_errors(t *testing.T) {
+	var tests = []struct {
+		s   string
+		err string
+	}{
+		{s: `int main () { return 1 / 0; }`, err: "division by zero in constant expression (pos=&{1 1 23})"},
+		{s: `int main () { x = 0; return f() % x; } int f() { return 1; }`,
+			err: "division by zero in constant expression (pos=&{1 1 32})"},
+		{s: `int main () { x = 70; return 1 << x; }`, err: "shift count 70 out of range (pos=&{1 1 31})"},
+		{s: `int main () { return 9223372036854775807 + 1; }`,
+			err: "integer overflow in constant expression (pos=&{1 1 41})"},
+		{s: `int main () { return (0 - 9223372036854775807) - 2; }`,
+			err: "integer overflow in constant expression (pos=&{1 1 47})"},
+		{s: `int main () { return 4294967296 * 4294967296; }`,
+			err: "integer overflow in constant expression (pos=&{1 1 32})"},
+		{s: `int m = 0 - 9223372036854775807 - 1; int main () { return m / (0 - 1); }`,
+			err: "integer overflow in constant expression (pos=&{1 1 60})"},
+	}
+
+	for i, tt := range tests {
+		program, err := parse(strings.NewReader(tt.s), io.Discard)
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.s, err)
+		}
+		if err := Optimize(program); errstring(err) != tt.err {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		}
+	}
+}
+
+// Ensure the optimized programs write the same output and return the same value as the programs, with the
+// interpreter and the virtual machine, and that the programs whose optimization fails fail when they are executed.
+func TestOptimize_output(t *testing.T) {
+	sources := append(nativeTests[:len(nativeTests):len(nativeTests)],
+		// the global variable is read by the function before its initialization
+		`int f() { return g; } int a = f(); int g = 5; int main() { return a; }`,
+		`int g = 5; int h() { return g + k; } int a = h(); int k = 1; int main() { return a + g + k; }`)
+	for _, s := range sources {
+		program, err := parse(strings.NewReader(s), io.Discard)
+		if err != nil {
+			t.Fatalf("%q: parse error: %s", s, err)
+		}
+		res, err := NewInterpreter(program).interpreterContext(context.Background())
+		if err := Optimize(program); err != nil {
+			if res.Err == nil {
+				t.Errorf("%q: optimization error %q, but the execution succeeds", s, err)
+			}
+			continue
+		}
+		for _, vm := range []bool{false, true} {
+			optimized, errOptimized := NewInterpreterWithOptions(program, Options{VM: vm}).
+				interpreterContext(context.Background())
+			if errstring(err) != errstring(errOptimized) || res.Stdout != optimized.Stdout ||
+				res.ExitCode != optimized.ExitCode {
+				t.Errorf("%q: result mismatch (vm=%t):\n  exp=%q %d %v\n  got=%q %d %v\n\n", s, vm, res.Stdout,
+					res.ExitCode, err, optimized.Stdout, optimized.ExitCode, errOptimized)
+			}
+		}
+	}
+}
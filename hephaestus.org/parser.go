@@ -14,6 +14,7 @@ const (
 	TYPE_VOID
 	TYPE_STRING
 	TYPE_BOOLEAN
+	TYPE_ENUM
 )
 
 type InstructionCode int
@@ -21,27 +22,73 @@ type InstructionCode int
 const (
 	INSTRUCTION_AFFECTATION InstructionCode = iota
 	INSTRUCTION_CALL
+	INSTRUCTION_RETURN
+	INSTRUCTION_DECLARATION
+	INSTRUCTION_SWITCH
+	INSTRUCTION_BREAK
+	INSTRUCTION_EXPRESSION
 )
 
 type Type struct {
 	code     TypeCode
+	name     string // name of the enumeration for TYPE_ENUM
+	position *Position
+}
+
+// Program is a parsed source file: the enumerations, the top-level variables and the functions.
+type Program struct {
+	Enums     []Enum
+	Globals   []Instruction
+	Functions []Function
+}
+
+type Enum struct {
+	Name     string
+	Values   []EnumValue
+	position *Position
+}
+
+// EnumValue is a named constant of an enumeration.
+type EnumValue struct {
+	Name     string
+	Valeur   *Expression // explicit value, nil if the value follows the previous one
+	Value    int
 	position *Position
 }
 
 type Function struct {
 	ReturnType  Type
 	Name        string
+	Parameter   []Parameter
 	Instruction []Instruction
 	position    *Position
+	end         *Position // closing curly bracket
+}
+
+type Parameter struct {
+	Name     string
+	Type     Type
+	position *Position
 }
 
 type Instruction struct {
 	Code         InstructionCode
 	FunctionName string
 	Variable     string
+	VariableType *Type // type of the variable for INSTRUCTION_DECLARATION
+	Constant     bool
 	Valeur       *Expression
 	Parameter    []Expression
+	Case         []Case // cases of INSTRUCTION_SWITCH
 	position     *Position
+	end          *Position // closing curly bracket of INSTRUCTION_SWITCH
+}
+
+// Case is a case of a switch, with the instructions executed until a break.
+type Case struct {
+	Valeur      *Expression // nil for default
+	Instruction []Instruction
+	position    *Position
 }
 
 type ExprCode int
@@ -59,6 +106,27 @@ const (
 	EXPR_CODE_EQU
 	EXPR_CODE_TRUE
 	EXPR_CODE_FALSE
+	EXPR_CODE_CALL
+	EXPR_CODE_MUL
+	EXPR_CODE_DIV
+	EXPR_CODE_MOD
+	EXPR_CODE_ASSIGN          // variable = right
+	EXPR_CODE_COMPOUND_ASSIGN // variable operator= right
+	EXPR_CODE_PRE_INC         // ++variable
+	EXPR_CODE_PRE_DEC         // --variable
+	EXPR_CODE_POST_INC        // variable++
+	EXPR_CODE_POST_DEC        // variable--
+	EXPR_CODE_BIT_AND
+	EXPR_CODE_BIT_OR
+	EXPR_CODE_BIT_XOR
+	EXPR_CODE_BIT_NOT // ~right
+	EXPR_CODE_SHL
+	EXPR_CODE_SHR // arithmetic shift, the sign is kept
+	EXPR_CODE_NEQ
+	EXPR_CODE_AND         // left && right, right is evaluated only if left is true
+	EXPR_CODE_OR          // left || right, right is evaluated only if left is false
+	EXPR_CODE_NOT         // !right
+	EXPR_CODE_CONDITIONAL // condition ? left : right
 )
 
 type Expression struct {
@@ -66,54 +134,224 @@ type Expression struct {
 	valeurInt    int
 	variable     string
 	valeurString string
+	functionName string
+	parameter    []Expression
+	operator     ExprCode    // binary operation of EXPR_CODE_COMPOUND_ASSIGN
+	condition    *Expression // condition of EXPR_CODE_CONDITIONAL
 	left         *Expression
 	right        *Expression
 	position     *Position
 }
 
+// Comment is a comment of the source.
+type Comment struct {
+	Text     string
+	trailing bool // the comment follows a token on the same line
+	position *Position
+}
+
 // Parser represents a parser.
 type Parser struct {
-	s   *Scanner
-	buf struct {
-		tok Token  // last read token
-		lit string // last read literal
-		n   int    // buffer size (max=1)
+	s        *Scanner
+	warnings []Warning
+	comments []Comment
+	blanks   map[int]bool // lines preceded by a blank line
+	line     int          // line of the last token scanned
+	buf      struct {
+		tok Token     // last read token
+		lit string    // last read literal
+		pos *Position // last read position
+		n   int       // buffer size (max=1)
 	}
 }
 
 var binaryOperation = map[Token]ExprCode{ADD: EXPR_CODE_ADD,
 	SUB: EXPR_CODE_SUB, EQUALS2: EXPR_CODE_EQU, LESSER: EXPR_CODE_LT, LESSER_OR_EQUALS: EXPR_CODE_LTE,
-	GREATER: EXPR_CODE_GT, GREATER_OR_EQUALS: EXPR_CODE_GTE}
+	GREATER: EXPR_CODE_GT, GREATER_OR_EQUALS: EXPR_CODE_GTE, ASTERISK: EXPR_CODE_MUL, SLASH: EXPR_CODE_DIV,
+	PERCENT: EXPR_CODE_MOD, AMPERSAND: EXPR_CODE_BIT_AND, PIPE: EXPR_CODE_BIT_OR, CARET: EXPR_CODE_BIT_XOR,
+	SHIFT_LEFT: EXPR_CODE_SHL, SHIFT_RIGHT: EXPR_CODE_SHR,
+	NOT_EQUALS: EXPR_CODE_NEQ, LOGICAL_AND: EXPR_CODE_AND, LOGICAL_OR: EXPR_CODE_OR}
+
+// binaryPrecedence is the precedence of the binary operations, as in C: higher binds tighter.
+var binaryPrecedence = map[ExprCode]int{
+	EXPR_CODE_MUL: 10, EXPR_CODE_DIV: 10, EXPR_CODE_MOD: 10,
+	EXPR_CODE_ADD: 9, EXPR_CODE_SUB: 9,
+	EXPR_CODE_SHL: 8, EXPR_CODE_SHR: 8,
+	EXPR_CODE_LT: 7, EXPR_CODE_LTE: 7, EXPR_CODE_GT: 7, EXPR_CODE_GTE: 7,
+	EXPR_CODE_EQU: 6, EXPR_CODE_NEQ: 6,
+	EXPR_CODE_BIT_AND: 5,
+	EXPR_CODE_BIT_XOR: 4,
+	EXPR_CODE_BIT_OR:  3,
+	EXPR_CODE_AND:     2,
+	EXPR_CODE_OR:      1,
+}
+
+// compoundAssignment is the binary operation of the compound assignment operators.
+var compoundAssignment = map[Token]ExprCode{ADD_EQUALS: EXPR_CODE_ADD, SUB_EQUALS: EXPR_CODE_SUB,
+	MUL_EQUALS: EXPR_CODE_MUL, DIV_EQUALS: EXPR_CODE_DIV, MOD_EQUALS: EXPR_CODE_MOD, AND_EQUALS: EXPR_CODE_BIT_AND,
+	OR_EQUALS: EXPR_CODE_BIT_OR, XOR_EQUALS: EXPR_CODE_BIT_XOR, SHL_EQUALS: EXPR_CODE_SHL, SHR_EQUALS: EXPR_CODE_SHR}
 
 // NewParser returns a new instance of Parser.
 func NewParser(r io.Reader) *Parser {
-	return &Parser{s: NewScanner(r)}
+	return &Parser{s: NewScanner(r), blanks: make(map[int]bool)}
 }
 
-func parser() {
+// Comments returns the comments of the source parsed, in their order.
+func (p *Parser) Comments() []Comment {
+	return p.comments
+}
 
-	s := "void main () { x=5;y=18;z=x;t=x+8;v=\"abc\";print(x,y,z,t,v);}"
-	p := NewParser(strings.NewReader(s))
-	funct, err := p.Parse2()
+// parseExpr parses an expression. The assignments are the operations with the lowest precedence and are
+// right associative: a = b += 1 is a = (b += 1).
+func (p *Parser) parseExpr() (*Expression, error) {
+	expr, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+	tok, lit, pos, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, err
+	}
+	operator, isCompound := compoundAssignment[tok]
+	if tok != EQUALS && !isCompound {
+		p.unscan()
+		return expr, nil
+	} else if expr.code != EXPR_CODE_VAR {
+		return nil, errorAt(pos, "found %q, lvalue required as left operand of assignment", lit)
+	}
+	right, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if isCompound {
+		return &Expression{code: EXPR_CODE_COMPOUND_ASSIGN, variable: expr.variable, operator: operator,
+			right: right, position: pos}, nil
+	}
+	return &Expression{code: EXPR_CODE_ASSIGN, variable: expr.variable, right: right, position: pos}, nil
+}
 
+// parseExpressionSource parses the source of a single expression, such as the input of the REPL or the condition
+// of a breakpoint.
+func parseExpressionSource(source string) (*Expression, error) {
+	program, err := NewParser(strings.NewReader("void f() {\nreturn " + source + ";\n}")).Parse2()
 	if err != nil {
-		fmt.Printf("error : %v\n", err)
+		return nil, err
+	} else if instructions := program.Functions[0].Instruction; len(instructions) != 1 {
+		return nil, fmt.Errorf("expected an expression, found %q", source)
 	} else {
-		err = p.Checker(funct)
+		return instructions[0].Valeur, nil
+	}
+}
+
+// parseConditional parses a conditional expression, which is right associative: a ? b : c ? d : e is
+// a ? b : (c ? d : e).
+func (p *Parser) parseConditional() (*Expression, error) {
+	expr, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	tok, _, pos, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, err
+	} else if tok != QUESTION_MARK {
+		p.unscan()
+		return expr, nil
+	}
+	left, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+		return nil, err
+	} else if tok != COLON {
+		return nil, errorAt(pos, "found %q, expected :", lit)
+	}
+	right, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{code: EXPR_CODE_CONDITIONAL, condition: expr, left: left, right: right, position: pos}, nil
+}
+
+// parseBinary parses the binary operations with a precedence greater or equal to minPrecedence.
+// The operations with the same precedence are left associative.
+func (p *Parser) parseBinary(minPrecedence int) (*Expression, error) {
+	expr, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, _, pos, err := p.scanIgnoreWhitespace()
 		if err != nil {
-			fmt.Printf("error : %v\n", err)
-		} else {
-			fmt.Printf("ok %v\n", funct)
-			interpreter := NewInterpreter(funct)
-			_, err = interpreter.interpreter()
-			if err != nil {
-				fmt.Printf("error : %v\n", err)
-			}
+			return nil, err
+		}
+		val, ok := binaryOperation[tok]
+		if !ok || binaryPrecedence[val] < minPrecedence {
+			p.unscan()
+			return expr, nil
+		}
+		expr2, err := p.parseBinary(binaryPrecedence[val] + 1)
+		if err != nil {
+			return nil, errorAt(pos, "expected expression for add: %w", err)
 		}
+		expr = &Expression{code: val, left: expr, right: expr2, position: pos}
 	}
 }
 
-func (p *Parser) parseExpr() (*Expression, error) {
+// parseUnary parses the prefix operations and the postfix operations.
+func (p *Parser) parseUnary() (*Expression, error) {
+	tok, lit, pos, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, err
+	} else if tok == INCREMENT || tok == DECREMENT {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		} else if expr.code != EXPR_CODE_VAR {
+			return nil, errorAt(pos, "found %q, lvalue required as operand", lit)
+		}
+		code := EXPR_CODE_PRE_INC
+		if tok == DECREMENT {
+			code = EXPR_CODE_PRE_DEC
+		}
+		return &Expression{code: code, variable: expr.variable, position: pos}, nil
+	} else if tok == TILDE || tok == NOT {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		code := EXPR_CODE_BIT_NOT
+		if tok == NOT {
+			code = EXPR_CODE_NOT
+		}
+		return &Expression{code: code, right: expr, position: pos}, nil
+	}
+	p.unscan()
+
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, lit, pos, err := p.scanIgnoreWhitespace()
+		if err != nil {
+			return nil, err
+		} else if tok != INCREMENT && tok != DECREMENT {
+			p.unscan()
+			return expr, nil
+		} else if expr.code != EXPR_CODE_VAR {
+			return nil, errorAt(pos, "found %q, lvalue required as operand", lit)
+		}
+		code := EXPR_CODE_POST_INC
+		if tok == DECREMENT {
+			code = EXPR_CODE_POST_DEC
+		}
+		expr = &Expression{code: code, variable: expr.variable, position: pos}
+	}
+}
+
+// parsePrimary parses a literal, a variable, a call or an expression in parenthesis.
+func (p *Parser) parsePrimary() (*Expression, error) {
 	var expr Expression
 	tok, lit, pos, err := p.scanIgnoreWhitespace()
 	if err != nil {
@@ -121,39 +359,42 @@ func (p *Parser) parseExpr() (*Expression, error) {
 	} else if tok == NUMBER {
 		intVar, err := strconv.Atoi(lit)
 		if err != nil {
-			return nil, fmt.Errorf("invalide number %q (pos=%v)", lit, pos)
+			return nil, errorAt(pos, "invalide number %q", lit)
 		} else {
 			expr = Expression{code: EXPR_CODE_INT, valeurInt: intVar, position: pos}
 		}
 	} else if tok == IDENT {
-		expr = Expression{code: EXPR_CODE_VAR, variable: lit, position: pos}
+		if tok2, _, _, err := p.scanIgnoreWhitespace(); err != nil {
+			return nil, err
+		} else if tok2 == OPEN_PARENTHESIS {
+			param, err := p.parseParameters()
+			if err != nil {
+				return nil, err
+			}
+			expr = Expression{code: EXPR_CODE_CALL, functionName: lit, parameter: param, position: pos}
+		} else {
+			p.unscan()
+			expr = Expression{code: EXPR_CODE_VAR, variable: lit, position: pos}
+		}
 	} else if tok == STRING_LITERAL {
 		expr = Expression{code: EXPR_CODE_STR, valeurString: lit, position: pos}
 	} else if tok == TRUE {
 		expr = Expression{code: EXPR_CODE_TRUE, position: pos}
 	} else if tok == FALSE {
 		expr = Expression{code: EXPR_CODE_FALSE, position: pos}
-	} else {
-		return nil, fmt.Errorf("found %q, expected number or ident or string (pos=%v)", lit, pos)
-	}
-	tok, lit, pos, err = p.scanIgnoreWhitespace()
-	if err != nil {
-		return nil, err
-	} else if val, ok := binaryOperation[tok]; ok {
-		expr2, err := p.parseExpr()
+	} else if tok == OPEN_PARENTHESIS {
+		expr, err := p.parseExpr()
 		if err != nil {
-			return nil, fmt.Errorf("expected expression for add: %s (pos=%v)", err, pos)
-		} else {
-			var expr3 *Expression
-			expr3 = new(Expression)
-			expr3.code = val
-			expr3.left = &expr
-			expr3.right = expr2
-			expr3.position = pos
-			return expr3, nil
+			return nil, err
+		}
+		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+			return nil, err
+		} else if tok != CLOSE_PARENTHESIS {
+			return nil, errorAt(pos, "found %q, expected )", lit)
 		}
+		return expr, nil
 	} else {
-		p.unscan()
+		return nil, errorAt(pos, "found %q, expected number or ident or string", lit)
 	}
 	return &expr, nil
 }
@@ -182,138 +423,476 @@ func (p *Parser) parseType() (*Type, error) {
 		res.code = TYPE_BOOLEAN
 		res.position = pos
 		return res, nil
+	} else if tok == ENUM {
+		res = new(Type)
+		res.code = TYPE_ENUM
+		res.position = pos
+		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+			return nil, err
+		} else if tok != IDENT {
+			return nil, errorAt(pos, "found %q, expected identifier", lit)
+		} else {
+			res.name = lit
+		}
+		return res, nil
 	} else {
-		return nil, fmt.Errorf("found %q, expected type (pos=%v)", lit, pos)
+		return nil, errorAt(pos, "found %q, expected type", lit)
 	}
 }
 
-func (p *Parser) parseInstr(funct *Function) (*Instruction, error) {
-
+// parseEnum parses the values of an enumeration, after the open curly bracket.
+func (p *Parser) parseEnum(enum *Enum) error {
+	value := 0
 	for {
-
-		instr := &Instruction{}
-		var name = ""
-		var posStart *Position
-
+		enumValue := EnumValue{}
 		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
-			return nil, err
+			return err
 		} else if tok != IDENT {
-			return nil, fmt.Errorf("found %q, expected identifier (pos=%v)", lit, pos)
+			return errorAt(pos, "found %q, expected identifier", lit)
 		} else {
-			name = lit
-			posStart = pos
+			enumValue.Name = lit
+			enumValue.position = pos
 		}
-
-		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
-			return nil, err
+		tok, lit, pos, err := p.scanIgnoreWhitespace()
+		if err != nil {
+			return err
 		} else if tok == EQUALS {
-			expr, err := p.parseExpr()
+			tok, lit, pos, err = p.scanIgnoreWhitespace()
+			start, sign := pos, ""
+			if err == nil && tok == SUB {
+				// a negative value is a number after a minus
+				sign = "-"
+				tok, lit, pos, err = p.scanIgnoreWhitespace()
+			}
 			if err != nil {
-				return nil, fmt.Errorf("invalid expression: %s", err)
+				return err
+			} else if tok != NUMBER {
+				return errorAt(pos, "found %q, expected number", lit)
+			} else if value, err = strconv.Atoi(sign + lit); err != nil {
+				return errorAt(pos, "invalide number %q", lit)
 			} else {
-				instr.Code = INSTRUCTION_AFFECTATION
-				instr.Valeur = expr
-				instr.Variable = name
-				instr.position = posStart
+				enumValue.Valeur = &Expression{code: EXPR_CODE_INT, valeurInt: value, position: start}
 			}
-		} else if tok == OPEN_PARENTHESIS {
-			instr.Code = INSTRUCTION_CALL
-			instr.FunctionName = name
-			instr.position = posStart
-			var param []Expression
-			end := false
-			for !end {
-				expr, err := p.parseExpr()
-				if err != nil {
-					return nil, fmt.Errorf("invalid expression: %s", err)
-				} else {
-					param = append(param, *expr)
-					if tok, _, pos, err := p.scanIgnoreWhitespace(); err != nil {
-						return nil, err
-					} else if tok == COMMA {
-						// on continue
-					} else if tok == CLOSE_PARENTHESIS {
-						end = true
-					} else {
-						return nil, fmt.Errorf("invalid call (pos=%v)", pos)
-					}
-				}
+			tok, lit, pos, err = p.scanIgnoreWhitespace()
+			if err != nil {
+				return err
 			}
-			instr.Parameter = param
-		} else {
-			return nil, fmt.Errorf("found %q, expected = (pos=%v)", lit, pos)
 		}
-
-		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
-			return nil, err
-		} else if tok != SEMICOLON {
-			return nil, fmt.Errorf("found %q, expected ';' (pos=%v)", lit, pos)
+		enumValue.Value = value
+		value++
+		enum.Values = append(enum.Values, enumValue)
+		if tok == CLOSE_CURLY_BRACKET {
+			break
+		} else if tok != COMMA {
+			return errorAt(pos, "found %q, expected }", lit)
 		}
+	}
 
-		funct.Instruction = append(funct.Instruction, *instr)
+	if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+		return err
+	} else if tok != SEMICOLON {
+		return errorAt(pos, "found %q, expected ';'", lit)
+	}
+	return nil
+}
 
-		if tok, _, _, err := p.scanIgnoreWhitespace(); err != nil {
-			return nil, err
+// parseSwitch parses a switch, after the keyword switch.
+func (p *Parser) parseSwitch(instr *Instruction) error {
+	instr.Code = INSTRUCTION_SWITCH
+
+	if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+		return err
+	} else if tok != OPEN_PARENTHESIS {
+		return errorAt(pos, "found %q, expected (", lit)
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return fmt.Errorf("invalid expression: %w", err)
+	}
+	instr.Valeur = expr
+	if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+		return err
+	} else if tok != CLOSE_PARENTHESIS {
+		return errorAt(pos, "found %q, expected )", lit)
+	}
+	if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+		return err
+	} else if tok != OPEN_CURLY_BRACKET {
+		return errorAt(pos, "found %q, expected {", lit)
+	}
+
+	for {
+		c := Case{}
+		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+			return err
 		} else if tok == CLOSE_CURLY_BRACKET {
-			p.unscan()
+			instr.end = pos
 			break
+		} else if tok == CASE {
+			c.position = pos
+			expr, err := p.parseExpr()
+			if err != nil {
+				return fmt.Errorf("invalid expression: %w", err)
+			}
+			c.Valeur = expr
+		} else if tok == DEFAULT {
+			c.position = pos
 		} else {
-			p.unscan()
+			return errorAt(pos, "found %q, expected case or default", lit)
 		}
-
+		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+			return err
+		} else if tok != COLON {
+			return errorAt(pos, "found %q, expected :", lit)
+		}
+		instructions, err := p.parseInstr()
+		if err != nil {
+			return err
+		}
+		c.Instruction = instructions
+		instr.Case = append(instr.Case, c)
 	}
+	return nil
+}
 
-	return nil, nil
+// parseParameters parses the parameters of a call, after the open parenthesis.
+func (p *Parser) parseParameters() ([]Expression, error) {
+	var param []Expression
+	if tok, _, _, err := p.scanIgnoreWhitespace(); err != nil {
+		return nil, err
+	} else if tok == CLOSE_PARENTHESIS {
+		return param, nil
+	} else {
+		p.unscan()
+	}
+	end := false
+	for !end {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression: %w", err)
+		} else {
+			param = append(param, *expr)
+			if tok, _, pos, err := p.scanIgnoreWhitespace(); err != nil {
+				return nil, err
+			} else if tok == COMMA {
+				// on continue
+			} else if tok == CLOSE_PARENTHESIS {
+				end = true
+			} else {
+				return nil, errorAt(pos, "invalid call")
+			}
+		}
+	}
+	return param, nil
 }
 
-func (p *Parser) Parse2() ([]Function, error) {
+// parseDeclaration parses the declaration of a variable, without the final semicolon.
+func (p *Parser) parseDeclaration() (*Instruction, error) {
+	instr := &Instruction{Code: INSTRUCTION_DECLARATION}
 
-	funct := &Function{}
+	if tok, _, pos, err := p.scanIgnoreWhitespace(); err != nil {
+		return nil, err
+	} else if tok == CONST {
+		instr.Constant = true
+		instr.position = pos
+	} else {
+		p.unscan()
+	}
 
-	typeReturn, err := p.parseType()
+	typeVar, err := p.parseType()
 	if err != nil {
 		return nil, err
+	} else if typeVar.code == TYPE_VOID {
+		return nil, errorAt(typeVar.position, "variable can not be void")
+	}
+	instr.VariableType = typeVar
+	if instr.position == nil {
+		instr.position = typeVar.position
 	}
-	funct.ReturnType = *typeReturn
 
 	if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
-		return []Function{}, err
+		return nil, err
 	} else if tok != IDENT {
-		return nil, fmt.Errorf("found %q, expected main (pos=%v)", lit, pos)
+		return nil, errorAt(pos, "found %q, expected identifier", lit)
 	} else {
-		funct.Name = lit
+		instr.Variable = lit
 	}
 
-	if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
-		return []Function{}, err
-	} else if tok != OPEN_PARENTHESIS {
-		return nil, fmt.Errorf("found %q, expected ( (pos=%v)", lit, pos)
+	if tok, _, _, err := p.scanIgnoreWhitespace(); err != nil {
+		return nil, err
+	} else if tok == EQUALS {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression: %w", err)
+		}
+		instr.Valeur = expr
+	} else {
+		p.unscan()
+	}
+
+	return instr, nil
+}
+
+// parseInstr parses the instructions until the end of the block or the next case of a switch.
+func (p *Parser) parseInstr() ([]Instruction, error) {
+
+	var instructions []Instruction
+
+	for {
+
+		if tok, _, _, err := p.scanIgnoreWhitespace(); err != nil {
+			return nil, err
+		} else if tok == CLOSE_CURLY_BRACKET || tok == CASE || tok == DEFAULT {
+			p.unscan()
+			break
+		} else {
+			p.unscan()
+		}
+
+		instr := &Instruction{}
+		var posStart *Position
+
+		isReturn := false
+		isDeclaration := false
+		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+			return nil, err
+		} else if tok == SWITCH {
+			instr.position = pos
+			if err := p.parseSwitch(instr); err != nil {
+				return nil, err
+			}
+			instructions = append(instructions, *instr)
+			continue
+		} else if tok == BREAK {
+			instr.Code = INSTRUCTION_BREAK
+			instr.position = pos
+			if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+				return nil, err
+			} else if tok != SEMICOLON {
+				return nil, errorAt(pos, "found %q, expected ';'", lit)
+			}
+			instructions = append(instructions, *instr)
+			continue
+		} else if tok == RETURN {
+			isReturn = true
+			posStart = pos
+		} else if tok == CONST || tok == INT || tok == STRING || tok == BOOLEAN || tok == VOID || tok == ENUM {
+			isDeclaration = true
+			p.unscan()
+		} else if tok != IDENT && tok != INCREMENT && tok != DECREMENT && tok != OPEN_PARENTHESIS {
+			return nil, errorAt(pos, "found %q, expected identifier", lit)
+		} else {
+			posStart = pos
+			p.unscan()
+		}
+
+		if isDeclaration {
+			var err error
+			instr, err = p.parseDeclaration()
+			if err != nil {
+				return nil, err
+			}
+		} else if isReturn {
+			instr.Code = INSTRUCTION_RETURN
+			instr.position = posStart
+			if tok, _, _, err := p.scanIgnoreWhitespace(); err != nil {
+				return nil, err
+			} else if tok != SEMICOLON {
+				p.unscan()
+				expr, err := p.parseExpr()
+				if err != nil {
+					return nil, fmt.Errorf("invalid expression: %w", err)
+				}
+				instr.Valeur = expr
+			} else {
+				p.unscan()
+			}
+		} else if expr, err := p.parseExpr(); err != nil {
+			return nil, fmt.Errorf("invalid expression: %w", err)
+		} else if expr.code == EXPR_CODE_ASSIGN {
+			instr.Code = INSTRUCTION_AFFECTATION
+			instr.Valeur = expr.right
+			instr.Variable = expr.variable
+			instr.position = posStart
+		} else if expr.code == EXPR_CODE_CALL {
+			instr.Code = INSTRUCTION_CALL
+			instr.FunctionName = expr.functionName
+			instr.Parameter = expr.parameter
+			instr.position = posStart
+		} else {
+			instr.Code = INSTRUCTION_EXPRESSION
+			instr.Valeur = expr
+			instr.position = posStart
+		}
+
+		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+			return nil, err
+		} else if tok != SEMICOLON {
+			return nil, errorAt(pos, "found %q, expected ';'", lit)
+		}
+
+		instructions = append(instructions, *instr)
 	}
 
+	return instructions, nil
+}
+
+// parseFunction parses a function after its name, from the open parenthesis.
+func (p *Parser) parseFunction(funct *Function) error {
+
 	if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
-		return []Function{}, err
+		return err
 	} else if tok != CLOSE_PARENTHESIS {
-		return nil, fmt.Errorf("found %q, expected )(pos=%v)", lit, pos)
+		p.unscan()
+		for {
+			typeParam, err := p.parseType()
+			if err != nil {
+				return err
+			} else if typeParam.code == TYPE_VOID {
+				return errorAt(typeParam.position, "parameter can not be void")
+			}
+			param := Parameter{Type: *typeParam, position: typeParam.position}
+			if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+				return err
+			} else if tok != IDENT {
+				return errorAt(pos, "found %q, expected identifier", lit)
+			} else {
+				param.Name = lit
+			}
+			funct.Parameter = append(funct.Parameter, param)
+			if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+				return err
+			} else if tok == CLOSE_PARENTHESIS {
+				break
+			} else if tok != COMMA {
+				return errorAt(pos, "found %q, expected )", lit)
+			}
+		}
+	} else if tok != CLOSE_PARENTHESIS {
+		return errorAt(pos, "found %q, expected )", lit)
 	}
 
 	if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
-		return []Function{}, err
+		return err
 	} else if tok != OPEN_CURLY_BRACKET {
-		return nil, fmt.Errorf("found %q, expected { (pos=%v)", lit, pos)
+		return errorAt(pos, "found %q, expected {", lit)
 	}
 
-	_, err = p.parseInstr(funct)
+	instructions, err := p.parseInstr()
 	if err != nil {
-		return nil, fmt.Errorf("expected instruction: %s", err)
+		return fmt.Errorf("expected instruction: %w", err)
 	}
+	funct.Instruction = instructions
 
 	if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
-		return []Function{}, err
+		return err
 	} else if tok != CLOSE_CURLY_BRACKET {
-		return nil, fmt.Errorf("found %q, expected } (pos=%v)", lit, pos)
+		return errorAt(pos, "found %q, expected }", lit)
+	} else {
+		funct.end = pos
 	}
+	return nil
+}
 
-	return []Function{*funct}, nil
+// Parse2 parses the top-level declarations of the source: enumerations, functions and variables.
+func (p *Parser) Parse2() (*Program, error) {
+
+	program := &Program{}
+
+	for {
+		var typeEnum *Type
+		if tok, _, _, err := p.scanIgnoreWhitespace(); err != nil {
+			return nil, err
+		} else if tok == EOF && len(program.Functions)+len(program.Globals)+len(program.Enums) > 0 {
+			break
+		} else if tok == ENUM {
+			if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+				return nil, err
+			} else if tok != IDENT {
+				return nil, errorAt(pos, "found %q, expected identifier", lit)
+			} else if tok, _, _, err := p.scanIgnoreWhitespace(); err != nil {
+				return nil, err
+			} else if tok == OPEN_CURLY_BRACKET {
+				enum := Enum{Name: lit, position: pos}
+				if err := p.parseEnum(&enum); err != nil {
+					return nil, err
+				}
+				program.Enums = append(program.Enums, enum)
+				continue
+			} else {
+				p.unscan()
+				typeEnum = &Type{code: TYPE_ENUM, name: lit, position: pos}
+			}
+		} else if tok == CONST {
+			p.unscan()
+			instr, err := p.parseDeclaration()
+			if err != nil {
+				return nil, err
+			}
+			if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+				return nil, err
+			} else if tok != SEMICOLON {
+				return nil, errorAt(pos, "found %q, expected ';'", lit)
+			}
+			program.Globals = append(program.Globals, *instr)
+			continue
+		} else {
+			p.unscan()
+		}
+
+		typeReturn := typeEnum
+		if typeReturn == nil {
+			var err error
+			typeReturn, err = p.parseType()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var name string
+		var namePos *Position
+		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+			return nil, err
+		} else if tok != IDENT {
+			return nil, errorAt(pos, "found %q, expected main", lit)
+		} else {
+			name = lit
+			namePos = pos
+		}
+
+		if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+			return nil, err
+		} else if tok == OPEN_PARENTHESIS {
+			funct := Function{ReturnType: *typeReturn, Name: name, position: namePos}
+			if err := p.parseFunction(&funct); err != nil {
+				return nil, err
+			}
+			program.Functions = append(program.Functions, funct)
+		} else if tok == EQUALS || tok == SEMICOLON {
+			if typeReturn.code == TYPE_VOID {
+				return nil, errorAt(typeReturn.position, "variable can not be void")
+			}
+			instr := Instruction{Code: INSTRUCTION_DECLARATION, Variable: name, VariableType: typeReturn,
+				position: typeReturn.position}
+			if tok == EQUALS {
+				expr, err := p.parseExpr()
+				if err != nil {
+					return nil, fmt.Errorf("invalid expression: %w", err)
+				}
+				instr.Valeur = expr
+				if tok, lit, pos, err := p.scanIgnoreWhitespace(); err != nil {
+					return nil, err
+				} else if tok != SEMICOLON {
+					return nil, errorAt(pos, "found %q, expected ';'", lit)
+				}
+			}
+			program.Globals = append(program.Globals, instr)
+		} else {
+			return nil, errorAt(pos, "found %q, expected (", lit)
+		}
+	}
+
+	return program, nil
 }
 
 // scan returns the next token from the underlying scanner.
@@ -322,7 +901,7 @@ func (p *Parser) scan() (tok Token, lit string, pos *Position, error error) {
 	// If we have a token on the buffer, then return it.
 	if p.buf.n != 0 {
 		p.buf.n = 0
-		return p.buf.tok, p.buf.lit, nil, nil
+		return p.buf.tok, p.buf.lit, p.buf.pos, nil
 	}
 
 	// Otherwise read the next token from the scanner.
@@ -333,16 +912,34 @@ func (p *Parser) scan() (tok Token, lit string, pos *Position, error error) {
 	tok, lit, pos = tmp.tok, tmp.lit, &tmp.position
 
 	// Save it to the buffer in case we unscan later.
-	p.buf.tok, p.buf.lit = tok, lit
+	p.buf.tok, p.buf.lit, p.buf.pos = tok, lit, pos
 
 	return
 }
 
-// scanIgnoreWhitespace scans the next non-whitespace token.
+// scanIgnoreWhitespace scans the next token which is not a whitespace or a comment. The comments and the lines
+// of the source left blank are recorded.
 func (p *Parser) scanIgnoreWhitespace() (tok Token, lit string, pos *Position, err error) {
-	tok, lit, pos, err = p.scan()
-	if tok == WS {
-		tok, lit, pos, err = p.scan()
+	blank := false
+	for {
+		if tok, lit, pos, err = p.scan(); err != nil || tok != WS && tok != COMMENT {
+			break
+		} else if tok == WS {
+			blank = strings.Count(lit, "\n") > 1
+			continue
+		}
+		p.comments = append(p.comments, Comment{Text: lit, trailing: pos.line == p.line, position: pos})
+		if blank {
+			p.blanks[pos.line] = true
+		}
+		p.line = pos.line + strings.Count(lit, "\n")
+		blank = false
+	}
+	if err == nil && pos != nil {
+		if blank {
+			p.blanks[pos.line] = true
+		}
+		p.line = pos.line
 	}
 	return
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/kr/pretty"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -23,7 +24,9 @@ func TestParser_ParseStatement(t *testing.T) {
 				ReturnType: Type{code: TYPE_VOID, position: &Position{
 					line: 1, column: 1, pos: 0,
 				}},
-				Name: "main",
+				Name:     "main",
+				position: &Position{line: 1, column: 1, pos: 5},
+				end:      &Position{line: 1, column: 1, pos: 24},
 				Instruction: []Instruction{
 					{
 						Variable: "x",
@@ -32,6 +35,7 @@ func TestParser_ParseStatement(t *testing.T) {
 					}, {
 						Variable: "y",
 						Valeur:   &Expression{code: EXPR_CODE_INT, valeurInt: 18, position: &Position{line: 1, column: 1, pos: 21}},
+						position: &Position{line: 1, column: 1, pos: 19},
 					},
 				},
 			},
@@ -43,7 +47,9 @@ func TestParser_ParseStatement(t *testing.T) {
 				ReturnType: Type{code: TYPE_VOID, position: &Position{
 					line: 1, column: 1, pos: 0,
 				}},
-				Name: "test123",
+				Name:     "test123",
+				position: &Position{line: 1, column: 1, pos: 5},
+				end:      &Position{line: 1, column: 1, pos: 33},
 				Instruction: []Instruction{
 					{
 						Variable: "abc",
@@ -52,6 +58,7 @@ func TestParser_ParseStatement(t *testing.T) {
 					}, {
 						Variable: "zzz",
 						Valeur:   &Expression{code: EXPR_CODE_INT, valeurInt: 156, position: &Position{line: 1, column: 1, pos: 29}},
+						position: &Position{line: 1, column: 1, pos: 25},
 					},
 				},
 			},
@@ -63,7 +70,9 @@ func TestParser_ParseStatement(t *testing.T) {
 				ReturnType: Type{code: TYPE_VOID, position: &Position{
 					line: 1, column: 1, pos: 0,
 				}},
-				Name: "test3",
+				Name:     "test3",
+				position: &Position{line: 1, column: 1, pos: 5},
+				end:      &Position{line: 1, column: 1, pos: 28},
 				Instruction: []Instruction{
 					{
 						Variable: "x",
@@ -76,6 +85,7 @@ func TestParser_ParseStatement(t *testing.T) {
 							right:    &Expression{code: EXPR_CODE_INT, valeurInt: 15, position: &Position{line: 1, column: 1, pos: 25}},
 							position: &Position{line: 1, column: 1, pos: 24},
 						},
+						position: &Position{line: 1, column: 1, pos: 21},
 					},
 				},
 			},
@@ -87,7 +97,9 @@ func TestParser_ParseStatement(t *testing.T) {
 				ReturnType: Type{code: TYPE_VOID, position: &Position{
 					line: 1, column: 1, pos: 0,
 				}},
-				Name: "test3",
+				Name:     "test3",
+				position: &Position{line: 1, column: 1, pos: 5},
+				end:      &Position{line: 1, column: 1, pos: 28},
 				Instruction: []Instruction{
 					{
 						Variable: "x",
@@ -97,6 +109,7 @@ func TestParser_ParseStatement(t *testing.T) {
 						Variable: "y",
 						Valeur: &Expression{code: EXPR_CODE_VAR,
 							variable: "x", position: &Position{line: 1, column: 1, pos: 26}},
+						position: &Position{line: 1, column: 1, pos: 24},
 					},
 				},
 			},
@@ -108,7 +121,9 @@ func TestParser_ParseStatement(t *testing.T) {
 				ReturnType: Type{code: TYPE_VOID, position: &Position{
 					line: 1, column: 1, pos: 0,
 				}},
-				Name: "test3",
+				Name:     "test3",
+				position: &Position{line: 1, column: 1, pos: 5},
+				end:      &Position{line: 1, column: 1, pos: 38},
 				Instruction: []Instruction{
 					{
 						Variable: "x",
@@ -117,6 +132,7 @@ func TestParser_ParseStatement(t *testing.T) {
 					}, {
 						Variable: "y",
 						Valeur:   &Expression{code: EXPR_CODE_FALSE, position: &Position{line: 1, column: 1, pos: 25}},
+						position: &Position{line: 1, column: 1, pos: 23},
 					}, {
 						Variable: "z",
 						Valeur: &Expression{code: EXPR_CODE_LTE,
@@ -124,6 +140,7 @@ func TestParser_ParseStatement(t *testing.T) {
 							right:    &Expression{code: EXPR_CODE_INT, valeurInt: 7, position: &Position{line: 1, column: 1, pos: 36}},
 							position: &Position{line: 1, column: 1, pos: 34},
 						},
+						position: &Position{line: 1, column: 1, pos: 31},
 					},
 				},
 			},
@@ -135,7 +152,9 @@ func TestParser_ParseStatement(t *testing.T) {
 				ReturnType: Type{code: TYPE_VOID, position: &Position{
 					line: 1, column: 1, pos: 0,
 				}},
-				Name: "test3",
+				Name:     "test3",
+				position: &Position{line: 1, column: 1, pos: 5},
+				end:      &Position{line: 1, column: 1, pos: 58},
 				Instruction: []Instruction{
 					{
 						Variable: "x",
@@ -152,6 +171,7 @@ func TestParser_ParseStatement(t *testing.T) {
 							right:    &Expression{code: EXPR_CODE_INT, valeurInt: 17, position: &Position{line: 1, column: 1, pos: 29}},
 							position: &Position{line: 1, column: 1, pos: 27},
 						},
+						position: &Position{line: 1, column: 1, pos: 23},
 					}, {
 						Variable: "z",
 						Valeur: &Expression{code: EXPR_CODE_GT,
@@ -159,6 +179,7 @@ func TestParser_ParseStatement(t *testing.T) {
 							right:    &Expression{code: EXPR_CODE_INT, valeurInt: 26, position: &Position{line: 1, column: 1, pos: 37}},
 							position: &Position{line: 1, column: 1, pos: 36},
 						},
+						position: &Position{line: 1, column: 1, pos: 32},
 					}, {
 						Variable: "t",
 						Valeur: &Expression{code: EXPR_CODE_GTE,
@@ -166,6 +187,7 @@ func TestParser_ParseStatement(t *testing.T) {
 							right:    &Expression{code: EXPR_CODE_INT, valeurInt: 50, position: &Position{line: 1, column: 1, pos: 46}},
 							position: &Position{line: 1, column: 1, pos: 44},
 						},
+						position: &Position{line: 1, column: 1, pos: 40},
 					}, {
 						Variable: "v",
 						Valeur: &Expression{code: EXPR_CODE_EQU,
@@ -173,6 +195,7 @@ func TestParser_ParseStatement(t *testing.T) {
 							right:    &Expression{code: EXPR_CODE_INT, valeurInt: 63, position: &Position{line: 1, column: 1, pos: 55}},
 							position: &Position{line: 1, column: 1, pos: 53},
 						},
+						position: &Position{line: 1, column: 1, pos: 49},
 					},
 				},
 			},
@@ -184,7 +207,9 @@ func TestParser_ParseStatement(t *testing.T) {
 				ReturnType: Type{code: TYPE_VOID, position: &Position{
 					line: 1, column: 1, pos: 0,
 				}},
-				Name: "test3",
+				Name:     "test3",
+				position: &Position{line: 1, column: 1, pos: 5},
+				end:      &Position{line: 1, column: 1, pos: 36},
 				Instruction: []Instruction{
 					{
 						Code:     INSTRUCTION_AFFECTATION,
@@ -195,6 +220,7 @@ func TestParser_ParseStatement(t *testing.T) {
 						Code:     INSTRUCTION_AFFECTATION,
 						Variable: "y",
 						Valeur:   &Expression{code: EXPR_CODE_INT, valeurInt: 20, position: &Position{line: 1, column: 1, pos: 22}},
+						position: &Position{line: 1, column: 1, pos: 20},
 					}, {
 						Code:         INSTRUCTION_CALL,
 						FunctionName: "print",
@@ -202,6 +228,30 @@ func TestParser_ParseStatement(t *testing.T) {
 							{code: EXPR_CODE_VAR, variable: "x", position: &Position{line: 1, column: 1, pos: 31}},
 							{code: EXPR_CODE_VAR, variable: "y", position: &Position{line: 1, column: 1, pos: 33}},
 						},
+						position: &Position{line: 1, column: 1, pos: 25},
+					},
+				},
+			},
+			},
+		},
+		{
+			s: `int main() { return 5+2;}`,
+			funct: []Function{{
+				ReturnType: Type{code: TYPE_INT, position: &Position{
+					line: 1, column: 1, pos: 0,
+				}},
+				Name:     "main",
+				position: &Position{line: 1, column: 1, pos: 4},
+				end:      &Position{line: 1, column: 1, pos: 24},
+				Instruction: []Instruction{
+					{
+						Code: INSTRUCTION_RETURN,
+						Valeur: &Expression{code: EXPR_CODE_ADD,
+							left:     &Expression{code: EXPR_CODE_INT, valeurInt: 5, position: &Position{line: 1, column: 1, pos: 20}},
+							right:    &Expression{code: EXPR_CODE_INT, valeurInt: 2, position: &Position{line: 1, column: 1, pos: 22}},
+							position: &Position{line: 1, column: 1, pos: 21},
+						},
+						position: &Position{line: 1, column: 1, pos: 13},
 					},
 				},
 			},
@@ -212,7 +262,11 @@ func TestParser_ParseStatement(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		stmt, err := NewParser(strings.NewReader(tt.s)).Parse2()
+		program, err := NewParser(strings.NewReader(tt.s)).Parse2()
+		var stmt []Function
+		if program != nil {
+			stmt = program.Functions
+		}
 
 		//if diff := deep.Equal(t1, t2); diff != nil {
 		//	t.Error(diff)
@@ -237,6 +291,228 @@ func TestParser_ParseStatement(t *testing.T) {
 	}
 }
 
+// Ensure the parser can parse the top-level variables and the functions with parameters.
+func TestParser_ParseGlobals(t *testing.T) {
+	var tests = []struct {
+		s         string
+		globals   []Instruction
+		functions int
+		err       string
+	}{
+		{
+			s: `const int N=3; string name; void main () { int x=N; }`,
+			globals: []Instruction{
+				{
+					Code: INSTRUCTION_DECLARATION, Variable: "N", Constant: true,
+					VariableType: &Type{code: TYPE_INT, position: &Position{line: 1, column: 1, pos: 6}},
+					Valeur:       &Expression{code: EXPR_CODE_INT, valeurInt: 3, position: &Position{line: 1, column: 1, pos: 12}},
+					position:     &Position{line: 1, column: 1, pos: 0},
+				}, {
+					Code: INSTRUCTION_DECLARATION, Variable: "name",
+					VariableType: &Type{code: TYPE_STRING, position: &Position{line: 1, column: 1, pos: 15}},
+					position:     &Position{line: 1, column: 1, pos: 15},
+				},
+			},
+			functions: 1,
+		},
+		{
+			s:         `int twice(int a) { return a+a; } int main () { return twice(2); }`,
+			functions: 2,
+		},
+		// Errors
+		{s: `void x;`, err: `variable can not be void (pos=&{1 1 0})`},
+		{s: `int f(int a b) { }`, err: `found "b", expected ) (pos=&{1 1 12})`},
+		{s: `void main () { const int x; }`, functions: 1},
+		{s: ``, err: `found "", expected type (pos=&{1 1 -1})`},
+	}
+
+	for i, tt := range tests {
+		program, err := NewParser(strings.NewReader(tt.s)).Parse2()
+		if tt.err != errstring(err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if err == nil && !reflect.DeepEqual(tt.globals, program.Globals) {
+			t.Errorf("%d. %q\n\nglobals mismatch:\n\nexp=%# v\n\ngot=%# v\n\n", i, tt.s,
+				pretty.Formatter(tt.globals), pretty.Formatter(program.Globals))
+		} else if err == nil && tt.functions != len(program.Functions) {
+			t.Errorf("%d. %q: functions mismatch: exp=%d got=%d", i, tt.s, tt.functions, len(program.Functions))
+		}
+	}
+}
+
+// Ensure the parser can parse the enumerations and the switches.
+func TestParser_ParseEnum(t *testing.T) {
+	var tests = []struct {
+		s     string
+		enums []Enum
+		cases []Case
+		err   string
+	}{
+		{
+			s: `enum Color { RED, GREEN = 5, BLUE }; void main () { }`,
+			enums: []Enum{{
+				Name: "Color",
+				Values: []EnumValue{
+					{Name: "RED", Value: 0, position: &Position{line: 1, column: 1, pos: 13}},
+					{Name: "GREEN", Value: 5, position: &Position{line: 1, column: 1, pos: 18},
+						Valeur: &Expression{code: EXPR_CODE_INT, valeurInt: 5, position: &Position{line: 1, column: 1, pos: 26}}},
+					{Name: "BLUE", Value: 6, position: &Position{line: 1, column: 1, pos: 29}},
+				},
+				position: &Position{line: 1, column: 1, pos: 5},
+			}},
+		},
+		{
+			s: `enum Sign { MINUS = -1, ZERO, PLUS = 1 }; void main () { }`,
+			enums: []Enum{{
+				Name: "Sign",
+				Values: []EnumValue{
+					{Name: "MINUS", Value: -1, position: &Position{line: 1, column: 1, pos: 12},
+						Valeur: &Expression{code: EXPR_CODE_INT, valeurInt: -1, position: &Position{line: 1, column: 1, pos: 20}}},
+					{Name: "ZERO", Value: 0, position: &Position{line: 1, column: 1, pos: 24}},
+					{Name: "PLUS", Value: 1, position: &Position{line: 1, column: 1, pos: 30},
+						Valeur: &Expression{code: EXPR_CODE_INT, valeurInt: 1, position: &Position{line: 1, column: 1, pos: 37}}},
+				},
+				position: &Position{line: 1, column: 1, pos: 5},
+			}},
+		},
+		{
+			s: `void main () { switch (x) { case 1: case 2: y=3; break; default: } }`,
+			cases: []Case{
+				{
+					Valeur:   &Expression{code: EXPR_CODE_INT, valeurInt: 1, position: &Position{line: 1, column: 1, pos: 33}},
+					position: &Position{line: 1, column: 1, pos: 28},
+				}, {
+					Valeur: &Expression{code: EXPR_CODE_INT, valeurInt: 2, position: &Position{line: 1, column: 1, pos: 41}},
+					Instruction: []Instruction{
+						{
+							Code:     INSTRUCTION_AFFECTATION,
+							Variable: "y",
+							Valeur:   &Expression{code: EXPR_CODE_INT, valeurInt: 3, position: &Position{line: 1, column: 1, pos: 46}},
+							position: &Position{line: 1, column: 1, pos: 44},
+						}, {
+							Code:     INSTRUCTION_BREAK,
+							position: &Position{line: 1, column: 1, pos: 49},
+						},
+					},
+					position: &Position{line: 1, column: 1, pos: 36},
+				}, {
+					position: &Position{line: 1, column: 1, pos: 56},
+				},
+			},
+		},
+		// Errors
+		{s: `enum Color { RED GREEN };`, err: `found "GREEN", expected } (pos=&{1 1 17})`},
+		{s: `enum Color { RED = x };`, err: `found "x", expected number (pos=&{1 1 19})`},
+		{s: `enum Color { RED = -x };`, err: `found "x", expected number (pos=&{1 1 20})`},
+		{s: `void main () { switch (x) { y=1; } }`, err: `expected instruction: found "y", expected case or default (pos=&{1 1 28})`},
+		{s: `void main () { switch (x) { case 1 y=1; } }`, err: `expected instruction: found "y", expected : (pos=&{1 1 35})`},
+	}
+
+	for i, tt := range tests {
+		program, err := NewParser(strings.NewReader(tt.s)).Parse2()
+		if tt.err != errstring(err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if err == nil && !reflect.DeepEqual(tt.enums, program.Enums) {
+			t.Errorf("%d. %q\n\nenums mismatch:\n\nexp=%# v\n\ngot=%# v\n\n", i, tt.s,
+				pretty.Formatter(tt.enums), pretty.Formatter(program.Enums))
+		} else if err == nil && tt.cases != nil && !reflect.DeepEqual(tt.cases, program.Functions[0].Instruction[0].Case) {
+			t.Errorf("%d. %q\n\ncases mismatch:\n\nexp=%# v\n\ngot=%# v\n\n", i, tt.s,
+				pretty.Formatter(tt.cases), pretty.Formatter(program.Functions[0].Instruction[0].Case))
+		}
+	}
+}
+
+// Ensure the parser respects the precedence and the associativity of the operators.
+func TestParser_ParseExpression(t *testing.T) {
+	var tests = []struct {
+		s    string
+		expr string
+		err  string
+	}{
+		{s: `1+2*3-4`, expr: `((1 + (2 * 3)) - 4)`},
+		{s: `10-4-3`, expr: `((10 - 4) - 3)`},
+		{s: `(10-4)*3 <= 18 % 5`, expr: `(((10 - 4) * 3) <= (18 % 5))`},
+		{s: `a+b == c/2`, expr: `((a + b) == (c / 2))`},
+		{s: `a = b = c += 2`, expr: `(a = (b = (c += 2)))`},
+		{s: `a = b++ + ++c`, expr: `(a = ((b++) + (++c)))`},
+		{s: `x-- - --y`, expr: `((x--) - (--y))`},
+		{s: `f(a+1, g())*2`, expr: `(f((a + 1), g()) * 2)`},
+		{s: `a | b ^ c & d`, expr: `(a | (b ^ (c & d)))`},
+		{s: `a & b == c`, expr: `(a & (b == c))`},
+		{s: `1 << n + 1 < m >> 2`, expr: `((1 << (n + 1)) < (m >> 2))`},
+		{s: `x >> 4 & 15`, expr: `((x >> 4) & 15)`},
+		{s: `~a & ~~b`, expr: `((~a) & (~(~b)))`},
+		{s: `flags |= 1 << bit`, expr: `(flags |= (1 << bit))`},
+		{s: `x >>= y <<= 2`, expr: `(x >>= (y <<= 2))`},
+		{s: `a || b && c || d`, expr: `((a || (b && c)) || d)`},
+		{s: `a & 1 != 0 && !b`, expr: `((a & (1 != 0)) && (!b))`},
+		{s: `!a == b | c`, expr: `(((!a) == b) | c)`},
+		{s: `a ? b : c ? d : e`, expr: `(a ? b : (c ? d : e))`},
+		{s: `a || b ? x = 1 : y`, expr: `((a || b) ? (x = 1) : y)`},
+		{s: `x = a ? b ? 1 : 2 : 3`, expr: `(x = (a ? (b ? 1 : 2) : 3))`},
+		// Errors
+		{s: `1 = 2`, err: `found "=", lvalue required as left operand of assignment (pos=&{1 1 2})`},
+		{s: `a + b -= 2`, err: `found "-=", lvalue required as left operand of assignment (pos=&{1 1 6})`},
+		{s: `++5`, err: `found "++", lvalue required as operand (pos=&{1 1 0})`},
+		{s: `a ? b ;`, err: `found ";", expected : (pos=&{1 1 6})`},
+		{s: `a ? b : c = 2`, err: `found "=", lvalue required as left operand of assignment (pos=&{1 1 10})`},
+		{s: `(a+1`, err: `found "", expected ) (pos=&{1 1 3})`},
+	}
+
+	for i, tt := range tests {
+		expr, err := NewParser(strings.NewReader(tt.s)).parseExpr()
+		if tt.err != errstring(err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if err == nil && tt.expr != exprString(expr) {
+			t.Errorf("%d. %q: expression mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.expr, exprString(expr))
+		}
+	}
+}
+
+// exprString returns the expression with parenthesis around each operation.
+func exprString(expr *Expression) string {
+	operators := map[ExprCode]string{EXPR_CODE_ADD: "+", EXPR_CODE_SUB: "-", EXPR_CODE_MUL: "*", EXPR_CODE_DIV: "/",
+		EXPR_CODE_MOD: "%", EXPR_CODE_LT: "<", EXPR_CODE_LTE: "<=", EXPR_CODE_GT: ">", EXPR_CODE_GTE: ">=",
+		EXPR_CODE_EQU: "==", EXPR_CODE_BIT_AND: "&", EXPR_CODE_BIT_OR: "|", EXPR_CODE_BIT_XOR: "^", EXPR_CODE_SHL: "<<",
+		EXPR_CODE_SHR: ">>", EXPR_CODE_NEQ: "!=", EXPR_CODE_AND: "&&", EXPR_CODE_OR: "||"}
+	switch expr.code {
+	case EXPR_CODE_INT:
+		return fmt.Sprint(expr.valeurInt)
+	case EXPR_CODE_STR:
+		return strconv.Quote(expr.valeurString)
+	case EXPR_CODE_TRUE:
+		return "true"
+	case EXPR_CODE_FALSE:
+		return "false"
+	case EXPR_CODE_VAR:
+		return expr.variable
+	case EXPR_CODE_CALL:
+		var param []string
+		for i := range expr.parameter {
+			param = append(param, exprString(&expr.parameter[i]))
+		}
+		return expr.functionName + "(" + strings.Join(param, ", ") + ")"
+	case EXPR_CODE_ASSIGN:
+		return "(" + expr.variable + " = " + exprString(expr.right) + ")"
+	case EXPR_CODE_COMPOUND_ASSIGN:
+		return "(" + expr.variable + " " + operators[expr.operator] + "= " + exprString(expr.right) + ")"
+	case EXPR_CODE_BIT_NOT:
+		return "(~" + exprString(expr.right) + ")"
+	case EXPR_CODE_NOT:
+		return "(!" + exprString(expr.right) + ")"
+	case EXPR_CODE_CONDITIONAL:
+		return "(" + exprString(expr.condition) + " ? " + exprString(expr.left) + " : " + exprString(expr.right) + ")"
+	case EXPR_CODE_PRE_INC:
+		return "(++" + expr.variable + ")"
+	case EXPR_CODE_PRE_DEC:
+		return "(--" + expr.variable + ")"
+	case EXPR_CODE_POST_INC:
+		return "(" + expr.variable + "++)"
+	case EXPR_CODE_POST_DEC:
+		return "(" + expr.variable + "--)"
+	}
+	return "(" + exprString(expr.left) + " " + operators[expr.code] + " " + exprString(expr.right) + ")"
+}
+
 // errstring returns the string representation of an error.
 func errstring(err error) string {
 	if err != nil {
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The prompts of the REPL: the first line of an input, and the next lines while its curly brackets are not
+// balanced.
+const (
+	REPL_PROMPT          = "> "
+	REPL_PROMPT_CONTINUE = "... "
+)
+
+// REPL_FUNCTION is the name of the function in which the checker checks the statements of the REPL. It is not an
+// identifier of the language, so it cannot be called.
+const REPL_FUNCTION = "<repl>"
+
+// replHelp describes the commands of the REPL.
+const replHelp = `Enter a declaration, a statement ending with ; or an expression to print its value.
+Commands:
+  :type expr   print the type of the expression without evaluating it
+  :vars        list the variables with their type and their value
+  :load file   add the declarations of the file, without executing main
+  :reset       forget the variables, the functions and the enumerations
+  :history     list the previous inputs, !n evaluates the input n again
+The lines are read as typed, without editing nor recall of the previous ones with the arrows: run the REPL in
+rlwrap for them.
+  :help        print this help
+  :quit        leave the REPL
+`
+
+// Repl evaluates the inputs of an interactive session. The variables, the functions and the enumerations
+// declared by an input are kept for the next ones: the declarations are added to a program, checked with it, and
+// the statements are executed by an Interpreter whose global variables are the variables of the session.
+type Repl struct {
+	program     *Program
+	interpreter *Interpreter
+	options     Options
+	out         io.Writer
+	history     []string
+}
+
+// NewRepl returns a new session writing the results of the inputs, and the output of the program, to out. The
+// limits are checked for each input.
+func NewRepl(out io.Writer, limits Limits) *Repl {
+	r := &Repl{options: Options{Limits: limits, Stdout: out}, out: out}
+	r.reset()
+	return r
+}
+
+// reset starts an empty session.
+func (r *Repl) reset() {
+	r.program = &Program{}
+	r.interpreter = NewInterpreterWithOptions(r.program, r.options)
+	r.interpreter.reset(context.Background())
+}
+
+// Run reads the inputs from in, line by line, and evaluates them until :quit or the end of in. An input continues
+// on the next lines while its curly brackets are not balanced. The errors of the inputs are written to out, only
+// the errors reading in are returned.
+func (r *Repl) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	var input strings.Builder
+	for {
+		if input.Len() == 0 {
+			fmt.Fprint(r.out, REPL_PROMPT)
+		} else {
+			fmt.Fprint(r.out, REPL_PROMPT_CONTINUE)
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			return scanner.Err()
+		}
+		input.WriteString(scanner.Text())
+		input.WriteString("\n")
+		text := strings.TrimSpace(input.String())
+		if text == "" {
+			input.Reset()
+			continue
+		} else if !strings.HasPrefix(text, ":") && !replComplete(text) {
+			continue
+		}
+		input.Reset()
+		if text == ":quit" || text == ":q" {
+			return nil
+		}
+		if err := r.Eval(text); err != nil {
+			// the positions in the input are not useful, nor the prefixes of the errors of the interpreter
+			message, _ := errorMessage(err)
+			for strings.HasPrefix(message, "error: ") {
+				message = strings.TrimPrefix(message, "error: ")
+			}
+			fmt.Fprintf(r.out, "error : %s\n", message)
+		}
+	}
+}
+
+// replComplete reports whether the curly brackets and the parenthesis of the input are balanced, outside of the
+// strings and the comments.
+func replComplete(text string) bool {
+	brackets, parenthesis := 0, 0
+	scanner := NewScanner(strings.NewReader(text))
+	for {
+		res, err := scanner.Scan()
+		if err != nil {
+			// a comment is not terminated
+			return false
+		}
+		switch res.tok {
+		case EOF:
+			return brackets <= 0 && parenthesis <= 0
+		case OPEN_CURLY_BRACKET:
+			brackets++
+		case CLOSE_CURLY_BRACKET:
+			brackets--
+		case OPEN_PARENTHESIS:
+			parenthesis++
+		case CLOSE_PARENTHESIS:
+			parenthesis--
+		}
+	}
+}
+
+// Eval evaluates an input: a command, the declarations of enumerations, functions or variables, statements, or an
+// expression, without a final semicolon, whose value is printed with its type.
+func (r *Repl) Eval(input string) error {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "!") {
+		n, err := strconv.Atoi(input[1:])
+		if err != nil || n < 1 || n > len(r.history) {
+			return fmt.Errorf("no input %s in the history", input[1:])
+		}
+		input = r.history[n-1]
+		fmt.Fprintln(r.out, input)
+	}
+	r.history = append(r.history, input)
+	r.interpreter.steps = 0
+	r.interpreter.stdout.Reset()
+
+	if strings.HasPrefix(input, ":") {
+		command, arg := input, ""
+		if i := strings.IndexAny(input, " \t"); i > 0 {
+			command, arg = input[:i], strings.TrimSpace(input[i:])
+		}
+		return r.command(command, arg)
+	}
+
+	first, err := NewScanner(strings.NewReader(input)).Scan()
+	if err != nil {
+		return err
+	}
+	switch first.tok {
+	case CONST, INT, STRING, BOOLEAN, VOID, ENUM:
+		program, err := NewParser(strings.NewReader(input + replSemicolon(input))).Parse2()
+		if err != nil && strings.HasSuffix(input, "}") {
+			// the declaration of an enumeration ends with };, unlike a function
+			if enum, errEnum := NewParser(strings.NewReader(input + ";")).Parse2(); errEnum == nil {
+				program, err = enum, nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return r.declare(program)
+	}
+
+	var exprErr error
+	if replSemicolon(input) != "" {
+		var expr *Expression
+		if expr, exprErr = parseExpressionSource(input); exprErr == nil && !r.voidCall(expr) {
+			return r.evaluate(expr)
+		}
+	}
+	instructions, err := replParse(input + replSemicolon(input))
+	if err != nil {
+		// the error of the expression is more precise if the input is not a statement
+		if exprErr != nil {
+			return exprErr
+		}
+		return err
+	}
+	return r.execute(instructions)
+}
+
+// evaluate checks the expression and prints its value with its type.
+func (r *Repl) evaluate(expr *Expression) error {
+	c, err := r.check()
+	if err != nil {
+		return err
+	}
+	typeExpr, err := c.checkExpression(expr)
+	if err != nil {
+		return err
+	}
+	val, err := r.interpreter.getIntValue(expr, r.interpreter.globals)
+	r.created()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, formatValeur(val, typeExpr))
+	return nil
+}
+
+// voidCall reports whether the expression is a call of a function returning no value, which is executed as a
+// statement.
+func (r *Repl) voidCall(expr *Expression) bool {
+	if expr.code != EXPR_CODE_CALL {
+		return false
+	} else if function, ok := r.interpreter.functions[expr.functionName]; ok {
+		return function.ReturnType.code == TYPE_VOID
+	}
+	return builtinFunctions[expr.functionName]
+}
+
+// replSemicolon returns the semicolon missing at the end of the input, "" if it ends a statement or a block.
+func replSemicolon(input string) string {
+	if strings.HasSuffix(input, ";") || strings.HasSuffix(input, "}") {
+		return ""
+	}
+	return ";"
+}
+
+// replParse parses the statements of the input.
+func replParse(input string) ([]Instruction, error) {
+	program, err := NewParser(strings.NewReader("void f() {\n" + input + "\n}")).Parse2()
+	if err != nil {
+		return nil, err
+	}
+	return program.Functions[0].Instruction, nil
+}
+
+// check checks the program of the session and returns the checker, ready to check the statements of an input as
+// the statements of a function whose variables are the global variables.
+func (r *Repl) check() (*checker, error) {
+	c := newChecker()
+	if err := c.checkProgram(r.program); err != nil {
+		return nil, err
+	}
+	c.function = &Function{Name: REPL_FUNCTION, ReturnType: Type{code: TYPE_VOID}}
+	c.locals = c.globals
+	return c, nil
+}
+
+// declare checks the declarations with the program of the session and adds them to it. The global variables
+// are initialized in their order, until an initialization fails.
+func (r *Repl) declare(declarations *Program) error {
+	program := &Program{Enums: append(append([]Enum(nil), r.program.Enums...), declarations.Enums...),
+		Globals:   append(append([]Instruction(nil), r.program.Globals...), declarations.Globals...),
+		Functions: append(append([]Function(nil), r.program.Functions...), declarations.Functions...)}
+	if err := newChecker().checkProgram(program); err != nil {
+		return err
+	}
+
+	program.Globals = program.Globals[:len(r.program.Globals)]
+	r.program = program
+	interpreter := r.interpreter
+	interpreter.program = program
+	for i := range program.Functions {
+		interpreter.functions[program.Functions[i].Name] = &program.Functions[i]
+	}
+	for _, enum := range declarations.Enums {
+		for _, value := range enum.Values {
+			interpreter.constants[value.Name] = Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: value.Value}
+		}
+	}
+	for i := range declarations.Globals {
+		instr := &declarations.Globals[i]
+		if err := interpreter.step(instr.position); err != nil {
+			return &RuntimeError{position: instr.position, err: err}
+		}
+		val, err := interpreter.declareVariable(instr, interpreter.globals)
+		if err != nil {
+			return &RuntimeError{position: instr.position, err: err}
+		}
+		fmt.Fprintf(r.out, "%s = %s\n", instr.Variable, formatValeur(val, instr.VariableType))
+		program.Globals = append(program.Globals, *instr)
+	}
+	return nil
+}
+
+// execute checks the statements and executes them with the variables of the session. The value of the variable
+// assigned by a statement of the input is printed with its type, as the value of an expression, instead of the
+// trace of the assignment.
+func (r *Repl) execute(instructions []Instruction) error {
+	c, err := r.check()
+	if err != nil {
+		return err
+	}
+	for i := range instructions {
+		if err := c.checkInstruction(&instructions[i]); err != nil {
+			return err
+		}
+	}
+	defer r.created()
+	interpreter := r.interpreter
+	for i := range instructions {
+		instr := &instructions[i]
+		name := instr.Variable
+		if instr.Code == INSTRUCTION_EXPRESSION {
+			name = assignedVariable(instr.Valeur)
+		}
+		if (instr.Code != INSTRUCTION_AFFECTATION && instr.Code != INSTRUCTION_EXPRESSION) || name == "" {
+			if flow, _, err := interpreter.execute(instructions[i:i+1], interpreter.globals); err != nil {
+				return err
+			} else if flow != FLOW_NEXT {
+				return nil
+			}
+			continue
+		}
+		if err := interpreter.step(instr.position); err != nil {
+			return err
+		}
+		val, err := interpreter.getIntValue(instr.Valeur, interpreter.globals)
+		if err != nil {
+			return err
+		}
+		if instr.Code == INSTRUCTION_AFFECTATION {
+			err = interpreter.setVariable(name, val, interpreter.globals, instr.position)
+		} else {
+			val, err = interpreter.getVariable(name, interpreter.globals)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(r.out, "%s = %s\n", name, formatValeur(val, c.lookup(name).typeVar))
+	}
+	return nil
+}
+
+// created declares in the program of the session the variables created by the assignments of an input, with the
+// type of their value.
+func (r *Repl) created() {
+	declared := make(map[string]bool)
+	for _, instr := range r.program.Globals {
+		declared[instr.Variable] = true
+	}
+	var names []string
+	for name := range r.interpreter.globals {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		val := r.interpreter.globals[name]
+		r.program.Globals = append(r.program.Globals, Instruction{Code: INSTRUCTION_DECLARATION, Variable: name,
+			VariableType: &Type{code: val.valeurtype.code}, position: &Position{}})
+	}
+}
+
+// command executes a command of the REPL.
+func (r *Repl) command(command, arg string) error {
+	switch command {
+	case ":help":
+		fmt.Fprint(r.out, replHelp)
+	case ":type":
+		expr, err := parseExpressionSource(arg)
+		if err != nil {
+			return err
+		}
+		c, err := r.check()
+		if err != nil {
+			return err
+		}
+		typeExpr, err := c.checkExpression(expr)
+		if err != nil {
+			return err
+		} else if typeExpr == nil {
+			fmt.Fprintln(r.out, "unknown")
+		} else {
+			fmt.Fprintln(r.out, typeName(typeExpr))
+		}
+	case ":vars":
+		globals := append([]Instruction(nil), r.program.Globals...)
+		sort.Slice(globals, func(i, j int) bool { return globals[i].Variable < globals[j].Variable })
+		for _, instr := range globals {
+			declaration := typeName(instr.VariableType) + " " + instr.Variable
+			if instr.Constant {
+				declaration = "const " + declaration
+			}
+			val := r.interpreter.globals[instr.Variable]
+			fmt.Fprintf(r.out, "%s = %s\n", declaration, formatValue(&val))
+		}
+	case ":reset":
+		r.reset()
+	case ":load":
+		if arg == "" {
+			return fmt.Errorf("usage: :load file.he")
+		}
+		source, err := os.ReadFile(arg)
+		if err != nil {
+			return err
+		}
+		program, err := NewParser(bytes.NewReader(source)).Parse2()
+		if err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		} else if err := r.declare(program); err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+		fmt.Fprintf(r.out, "loaded %s: %d functions, %d variables, %d enumerations\n", arg,
+			len(program.Functions), len(program.Globals), len(program.Enums))
+	case ":history":
+		// the command itself is the last input
+		for i, input := range r.history[:len(r.history)-1] {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, strings.ReplaceAll(input, "\n", "\n      "))
+		}
+	default:
+		return fmt.Errorf("unknown command %s, :help lists the commands", command)
+	}
+	return nil
+}
+
+// formatValeur returns the value with its type: the type of the expression, if it is known, or of the value.
+func formatValeur(val *Valeur, typeVar *Type) string {
+	if typeVar == nil {
+		typeVar = &val.valeurtype
+	}
+	return "(" + typeName(typeVar) + ") " + formatValue(val)
+}
+
+// formatValue returns the value as a literal of the language.
+func formatValue(val *Valeur) string {
+	switch val.valeurtype.code {
+	case TYPE_STRING:
+		return strconv.Quote(val.valeurString)
+	case TYPE_BOOLEAN:
+		return strconv.FormatBool(val.valeurBoolean)
+	}
+	return strconv.Itoa(val.valeurInt)
+}
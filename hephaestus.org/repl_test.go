@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Ensure the REPL evaluates the inputs of a session with the declarations of the previous ones.
+func TestRepl_Run(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "lib.he")
+	if err := os.WriteFile(filename, []byte("int twice(int n) { return 2 * n; }\nint base = 10;\n"),
+		0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []struct {
+		in  string
+		out string
+	}{
+		{in: "x = 5;\nx + 3\n\"a\" == \"b\"\n", out: "x = (int) 5\n(int) 8\nerror : invalid operand, expected int\n\n"},
+		{in: "enum Color { RED, GREEN };\nenum Color c = GREEN;\nc\nRED\n:type c == RED\n:type c = 2\n",
+			out: "c = (enum Color) 1\n(enum Color) 1\n(enum Color) 0\nboolean\nenum Color\n\n"},
+		{in: "enum Color { RED, GREEN };\nenum Color c = GREEN;\nc = RED; n = 1;\nn += 2;\nn++;\n" +
+			"switch (n) { case 4: c = GREEN; }\n",
+			out: "c = (enum Color) 1\nc = (enum Color) 0\nn = (int) 1\nn = (int) 3\nn = (int) 4\nswitch 4\nc=1\n\n"},
+		{in: "enum F { C }\nC\nenum F g() { return C; }\ng()\nenum G { D } x\n",
+			out: "(enum F) 0\nfunction g\nreturn 0\n(enum F) 0\nerror : found \"x\", expected ';'\n\n"},
+		{in: "int add(int a,\n  int b) {\n  return a + b;\n}\nadd(1, 2)\n/* comment\n */ true\n",
+			out: "function add\nreturn 3\n(int) 3\n(boolean) true\n\n"},
+		{in: "void hello(string who) { print(who); }\nhello(\"you\")\nhello(\"me\") + 1\n",
+			out: "hello(you)\nfunction hello\nprint(you)\nerror : function hello returns no value\n\n"},
+		{in: "s = \"abc\";\nconst int N = 3;\nb = N > 2 && s == s;\n:vars\n",
+			out: "s = (string) \"abc\"\nN = (int) 3\nerror : invalid operand, expected int\n" +
+				"const int N = 3\nstring s = \"abc\"\n\n"},
+		{in: "N = 1;\nint N = 2;\nint N = 1;\nN = \"a\";\nN\n",
+			out: "N = (int) 1\nerror : variable N already declared\nerror : variable N already declared\n" +
+				"error : cannot assign string to variable N of type int\n(int) 1\n\n"},
+		{in: "x = 1 / 0;\nx\nint f() { return f(); }\nf()\n",
+			out: "error : division by zero\nerror : variable x not declared\n" +
+				"function f\nfunction f\nfunction f\nerror : call depth limit exceeded calling f (limit=3)\n\n"},
+		{in: "x = 1;\n:reset\nx\n:type y\n:type int\n",
+			out: "x = (int) 1\nerror : variable x not declared\nerror : variable y not declared\n" +
+				"error : expected instruction: invalid expression: found \"int\", expected number or ident or string\n\n"},
+		{in: ":load " + filename + "\ntwice(base)\n", out: "base = (int) 10\nloaded " + filename +
+			": 1 functions, 1 variables, 0 enumerations\nfunction twice\nreturn 20\n(int) 20\n\n"},
+		{in: "x = 2;\n:history\n!1\n!9\n",
+			out: "x = (int) 2\n   1  x = 2;\nx = 2;\nx = (int) 2\nerror : no input 9 in the history\n\n"},
+		{in: ":load\n:unknown\n:quit\nx = 2;\n",
+			out: "error : usage: :load file.he\nerror : unknown command :unknown, :help lists the commands\n"},
+	} {
+		var out bytes.Buffer
+		r := NewRepl(&out, Limits{MaxCallDepth: 3})
+		if err := r.Run(strings.NewReader(tt.in)); err != nil {
+			t.Fatal(err)
+		}
+		// the prompts are not compared
+		got := strings.ReplaceAll(strings.ReplaceAll(out.String(), REPL_PROMPT_CONTINUE, ""), REPL_PROMPT, "")
+		if got != tt.out {
+			t.Errorf("%d. %q: output mismatch:\n  exp=%q\n  got=%q", i, tt.in, tt.out, got)
+		}
+	}
+}
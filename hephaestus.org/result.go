@@ -0,0 +1,32 @@
+package main
+
+// Result is the outcome of the execution of a program.
+type Result struct {
+	Value     *Valeur           // value returned by main, nil if main returns nothing
+	ExitCode  int               // value returned by main if it is an int, 0 otherwise
+	Stdout    string            // output written by the program
+	Globals   map[string]Valeur // top-level variables at the end of the execution
+	Variables map[string]Valeur // variables of main when it returned
+	Stats     Stats
+	Err       error // *RuntimeError if the execution failed
+}
+
+// Stats holds the statistics of an execution.
+type Stats struct {
+	Steps         int64 // instructions and expressions evaluated
+	MaxStackDepth int   // maximum number of function frames active at the same time
+	Allocations   int64 // values stored in variables
+	PeakMemory    int64 // maximum bytes held by variables at the same time
+}
+
+// RuntimeError is an error raised during the execution of a program.
+// The limit errors (StepLimitError, CanceledError...) can be retrieved with errors.As.
+type RuntimeError struct {
+	Function string
+	position *Position
+	err      error
+}
+
+func (e *RuntimeError) Error() string { return e.err.Error() }
+
+func (e *RuntimeError) Unwrap() error { return e.err }
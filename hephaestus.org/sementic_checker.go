@@ -1,13 +1,687 @@
 package main
 
-func (p *Parser) Checker(functionList []Function) error {
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+)
 
-	for _, function := range functionList {
-		for _, instr := range function.Instruction {
-			if instr.Valeur != nil {
+// Warning is a problem found by the checker that doesn't prevent the execution.
+type Warning struct {
+	Message  string
+	position *Position
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s (pos=%v)", w.Message, w.position)
+}
+
+// symbol is a variable known by the checker.
+type symbol struct {
+	name      string
+	typeVar   *Type // nil if the variable is not declared with a type
+	constant  bool
+	enumValue *EnumValue // value of the enumeration if the symbol is an enumeration constant
+	param     bool
+	assigned  bool      // a value is assigned to the variable, by its declaration or an assignment
+	read      bool      // the value of the variable is read
+	inferred  *Position // assignment giving its type to a variable created by an assignment
+	creation  *Instruction
+	position  *Position
+}
+
+// checker holds the symbols visible while checking a program.
+type checker struct {
+	functions map[string]*Function
+	enums     map[string]*Enum
+	globals   map[string]*symbol
+	locals    map[string]*symbol
+	scopes    map[string]map[string]*symbol // local variables of each function, by name of the function
+	switches  int                           // number of switches around the instruction checked
+	function  *Function                     // function checked, nil for the global variables
+	calls     map[string]int
+	breaks    bool      // a break of the switch analyzed by checkFlow is reached
+	constant  int       // number of constant conditions around the expression checked
+	created   []*symbol // variables created by an assignment, in the order of the source
+	warnings  []Warning
+}
+
+// builtinFunctions are the functions called without being declared.
+var builtinFunctions = map[string]bool{"print": true}
+
+// Warnings returns the warnings found by the last call to Checker.
+func (p *Parser) Warnings() []Warning {
+	return p.warnings
+}
+
+func (p *Parser) Checker(program *Program) error {
 
+	c := newChecker()
+	p.warnings = nil
+	if err := c.checkProgram(program); err != nil {
+		return err
+	}
+	p.warnings = c.warnings
+	return nil
+}
+
+func newChecker() *checker {
+	return &checker{functions: make(map[string]*Function), enums: make(map[string]*Enum),
+		globals: make(map[string]*symbol), scopes: make(map[string]map[string]*symbol),
+		calls: make(map[string]int)}
+}
+
+func (c *checker) warn(position *Position, format string, a ...interface{}) {
+	c.warnings = append(c.warnings, Warning{Message: fmt.Sprintf(format, a...), position: position})
+}
+
+func (c *checker) checkProgram(program *Program) error {
+
+	for i := range program.Enums {
+		enum := &program.Enums[i]
+		if _, ok := c.enums[enum.Name]; ok {
+			return errorAt(enum.position, "enum %s already declared", enum.Name)
+		}
+		c.enums[enum.Name] = enum
+		for j := range enum.Values {
+			value := &enum.Values[j]
+			if _, ok := c.globals[value.Name]; ok {
+				return errorAt(value.position, "variable %s already declared", value.Name)
 			}
+			c.globals[value.Name] = &symbol{name: value.Name, typeVar: &Type{code: TYPE_ENUM, name: enum.Name},
+				constant: true, enumValue: value, position: value.position}
+		}
+	}
+
+	for i := range program.Functions {
+		function := &program.Functions[i]
+		if _, ok := c.functions[function.Name]; ok || builtinFunctions[function.Name] {
+			return errorAt(function.position, "function %s already declared", function.Name)
+		}
+		c.functions[function.Name] = function
+	}
+
+	for i := range program.Globals {
+		if err := c.checkDeclaration(&program.Globals[i], c.globals); err != nil {
+			return err
+		}
+	}
+	c.checkAssigned(program.Globals, nil)
+
+	for i := range program.Functions {
+		function := &program.Functions[i]
+		c.function = function
+		c.locals = make(map[string]*symbol)
+		c.scopes[function.Name] = c.locals
+		if err := c.checkType(&function.ReturnType); err != nil {
+			return err
+		} else if function.Name == "main" && (len(function.Parameter) > 0 ||
+			function.ReturnType.code != TYPE_VOID && function.ReturnType.code != TYPE_INT) {
+			return errorAt(function.position, "function main must be declared as void main() or int main()")
+		}
+		for i := range function.Parameter {
+			param := &function.Parameter[i]
+			if err := c.checkType(&param.Type); err != nil {
+				return err
+			}
+			if _, ok := c.locals[param.Name]; ok {
+				return errorAt(param.position, "parameter %s already declared", param.Name)
+			}
+			c.locals[param.Name] = &symbol{name: param.Name, typeVar: &param.Type, param: true, assigned: true,
+				position: param.position}
+		}
+		for i := range function.Instruction {
+			if err := c.checkInstruction(&function.Instruction[i]); err != nil {
+				return err
+			}
+		}
+		c.checkAssigned(function.Instruction, function.Parameter)
+		if c.checkFlow(function.Instruction) && function.ReturnType.code != TYPE_VOID {
+			return errorAt(function.position, "missing return at end of function %s", function.Name)
+		}
+		c.warnUnused(c.locals)
+	}
+	c.function, c.locals = nil, nil
+	c.warnUnused(c.globals)
+	for _, function := range program.Functions {
+		if function.Name != "main" && c.calls[function.Name] == 0 {
+			c.warn(function.position, "function %s is never called", function.Name)
 		}
 	}
 	return nil
 }
+
+// warnUnused warns about the variables of the scope whose value is never read, in the order of the source.
+func (c *checker) warnUnused(scope map[string]*symbol) {
+	var unused []*symbol
+	for _, sym := range scope {
+		if !sym.read && sym.enumValue == nil {
+			unused = append(unused, sym)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i].position.pos < unused[j].position.pos })
+	for _, sym := range unused {
+		if sym.param {
+			c.warn(sym.position, "parameter %s is never used", sym.name)
+		} else if sym.assigned {
+			c.warn(sym.position, "variable %s is assigned but never read", sym.name)
+		} else {
+			c.warn(sym.position, "variable %s is declared but never used", sym.name)
+		}
+	}
+}
+
+// checkType checks the enumeration of the type is declared.
+func (c *checker) checkType(typeVar *Type) error {
+	if _, ok := c.enums[typeVar.name]; typeVar.code == TYPE_ENUM && !ok {
+		return errorAt(typeVar.position, "enum %s not declared", typeVar.name)
+	}
+	return nil
+}
+
+// assignable returns true if a value of type from can be stored in a variable of type to.
+// As in C, the enumerations and the int are converted implicitly.
+func assignable(to *Type, from *Type) bool {
+	if isInteger(to) {
+		return isInteger(from)
+	}
+	return to.code == from.code
+}
+
+// isInteger returns true for the int and the enumerations.
+func isInteger(typeVar *Type) bool {
+	return typeVar.code == TYPE_INT || typeVar.code == TYPE_ENUM
+}
+
+// lookup returns the variable visible with this name, or nil.
+func (c *checker) lookup(name string) *symbol {
+	if sym, ok := c.locals[name]; ok {
+		return sym
+	}
+	return c.globals[name]
+}
+
+func (c *checker) checkDeclaration(instr *Instruction, scope map[string]*symbol) error {
+	if _, ok := scope[instr.Variable]; ok {
+		return errorAt(instr.position, "variable %s already declared", instr.Variable)
+	}
+	if err := c.checkType(instr.VariableType); err != nil {
+		return err
+	}
+	if instr.Constant && instr.Valeur == nil {
+		return errorAt(instr.position, "constant %s must be initialized", instr.Variable)
+	}
+	if instr.Valeur != nil {
+		if _, err := c.checkAssignable(instr.Variable, instr.VariableType, instr.Valeur); err != nil {
+			return err
+		}
+	}
+	scope[instr.Variable] = &symbol{name: instr.Variable, typeVar: instr.VariableType, constant: instr.Constant,
+		assigned: instr.Valeur != nil, position: instr.position}
+	return nil
+}
+
+// checkAssignable checks the expression and that its type is the type of the variable, if both are known.
+// It returns the type of the expression.
+func (c *checker) checkAssignable(name string, typeVar *Type, expr *Expression) (*Type, error) {
+	typeExpr, err := c.checkExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	if typeVar != nil && typeExpr != nil && !assignable(typeVar, typeExpr) {
+		return nil, errorAt(expr.position, "cannot assign %s to variable %s of type %s", typeName(typeExpr), name,
+			typeName(typeVar))
+	}
+	return typeExpr, nil
+}
+
+func (c *checker) checkInstruction(instr *Instruction) error {
+	if instr.Code == INSTRUCTION_DECLARATION {
+		return c.checkDeclaration(instr, c.locals)
+	} else if instr.Code == INSTRUCTION_AFFECTATION {
+		created := c.lookup(instr.Variable) == nil
+		if _, err := c.checkAssignment(instr.Variable, instr.Valeur, instr.position); err != nil {
+			return err
+		} else if sym := c.lookup(instr.Variable); created && sym.typeVar != nil {
+			sym.creation = instr
+		}
+	} else if instr.Code == INSTRUCTION_EXPRESSION {
+		if _, err := c.checkExpression(instr.Valeur); err != nil {
+			return err
+		}
+	} else if instr.Code == INSTRUCTION_CALL {
+		if _, err := c.checkCall(instr.FunctionName, instr.Parameter, instr.position); err != nil {
+			return err
+		}
+	} else if instr.Code == INSTRUCTION_SWITCH {
+		return c.checkSwitch(instr)
+	} else if instr.Code == INSTRUCTION_BREAK {
+		if c.switches == 0 {
+			return errorAt(instr.position, "break statement not within switch")
+		}
+	} else if instr.Code == INSTRUCTION_RETURN {
+		return c.checkReturn(instr)
+	}
+	return nil
+}
+
+// checkReturn checks the value returned is of the type of the function, and that only the void functions return
+// no value.
+func (c *checker) checkReturn(instr *Instruction) error {
+	returnType := &c.function.ReturnType
+	if instr.Valeur == nil {
+		if returnType.code != TYPE_VOID {
+			return errorAt(instr.position, "function %s must return a value of type %s", c.function.Name, typeName(returnType))
+		}
+		return nil
+	}
+	typeExpr, err := c.checkExpression(instr.Valeur)
+	if err != nil {
+		return err
+	} else if returnType.code == TYPE_VOID {
+		return errorAt(instr.Valeur.position, "function %s returns no value, cannot return a value", c.function.Name)
+	} else if typeExpr != nil && !assignable(returnType, typeExpr) {
+		return errorAt(instr.Valeur.position, "cannot return %s from function %s of type %s", typeName(typeExpr),
+			c.function.Name, typeName(returnType))
+	}
+	return nil
+}
+
+// checkAssignment checks the assignment of the expression to the variable, and returns the type of the variable,
+// or of the expression if the variable is not declared with a type. An assignment to an unknown variable creates it.
+func (c *checker) checkAssignment(name string, expr *Expression, position *Position) (*Type, error) {
+	sym := c.lookup(name)
+	if sym != nil && sym.constant {
+		return nil, errorAt(position, "cannot assign to constant %s", name)
+	}
+	var typeVar *Type
+	if sym != nil {
+		typeVar = sym.typeVar
+	}
+	if sym != nil && sym.inferred != nil {
+		typeExpr, err := c.checkExpression(expr)
+		if err != nil {
+			return nil, err
+		} else if typeExpr != nil && !assignable(typeVar, typeExpr) {
+			return nil, errorAt(expr.position, "cannot assign %s to variable %s of type %s inferred at line %d",
+				typeName(typeExpr), name, typeName(typeVar), sym.inferred.line)
+		}
+		return typeVar, nil
+	}
+	typeExpr, err := c.checkAssignable(name, typeVar, expr)
+	if err != nil {
+		return nil, err
+	}
+	if sym == nil {
+		scope := c.locals
+		if scope == nil {
+			scope = c.globals
+		}
+		sym = &symbol{name: name, position: position}
+		scope[name] = sym
+		c.created = append(c.created, sym)
+	}
+	sym.assigned = true
+	if typeVar == nil && typeExpr != nil {
+		// the first value of a known type gives its type to the variable, the enumerations are int as in C
+		sym.typeVar, sym.inferred = &Type{code: typeExpr.code, name: typeExpr.name}, position
+		if typeExpr.code == TYPE_ENUM {
+			sym.typeVar = &Type{code: TYPE_INT}
+		}
+		return sym.typeVar, nil
+	} else if typeVar != nil {
+		return typeVar, nil
+	}
+	return typeExpr, nil
+}
+
+// checkUpdate checks the compound assignment or the increment of the variable, and returns its type.
+func (c *checker) checkUpdate(expr *Expression) (*Type, error) {
+	sym := c.lookup(expr.variable)
+	if sym == nil {
+		return nil, errorAt(expr.position, "variable %s not declared", expr.variable)
+	} else if sym.constant {
+		return nil, errorAt(expr.position, "cannot assign to constant %s", expr.variable)
+	}
+	typeVar := sym.typeVar
+	if typeVar != nil && !isInteger(typeVar) {
+		return nil, errorAt(expr.position, "invalid operand, expected int")
+	} else if typeVar == nil {
+		sym.typeVar, sym.inferred = &Type{code: TYPE_INT}, expr.position
+	}
+	if expr.right != nil {
+		right, err := c.checkExpression(expr.right)
+		if err != nil {
+			return nil, err
+		} else if right != nil && !isInteger(right) {
+			return nil, errorAt(expr.position, "invalid operand, expected int")
+		} else if isShift(expr.operator) && expr.right.code == EXPR_CODE_INT && expr.right.valeurInt >= bits.UintSize {
+			return nil, errorAt(expr.position, "shift count %d out of range", expr.right.valeurInt)
+		}
+	}
+	if typeVar == nil {
+		return &Type{code: TYPE_INT}, nil
+	}
+	return typeVar, nil
+}
+
+// checkCall checks the function is declared and the parameters, and returns the function (nil for a builtin).
+func (c *checker) checkCall(name string, parameter []Expression, position *Position) (*Function, error) {
+	function, ok := c.functions[name]
+	if !ok && !builtinFunctions[name] {
+		return nil, errorAt(position, "function %s not declared", name)
+	} else if c.function == nil || c.function.Name != name {
+		// the recursive calls don't make a function used
+		c.calls[name]++
+	}
+	if ok && len(parameter) != len(function.Parameter) {
+		return nil, errorAt(position, "function %s expects %d parameters, found %d", name, len(function.Parameter),
+			len(parameter))
+	}
+	for i := range parameter {
+		typeExpr, err := c.checkExpression(&parameter[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok && typeExpr != nil && !assignable(&function.Parameter[i].Type, typeExpr) {
+			return nil, errorAt(parameter[i].position, "cannot use %s as parameter %s of type %s", typeName(typeExpr),
+				function.Parameter[i].Name, typeName(&function.Parameter[i].Type))
+		}
+	}
+	return function, nil
+}
+
+// checkExpression checks the expression and returns its type, or nil if it is only known at runtime.
+func (c *checker) checkExpression(expr *Expression) (*Type, error) {
+	switch expr.code {
+	case EXPR_CODE_INT:
+		return &Type{code: TYPE_INT}, nil
+	case EXPR_CODE_STR:
+		return &Type{code: TYPE_STRING}, nil
+	case EXPR_CODE_TRUE, EXPR_CODE_FALSE:
+		return &Type{code: TYPE_BOOLEAN}, nil
+	case EXPR_CODE_VAR:
+		sym := c.lookup(expr.variable)
+		if sym == nil {
+			// no path of the execution declares the variable before it is read
+			return nil, errorAt(expr.position, "variable %s not declared", expr.variable)
+		}
+		sym.read = true
+		return sym.typeVar, nil
+	case EXPR_CODE_CALL:
+		function, err := c.checkCall(expr.functionName, expr.parameter, expr.position)
+		if err != nil {
+			return nil, err
+		} else if function == nil || function.ReturnType.code == TYPE_VOID {
+			return nil, errorAt(expr.position, "function %s returns no value", expr.functionName)
+		}
+		return &Type{code: function.ReturnType.code, name: function.ReturnType.name}, nil
+	case EXPR_CODE_ASSIGN:
+		return c.checkAssignment(expr.variable, expr.right, expr.position)
+	case EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC, EXPR_CODE_POST_DEC:
+		return c.checkUpdate(expr)
+	case EXPR_CODE_BIT_NOT:
+		right, err := c.checkExpression(expr.right)
+		if err != nil {
+			return nil, err
+		} else if right != nil && !isInteger(right) {
+			return nil, errorAt(expr.position, "invalid operand, expected int")
+		}
+		return &Type{code: TYPE_INT}, nil
+	case EXPR_CODE_NOT:
+		if err := c.checkCondition(expr.right); err != nil {
+			return nil, err
+		}
+		return &Type{code: TYPE_BOOLEAN}, nil
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		if err := c.checkCondition(expr.left); err != nil {
+			return nil, err
+		} else if err := c.checkCondition(expr.right); err != nil {
+			return nil, err
+		}
+		return &Type{code: TYPE_BOOLEAN}, nil
+	case EXPR_CODE_CONDITIONAL:
+		return c.checkConditional(expr)
+	}
+
+	left, err := c.checkExpression(expr.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.checkExpression(expr.right)
+	if err != nil {
+		return nil, err
+	}
+	if (expr.code == EXPR_CODE_EQU || expr.code == EXPR_CODE_NEQ) && (left == nil || left.code == TYPE_BOOLEAN) &&
+		(right == nil || right.code == TYPE_BOOLEAN) && (left != nil || right != nil) {
+		return &Type{code: TYPE_BOOLEAN}, nil
+	} else if (left != nil && !isInteger(left)) || (right != nil && !isInteger(right)) {
+		return nil, errorAt(expr.position, "invalid operand, expected int")
+	}
+	if isShift(expr.code) && expr.right.code == EXPR_CODE_INT && expr.right.valeurInt >= bits.UintSize {
+		return nil, errorAt(expr.position, "shift count %d out of range", expr.right.valeurInt)
+	} else if isArithmetic(expr.code) {
+		return &Type{code: TYPE_INT}, nil
+	}
+	return &Type{code: TYPE_BOOLEAN}, nil
+}
+
+// checkCondition checks the operand of a logical operation or a condition is a boolean, and warns if its value
+// is always the same. The conditions in a constant condition are not reported.
+func (c *checker) checkCondition(expr *Expression) error {
+	value, constant := c.constantValue(expr)
+	if constant {
+		c.constant++
+		defer func() { c.constant-- }()
+	}
+	typeExpr, err := c.checkExpression(expr)
+	if err != nil {
+		return err
+	} else if typeExpr != nil && typeExpr.code != TYPE_BOOLEAN {
+		return errorAt(expr.position, "invalid operand, expected boolean")
+	} else if constant && c.constant == 1 && value.valeurtype.code == TYPE_BOOLEAN {
+		c.warn(expr.position, "condition is always %t", value.valeurBoolean)
+	}
+	return nil
+}
+
+// constantValue returns the value of the expression if it doesn't depend on the execution: a literal, an
+// enumeration constant, or an operation on constants.
+func (c *checker) constantValue(expr *Expression) (*Valeur, bool) {
+	switch expr.code {
+	case EXPR_CODE_INT:
+		return &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: expr.valeurInt}, true
+	case EXPR_CODE_TRUE, EXPR_CODE_FALSE:
+		return &Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: expr.code == EXPR_CODE_TRUE}, true
+	case EXPR_CODE_VAR:
+		if sym := c.lookup(expr.variable); sym != nil && sym.enumValue != nil {
+			return &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: sym.enumValue.Value}, true
+		}
+	case EXPR_CODE_BIT_NOT:
+		if value, ok := c.constantValue(expr.right); ok && value.valeurtype.code == TYPE_INT {
+			return &Valeur{valeurtype: Type{code: TYPE_INT}, valeurInt: ^value.valeurInt}, true
+		}
+	case EXPR_CODE_NOT:
+		if value, ok := c.constantValue(expr.right); ok && value.valeurtype.code == TYPE_BOOLEAN {
+			return &Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: !value.valeurBoolean}, true
+		}
+	case EXPR_CODE_AND, EXPR_CODE_OR:
+		left, ok := c.constantValue(expr.left)
+		if !ok || left.valeurtype.code != TYPE_BOOLEAN {
+			return nil, false
+		} else if left.valeurBoolean == (expr.code == EXPR_CODE_OR) {
+			// the right operand is not evaluated
+			return left, true
+		}
+		if right, ok := c.constantValue(expr.right); ok && right.valeurtype.code == TYPE_BOOLEAN {
+			return right, true
+		}
+	case EXPR_CODE_CONDITIONAL:
+		if condition, ok := c.constantValue(expr.condition); ok && condition.valeurtype.code == TYPE_BOOLEAN {
+			if condition.valeurBoolean {
+				return c.constantValue(expr.left)
+			}
+			return c.constantValue(expr.right)
+		}
+	default:
+		if _, ok := binaryPrecedence[expr.code]; !ok {
+			return nil, false
+		}
+		left, ok := c.constantValue(expr.left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := c.constantValue(expr.right)
+		if !ok {
+			return nil, false
+		}
+		// the operations failing at runtime are not constants
+		if value, err := binaryValue(expr.code, left, right, expr.position); err == nil {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// checkConditional checks a conditional expression and returns the type unifying the types of both branches:
+// the common type if they are the same, int if they are both integers.
+func (c *checker) checkConditional(expr *Expression) (*Type, error) {
+	if err := c.checkCondition(expr.condition); err != nil {
+		return nil, err
+	}
+	left, err := c.checkExpression(expr.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.checkExpression(expr.right)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil {
+		return right, nil
+	} else if right == nil || (left.code == right.code && left.name == right.name) {
+		return left, nil
+	} else if isInteger(left) && isInteger(right) {
+		return &Type{code: TYPE_INT}, nil
+	}
+	return nil, errorAt(expr.position, "type mismatch in conditional expression: %s and %s", typeName(left),
+		typeName(right))
+}
+
+// isShift returns true if the binary operation is a shift, whose count must be lower than the size of an int.
+func isShift(code ExprCode) bool {
+	return code == EXPR_CODE_SHL || code == EXPR_CODE_SHR
+}
+
+// checkSwitch checks the cases of the switch are distinct constants, and warns if a switch over an enumeration
+// doesn't handle all its values.
+func (c *checker) checkSwitch(instr *Instruction) error {
+	typeExpr, err := c.checkExpression(instr.Valeur)
+	if err != nil {
+		return err
+	} else if typeExpr != nil && !isInteger(typeExpr) {
+		return errorAt(instr.Valeur.position, "switch quantity not an integer")
+	}
+
+	values := make(map[int]bool)
+	hasDefault := false
+	for i := range instr.Case {
+		caseSwitch := &instr.Case[i]
+		if caseSwitch.Valeur == nil {
+			if hasDefault {
+				return errorAt(caseSwitch.position, "multiple default labels in one switch")
+			}
+			hasDefault = true
+		} else {
+			value, err := c.caseValue(caseSwitch.Valeur)
+			if err != nil {
+				return err
+			} else if values[value] {
+				return errorAt(caseSwitch.position, "duplicate case value %d", value)
+			}
+			values[value] = true
+		}
+		c.switches++
+		for j := range caseSwitch.Instruction {
+			if err := c.checkInstruction(&caseSwitch.Instruction[j]); err != nil {
+				return err
+			}
+		}
+		c.switches--
+	}
+
+	if typeExpr != nil && typeExpr.code == TYPE_ENUM && !hasDefault {
+		enum := c.enums[typeExpr.name]
+		for _, value := range enum.Values {
+			if !values[value.Value] {
+				c.warn(instr.position, "enumeration value %s not handled in switch", value.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkFlow warns about the instructions following a return, a break or a switch which doesn't continue, and
+// returns true if the execution may continue after the instructions.
+func (c *checker) checkFlow(instructions []Instruction) bool {
+	for i := range instructions {
+		instr := &instructions[i]
+		next := true
+		if instr.Code == INSTRUCTION_RETURN {
+			next = false
+		} else if instr.Code == INSTRUCTION_BREAK {
+			c.breaks, next = true, false
+		} else if instr.Code == INSTRUCTION_SWITCH {
+			next = c.checkSwitchFlow(instr)
+		}
+		if !next {
+			if i+1 < len(instructions) {
+				c.warn(instructions[i+1].position, "unreachable code")
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// checkSwitchFlow returns true if the execution may continue after the switch: a case breaks, the last case
+// continues, or no case matches the value.
+func (c *checker) checkSwitchFlow(instr *Instruction) bool {
+	breaks := c.breaks
+	defer func() { c.breaks = breaks }()
+	c.breaks = false
+	next, hasDefault := true, false
+	for i := range instr.Case {
+		// each case continues with the next one, so only the last one can leave the switch
+		next = c.checkFlow(instr.Case[i].Instruction)
+		hasDefault = hasDefault || instr.Case[i].Valeur == nil
+	}
+	return next || c.breaks || !hasDefault
+}
+
+// caseValue returns the value of the label of a case: a number or a constant of an enumeration.
+func (c *checker) caseValue(expr *Expression) (int, error) {
+	if expr.code == EXPR_CODE_INT {
+		return expr.valeurInt, nil
+	} else if sym := c.lookup(expr.variable); expr.code == EXPR_CODE_VAR && sym != nil && sym.enumValue != nil {
+		return sym.enumValue.Value, nil
+	}
+	return 0, errorAt(expr.position, "case label does not reduce to an integer constant")
+}
+
+// typeName returns the name of the type in the source.
+func typeName(typeVar *Type) string {
+	switch typeVar.code {
+	case TYPE_INT:
+		return "int"
+	case TYPE_VOID:
+		return "void"
+	case TYPE_STRING:
+		return "string"
+	case TYPE_BOOLEAN:
+		return "boolean"
+	case TYPE_ENUM:
+		return "enum " + typeVar.name
+	}
+	return fmt.Sprintf("type(%d)", typeVar.code)
+}
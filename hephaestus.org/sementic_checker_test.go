@@ -0,0 +1,204 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Ensure the checker reports the semantic errors, the functions which may end without returning their value and
+// the values returned which don't match the type of the function.
+func TestParser_Checker(t *testing.T) {
+	var tests = []struct {
+		s   string
+		err string
+	}{
+		{s: `const int N=3; int total=N+2; void main () { x=N; total=x; }`},
+		{s: `int twice(int a) { return a+a; } void main () { x=twice(2); print(twice(x)); }`},
+		{s: `const string NAME="abc"; void main () { string NAME="def"; NAME="ghi"; }`},
+		// Errors
+		{s: `const int N=3; void main () { N=4; }`, err: `cannot assign to constant N (pos=&{1 1 30})`},
+		{s: `void main () { const boolean b=true; b=false; }`, err: `cannot assign to constant b (pos=&{1 1 37})`},
+		{s: `const int N; void main () { }`, err: `constant N must be initialized (pos=&{1 1 0})`},
+		{s: `int N=1; string N="a"; void main () { }`, err: `variable N already declared (pos=&{1 1 9})`},
+		{s: `int N="a"; void main () { }`, err: `cannot assign string to variable N of type int (pos=&{1 1 6})`},
+		{s: `int N=1; void main () { N=true; }`, err: `cannot assign boolean to variable N of type int (pos=&{1 1 26})`},
+		{s: `void main () { x=1+"a"; }`, err: `invalid operand, expected int (pos=&{1 1 18})`},
+		{s: `void main () { foo(1); }`, err: `function foo not declared (pos=&{1 1 15})`},
+		{s: `void f(int a) { } void main () { f(1, 2); }`, err: `function f expects 1 parameters, found 2 (pos=&{1 1 33})`},
+		{s: `void f(int a) { } void main () { f("a"); }`, err: `cannot use string as parameter a of type int (pos=&{1 1 35})`},
+		{s: `void f() { } void main () { x=f(); }`, err: `function f returns no value (pos=&{1 1 30})`},
+		{s: `void f() { } int f() { return 1; }`, err: `function f already declared (pos=&{1 1 17})`},
+		{s: `enum Color { RED, GREEN }; enum Color c = RED; void main () { c = 1; x = GREEN+1; }`},
+		{s: `enum Color { RED }; enum Color { BLUE }; void main () { }`, err: `enum Color already declared (pos=&{1 1 25})`},
+		{s: `enum Color { RED }; int RED; void main () { }`, err: `variable RED already declared (pos=&{1 1 20})`},
+		{s: `enum Color { RED }; void main () { RED = 1; }`, err: `cannot assign to constant RED (pos=&{1 1 35})`},
+		{s: `void main () { enum Color c; }`, err: `enum Color not declared (pos=&{1 1 15})`},
+		{s: `enum Color { RED }; void main () { enum Color c = "red"; }`, err: `cannot assign string to variable c of type enum Color (pos=&{1 1 50})`},
+		{s: `void main () { switch ("a") { } }`, err: `switch quantity not an integer (pos=&{1 1 23})`},
+		{s: `void main () { switch (1) { case 1: case 1: } }`, err: `duplicate case value 1 (pos=&{1 1 36})`},
+		{s: `enum Color { RED, GREEN = 0 }; void main () { switch (1) { case RED: case GREEN: } }`, err: `duplicate case value 0 (pos=&{1 1 69})`},
+		{s: `void main () { switch (1) { default: default: } }`, err: `multiple default labels in one switch (pos=&{1 1 37})`},
+		{s: `void main () { x=1; switch (1) { case x: } }`, err: `case label does not reduce to an integer constant (pos=&{1 1 38})`},
+		{s: `const int N=3; void main () { x=1; x+=N*2; y=x++ + --x; int z = y = 4; }`},
+		{s: `const int N=3; void main () { N+=1; }`, err: `cannot assign to constant N (pos=&{1 1 31})`},
+		{s: `const int N=3; void main () { x=N++; }`, err: `cannot assign to constant N (pos=&{1 1 33})`},
+		{s: `void main () { string s="a"; s++; }`, err: `invalid operand, expected int (pos=&{1 1 30})`},
+		{s: `void main () { x=1; x*="a"; }`, err: `invalid operand, expected int (pos=&{1 1 21})`},
+		{s: `void main () { int x; string s = x = 2; }`, err: `cannot assign int to variable s of type string (pos=&{1 1 35})`},
+		{s: `enum Color { RED, GREEN }; void main () { enum Color c = RED; x = ~c & 3 | GREEN << 2; x >>= 63; }`},
+		{s: `void main () { x = 1 << 64; }`, err: `shift count 64 out of range (pos=&{1 1 21})`},
+		{s: `void main () { x = 1; x >>= 70; }`, err: `shift count 70 out of range (pos=&{1 1 24})`},
+		{s: `void main () { x = 1 & true; }`, err: `invalid operand, expected int (pos=&{1 1 21})`},
+		{s: `void main () { x = ~"a"; }`, err: `invalid operand, expected int (pos=&{1 1 19})`},
+		{s: `enum Color { RED, GREEN }; void main () { enum Color c = RED; boolean b = !(c == GREEN) && (true != false || c > RED); enum Color d = b ? c : GREEN; int x = b ? c : 1; string s = b ? "a" : "b"; }`},
+		{s: `void main () { boolean b = 1 && true; }`, err: `invalid operand, expected boolean (pos=&{1 1 27})`},
+		{s: `void main () { boolean b = true || "a"; }`, err: `invalid operand, expected boolean (pos=&{1 1 35})`},
+		{s: `void main () { boolean b = !5; }`, err: `invalid operand, expected boolean (pos=&{1 1 28})`},
+		{s: `void main () { x = 1 ? 2 : 3; }`, err: `invalid operand, expected boolean (pos=&{1 1 19})`},
+		{s: `void main () { x = true ? 2 : "a"; }`, err: `type mismatch in conditional expression: int and string (pos=&{1 1 24})`},
+		{s: `void main () { string s = true ? 2 : 3; }`, err: `cannot assign int to variable s of type string (pos=&{1 1 31})`},
+		{s: `void main () { boolean b = true == 1; }`, err: `invalid operand, expected int (pos=&{1 1 32})`},
+		{s: `void main () { break; }`, err: `break statement not within switch (pos=&{1 1 15})`},
+		{s: `void main () { switch (1) { case 1: x=1; } break; }`, err: `break statement not within switch (pos=&{1 1 43})`},
+		{s: `enum Color { RED }; enum Color f(int n) { switch (n) { case 0: return RED; default: return 1; } } int main () { return f(0); }`},
+		{s: `void f() { return; } void main () { f(); return; }`},
+		{s: `int f(int n) { switch (n) { case 0: return 1; } } int main () { return f(0); }`, err: `missing return at end of function f (pos=&{1 1 4})`},
+		{s: `int f(int n) { switch (n) { case 0: return 1; default: break; } } int main () { return f(0); }`, err: `missing return at end of function f (pos=&{1 1 4})`},
+		{s: `int main () { return; }`, err: `function main must return a value of type int (pos=&{1 1 14})`},
+		{s: `void main () { return 1; }`, err: `function main returns no value, cannot return a value (pos=&{1 1 22})`},
+		{s: `string f() { return 1; } void main () { print(f()); }`, err: `cannot return int from function f of type string (pos=&{1 1 20})`},
+		{s: `boolean main () { return true; }`, err: `function main must be declared as void main() or int main() (pos=&{1 1 8})`},
+		{s: `void main () { x = 1; x = "a"; }`, err: `cannot assign string to variable x of type int inferred at line 1 (pos=&{1 1 26})`},
+		{s: `void main () { switch (1) { case 1: x = 1; break; default: x = "a"; } }`, err: `cannot assign string to variable x of type int inferred at line 1 (pos=&{1 1 63})`},
+		{s: `void main () {
+			x = 1; x++;
+			x = true; }`, err: `cannot assign boolean to variable x of type int inferred at line 2 (pos=&{3 1 37})`},
+		{s: `void main () { a = (b = 2) + 1; print(x = "a"); b = x; }`,
+			err: `cannot assign string to variable b of type int inferred at line 1 (pos=&{1 1 52})`},
+		{s: `int a = b; int b = 1; void main () { print(a); }`, err: `variable b not declared (pos=&{1 1 8})`},
+		{s: `int main () { int count = 1; return cuont; }`, err: `variable cuont not declared (pos=&{1 1 36})`},
+		{s: `void main () { n += 1; }`, err: `variable n not declared (pos=&{1 1 17})`},
+		{s: `void main () { b = 1 > 2; x = b + 1; }`, err: `invalid operand, expected int (pos=&{1 1 32})`},
+		{s: `enum Color { RED }; void main () { x = RED; x = 2; s = "a"; s = "b" ; }`},
+		{s: `int main (int n) { return n; }`, err: `function main must be declared as void main() or int main() (pos=&{1 1 4})`},
+	}
+
+	for i, tt := range tests {
+		p := NewParser(strings.NewReader(tt.s))
+		program, err := p.Parse2()
+		if err != nil {
+			t.Errorf("%d. %q: parse error: %s", i, tt.s, err)
+			continue
+		}
+		err = p.Checker(program)
+		if tt.err != errstring(err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		}
+	}
+}
+
+// Ensure the checker warns when a switch over an enumeration doesn't handle all its values, about the unused
+// variables, parameters and functions, the unreachable code, the constant conditions and the variables which may
+// be read before they are assigned.
+func TestParser_CheckerWarnings(t *testing.T) {
+	var tests = []struct {
+		s        string
+		warnings []string
+	}{
+		{s: `enum Color { RED, GREEN, BLUE }; void main () { enum Color c = RED; switch (c) { case RED: case GREEN: case BLUE: } }`},
+		{s: `enum Color { RED, GREEN, BLUE }; void main () { enum Color c = RED; switch (c) { case RED: default: } }`},
+		{s: `enum Color { RED, GREEN, BLUE }; void main () { x = RED; switch (x) { case RED: } }`},
+		{
+			s: `enum Color { RED, GREEN, BLUE }; void main () { enum Color c = RED; switch (c) { case GREEN: } }`,
+			warnings: []string{
+				"enumeration value RED not handled in switch (pos=&{1 1 68})",
+				"enumeration value BLUE not handled in switch (pos=&{1 1 68})",
+			},
+		},
+		{
+			s: `enum Color { RED, GREEN }; void f(enum Color c) { switch (c) { case 0: } } void main () { }`,
+			warnings: []string{
+				"enumeration value GREEN not handled in switch (pos=&{1 1 50})",
+				"function f is never called (pos=&{1 1 32})",
+			},
+		},
+		{
+			s: `int g = 1; int h; int f(int a, int b) { int c; x = a; y = x; return y; } void main () { f(1, 2); }`,
+			warnings: []string{
+				"parameter b is never used (pos=&{1 1 31})",
+				"variable c is declared but never used (pos=&{1 1 40})",
+				"variable g is assigned but never read (pos=&{1 1 0})",
+				"variable h is declared but never used (pos=&{1 1 11})",
+			},
+		},
+		{
+			s:        `int f(int n) { return f(n - 1); } int g() { return 1; } void main () { x = g(); x++; print(x); }`,
+			warnings: []string{"function f is never called (pos=&{1 1 4})"},
+		},
+		{
+			s:        `int main () { x = 1; return x; x = 2; }`,
+			warnings: []string{"unreachable code (pos=&{1 1 31})"},
+		},
+		{
+			s:        `int main () { x = 1; switch (x) { case 1: break; print(x); default: return 1; } return 0; }`,
+			warnings: []string{"unreachable code (pos=&{1 1 49})"},
+		},
+		{
+			s:        `int main () { x = 1; switch (x) { case 1: switch (x) { default: break; } return 1; default: return 2; } return 0; }`,
+			warnings: []string{"unreachable code (pos=&{1 1 104})"},
+		},
+		{s: `int main () { x = 1; switch (x) { case 1: return 1; } return 0; }`},
+		{s: `int main () { x = 1; switch (x) { case 1: return 1; default: break; } return 0; }`},
+		{
+			s: `enum Color { RED }; void main () { boolean b = true; x = 1 < 2 && b; y = b || !(RED == 0 && b); z = (true || b) ? 1 : 2; print(x, y, z); }`,
+			warnings: []string{
+				"condition is always true (pos=&{1 1 59})",
+				"condition is always true (pos=&{1 1 84})",
+				"condition is always true (pos=&{1 1 106})",
+			},
+		},
+		{s: `void main () { boolean b = true; x = !b && (b || b); print(x ? 1 : 0); }`},
+		{
+			s:        `int f(int n) { switch (n) { case 1: y = 2; break; default: } return y; } int main () { return f(1); }`,
+			warnings: []string{"variable y may be used uninitialised, path: switch at line 1 takes default (pos=&{1 1 68})"},
+		},
+		{
+			s: `enum Color { RED }; int f(int n) {
+				switch (n) { case RED: r = 1; }
+				return r + r;
+			} int main () { return f(1); }`,
+			warnings: []string{"variable r may be used uninitialised, path: switch at line 2 matches no case (pos=&{3 1 82})"},
+		},
+		{
+			s: `void main () { boolean b = true; x = b ? (y = 1) : 2; z = b && (w = true) || !b; print(x, y, z, w); }`,
+			warnings: []string{
+				"variable y may be used uninitialised, path: condition at line 1 is false -> " +
+					"left operand of && at line 1 is true -> left operand of || at line 1 is false (pos=&{1 1 90})",
+				"variable w may be used uninitialised, path: condition at line 1 is true -> " +
+					"left operand of && at line 1 is false -> left operand of || at line 1 is false (pos=&{1 1 96})",
+			},
+		},
+		{s: `int y = 1; enum Color { RED }; int f(int n) { switch (n) { case 0: y = 2; r = RED; break; default: r = 2; } return r + y; } int main () { return f(1); }`},
+	}
+
+	for i, tt := range tests {
+		p := NewParser(strings.NewReader(tt.s))
+		program, err := p.Parse2()
+		if err != nil {
+			t.Errorf("%d. %q: parse error: %s", i, tt.s, err)
+			continue
+		}
+		if err = p.Checker(program); err != nil {
+			t.Errorf("%d. %q: check error: %s", i, tt.s, err)
+			continue
+		}
+		var warnings []string
+		for _, warning := range p.Warnings() {
+			warnings = append(warnings, warning.String())
+		}
+		if !reflect.DeepEqual(tt.warnings, warnings) {
+			t.Errorf("%d. %q: warnings mismatch:\n  exp=%q\n  got=%q\n\n", i, tt.s, tt.warnings, warnings)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+; Code generated by hephaestus to-llvm from checks.he. DO NOT EDIT.
+
+source_filename = "checks.he"
+
+; The runtime of the LLVM modules generated by the command to-llvm, copied in each module. The modules write
+; the same output as the interpreter, and report the same errors. The integers are computed on 64 bits and
+; wrap around, as the ones of the interpreter.
+
+@rt.true = private unnamed_addr constant [5 x i8] c"true\00"
+@rt.false = private unnamed_addr constant [6 x i8] c"false\00"
+@rt.error = private unnamed_addr constant [9 x i8] c"error : \00"
+@rt.wrap = private unnamed_addr constant [8 x i8] c"error: \00"
+@rt.line = private unnamed_addr constant [4 x i8] c"%s\0A\00"
+@rt.shift = private unnamed_addr constant [47 x i8] c"error: shift count %lld out of range (pos=%s)\0A\00"
+
+declare i32 @printf(ptr, ...)
+declare i32 @dprintf(i32, ptr, ...)
+declare i32 @fflush(ptr)
+declare void @exit(i32) noreturn
+
+; @rt_exit ends the program with the exit code.
+define void @rt_exit(i64 %code) noreturn {
+entry:
+  %low = trunc i64 %code to i32
+  %status = and i32 %low, 255
+  call void @exit(i32 %status)
+  unreachable
+}
+
+; @rt_bool returns the text of a boolean.
+define ptr @rt_bool(i1 %value) {
+entry:
+  %text = select i1 %value, ptr @rt.true, ptr @rt.false
+  ret ptr %text
+}
+
+; @rt_error writes the beginning of an error, wrapped %wrap times.
+define void @rt_error(i32 %wrap) {
+entry:
+  %flushed = call i32 @fflush(ptr null)
+  %written = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.error)
+  br label %loop
+loop:
+  %n = phi i32 [ %wrap, %entry ], [ %next, %body ]
+  %done = icmp sle i32 %n, 0
+  br i1 %done, label %end, label %body
+body:
+  %wrapped = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.wrap)
+  %next = sub i32 %n, 1
+  br label %loop
+end:
+  ret void
+}
+
+; @rt_fail ends the program with the error of the interpreter, wrapped %wrap times.
+define void @rt_fail(i32 %wrap, ptr %message) noreturn {
+entry:
+  call void @rt_error(i32 %wrap)
+  %written = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.line, ptr %message)
+  call void @exit(i32 1)
+  unreachable
+}
+
+; @rt_declared fails if the variable is not set.
+define void @rt_declared(i1 %set, i32 %wrap, ptr %message) {
+entry:
+  br i1 %set, label %ok, label %fail
+fail:
+  call void @rt_fail(i32 %wrap, ptr %message)
+  unreachable
+ok:
+  ret void
+}
+
+; @rt_divisor checks the divisor of a division or a modulo.
+define i64 @rt_divisor(i64 %divisor, i32 %wrap, ptr %message) {
+entry:
+  %zero = icmp eq i64 %divisor, 0
+  br i1 %zero, label %fail, label %ok
+fail:
+  call void @rt_fail(i32 %wrap, ptr %message)
+  unreachable
+ok:
+  ret i64 %divisor
+}
+
+; @rt_div divides, the division of the smallest integer by -1 wraps around.
+define i64 @rt_div(i64 %a, i64 %b) {
+entry:
+  %negate = icmp eq i64 %b, -1
+  br i1 %negate, label %opposite, label %divide
+opposite:
+  %opposite.value = sub i64 0, %a
+  ret i64 %opposite.value
+divide:
+  %quotient = sdiv i64 %a, %b
+  ret i64 %quotient
+}
+
+define i64 @rt_mod(i64 %a, i64 %b) {
+entry:
+  %negate = icmp eq i64 %b, -1
+  br i1 %negate, label %zero, label %divide
+zero:
+  ret i64 0
+divide:
+  %remainder = srem i64 %a, %b
+  ret i64 %remainder
+}
+
+; @rt_shift checks the count of a shift is lower than the size of an integer.
+define i64 @rt_shift(i64 %count, i32 %wrap, ptr %pos) {
+entry:
+  %out = icmp uge i64 %count, 64
+  br i1 %out, label %fail, label %ok
+fail:
+  call void @rt_error(i32 %wrap)
+  %written = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.shift, i64 %count, ptr %pos)
+  call void @exit(i32 1)
+  unreachable
+ok:
+  ret i64 %count
+}
+
+; @rt_returned checks the function called returns a value.
+define void @rt_returned(i1 %ok, i32 %wrap, ptr %message) {
+entry:
+  br i1 %ok, label %done, label %fail
+fail:
+  call void @rt_fail(i32 %wrap, ptr %message)
+  unreachable
+done:
+  ret void
+}
+
+@.str.1 = private unnamed_addr constant [12 x i8] c"function f\0A\00"
+@.str.2 = private unnamed_addr constant [13 x i8] c"switch %lld\0A\00"
+@.str.3 = private unnamed_addr constant [13 x i8] c"return %lld\0A\00"
+@.str.4 = private unnamed_addr constant [15 x i8] c"function main\0A\00"
+@.str.5 = private unnamed_addr constant [42 x i8] c"error: division by zero (pos=&{13 1 174})\00"
+@.str.6 = private unnamed_addr constant [8 x i8] c"y=%lld\0A\00"
+@.str.7 = private unnamed_addr constant [24 x i8] c"variable y not declared\00"
+@.str.8 = private unnamed_addr constant [12 x i8] c"&{15 1 198}\00"
+@.str.9 = private unnamed_addr constant [8 x i8] c"x=%lld\0A\00"
+@.str.10 = private unnamed_addr constant [42 x i8] c"error: division by zero (pos=&{16 1 217})\00"
+
+define internal i64 @f(i32 %wrap, i64 %n.arg) !dbg !5 {
+entry:
+  %n.addr = alloca i64, !dbg !6
+  store i64 %n.arg, ptr %n.addr, !dbg !6
+  call i32 (ptr, ...) @printf(ptr @.str.1), !dbg !6
+  %t1 = load i64, ptr %n.addr, !dbg !7
+  %t2 = icmp sgt i64 %t1, 0, !dbg !7
+  br i1 %t2, label %cond1.then, label %cond1.else, !dbg !7
+cond1.then:
+  br label %cond1.end, !dbg !7
+cond1.else:
+  br label %cond1.end, !dbg !7
+cond1.end:
+  %t3 = phi i64 [ 1, %cond1.then ], [ 0, %cond1.else ], !dbg !7
+  call i32 (ptr, ...) @printf(ptr @.str.2, i64 %t3), !dbg !7
+  switch i64 %t3, label %switch2.case1 [i64 1, label %switch2.case0], !dbg !7
+switch2.case0:
+  %t4 = load i64, ptr %n.addr, !dbg !8
+  call i32 (ptr, ...) @printf(ptr @.str.3, i64 %t4), !dbg !8
+  ret i64 %t4, !dbg !8
+switch2.case1:
+  call i32 (ptr, ...) @printf(ptr @.str.3, i64 0), !dbg !9
+  ret i64 0, !dbg !9
+switch2.end:
+  unreachable, !dbg !9
+}
+
+define internal i64 @main_(i32 %wrap) !dbg !10 {
+entry:
+  %y.addr = alloca i64, !dbg !11
+  %y.set = alloca i1, !dbg !11
+  store i1 false, ptr %y.set, !dbg !11
+  %x.addr = alloca i64, !dbg !11
+  call i32 (ptr, ...) @printf(ptr @.str.4), !dbg !11
+  %t1 = add i32 %wrap, 1, !dbg !12
+  %t2 = call i64 @f(i32 %t1, i64 1), !dbg !12
+  call i32 (ptr, ...) @printf(ptr @.str.2, i64 %t2), !dbg !12
+  switch i64 %t2, label %switch1.end [i64 1, label %switch1.case0], !dbg !12
+switch1.case0:
+  %t3 = add i32 %wrap, 2, !dbg !13
+  %t4 = call i64 @f(i32 %t3, i64 1), !dbg !13
+  %t6 = add i32 %wrap, 1, !dbg !13
+  %t5 = call i64 @rt_divisor(i64 %t4, i32 %t6, ptr @.str.5), !dbg !13
+  %t7 = call i64 @rt_div(i64 7, i64 %t5), !dbg !13
+  store i64 %t7, ptr %y.addr, !dbg !13
+  store i1 true, ptr %y.set, !dbg !13
+  call i32 (ptr, ...) @printf(ptr @.str.6, i64 %t7), !dbg !13
+  br label %switch1.end, !dbg !13
+switch1.end:
+  %t9 = add i32 %wrap, 2, !dbg !14
+  %t8 = load i1, ptr %y.set, !dbg !14
+  call void @rt_declared(i1 %t8, i32 %t9, ptr @.str.7), !dbg !14
+  %t10 = load i64, ptr %y.addr, !dbg !14
+  %t12 = add i32 %wrap, 1, !dbg !14
+  %t11 = call i64 @rt_shift(i64 %t10, i32 %t12, ptr @.str.8), !dbg !14
+  %t13 = shl i64 1, %t11, !dbg !14
+  store i64 %t13, ptr %x.addr, !dbg !14
+  call i32 (ptr, ...) @printf(ptr @.str.9, i64 %t13), !dbg !14
+  %t15 = add i32 %wrap, 2, !dbg !15
+  %t14 = load i1, ptr %y.set, !dbg !15
+  call void @rt_declared(i1 %t14, i32 %t15, ptr @.str.7), !dbg !15
+  %t16 = load i64, ptr %y.addr, !dbg !15
+  %t17 = add i32 %wrap, 2, !dbg !15
+  %t18 = call i64 @f(i32 %t17, i64 0), !dbg !15
+  %t20 = add i32 %wrap, 1, !dbg !15
+  %t19 = call i64 @rt_divisor(i64 %t18, i32 %t20, ptr @.str.10), !dbg !15
+  %t21 = call i64 @rt_mod(i64 %t16, i64 %t19), !dbg !15
+  call i32 (ptr, ...) @printf(ptr @.str.3, i64 %t21), !dbg !15
+  ret i64 %t21, !dbg !15
+}
+
+define i32 @main() !dbg !16 {
+entry:
+  %t1 = call i64 @main_(i32 0), !dbg !18
+  call void @rt_exit(i64 %t1), !dbg !18
+  unreachable, !dbg !18
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!2, !3}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "hephaestus", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)
+!1 = !DIFile(filename: "checks.he", directory: "")
+!2 = !{i32 2, !"Debug Info Version", i32 3}
+!3 = !{i32 2, !"Dwarf Version", i32 4}
+!4 = !DISubroutineType(types: !{})
+!5 = distinct !DISubprogram(name: "f", linkageName: "f", scope: !1, file: !1, line: 1, type: !4, scopeLine: 1, spFlags: DISPFlagDefinition, unit: !0)
+!6 = !DILocation(line: 1, column: 1, scope: !5)
+!7 = !DILocation(line: 2, column: 1, scope: !5)
+!8 = !DILocation(line: 4, column: 1, scope: !5)
+!9 = !DILocation(line: 6, column: 1, scope: !5)
+!10 = distinct !DISubprogram(name: "main", linkageName: "main_", scope: !1, file: !1, line: 10, type: !4, scopeLine: 10, spFlags: DISPFlagDefinition, unit: !0)
+!11 = !DILocation(line: 10, column: 1, scope: !10)
+!12 = !DILocation(line: 11, column: 1, scope: !10)
+!13 = !DILocation(line: 13, column: 1, scope: !10)
+!14 = !DILocation(line: 15, column: 1, scope: !10)
+!15 = !DILocation(line: 16, column: 1, scope: !10)
+!16 = distinct !DISubprogram(name: "main", linkageName: "main", scope: !1, file: !1, line: 1, type: !4, scopeLine: 1, spFlags: DISPFlagDefinition, unit: !0)
+!17 = !DILocation(line: 1, column: 1, scope: !16)
+!18 = !DILocation(line: 10, column: 1, scope: !16)
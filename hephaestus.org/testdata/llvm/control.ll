@@ -0,0 +1,248 @@
+; Code generated by hephaestus to-llvm from control.he. DO NOT EDIT.
+
+source_filename = "control.he"
+
+; The runtime of the LLVM modules generated by the command to-llvm, copied in each module. The modules write
+; the same output as the interpreter, and report the same errors. The integers are computed on 64 bits and
+; wrap around, as the ones of the interpreter.
+
+@rt.true = private unnamed_addr constant [5 x i8] c"true\00"
+@rt.false = private unnamed_addr constant [6 x i8] c"false\00"
+@rt.error = private unnamed_addr constant [9 x i8] c"error : \00"
+@rt.wrap = private unnamed_addr constant [8 x i8] c"error: \00"
+@rt.line = private unnamed_addr constant [4 x i8] c"%s\0A\00"
+@rt.shift = private unnamed_addr constant [47 x i8] c"error: shift count %lld out of range (pos=%s)\0A\00"
+
+declare i32 @printf(ptr, ...)
+declare i32 @dprintf(i32, ptr, ...)
+declare i32 @fflush(ptr)
+declare void @exit(i32) noreturn
+
+; @rt_exit ends the program with the exit code.
+define void @rt_exit(i64 %code) noreturn {
+entry:
+  %low = trunc i64 %code to i32
+  %status = and i32 %low, 255
+  call void @exit(i32 %status)
+  unreachable
+}
+
+; @rt_bool returns the text of a boolean.
+define ptr @rt_bool(i1 %value) {
+entry:
+  %text = select i1 %value, ptr @rt.true, ptr @rt.false
+  ret ptr %text
+}
+
+; @rt_error writes the beginning of an error, wrapped %wrap times.
+define void @rt_error(i32 %wrap) {
+entry:
+  %flushed = call i32 @fflush(ptr null)
+  %written = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.error)
+  br label %loop
+loop:
+  %n = phi i32 [ %wrap, %entry ], [ %next, %body ]
+  %done = icmp sle i32 %n, 0
+  br i1 %done, label %end, label %body
+body:
+  %wrapped = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.wrap)
+  %next = sub i32 %n, 1
+  br label %loop
+end:
+  ret void
+}
+
+; @rt_fail ends the program with the error of the interpreter, wrapped %wrap times.
+define void @rt_fail(i32 %wrap, ptr %message) noreturn {
+entry:
+  call void @rt_error(i32 %wrap)
+  %written = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.line, ptr %message)
+  call void @exit(i32 1)
+  unreachable
+}
+
+; @rt_declared fails if the variable is not set.
+define void @rt_declared(i1 %set, i32 %wrap, ptr %message) {
+entry:
+  br i1 %set, label %ok, label %fail
+fail:
+  call void @rt_fail(i32 %wrap, ptr %message)
+  unreachable
+ok:
+  ret void
+}
+
+; @rt_divisor checks the divisor of a division or a modulo.
+define i64 @rt_divisor(i64 %divisor, i32 %wrap, ptr %message) {
+entry:
+  %zero = icmp eq i64 %divisor, 0
+  br i1 %zero, label %fail, label %ok
+fail:
+  call void @rt_fail(i32 %wrap, ptr %message)
+  unreachable
+ok:
+  ret i64 %divisor
+}
+
+; @rt_div divides, the division of the smallest integer by -1 wraps around.
+define i64 @rt_div(i64 %a, i64 %b) {
+entry:
+  %negate = icmp eq i64 %b, -1
+  br i1 %negate, label %opposite, label %divide
+opposite:
+  %opposite.value = sub i64 0, %a
+  ret i64 %opposite.value
+divide:
+  %quotient = sdiv i64 %a, %b
+  ret i64 %quotient
+}
+
+define i64 @rt_mod(i64 %a, i64 %b) {
+entry:
+  %negate = icmp eq i64 %b, -1
+  br i1 %negate, label %zero, label %divide
+zero:
+  ret i64 0
+divide:
+  %remainder = srem i64 %a, %b
+  ret i64 %remainder
+}
+
+; @rt_shift checks the count of a shift is lower than the size of an integer.
+define i64 @rt_shift(i64 %count, i32 %wrap, ptr %pos) {
+entry:
+  %out = icmp uge i64 %count, 64
+  br i1 %out, label %fail, label %ok
+fail:
+  call void @rt_error(i32 %wrap)
+  %written = call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @rt.shift, i64 %count, ptr %pos)
+  call void @exit(i32 1)
+  unreachable
+ok:
+  ret i64 %count
+}
+
+; @rt_returned checks the function called returns a value.
+define void @rt_returned(i1 %ok, i32 %wrap, ptr %message) {
+entry:
+  br i1 %ok, label %done, label %fail
+fail:
+  call void @rt_fail(i32 %wrap, ptr %message)
+  unreachable
+done:
+  ret void
+}
+
+@.str.1 = private unnamed_addr constant [14 x i8] c"function add\0A\00"
+@.str.2 = private unnamed_addr constant [12 x i8] c"total=%lld\0A\00"
+@.str.3 = private unnamed_addr constant [15 x i8] c"function main\0A\00"
+@.str.4 = private unnamed_addr constant [8 x i8] c"c=%lld\0A\00"
+@.str.5 = private unnamed_addr constant [13 x i8] c"switch %lld\0A\00"
+@.str.6 = private unnamed_addr constant [11 x i8] c"add(%lld)\0A\00"
+@.str.7 = private unnamed_addr constant [7 x i8] c"break\0A\00"
+@.str.8 = private unnamed_addr constant [7 x i8] c"ok=%s\0A\00"
+@.str.9 = private unnamed_addr constant [13 x i8] c"return %lld\0A\00"
+
+@total = internal global i64 0
+
+define internal void @add(i32 %wrap, i64 %n.arg) !dbg !5 {
+entry:
+  %n.addr = alloca i64, !dbg !6
+  store i64 %n.arg, ptr %n.addr, !dbg !6
+  %total.addr = alloca i64, !dbg !6
+  call i32 (ptr, ...) @printf(ptr @.str.1), !dbg !6
+  %t1 = load i64, ptr @total, !dbg !7
+  %t2 = load i64, ptr %n.addr, !dbg !7
+  %t3 = add i64 %t1, %t2, !dbg !7
+  store i64 %t3, ptr @total, !dbg !7
+  %t4 = load i64, ptr @total, !dbg !7
+  call i32 (ptr, ...) @printf(ptr @.str.2, i64 %t4), !dbg !7
+  ret void, !dbg !7
+}
+
+define internal i64 @main_(i32 %wrap) !dbg !8 {
+entry:
+  %c.addr = alloca i64, !dbg !9
+  %ok.addr = alloca i1, !dbg !9
+  call i32 (ptr, ...) @printf(ptr @.str.3), !dbg !9
+  store i64 1, ptr %c.addr, !dbg !10
+  call i32 (ptr, ...) @printf(ptr @.str.4, i64 1), !dbg !10
+  %t1 = load i64, ptr %c.addr, !dbg !11
+  call i32 (ptr, ...) @printf(ptr @.str.5, i64 %t1), !dbg !11
+  switch i64 %t1, label %switch1.case2 [i64 0, label %switch1.case0 i64 1, label %switch1.case1], !dbg !11
+switch1.case0:
+  call i32 (ptr, ...) @printf(ptr @.str.6, i64 1), !dbg !12
+  call void @add(i32 %wrap, i64 1), !dbg !12
+  br label %switch1.case1, !dbg !12
+switch1.case1:
+  call i32 (ptr, ...) @printf(ptr @.str.6, i64 2), !dbg !13
+  call void @add(i32 %wrap, i64 2), !dbg !13
+  call i32 (ptr, ...) @printf(ptr @.str.7), !dbg !14
+  br label %switch1.end, !dbg !14
+switch1.case2:
+  call i32 (ptr, ...) @printf(ptr @.str.6, i64 4), !dbg !15
+  call void @add(i32 %wrap, i64 4), !dbg !15
+  br label %switch1.end, !dbg !15
+switch1.end:
+  %t2 = load i64, ptr @total, !dbg !16
+  %t3 = icmp sgt i64 %t2, 11, !dbg !16
+  br i1 %t3, label %logic2.right, label %logic2.end, !dbg !16
+logic2.right:
+  %t4 = load i64, ptr %c.addr, !dbg !16
+  %t5 = icmp ne i64 %t4, 2, !dbg !16
+  br label %logic2.end, !dbg !16
+logic2.end:
+  %t6 = phi i1 [ false, %switch1.end ], [ %t5, %logic2.right ], !dbg !16
+  store i1 %t6, ptr %ok.addr, !dbg !16
+  %t7 = call ptr @rt_bool(i1 %t6), !dbg !16
+  call i32 (ptr, ...) @printf(ptr @.str.8, ptr %t7), !dbg !16
+  %t8 = load i1, ptr %ok.addr, !dbg !17
+  br i1 %t8, label %cond3.then, label %cond3.else, !dbg !17
+cond3.then:
+  %t9 = load i64, ptr @total, !dbg !17
+  %t10 = ashr i64 %t9, 1, !dbg !17
+  br label %cond3.end, !dbg !17
+cond3.else:
+  %t11 = load i64, ptr @total, !dbg !17
+  %t12 = xor i64 %t11, -1, !dbg !17
+  br label %cond3.end, !dbg !17
+cond3.end:
+  %t13 = phi i64 [ %t10, %cond3.then ], [ %t12, %cond3.else ], !dbg !17
+  call i32 (ptr, ...) @printf(ptr @.str.9, i64 %t13), !dbg !17
+  ret i64 %t13, !dbg !17
+}
+
+define i32 @main() !dbg !18 {
+entry:
+  store i64 10, ptr @total, !dbg !20
+  call i32 (ptr, ...) @printf(ptr @.str.2, i64 10), !dbg !20
+  %t1 = call i64 @main_(i32 0), !dbg !21
+  call void @rt_exit(i64 %t1), !dbg !21
+  unreachable, !dbg !21
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!2, !3}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "hephaestus", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)
+!1 = !DIFile(filename: "control.he", directory: "")
+!2 = !{i32 2, !"Debug Info Version", i32 3}
+!3 = !{i32 2, !"Dwarf Version", i32 4}
+!4 = !DISubroutineType(types: !{})
+!5 = distinct !DISubprogram(name: "add", linkageName: "add", scope: !1, file: !1, line: 4, type: !4, scopeLine: 4, spFlags: DISPFlagDefinition, unit: !0)
+!6 = !DILocation(line: 4, column: 1, scope: !5)
+!7 = !DILocation(line: 5, column: 1, scope: !5)
+!8 = distinct !DISubprogram(name: "main", linkageName: "main_", scope: !1, file: !1, line: 8, type: !4, scopeLine: 8, spFlags: DISPFlagDefinition, unit: !0)
+!9 = !DILocation(line: 8, column: 1, scope: !8)
+!10 = !DILocation(line: 9, column: 1, scope: !8)
+!11 = !DILocation(line: 10, column: 1, scope: !8)
+!12 = !DILocation(line: 12, column: 1, scope: !8)
+!13 = !DILocation(line: 14, column: 1, scope: !8)
+!14 = !DILocation(line: 15, column: 1, scope: !8)
+!15 = !DILocation(line: 17, column: 1, scope: !8)
+!16 = !DILocation(line: 19, column: 1, scope: !8)
+!17 = !DILocation(line: 20, column: 1, scope: !8)
+!18 = distinct !DISubprogram(name: "main", linkageName: "main", scope: !1, file: !1, line: 1, type: !4, scopeLine: 1, spFlags: DISPFlagDefinition, unit: !0)
+!19 = !DILocation(line: 1, column: 1, scope: !18)
+!20 = !DILocation(line: 2, column: 1, scope: !18)
+!21 = !DILocation(line: 8, column: 1, scope: !18)
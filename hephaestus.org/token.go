@@ -8,6 +8,7 @@ const (
 	ILLEGAL Token = iota
 	EOF
 	WS
+	COMMENT // a comment, // until the end of the line or /* until */
 
 	// Literals
 	IDENT // main
@@ -30,6 +31,32 @@ const (
 	LESSER_OR_EQUALS    // <=
 	GREATER             // >
 	GREATER_OR_EQUALS   // >=
+	COLON               // :
+	SLASH               // /
+	PERCENT             // %
+	ADD_EQUALS          // +=
+	SUB_EQUALS          // -=
+	MUL_EQUALS          // *=
+	DIV_EQUALS          // /=
+	MOD_EQUALS          // %=
+	INCREMENT           // ++
+	DECREMENT           // --
+	AMPERSAND           // &
+	PIPE                // |
+	CARET               // ^
+	TILDE               // ~
+	SHIFT_LEFT          // <<
+	SHIFT_RIGHT         // >>
+	AND_EQUALS          // &=
+	OR_EQUALS           // |=
+	XOR_EQUALS          // ^=
+	SHL_EQUALS          // <<=
+	SHR_EQUALS          // >>=
+	LOGICAL_AND         // &&
+	LOGICAL_OR          // ||
+	NOT                 // !
+	NOT_EQUALS          // !=
+	QUESTION_MARK       // ?
 
 	// Keywords
 	VOID
@@ -38,4 +65,11 @@ const (
 	BOOLEAN
 	TRUE
 	FALSE
+	RETURN
+	CONST
+	ENUM
+	SWITCH
+	CASE
+	DEFAULT
+	BREAK
 )
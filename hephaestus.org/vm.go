@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// runModule initializes the global variables and executes the main function of the module compiled from the
+// program, with the virtual machine.
+func (interpreter *Interpreter) runModule(res *Result) {
+	if interpreter.module == nil {
+		interpreter.module = Compile(interpreter.program)
+	}
+	module := interpreter.module
+	interpreter.globalValues = make([]Valeur, len(module.Globals))
+	interpreter.globalSet = make([]bool, len(module.Globals))
+
+	for i := range module.Init {
+		if _, err := interpreter.run(&module.Init[i], nil, nil); err != nil {
+			res.Err = &RuntimeError{position: module.Init[i].position, err: err}
+			break
+		}
+	}
+	if res.Err == nil && module.Main < 0 {
+		res.Err = &RuntimeError{err: fmt.Errorf("function main not found")}
+	} else if res.Err == nil {
+		main := &module.Functions[module.Main]
+		if locals, set, val, err := interpreter.call(main, nil); err != nil {
+			res.Err = &RuntimeError{Function: main.Name, position: main.position, err: err}
+		} else {
+			res.Variables = make(map[string]Valeur)
+			for i := range locals {
+				if set[i] {
+					res.Variables[main.Locals[i].Name] = locals[i]
+				}
+			}
+			res.Value = val
+			if val != nil && val.valeurtype.code == TYPE_INT {
+				res.ExitCode = val.valeurInt
+			}
+		}
+	}
+	for i := range module.Globals {
+		if interpreter.globalSet[i] {
+			res.Globals[module.Globals[i].Name] = interpreter.globalValues[i]
+		}
+	}
+}
+
+// call executes the compiled function with the values of the parameters, and returns its variables and the
+// returned value.
+func (interpreter *Interpreter) call(function *CompiledFunction, args []Valeur) ([]Valeur, []bool, *Valeur, error) {
+
+	if limit := interpreter.options.Limits.MaxCallDepth; limit > 0 && interpreter.depth >= limit {
+		return nil, nil, nil, &CallDepthError{Limit: limit, Function: function.Name}
+	}
+	if len(args) != len(function.Parameters) {
+		return nil, nil, nil, fmt.Errorf("function %s expects %d parameters, found %d", function.Name,
+			len(function.Parameters), len(args))
+	}
+	interpreter.depth++
+	defer func() { interpreter.depth-- }()
+	if interpreter.depth > interpreter.stats.MaxStackDepth {
+		interpreter.stats.MaxStackDepth = interpreter.depth
+	}
+
+	if err := interpreter.printf("function %s\n", function.Name); err != nil {
+		return nil, nil, nil, err
+	}
+
+	locals := make([]Valeur, len(function.Locals))
+	set := make([]bool, len(function.Locals))
+	defer func() {
+		for i := range locals {
+			if set[i] {
+				interpreter.memory -= valueSize(&locals[i])
+			}
+		}
+	}()
+	for i, typeCode := range function.Parameters {
+		if args[i].valeurtype.code != typeCode {
+			return nil, nil, nil, fmt.Errorf("invalid type for parameter %s of function %s", function.Locals[i].Name,
+				function.Name)
+		}
+		locals[i] = args[i]
+		set[i] = true
+		if err := interpreter.allocate(valueSize(&args[i]), function.Locals[i].position); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	val, err := interpreter.run(function, locals, set)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return locals, set, val, nil
+}
+
+// run executes the instructions of the function until it returns.
+func (interpreter *Interpreter) run(function *CompiledFunction, locals []Valeur, set []bool) (*Valeur, error) {
+	module := interpreter.module
+	code := function.Code
+	stack := make([]Valeur, 0, 8)
+
+	for pc := 0; pc < len(code); {
+		current := pc
+		instr := &code[pc]
+		pc++
+		if instr.Steps > 0 {
+			if err := interpreter.stepInstr(function, current); err != nil {
+				return nil, err
+			}
+		}
+
+		var err error
+		switch instr.Op {
+		case OP_CONST:
+			stack = append(stack, module.Constants[instr.A])
+		case OP_POP:
+			stack = stack[:len(stack)-int(instr.A)]
+		case OP_DUP:
+			stack = append(stack, stack[len(stack)-1])
+		case OP_LOAD_LOCAL:
+			if set[instr.A] {
+				stack = append(stack, locals[instr.A])
+			} else if local := &function.Locals[instr.A]; local.Global >= 0 && interpreter.globalSet[local.Global] {
+				stack = append(stack, interpreter.globalValues[local.Global])
+			} else if local.Constant >= 0 {
+				stack = append(stack, module.Constants[local.Constant])
+			} else {
+				err = fmt.Errorf("variable %s not declared", local.Name)
+			}
+		case OP_LOAD_GLOBAL:
+			if interpreter.globalSet[instr.A] {
+				stack = append(stack, interpreter.globalValues[instr.A])
+			} else if global := &module.Globals[instr.A]; global.Constant >= 0 {
+				stack = append(stack, module.Constants[global.Constant])
+			} else {
+				err = fmt.Errorf("variable %s not declared", global.Name)
+			}
+		case OP_STORE_LOCAL:
+			if global := function.Locals[instr.A].Global; !set[instr.A] && global >= 0 && interpreter.globalSet[global] {
+				err = interpreter.store(interpreter.globalValues, interpreter.globalSet, global, &stack[len(stack)-1],
+					function.Debug[current].Position)
+			} else {
+				err = interpreter.store(locals, set, int(instr.A), &stack[len(stack)-1], function.Debug[current].Position)
+			}
+		case OP_STORE_GLOBAL:
+			err = interpreter.store(interpreter.globalValues, interpreter.globalSet, int(instr.A), &stack[len(stack)-1],
+				function.Debug[current].Position)
+		case OP_DECLARE_LOCAL, OP_DECLARE_GLOBAL:
+			values, valuesSet, name := locals, set, ""
+			if instr.Op == OP_DECLARE_GLOBAL {
+				values, valuesSet, name = interpreter.globalValues, interpreter.globalSet, module.Globals[instr.A].Name
+			} else {
+				name = function.Locals[instr.A].Name
+			}
+			if stack[len(stack)-1].valeurtype.code != TypeCode(instr.B) {
+				err = errorAt(function.Debug[current].Position, "invalid type for variable %s", name)
+			} else {
+				err = interpreter.store(values, valuesSet, int(instr.A), &stack[len(stack)-1],
+					function.Debug[current].Position)
+			}
+		case OP_PRINT:
+			err = interpreter.printf("%s", module.Constants[instr.A].valeurString)
+		case OP_PRINT_VALUE:
+			err = interpreter.printValue(&stack[len(stack)-1])
+		case OP_PRINT_CALL:
+			args := stack[len(stack)-int(instr.B):]
+			err = interpreter.printf("%s(", module.Constants[instr.A].valeurString)
+			for i := 0; i < len(args) && err == nil; i++ {
+				if i > 0 {
+					err = interpreter.printf(",")
+				}
+				if err == nil {
+					err = interpreter.printValue(&args[i])
+				}
+			}
+			if err == nil {
+				err = interpreter.printf(")")
+			}
+		case OP_BINARY:
+			left, right := &stack[len(stack)-2], &stack[len(stack)-1]
+			if left.valeurtype.code == TYPE_INT && right.valeurtype.code == TYPE_INT && ExprCode(instr.A) == EXPR_CODE_ADD {
+				left.valeurInt += right.valeurInt
+			} else if left.valeurtype.code == TYPE_INT && right.valeurtype.code == TYPE_INT &&
+				ExprCode(instr.A) == EXPR_CODE_SUB {
+				left.valeurInt -= right.valeurInt
+			} else {
+				var val *Valeur
+				val, err = binaryValue(ExprCode(instr.A), left, right, function.Debug[current].Position)
+				if err == nil {
+					*left = *val
+				}
+			}
+			stack = stack[:len(stack)-1]
+		case OP_BIT_NOT:
+			if top := &stack[len(stack)-1]; top.valeurtype.code != TYPE_INT {
+				err = fmt.Errorf("error: var is not int")
+			} else {
+				top.valeurInt = ^top.valeurInt
+			}
+		case OP_NOT, OP_CHECK_BOOLEAN:
+			if top := &stack[len(stack)-1]; top.valeurtype.code != TYPE_BOOLEAN {
+				err = errorAt(function.Debug[current].Position, "error: var is not boolean")
+			} else {
+				*top = Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: top.valeurBoolean != (instr.Op == OP_NOT)}
+			}
+		case OP_CHECK_INT:
+			if stack[len(stack)-1].valeurtype.code != TYPE_INT {
+				err = fmt.Errorf("error: var is not int")
+			}
+		case OP_JUMP:
+			pc = int(instr.A)
+		case OP_JUMP_IF_FALSE, OP_JUMP_IF_FALSE_OR_POP, OP_JUMP_IF_TRUE_OR_POP:
+			top := &stack[len(stack)-1]
+			if top.valeurtype.code != TYPE_BOOLEAN {
+				err = errorAt(function.Debug[current].Position, "error: var is not boolean")
+			} else if instr.Op == OP_JUMP_IF_FALSE {
+				if !top.valeurBoolean {
+					pc = int(instr.A)
+				}
+				stack = stack[:len(stack)-1]
+			} else if top.valeurBoolean == (instr.Op == OP_JUMP_IF_TRUE_OR_POP) {
+				*top = Valeur{valeurtype: Type{code: TYPE_BOOLEAN}, valeurBoolean: top.valeurBoolean}
+				pc = int(instr.A)
+			} else {
+				stack = stack[:len(stack)-1]
+			}
+		case OP_CASE:
+			label := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if label.valeurInt == stack[len(stack)-1].valeurInt {
+				stack = stack[:len(stack)-1]
+				pc = int(instr.A)
+			}
+		case OP_CALL, OP_CALL_VOID:
+			callee := &module.Functions[instr.A]
+			args := stack[len(stack)-int(instr.B):]
+			_, _, val, err2 := interpreter.call(callee, args)
+			stack = stack[:len(stack)-int(instr.B)]
+			if err2 != nil {
+				err = err2
+			} else if instr.Op == OP_CALL_VOID {
+				// the returned value is ignored
+			} else if val == nil {
+				err = errorAt(function.Debug[current].Position, "function %s returns no value", callee.Name)
+			} else {
+				stack = append(stack, *val)
+			}
+		case OP_RETURN:
+			val := stack[len(stack)-1]
+			return &val, nil
+		case OP_RETURN_VOID:
+			return nil, nil
+		case OP_FAIL:
+			err = errors.New(module.Constants[instr.A].valeurString)
+		default:
+			err = fmt.Errorf("invalid instruction %d", instr.Op)
+		}
+		if err != nil {
+			return nil, wrapError(err, function.Debug[current].Wrap)
+		}
+	}
+	return nil, nil
+}
+
+// store stores the value in the variable of values and accounts for its memory.
+func (interpreter *Interpreter) store(values []Valeur, set []bool, index int, val *Valeur, position *Position) error {
+	size := valueSize(val)
+	if set[index] {
+		size -= valueSize(&values[index])
+	}
+	values[index] = *val
+	set[index] = true
+	return interpreter.allocate(size, position)
+}
+
+// stepInstr accounts for the steps of the instruction at pc, and checks the step limit and the context as
+// the tree-walking interpreter does for each of these steps.
+func (interpreter *Interpreter) stepInstr(function *CompiledFunction, pc int) error {
+	before := interpreter.steps
+	interpreter.steps += int64(function.Code[pc].Steps)
+	if limit := interpreter.options.Limits.MaxSteps; limit > 0 && interpreter.steps > limit {
+		step := function.Debug[pc].Steps[limit-before]
+		interpreter.steps = limit + 1
+		return wrapError(&StepLimitError{Limit: limit, position: step.Position}, step.Wrap)
+	}
+	// the context is checked every 256 steps
+	if before == 0 || before>>8 != interpreter.steps>>8 {
+		select {
+		case <-interpreter.ctx.Done():
+			interpreter.steps = before + 1
+			return wrapError(contextError(interpreter.ctx.Err()), function.Debug[pc].Steps[0].Wrap)
+		default:
+		}
+	}
+	return nil
+}
+
+// wrapError wraps the error n times, as the tree-walking interpreter does while returning from the evaluation
+// of the expressions.
+func wrapError(err error, n int) error {
+	for i := 0; i < n; i++ {
+		err = fmt.Errorf("error: %w", err)
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// interpret executes the program with the tree-walking interpreter and with the virtual machine, checks both
+// give the same result, and returns the result of the tree-walking interpreter.
+func interpret(t *testing.T, program *Program, options Options, ctx context.Context) (*Result, error) {
+	t.Helper()
+	res, err := NewInterpreterWithOptions(program, options).interpreterContext(ctx)
+	options.VM = true
+	options.Stdout = nil
+	resVM, errVM := NewInterpreterWithOptions(program, options).interpreterContext(ctx)
+	if errstring2(err) != errstring2(errVM) || !reflect.DeepEqual(errorTypes(err), errorTypes(errVM)) {
+		t.Errorf("virtual machine error mismatch:\n  exp=%s %v\n  got=%s %v\n\n", err, errorTypes(err), errVM,
+			errorTypes(errVM))
+	}
+	exp, got := *res, *resVM
+	exp.Err, got.Err = nil, nil
+	if !reflect.DeepEqual(exp, got) {
+		t.Errorf("virtual machine result mismatch:\n  exp=%+v\n  got=%+v\n\n", exp, got)
+	}
+	return res, err
+}
+
+// errorTypes returns the types of the errors of the chain of wrapped errors.
+func errorTypes(err error) []string {
+	var types []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		types = append(types, fmt.Sprintf("%T", err))
+	}
+	return types
+}
+
+// Ensure the compiler resolves the variables to slots and shares the constants.
+func TestCompile(t *testing.T) {
+	program, err := NewParser(strings.NewReader(`int g = 1; int main () { x=2; x+=g; return x+2; }`)).Parse2()
+	if err != nil {
+		t.Fatal(err)
+	}
+	module := Compile(program)
+	if module.Main != 0 || len(module.Globals) != 1 || len(module.Init) != 1 {
+		t.Fatalf("unexpected module: %+v", module)
+	}
+	main := module.Functions[0]
+	if !reflect.DeepEqual(main.Locals, []Local{{Name: "x", Global: -1, Constant: -1}}) {
+		t.Errorf("locals mismatch: %+v", main.Locals)
+	}
+	var ops []Opcode
+	for _, instr := range main.Code {
+		ops = append(ops, instr.Op)
+	}
+	exp := []Opcode{
+		OP_CONST, OP_PRINT, OP_PRINT_VALUE, OP_STORE_LOCAL, OP_POP, OP_PRINT, // x=2;
+		OP_LOAD_LOCAL, OP_LOAD_GLOBAL, OP_BINARY, OP_STORE_LOCAL, OP_POP, // x+=g;
+		OP_LOAD_LOCAL, OP_PRINT, OP_PRINT_VALUE, OP_POP, OP_PRINT,
+		OP_LOAD_LOCAL, OP_CONST, OP_BINARY, OP_PRINT, OP_PRINT_VALUE, OP_PRINT, OP_RETURN, // return x+2;
+		OP_RETURN_VOID,
+	}
+	if !reflect.DeepEqual(exp, ops) {
+		t.Errorf("code mismatch:\n  exp=%v\n  got=%v", exp, ops)
+	}
+	constants := 0
+	for _, val := range module.Constants {
+		if val.valeurtype.code == TYPE_INT && val.valeurInt == 2 {
+			constants++
+		}
+	}
+	if constants != 1 {
+		t.Errorf("constant 2 found %d times in the pool: %v", constants, module.Constants)
+	}
+}
+
+// Ensure the virtual machine stops at the same step, for the same error, as the tree-walking interpreter,
+// whatever the limit.
+func TestVM_limits(t *testing.T) {
+	var tests = []string{
+		`int fib(int n) { switch (n < 2 ? 0 : 1) { case 0: return n; } return fib(n-1) + fib(n-2); }
+		 int main () { return fib(6); }`,
+		`enum Color { RED, GREEN, BLUE }; int total = 10; int count;
+		 void add(int n) { total += n; count++; }
+		 int main () { enum Color c = GREEN; switch (c) { case RED: add(1); case GREEN: add(2); case BLUE: add(3); break;
+		 default: add(4); } x = total > 12 && count != 0 || 1/count == 0; print(x, total, "s"); return ~total >> 1; }`,
+		`int g = f(); int f() { h = 2; return h * 3; } void main () { g++; string s = "abc"; s = "abcdef"; }`,
+	}
+
+	for i, s := range tests {
+		program, err := NewParser(strings.NewReader(s)).Parse2()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, s, err)
+		}
+		res, err := interpret(t, program, Options{}, context.Background())
+		if err != nil {
+			t.Fatalf("%d. %q: unexpected error: %s", i, s, err)
+		}
+		for n := int64(1); n <= res.Stats.Steps; n++ {
+			interpret(t, program, Options{Limits: Limits{MaxSteps: n}}, context.Background())
+		}
+		for n := int64(1); n <= res.Stats.PeakMemory; n++ {
+			interpret(t, program, Options{Limits: Limits{MaxMemory: n}}, context.Background())
+		}
+		for n := int64(1); n <= int64(len(res.Stdout)); n++ {
+			interpret(t, program, Options{Limits: Limits{MaxOutput: n}}, context.Background())
+		}
+		for n := 1; n <= res.Stats.MaxStackDepth; n++ {
+			interpret(t, program, Options{Limits: Limits{MaxCallDepth: n}}, context.Background())
+		}
+	}
+}
+
+func benchmarkFib(b *testing.B, options Options) {
+	program, err := NewParser(strings.NewReader(`int fib(int n) { switch (n < 2 ? 0 : 1) { case 0: return n; }
+		return fib(n-1) + fib(n-2); } int main () { return fib(15); }`)).Parse2()
+	if err != nil {
+		b.Fatal(err)
+	}
+	interpreter := NewInterpreterWithOptions(program, options)
+	for i := 0; i < b.N; i++ {
+		if _, err := interpreter.interpreter(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInterpreter_fib(b *testing.B) { benchmarkFib(b, Options{}) }
+
+func BenchmarkVM_fib(b *testing.B) { benchmarkFib(b, Options{VM: true}) }
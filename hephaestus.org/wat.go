@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// watRuntime is the runtime copied in the generated modules: the texts, the globals and the functions whose
+// names start with rt_.
+//
+//go:embed watruntime.wat
+var watRuntime string
+
+const (
+	watTexts   = 1024  // address of the texts of the program
+	watPage    = 65536 // size of a page of the memory
+	watStdout  = 1
+	watNoValue = "i32.const 0\nglobal.set $rt_ok"
+)
+
+// watGenerator translates a program to a WebAssembly module in text format. The module imports fd_write and
+// proc_exit from WASI, and exports its memory and the function _start, which runs the program.
+type watGenerator struct {
+	*nativeProgram
+	buf       *bytes.Buffer
+	data      bytes.Buffer   // data segments of the texts
+	texts     map[string]int // addresses of the texts
+	end       int            // end of the texts
+	names     map[*nativeVariable]string
+	functions map[string]string
+	function  *Function                // nil for the initializers of the global variables
+	used      map[*nativeVariable]bool // variables read
+	stored    map[*nativeVariable]bool // variables assigned
+	temps     []TypeCode               // types of the temporary variables
+	switches  int                      // number of switches of the function
+	indent    int
+	reachable bool
+	labels    []string // labels ending the enclosing switches
+	breaks    []bool   // a break ends each enclosing switch
+}
+
+// TranspileWat translates the checked program to a WebAssembly module in text format, which writes the same
+// output and exits with the same code as the interpreter when run by a WASI runtime. source is the name of the
+// source file, written in the header.
+func TranspileWat(program *Program, source string) ([]byte, error) {
+	p, err := analyzeProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	g := &watGenerator{nativeProgram: p, buf: &bytes.Buffer{}, texts: make(map[string]int), end: watTexts,
+		names: make(map[*nativeVariable]string), functions: make(map[string]string)}
+
+	// the functions and the globals are in distinct name spaces, as the locals of each function
+	taken := map[string]bool{"fd_write": true, "proc_exit": true}
+	for _, name := range regexp.MustCompile(`\$rt_\w+`).FindAllString(watRuntime, -1) {
+		taken[name[1:]] = true
+	}
+	globalNames := make(map[string]bool)
+	for name := range taken {
+		globalNames[name] = true
+	}
+	notReserved := func(name string) bool { return false }
+	for i := range program.Functions {
+		g.functions[program.Functions[i].Name] = allocateName(notReserved, taken, program.Functions[i].Name)
+	}
+	for _, v := range p.globals {
+		g.names[v] = allocateName(notReserved, globalNames, v.Name)
+	}
+
+	var funcs bytes.Buffer
+	for i := range program.Functions {
+		g.functionDecl(&funcs, &program.Functions[i])
+	}
+	g.startDecl(&funcs)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, ";; Code generated by hephaestus to-wat from %s. DO NOT EDIT.\n\n(module\n", source)
+	fmt.Fprintf(&out, "  (import \"wasi_snapshot_preview1\" \"fd_write\"")
+	fmt.Fprintf(&out, " (func $fd_write (param i32 i32 i32 i32) (result i32)))\n")
+	fmt.Fprintf(&out, "  (import \"wasi_snapshot_preview1\" \"proc_exit\" (func $proc_exit (param i32)))\n")
+	fmt.Fprintf(&out, "  (memory (export \"memory\") %d)\n\n%s\n", (g.end+watPage-1)/watPage, watRuntime)
+	out.Write(g.data.Bytes())
+	for _, v := range p.globals {
+		fmt.Fprintf(&out, "  (global $%s (mut %s) (%s.const 0))\n", g.names[v], watType(v.Code), watType(v.Code))
+		if v.Checked {
+			fmt.Fprintf(&out, "  (global $_set_%s (mut i32) (i32.const 0))\n", g.names[v])
+		}
+	}
+	out.Write(funcs.Bytes())
+	fmt.Fprintf(&out, ")\n")
+	return out.Bytes(), nil
+}
+
+// watType returns the type of WebAssembly of the values of the type: the booleans are i32, and the texts are
+// the i32 addresses of their length.
+func watType(code TypeCode) string {
+	switch code {
+	case TYPE_STRING, TYPE_BOOLEAN:
+		return "i32"
+	}
+	return "i64"
+}
+
+// watQuote returns the string literal of WebAssembly of the bytes.
+func watQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			fmt.Fprintf(&b, `\%02x`, c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// text returns the address of the text, added to the data of the module if needed.
+func (g *watGenerator) text(s string) int {
+	if addr, ok := g.texts[s]; ok {
+		return addr
+	}
+	addr := g.end
+	g.texts[s] = addr
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(s)))
+	fmt.Fprintf(&g.data, "  (data (i32.const %d) %s)\n", addr, watQuote(string(length[:])+s))
+	g.end += (4 + len(s) + 3) / 4 * 4
+	return addr
+}
+
+// emit writes instructions, one by line, indented.
+func (g *watGenerator) emit(format string, args ...interface{}) {
+	for _, line := range strings.Split(fmt.Sprintf(format, args...), "\n") {
+		if strings.HasPrefix(line, "end") || strings.HasPrefix(line, "else") {
+			g.indent--
+		}
+		g.buf.WriteString(strings.Repeat("  ", g.indent))
+		g.buf.WriteString(line)
+		g.buf.WriteByte('\n')
+		if strings.HasPrefix(line, "block") || strings.HasPrefix(line, "loop") || strings.HasPrefix(line, "if") ||
+			strings.HasPrefix(line, "else") {
+			g.indent++
+		}
+	}
+}
+
+// emitText pushes the address of the text.
+func (g *watGenerator) emitText(s string) {
+	g.emit("i32.const %d ;; %s", g.text(s), strconv.Quote(s))
+}
+
+// print writes the text to the standard output.
+func (g *watGenerator) print(s string) {
+	g.emit("i32.const %d", watStdout)
+	g.emitText(s)
+	g.emit("call $rt_print")
+}
+
+// printValue writes the value pushed by push to the standard output.
+func (g *watGenerator) printValue(code TypeCode, push func()) {
+	g.emit("i32.const %d", watStdout)
+	push()
+	switch code {
+	case TYPE_STRING:
+		g.emit("call $rt_print")
+	case TYPE_BOOLEAN:
+		g.emit("call $rt_print_bool")
+	default:
+		g.emit("call $rt_print_int")
+	}
+}
+
+// start prepares the generation of the body of a function.
+func (g *watGenerator) start(function *Function) {
+	g.buf.Reset()
+	g.function, g.temps, g.switches, g.indent, g.reachable = function, nil, 0, 2, true
+	g.used, g.stored = make(map[*nativeVariable]bool), make(map[*nativeVariable]bool)
+}
+
+// declareLocals declares the local variables used by the body, and its temporary variables.
+func (g *watGenerator) declareLocals(out *bytes.Buffer, locals []*nativeVariable) {
+	for _, v := range locals {
+		if g.used[v] || g.stored[v] {
+			fmt.Fprintf(out, "    (local $%s %s)\n", g.names[v], watType(v.Code))
+		}
+		if v.Checked {
+			fmt.Fprintf(out, "    (local $_set_%s i32)\n", g.names[v])
+		}
+	}
+	for i, code := range g.temps {
+		fmt.Fprintf(out, "    (local $_t%d %s)\n", i+1, watType(code))
+	}
+}
+
+func (g *watGenerator) functionDecl(out *bytes.Buffer, function *Function) {
+	locals := g.locals[function]
+	taken := make(map[string]bool)
+	notReserved := func(name string) bool { return false }
+	for _, v := range locals {
+		g.names[v] = allocateName(notReserved, taken, v.Name)
+	}
+
+	g.start(function)
+	g.print("function " + function.Name + "\n")
+	g.instructions(function.Instruction)
+	code := runtimeType(function.ReturnType.code)
+	if g.reachable && g.noValue[function] {
+		g.emit(watNoValue)
+		g.emit("%s.const 0", watType(code))
+	} else if !g.reachable && code != TYPE_VOID && !strings.HasSuffix(g.buf.String(), "return\n") {
+		// the end of the blocks is reachable for the validation
+		g.emit("unreachable")
+	}
+
+	fmt.Fprintf(out, "\n  (func $%s (param $_wrap i32)", g.functions[function.Name])
+	for _, v := range locals[:len(function.Parameter)] {
+		fmt.Fprintf(out, " (param $%s %s)", g.names[v], watType(v.Code))
+	}
+	if code != TYPE_VOID {
+		fmt.Fprintf(out, " (result %s)", watType(code))
+	}
+	fmt.Fprintf(out, "\n")
+	g.declareLocals(out, locals[len(function.Parameter):])
+	out.Write(g.buf.Bytes())
+	fmt.Fprintf(out, "  )\n")
+}
+
+// startDecl declares the function _start, which initializes the global variables and calls main.
+func (g *watGenerator) startDecl(out *bytes.Buffer) {
+	g.start(nil)
+	g.instructions(g.program.Globals)
+	main := g.functions["main"]
+	if function, ok := g.nativeProgram.functions["main"]; !ok {
+		g.emit("i32.const 0")
+		g.emitText("function main not found")
+		g.emit("call $rt_fail")
+	} else if len(function.Parameter) > 0 {
+		g.emit("i32.const 0")
+		g.emitText(fmt.Sprintf("function main expects %d parameters, found 0", len(function.Parameter)))
+		g.emit("call $rt_fail")
+	} else if function.ReturnType.code == TYPE_INT {
+		g.emit("i32.const 0\ncall $%s\ncall $rt_exit", main)
+	} else if function.ReturnType.code == TYPE_VOID {
+		g.emit("i32.const 0\ncall $%s", main)
+	} else {
+		g.emit("i32.const 0\ncall $%s\ndrop", main)
+	}
+	fmt.Fprintf(out, "\n  (func (export \"_start\")\n")
+	g.declareLocals(out, nil)
+	out.Write(g.buf.Bytes())
+	fmt.Fprintf(out, "  )\n")
+}
+
+// emitWrap pushes the number of times the errors are wrapped: the errors of the callers are wrapped $_wrap
+// times, and the errors of the expression wrap times more.
+func (g *watGenerator) emitWrap(wrap int) {
+	if g.function == nil {
+		g.emit("i32.const %d", wrap)
+	} else if wrap == 0 {
+		g.emit("local.get $_wrap")
+	} else {
+		g.emit("local.get $_wrap\ni32.const %d\ni32.add", wrap)
+	}
+}
+
+// fail ends the program with the error, the next instructions are not reached.
+func (g *watGenerator) fail(wrap int, message string) {
+	g.emitWrap(wrap)
+	g.emitText(message)
+	g.emit("call $rt_fail\nunreachable")
+}
+
+// temp declares a temporary variable of the type.
+func (g *watGenerator) temp(code TypeCode) string {
+	g.temps = append(g.temps, code)
+	return fmt.Sprintf("$_t%d", len(g.temps))
+}
+
+// read pushes the value of the variable, as resolved by the analysis.
+func (g *watGenerator) read(access nativeAccess, name string, wrap int) {
+	if v := access.variable; v != nil && v.Global {
+		g.used[v] = true
+		if access.checked {
+			g.emit("global.get $_set_%s\ni32.eqz\nif", g.names[v])
+			g.fail(wrap, "variable "+name+" not declared")
+			g.emit("end")
+		}
+		g.emit("global.get $%s", g.names[v])
+	} else if v != nil {
+		g.used[v] = true
+		if access.checked {
+			g.emit("local.get $_set_%s\ni32.eqz\nif", g.names[v])
+			g.fail(wrap, "variable "+name+" not declared")
+			g.emit("end")
+		}
+		g.emit("local.get $%s", g.names[v])
+	} else if access.constant != nil {
+		g.emit("i64.const %d ;; %s", access.constant.Value, access.constant.Name)
+	} else {
+		g.fail(wrap, "variable "+name+" not declared")
+	}
+}
+
+// store assigns the value on the stack to the variable, and leaves the value on the stack if tee is true.
+func (g *watGenerator) store(v *nativeVariable, tee bool) {
+	g.stored[v] = true
+	if v.Global {
+		g.emit("global.set $%s", g.names[v])
+		if tee {
+			g.emit("global.get $%s", g.names[v])
+		}
+	} else if tee {
+		g.emit("local.tee $%s", g.names[v])
+	} else {
+		g.emit("local.set $%s", g.names[v])
+	}
+	if v.Checked {
+		if v.Global {
+			g.emit("i32.const 1\nglobal.set $_set_%s", g.names[v])
+		} else {
+			g.emit("i32.const 1\nlocal.set $_set_%s", g.names[v])
+		}
+	}
+}
+
+// zeroValue pushes the zero value of the type.
+func (g *watGenerator) zeroValue(code TypeCode) {
+	if code == TYPE_STRING {
+		g.emitText("")
+	} else {
+		g.emit("%s.const 0", watType(code))
+	}
+}
+
+// watOperators are the instructions of the binary operations on integers computed without a check.
+var watOperators = map[ExprCode]string{EXPR_CODE_ADD: "i64.add", EXPR_CODE_SUB: "i64.sub", EXPR_CODE_MUL: "i64.mul",
+	EXPR_CODE_BIT_AND: "i64.and", EXPR_CODE_BIT_OR: "i64.or", EXPR_CODE_BIT_XOR: "i64.xor",
+	EXPR_CODE_SHL: "i64.shl", EXPR_CODE_SHR: "i64.shr_s",
+	EXPR_CODE_EQU: "i64.eq", EXPR_CODE_NEQ: "i64.ne", EXPR_CODE_LT: "i64.lt_s", EXPR_CODE_LTE: "i64.le_s",
+	EXPR_CODE_GT: "i64.gt_s", EXPR_CODE_GTE: "i64.ge_s"}
+
+// binary computes the binary operation on the operands on the stack. right is the right operand, whose checks
+// are omitted if it is a literal.
+func (g *watGenerator) binary(code ExprCode, right *Expression, boolean bool, wrap int, position *Position) {
+	literal := right != nil && right.code == EXPR_CODE_INT
+	switch code {
+	case EXPR_CODE_DIV, EXPR_CODE_MOD:
+		if !literal || right.valeurInt == 0 {
+			g.emitWrap(wrap)
+			g.emitText(fmt.Sprintf("error: division by zero (pos=%v)", position))
+			g.emit("call $rt_divisor")
+		}
+		if code == EXPR_CODE_MOD {
+			g.emit("i64.rem_s")
+		} else if literal && right.valeurInt != 0 {
+			g.emit("i64.div_s")
+		} else {
+			g.emit("call $rt_div")
+		}
+		return
+	case EXPR_CODE_SHL, EXPR_CODE_SHR:
+		if !literal || right.valeurInt < 0 || right.valeurInt >= 64 {
+			g.emitWrap(wrap)
+			g.emitText(fmt.Sprintf("%v", position))
+			g.emit("call $rt_shift")
+		}
+	case EXPR_CODE_EQU, EXPR_CODE_NEQ:
+		if boolean {
+			g.emit(strings.Replace(watOperators[code], "i64", "i32", 1))
+			return
+		}
+	}
+	g.emit(watOperators[code])
+}
+
+// expression pushes the value of the expression, whose errors are wrapped wrap times as they are by the
+// interpreter.
+func (g *watGenerator) expression(expr *Expression, wrap int) {
+	switch expr.code {
+	case EXPR_CODE_INT:
+		g.emit("i64.const %d", expr.valeurInt)
+	case EXPR_CODE_STR:
+		g.emitText(expr.valeurString)
+	case EXPR_CODE_TRUE:
+		g.emit("i32.const 1")
+	case EXPR_CODE_FALSE:
+		g.emit("i32.const 0")
+	case EXPR_CODE_VAR:
+		g.read(g.reads[expr], expr.variable, wrap)
+	case EXPR_CODE_CALL:
+		g.emitWrap(wrap)
+		for i := range expr.parameter {
+			g.expression(&expr.parameter[i], wrap+1)
+		}
+		g.emit("call $%s", g.functions[expr.functionName])
+		if callee := g.nativeProgram.functions[expr.functionName]; g.noValue[callee] {
+			g.emit("global.get $rt_ok")
+			g.emitWrap(wrap)
+			g.emitText(fmt.Sprintf("function %s returns no value (pos=%v)", callee.Name, expr.position))
+			g.emit("call $rt_returned")
+		}
+	case EXPR_CODE_ASSIGN, EXPR_CODE_COMPOUND_ASSIGN, EXPR_CODE_PRE_INC, EXPR_CODE_PRE_DEC, EXPR_CODE_POST_INC,
+		EXPR_CODE_POST_DEC:
+		g.assignment(expr, wrap, true)
+	case EXPR_CODE_BIT_NOT:
+		g.expression(expr.right, wrap+1)
+		g.emit("i64.const -1\ni64.xor")
+	case EXPR_CODE_NOT:
+		g.expression(expr.right, wrap+1)
+		g.emit("i32.eqz")
+	case EXPR_CODE_AND:
+		g.expression(expr.left, wrap+1)
+		g.emit("if (result i32)")
+		g.expression(expr.right, wrap+1)
+		g.emit("else\ni32.const 0\nend")
+	case EXPR_CODE_OR:
+		g.expression(expr.left, wrap+1)
+		g.emit("if (result i32)\ni32.const 1\nelse")
+		g.expression(expr.right, wrap+1)
+		g.emit("end")
+	case EXPR_CODE_CONDITIONAL:
+		g.expression(expr.condition, wrap+1)
+		g.emit("if (result %s)", watType(g.typeOf(expr)))
+		g.expression(expr.left, wrap)
+		g.emit("else")
+		g.expression(expr.right, wrap)
+		g.emit("end")
+	default:
+		g.expression(expr.left, wrap+1)
+		g.expression(expr.right, wrap+1)
+		g.binary(expr.code, expr.right, g.typeOf(expr.left) == TYPE_BOOLEAN, wrap, expr.position)
+	}
+}
+
+// assignment assigns the variable, and pushes the value of the expression if value is true.
+func (g *watGenerator) assignment(expr *Expression, wrap int, value bool) {
+	switch expr.code {
+	case EXPR_CODE_ASSIGN:
+		g.expression(expr.right, wrap+1)
+		g.store(g.writes[expr], value)
+	case EXPR_CODE_COMPOUND_ASSIGN:
+		g.read(g.reads[expr], expr.variable, wrap+1)
+		g.expression(expr.right, wrap+1)
+		g.binary(expr.operator, expr.right, false, wrap, expr.position)
+		g.store(g.writes[expr], value)
+	default:
+		operator := "i64.add"
+		if expr.code == EXPR_CODE_PRE_DEC || expr.code == EXPR_CODE_POST_DEC {
+			operator = "i64.sub"
+		}
+		g.read(g.reads[expr], expr.variable, wrap+1)
+		if value && (expr.code == EXPR_CODE_POST_INC || expr.code == EXPR_CODE_POST_DEC) {
+			old := g.temp(TYPE_INT)
+			g.emit("local.tee %s\ni64.const 1\n%s", old, operator)
+			g.store(g.writes[expr], false)
+			g.emit("local.get %s", old)
+		} else {
+			g.emit("i64.const 1\n%s", operator)
+			g.store(g.writes[expr], value)
+		}
+	}
+}
+
+func (g *watGenerator) instructions(instructions []Instruction) {
+	for i := range instructions {
+		if !g.reached[&instructions[i]] {
+			return
+		}
+		g.instruction(&instructions[i])
+	}
+}
+
+func (g *watGenerator) instruction(instr *Instruction) {
+	switch instr.Code {
+	case INSTRUCTION_AFFECTATION, INSTRUCTION_DECLARATION:
+		v := g.stores[instr]
+		if instr.Valeur != nil {
+			g.expression(instr.Valeur, 1)
+		} else {
+			g.zeroValue(v.Code)
+		}
+		g.store(v, false)
+		g.print(instr.Variable + "=")
+		g.printValue(v.Code, func() { g.read(nativeAccess{variable: v}, v.Name, 0) })
+		g.print("\n")
+	case INSTRUCTION_CALL:
+		var args []string
+		for i := range instr.Parameter {
+			arg := g.temp(g.typeOf(&instr.Parameter[i]))
+			g.expression(&instr.Parameter[i], 1)
+			g.emit("local.set %s", arg)
+			args = append(args, arg)
+		}
+		g.print(instr.FunctionName + "(")
+		for i, arg := range args {
+			if i > 0 {
+				g.print(",")
+			}
+			g.printValue(g.typeOf(&instr.Parameter[i]), func() { g.emit("local.get %s", arg) })
+		}
+		g.print(")\n")
+		if name, ok := g.functions[instr.FunctionName]; ok {
+			g.emitWrap(0)
+			for _, arg := range args {
+				g.emit("local.get %s", arg)
+			}
+			g.emit("call $%s", name)
+			if runtimeType(g.nativeProgram.functions[instr.FunctionName].ReturnType.code) != TYPE_VOID {
+				g.emit("drop")
+			}
+		}
+	case INSTRUCTION_EXPRESSION:
+		if name := assignedVariable(instr.Valeur); name == "" {
+			g.expression(instr.Valeur, 1)
+			g.emit("drop")
+		} else {
+			g.assignment(instr.Valeur, 1, false)
+			access := g.traces[instr]
+			g.print(name + "=")
+			g.printValue(g.typeOf(instr.Valeur), func() { g.read(access, name, 0) })
+			g.print("\n")
+		}
+	case INSTRUCTION_SWITCH:
+		g.switchCases(instr)
+	case INSTRUCTION_BREAK:
+		g.print("break\n")
+		if len(g.breaks) > 0 {
+			g.breaks[len(g.breaks)-1] = true
+			g.emit("br %s", g.labels[len(g.labels)-1])
+		} else {
+			// as the interpreter, a break outside of a switch ends the function
+			g.returnNoValue()
+		}
+		g.reachable = false
+	case INSTRUCTION_RETURN:
+		if instr.Valeur == nil {
+			g.print("return\n")
+			g.returnNoValue()
+		} else {
+			code := g.typeOf(instr.Valeur)
+			value := g.temp(code)
+			g.expression(instr.Valeur, 1)
+			g.emit("local.set %s", value)
+			g.print("return ")
+			g.printValue(code, func() { g.emit("local.get %s", value) })
+			g.print("\n")
+			if g.function.ReturnType.code != TYPE_VOID {
+				g.emit("local.get %s", value)
+			}
+			if g.noValue[g.function] {
+				g.emit("i32.const 1\nglobal.set $rt_ok")
+			}
+			g.emit("return")
+		}
+		g.reachable = false
+	}
+}
+
+// returnNoValue returns from the function without a value.
+func (g *watGenerator) returnNoValue() {
+	if code := runtimeType(g.function.ReturnType.code); code != TYPE_VOID {
+		g.emit(watNoValue)
+		g.emit("%s.const 0", watType(code))
+	}
+	g.emit("return")
+}
+
+// switchCases generates the blocks of the switch: a block by case, each ending before the instructions of
+// the case, in a block ending the switch. The innermost block branches to the block of the matching case.
+func (g *watGenerator) switchCases(instr *Instruction) {
+	value := g.temp(TYPE_INT)
+	g.expression(instr.Valeur, 1)
+	g.emit("local.set %s", value)
+	g.print("switch ")
+	g.printValue(TYPE_INT, func() { g.emit("local.get %s", value) })
+	g.print("\n")
+
+	g.switches++
+	label := fmt.Sprintf("$switch%d", g.switches)
+	g.emit("block %s", label)
+	for i := len(instr.Case) - 1; i >= 0; i-- {
+		g.emit("block %s_%d", label, i)
+	}
+	target := label
+	for i := range instr.Case {
+		if caseSwitch := &instr.Case[i]; caseSwitch.Valeur == nil {
+			target = fmt.Sprintf("%s_%d", label, i)
+		} else if caseSwitch.Valeur.code == EXPR_CODE_INT {
+			g.emit("local.get %s\ni64.const %d\ni64.eq\nbr_if %s_%d", value, caseSwitch.Valeur.valeurInt, label, i)
+		} else {
+			constant := g.nativeProgram.constants[caseSwitch.Valeur.variable]
+			g.emit("local.get %s\ni64.const %d ;; %s\ni64.eq\nbr_if %s_%d", value, constant.Value, constant.Name,
+				label, i)
+		}
+	}
+	g.emit("br %s", target)
+
+	hasDefault := false
+	g.labels, g.breaks = append(g.labels, label), append(g.breaks, false)
+	for i := range instr.Case {
+		hasDefault = hasDefault || instr.Case[i].Valeur == nil
+		g.emit("end")
+		g.reachable = true
+		g.instructions(instr.Case[i].Instruction)
+	}
+	g.emit("end")
+	g.reachable = g.reachable || len(instr.Case) == 0 || !hasDefault || g.breaks[len(g.breaks)-1]
+	g.labels, g.breaks = g.labels[:len(g.labels)-1], g.breaks[:len(g.breaks)-1]
+}
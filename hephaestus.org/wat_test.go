@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// Ensure the WebAssembly modules generated write the same output, report the same errors and exit with the
+// same code as the interpreter.
+func TestTranspileWat(t *testing.T) {
+	testNative(t, nativeTests, func(t *testing.T, dir string, program *Program) (string, string, int) {
+		code, err := TranspileWat(program, "test.he")
+		if err != nil {
+			t.Fatalf("transpile error: %s", err)
+		}
+		binary, err := assembleWat(string(code))
+		if err != nil {
+			t.Fatalf("assembly error: %s\n%s", err, code)
+		}
+
+		ctx := context.Background()
+		runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfigInterpreter())
+		defer runtime.Close(ctx)
+		wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+		var stdout, stderr bytes.Buffer
+		config := wazero.NewModuleConfig().WithStdout(&stdout).WithStderr(&stderr)
+		exitCode := 0
+		if _, err := runtime.InstantiateWithConfig(ctx, binary, config); err != nil {
+			var exitErr *sys.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("run error: %s\n%s", err, code)
+			}
+			exitCode = int(exitErr.ExitCode())
+		}
+		return stdout.String(), stderr.String(), exitCode
+	})
+}
+
+// watNode is a node of the text of a module: an atom, a string or a list.
+type watNode struct {
+	atom   string
+	str    bool
+	list   []*watNode
+	isList bool
+}
+
+// parseWat parses the nodes of the text.
+func parseWat(text string) ([]*watNode, error) {
+	stack := [][]*watNode{nil}
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(text[i:], ";;"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case c == '(':
+			stack = append(stack, nil)
+			i++
+		case c == ')':
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unexpected ) at %d", i)
+			}
+			list := &watNode{list: stack[len(stack)-1], isList: true}
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = append(stack[len(stack)-1], list)
+			i++
+		case c == '"':
+			var b strings.Builder
+			for i++; i < len(text) && text[i] != '"'; i++ {
+				if text[i] != '\\' {
+					b.WriteByte(text[i])
+					continue
+				}
+				if i+2 >= len(text) {
+					return nil, fmt.Errorf("invalid escape at %d", i)
+				}
+				n, err := strconv.ParseUint(text[i+1:i+3], 16, 8)
+				if err != nil {
+					return nil, fmt.Errorf("invalid escape at %d", i)
+				}
+				b.WriteByte(byte(n))
+				i += 2
+			}
+			i++
+			stack[len(stack)-1] = append(stack[len(stack)-1], &watNode{atom: b.String(), str: true})
+		default:
+			start := i
+			for i < len(text) && !strings.ContainsRune(" \t\r\n();\"", rune(text[i])) {
+				i++
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], &watNode{atom: text[start:i]})
+		}
+	}
+	if len(stack) != 1 {
+		return nil, errors.New("missing )")
+	}
+	return stack[0], nil
+}
+
+// watOpcodes are the opcodes of the instructions without immediates, or whose immediates are an index.
+var watOpcodes = map[string]byte{"unreachable": 0x00, "block": 0x02, "loop": 0x03, "if": 0x04, "else": 0x05,
+	"end": 0x0b, "br": 0x0c, "br_if": 0x0d, "return": 0x0f, "call": 0x10, "drop": 0x1a, "select": 0x1b,
+	"local.get": 0x20, "local.set": 0x21, "local.tee": 0x22, "global.get": 0x23, "global.set": 0x24,
+	"i32.load": 0x28, "i32.store": 0x36, "i32.store8": 0x3a, "i32.const": 0x41, "i64.const": 0x42,
+	"i32.eqz": 0x45, "i32.eq": 0x46, "i32.ne": 0x47, "i64.eqz": 0x50, "i64.eq": 0x51, "i64.ne": 0x52,
+	"i64.lt_s": 0x53, "i64.gt_s": 0x55, "i64.le_s": 0x57, "i64.ge_s": 0x59, "i64.ge_u": 0x5a, "i32.add": 0x6a,
+	"i32.sub": 0x6b, "i32.and": 0x71, "i64.add": 0x7c, "i64.sub": 0x7d, "i64.mul": 0x7e, "i64.div_s": 0x7f,
+	"i64.div_u": 0x80, "i64.rem_s": 0x81, "i64.rem_u": 0x82, "i64.and": 0x83, "i64.or": 0x84, "i64.xor": 0x85,
+	"i64.shl": 0x86, "i64.shr_s": 0x87, "i64.shr_u": 0x88, "i32.wrap_i64": 0xa7}
+
+var watValueTypes = map[string]byte{"i32": 0x7f, "i64": 0x7e}
+
+func appendUleb(b []byte, n uint64) []byte {
+	for {
+		c := byte(n & 0x7f)
+		if n >>= 7; n == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func appendSleb(b []byte, n int64) []byte {
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if (n == 0 && c&0x40 == 0) || (n == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func appendName(b []byte, s string) []byte {
+	return append(appendUleb(b, uint64(len(s))), s...)
+}
+
+// appendSection appends the section made of the count and the bytes of its entries.
+func appendSection(b []byte, id byte, count int, entries []byte) []byte {
+	content := appendUleb(nil, uint64(count))
+	content = append(content, entries...)
+	return append(appendUleb(append(b, id), uint64(len(content))), content...)
+}
+
+// watFunc is a function of the module.
+type watFunc struct {
+	typ    int
+	locals map[string]int
+	types  []byte // types of the locals which are not parameters
+	body   []*watNode
+	export string
+}
+
+// watAssembler assembles the fields of a module.
+type watAssembler struct {
+	types     []string // signatures of the function types
+	typeBytes []byte
+	functions map[string]int
+	globals   map[string]int
+	imports   []byte
+	nImports  int
+	funcs     []*watFunc
+	globalSec []byte
+	nGlobals  int
+	data      []byte
+	nData     int
+	memory    []byte
+	exports   []byte
+	nExports  int
+}
+
+// assembleWat translates the module in text format generated by TranspileWat to the binary format. It only
+// knows the instructions and the fields generated.
+func assembleWat(text string) ([]byte, error) {
+	nodes, err := parseWat(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) != 1 || !nodes[0].isList || len(nodes[0].list) == 0 || nodes[0].list[0].atom != "module" {
+		return nil, errors.New("module expected")
+	}
+	a := &watAssembler{functions: make(map[string]int), globals: make(map[string]int)}
+	fields := nodes[0].list[1:]
+	// the imported functions are numbered first
+	for _, field := range fields {
+		if field.list[0].atom == "import" {
+			if err := a.importField(field); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, field := range fields {
+		var err error
+		switch field.list[0].atom {
+		case "import":
+		case "func":
+			err = a.funcField(field)
+		case "memory":
+			err = a.memoryField(field)
+		case "global":
+			err = a.globalField(field)
+		case "data":
+			err = a.dataField(field)
+		default:
+			err = fmt.Errorf("unknown field %s", field.list[0].atom)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var code []byte
+	for _, f := range a.funcs {
+		body, err := a.funcBody(f)
+		if err != nil {
+			return nil, err
+		}
+		code = append(appendUleb(code, uint64(len(body))), body...)
+	}
+	var funcTypes []byte
+	for _, f := range a.funcs {
+		funcTypes = appendUleb(funcTypes, uint64(f.typ))
+	}
+
+	b := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	b = appendSection(b, 1, len(a.types), a.typeBytes)
+	b = appendSection(b, 2, a.nImports, a.imports)
+	b = appendSection(b, 3, len(a.funcs), funcTypes)
+	b = appendSection(b, 5, 1, a.memory)
+	b = appendSection(b, 6, a.nGlobals, a.globalSec)
+	b = appendSection(b, 7, a.nExports, a.exports)
+	b = appendSection(b, 10, len(a.funcs), code)
+	b = appendSection(b, 11, a.nData, a.data)
+	return b, nil
+}
+
+// signature reads the parameters and the result of a function, and returns the index of its type. The names
+// of the parameters are added to locals.
+func (a *watAssembler) signature(nodes []*watNode, locals map[string]int) (int, error) {
+	var params, results []byte
+	for _, n := range nodes {
+		if !n.isList || len(n.list) == 0 || (n.list[0].atom != "param" && n.list[0].atom != "result") {
+			continue
+		}
+		for _, t := range n.list[1:] {
+			if strings.HasPrefix(t.atom, "$") {
+				locals[t.atom] = len(params)
+				continue
+			}
+			code, ok := watValueTypes[t.atom]
+			if !ok {
+				return 0, fmt.Errorf("unknown type %s", t.atom)
+			}
+			if n.list[0].atom == "param" {
+				params = append(params, code)
+			} else {
+				results = append(results, code)
+			}
+		}
+	}
+	signature := string(params) + ":" + string(results)
+	for i, s := range a.types {
+		if s == signature {
+			return i, nil
+		}
+	}
+	a.types = append(a.types, signature)
+	a.typeBytes = append(appendUleb(append(a.typeBytes, 0x60), uint64(len(params))), params...)
+	a.typeBytes = append(appendUleb(a.typeBytes, uint64(len(results))), results...)
+	return len(a.types) - 1, nil
+}
+
+func (a *watAssembler) importField(field *watNode) error {
+	if len(field.list) != 4 || !field.list[3].isList || len(field.list[3].list) < 2 {
+		return errors.New("invalid import")
+	}
+	fn := field.list[3].list
+	typ, err := a.signature(fn[2:], make(map[string]int))
+	if err != nil {
+		return err
+	}
+	a.imports = appendName(appendName(a.imports, field.list[1].atom), field.list[2].atom)
+	a.imports = appendUleb(append(a.imports, 0x00), uint64(typ))
+	a.functions[fn[1].atom] = a.nImports
+	a.nImports++
+	return nil
+}
+
+func (a *watAssembler) funcField(field *watNode) error {
+	f := &watFunc{locals: make(map[string]int)}
+	var names []string
+	rest := field.list[1:]
+	if len(rest) > 0 && strings.HasPrefix(rest[0].atom, "$") {
+		a.functions[rest[0].atom] = a.nImports + len(a.funcs)
+		rest = rest[1:]
+	}
+	var header []*watNode
+	for len(rest) > 0 && rest[0].isList {
+		switch rest[0].list[0].atom {
+		case "export":
+			f.export = rest[0].list[1].atom
+		case "param", "result":
+			header = append(header, rest[0])
+		case "local":
+			code, ok := watValueTypes[rest[0].list[2].atom]
+			if !ok {
+				return fmt.Errorf("unknown type %s", rest[0].list[2].atom)
+			}
+			names = append(names, rest[0].list[1].atom)
+			f.types = append(f.types, code)
+		default:
+			return fmt.Errorf("unknown field %s in a function", rest[0].list[0].atom)
+		}
+		rest = rest[1:]
+	}
+	typ, err := a.signature(header, f.locals)
+	if err != nil {
+		return err
+	}
+	f.typ = typ
+	// the locals are numbered after the parameters
+	nParams := len(strings.Split(a.types[typ], ":")[0])
+	for i, name := range names {
+		f.locals[name] = nParams + i
+	}
+	f.body = rest
+	if f.export != "" {
+		a.exports = appendUleb(append(appendName(a.exports, f.export), 0x00), uint64(a.nImports+len(a.funcs)))
+		a.nExports++
+	}
+	a.funcs = append(a.funcs, f)
+	return nil
+}
+
+func (a *watAssembler) memoryField(field *watNode) error {
+	last := field.list[len(field.list)-1]
+	pages, err := strconv.ParseUint(last.atom, 10, 32)
+	if err != nil {
+		return err
+	}
+	a.memory = appendUleb([]byte{0x00}, pages)
+	if len(field.list) == 3 && field.list[1].isList && field.list[1].list[0].atom == "export" {
+		a.exports = append(appendName(a.exports, field.list[1].list[1].atom), 0x02, 0x00)
+		a.nExports++
+	}
+	return nil
+}
+
+func (a *watAssembler) globalField(field *watNode) error {
+	if len(field.list) != 4 || !field.list[2].isList || !field.list[3].isList {
+		return errors.New("invalid global")
+	}
+	typ := field.list[2].list
+	code, ok := watValueTypes[typ[len(typ)-1].atom]
+	if !ok {
+		return fmt.Errorf("unknown type %s", typ[len(typ)-1].atom)
+	}
+	init, err := a.constExpr(field.list[3])
+	if err != nil {
+		return err
+	}
+	a.globals[field.list[1].atom] = a.nGlobals
+	a.globalSec = append(append(a.globalSec, code, 0x01), init...)
+	a.nGlobals++
+	return nil
+}
+
+func (a *watAssembler) dataField(field *watNode) error {
+	if len(field.list) != 3 || !field.list[2].str {
+		return errors.New("invalid data")
+	}
+	offset, err := a.constExpr(field.list[1])
+	if err != nil {
+		return err
+	}
+	a.data = appendName(append(append(a.data, 0x00), offset...), field.list[2].atom)
+	a.nData++
+	return nil
+}
+
+// constExpr returns the constant expression (T.const n), ended.
+func (a *watAssembler) constExpr(n *watNode) ([]byte, error) {
+	if !n.isList || len(n.list) != 2 {
+		return nil, errors.New("invalid constant expression")
+	}
+	value, err := strconv.ParseInt(n.list[1].atom, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	opcode, ok := watOpcodes[n.list[0].atom]
+	if !ok || (opcode != 0x41 && opcode != 0x42) {
+		return nil, fmt.Errorf("invalid constant expression %s", n.list[0].atom)
+	}
+	return append(appendSleb([]byte{opcode}, value), 0x0b), nil
+}
+
+// funcBody returns the entry of the code section of the function.
+func (a *watAssembler) funcBody(f *watFunc) ([]byte, error) {
+	b := appendUleb(nil, uint64(len(f.types)))
+	for _, code := range f.types {
+		b = append(b, 0x01, code)
+	}
+	var labels []string
+	body := f.body
+	next := func() (string, error) {
+		if len(body) == 0 || body[0].isList {
+			return "", errors.New("immediate expected")
+		}
+		atom := body[0].atom
+		body = body[1:]
+		return atom, nil
+	}
+	for len(body) > 0 {
+		name, err := next()
+		if err != nil {
+			return nil, err
+		}
+		opcode, ok := watOpcodes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown instruction %s", name)
+		}
+		b = append(b, opcode)
+		switch name {
+		case "block", "loop", "if":
+			label := ""
+			if len(body) > 0 && strings.HasPrefix(body[0].atom, "$") {
+				label, _ = next()
+			}
+			labels = append(labels, label)
+			if len(body) > 0 && body[0].isList && len(body[0].list) == 2 && body[0].list[0].atom == "result" {
+				b = append(b, watValueTypes[body[0].list[1].atom])
+				body = body[1:]
+			} else {
+				b = append(b, 0x40)
+			}
+		case "end":
+			labels = labels[:len(labels)-1]
+		case "br", "br_if":
+			label, err := next()
+			if err != nil {
+				return nil, err
+			}
+			depth := -1
+			for i := len(labels) - 1; i >= 0 && depth < 0; i-- {
+				if labels[i] == label {
+					depth = len(labels) - 1 - i
+				}
+			}
+			if depth < 0 {
+				return nil, fmt.Errorf("unknown label %s", label)
+			}
+			b = appendUleb(b, uint64(depth))
+		case "call", "local.get", "local.set", "local.tee", "global.get", "global.set":
+			operand, err := next()
+			if err != nil {
+				return nil, err
+			}
+			index, ok := map[string]map[string]int{"c": a.functions, "l": f.locals, "g": a.globals}[name[:1]][operand]
+			if !ok {
+				return nil, fmt.Errorf("unknown index %s %s", name, operand)
+			}
+			b = appendUleb(b, uint64(index))
+		case "i32.const", "i64.const":
+			operand, err := next()
+			if err != nil {
+				return nil, err
+			}
+			value, err := strconv.ParseInt(operand, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			b = appendSleb(b, value)
+		case "i32.load", "i32.store":
+			b = append(b, 0x02, 0x00)
+		case "i32.store8":
+			b = append(b, 0x00, 0x00)
+		}
+	}
+	return append(b, 0x0b), nil
+}
+
+// Ensure the assembler of the tests encodes the integers as the binary format.
+func TestAssembleWat_leb(t *testing.T) {
+	for _, tt := range []struct {
+		n   int64
+		exp []byte
+	}{
+		{n: 0, exp: []byte{0x00}},
+		{n: 63, exp: []byte{0x3f}},
+		{n: 64, exp: []byte{0xc0, 0x00}},
+		{n: -1, exp: []byte{0x7f}},
+		{n: -65, exp: []byte{0xbf, 0x7f}},
+	} {
+		if got := appendSleb(nil, tt.n); !bytes.Equal(got, tt.exp) {
+			t.Errorf("%d: exp=%x got=%x", tt.n, tt.exp, got)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+  ;; The runtime of the WebAssembly modules generated by the command to-wat, copied in each module. The modules
+  ;; write the same output as the interpreter, and report the same errors.
+  ;;
+  ;; The memory holds at 0 the iovec of fd_write, at 8 the number of bytes written, from 16 to 64 the digits of
+  ;; the integers, from 64 the texts of the runtime and from 1024 the texts of the program. A text is its length
+  ;; on 4 bytes followed by its bytes.
+
+  ;; $rt_ok is set by the functions which may return no value: 1 if they return a value, 0 otherwise.
+  (global $rt_ok (mut i32) (i32.const 0))
+
+  (data (i32.const 64) "\04\00\00\00true")
+  (data (i32.const 96) "\05\00\00\00false")
+  (data (i32.const 128) "\08\00\00\00error : ")
+  (data (i32.const 160) "\07\00\00\00error: ")
+  (data (i32.const 192) "\01\00\00\00\0a")
+  (data (i32.const 224) "\13\00\00\00error: shift count ")
+  (data (i32.const 256) "\13\00\00\00 out of range (pos=")
+  (data (i32.const 288) "\01\00\00\00)")
+
+  ;; $rt_write writes the bytes to the file descriptor.
+  (func $rt_write (param $fd i32) (param $ptr i32) (param $len i32)
+    i32.const 0
+    local.get $ptr
+    i32.store
+    i32.const 4
+    local.get $len
+    i32.store
+    local.get $fd
+    i32.const 0
+    i32.const 1
+    i32.const 8
+    call $fd_write
+    drop
+  )
+
+  ;; $rt_print writes the text.
+  (func $rt_print (param $fd i32) (param $text i32)
+    local.get $fd
+    local.get $text
+    i32.const 4
+    i32.add
+    local.get $text
+    i32.load
+    call $rt_write
+  )
+
+  ;; $rt_print_bool writes the text of the boolean.
+  (func $rt_print_bool (param $fd i32) (param $value i32)
+    local.get $fd
+    i32.const 64
+    i32.const 96
+    local.get $value
+    select
+    call $rt_print
+  )
+
+  ;; $rt_print_int writes the decimal text of the integer.
+  (func $rt_print_int (param $fd i32) (param $value i64)
+    (local $pos i32)
+    (local $n i64)
+    i32.const 64
+    local.set $pos
+    local.get $value
+    local.set $n
+    local.get $value
+    i64.const 0
+    i64.lt_s
+    if
+      ;; the magnitude, read as an unsigned integer
+      i64.const 0
+      local.get $value
+      i64.sub
+      local.set $n
+    end
+    loop $digits
+      local.get $pos
+      i32.const 1
+      i32.sub
+      local.tee $pos
+      local.get $n
+      i64.const 10
+      i64.rem_u
+      i32.wrap_i64
+      i32.const 48
+      i32.add
+      i32.store8
+      local.get $n
+      i64.const 10
+      i64.div_u
+      local.tee $n
+      i64.const 0
+      i64.ne
+      br_if $digits
+    end
+    local.get $value
+    i64.const 0
+    i64.lt_s
+    if
+      local.get $pos
+      i32.const 1
+      i32.sub
+      local.tee $pos
+      i32.const 45
+      i32.store8
+    end
+    local.get $fd
+    local.get $pos
+    i32.const 64
+    local.get $pos
+    i32.sub
+    call $rt_write
+  )
+
+  ;; $rt_exit ends the program with the exit code.
+  (func $rt_exit (param $code i64)
+    local.get $code
+    i32.wrap_i64
+    i32.const 255
+    i32.and
+    call $proc_exit
+  )
+
+  ;; $rt_error writes the beginning of an error, wrapped $wrap times.
+  (func $rt_error (param $wrap i32)
+    i32.const 2
+    i32.const 128
+    call $rt_print
+    block $done
+      loop $next
+        local.get $wrap
+        i32.eqz
+        br_if $done
+        i32.const 2
+        i32.const 160
+        call $rt_print
+        local.get $wrap
+        i32.const 1
+        i32.sub
+        local.set $wrap
+        br $next
+      end
+    end
+  )
+
+  ;; $rt_fail ends the program with the error of the interpreter, wrapped $wrap times.
+  (func $rt_fail (param $wrap i32) (param $message i32)
+    local.get $wrap
+    call $rt_error
+    i32.const 2
+    local.get $message
+    call $rt_print
+    i32.const 2
+    i32.const 192
+    call $rt_print
+    i32.const 1
+    call $proc_exit
+  )
+
+  ;; $rt_divisor checks the divisor of a division or a modulo.
+  (func $rt_divisor (param $divisor i64) (param $wrap i32) (param $message i32) (result i64)
+    local.get $divisor
+    i64.eqz
+    if
+      local.get $wrap
+      local.get $message
+      call $rt_fail
+    end
+    local.get $divisor
+  )
+
+  ;; $rt_div divides, the division of the smallest integer by -1 wraps around.
+  (func $rt_div (param $a i64) (param $b i64) (result i64)
+    local.get $b
+    i64.const -1
+    i64.eq
+    if (result i64)
+      i64.const 0
+      local.get $a
+      i64.sub
+    else
+      local.get $a
+      local.get $b
+      i64.div_s
+    end
+  )
+
+  ;; $rt_shift checks the count of a shift is lower than the size of an integer.
+  (func $rt_shift (param $count i64) (param $wrap i32) (param $pos i32) (result i64)
+    local.get $count
+    i64.const 64
+    i64.ge_u
+    if
+      local.get $wrap
+      call $rt_error
+      i32.const 2
+      i32.const 224
+      call $rt_print
+      i32.const 2
+      local.get $count
+      call $rt_print_int
+      i32.const 2
+      i32.const 256
+      call $rt_print
+      i32.const 2
+      local.get $pos
+      call $rt_print
+      i32.const 2
+      i32.const 288
+      call $rt_print
+      i32.const 2
+      i32.const 192
+      call $rt_print
+      i32.const 1
+      call $proc_exit
+    end
+    local.get $count
+  )
+
+  ;; $rt_returned checks the function called returns a value, as set in $rt_ok.
+  (func $rt_returned (param $ok i32) (param $wrap i32) (param $message i32)
+    local.get $ok
+    i32.eqz
+    if
+      local.get $wrap
+      local.get $message
+      call $rt_fail
+    end
+  )